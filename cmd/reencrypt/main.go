@@ -0,0 +1,133 @@
+// Command reencrypt moves every encrypted column onto the active encryption
+// key. Run it after changing ENCRYPTION_ACTIVE_KEY_ID, before removing the old
+// key, and once after upgrading to encrypt existing plaintext bank details.
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/hutamy/invoice-generator-backend/config"
+	"github.com/hutamy/invoice-generator-backend/utils"
+	"gorm.io/gorm"
+)
+
+const batchSize = 500
+
+// encryptedColumns lists the encrypted columns per table. Text columns use
+// the "encrypted" GORM serializer, binary columns hold utils.Encrypt output.
+var encryptedColumns = []struct {
+	table  string
+	text   []string
+	binary []string
+}{
+	{table: "users", text: []string{"bank_name", "bank_account_name", "bank_account_number"}, binary: []string{"totp_secret"}},
+	{table: "signing_certificates", binary: []string{"encrypted_key"}},
+	{table: "payment_methods", text: []string{"bank_name", "account_name", "account_number", "iban", "wallet_id"}},
+	{table: "invoice_payment_methods", text: []string{"bank_name", "account_name", "account_number", "iban", "wallet_id"}},
+}
+
+func main() {
+	cfg := config.LoadEnv()
+	if err := utils.InitEncryption(cfg); err != nil {
+		log.Fatalf("failed to load encryption keys: %v", err)
+	}
+
+	db := config.InitDB(cfg.DatabaseURL())
+	for _, table := range encryptedColumns {
+		updated, err := reencryptTable(db, table.table, table.text, table.binary)
+		if err != nil {
+			log.Fatalf("failed to re-encrypt %s: %v", table.table, err)
+		}
+
+		log.Printf("re-encrypted %d rows in %s", updated, table.table)
+	}
+}
+
+// reencryptTable rewrites the given columns of every row, soft deleted ones
+// included, in batches ordered by id. Rows already on the active key are
+// left untouched.
+func reencryptTable(db *gorm.DB, table string, text, binary []string) (int, error) {
+	columns := append([]string{"id"}, append(append([]string{}, text...), binary...)...)
+	updated := 0
+	lastID := uint(0)
+	for {
+		var rows []map[string]interface{}
+		err := db.Table(table).Select(columns).Where("id > ?", lastID).Order("id").Limit(batchSize).Find(&rows).Error
+		if err != nil {
+			return updated, err
+		}
+
+		if len(rows) == 0 {
+			return updated, nil
+		}
+
+		for _, row := range rows {
+			id, err := rowID(row["id"])
+			if err != nil {
+				return updated, err
+			}
+			lastID = id
+
+			changes, err := reencryptRow(row, text, binary)
+			if err != nil {
+				return updated, fmt.Errorf("row %d: %w", id, err)
+			}
+
+			if len(changes) == 0 {
+				continue
+			}
+
+			if err := db.Table(table).Where("id = ?", id).Updates(changes).Error; err != nil {
+				return updated, err
+			}
+			updated++
+		}
+	}
+}
+
+func reencryptRow(row map[string]interface{}, text, binary []string) (map[string]interface{}, error) {
+	changes := map[string]interface{}{}
+	for _, column := range text {
+		stored, _ := row[column].(string)
+		value, changed, err := utils.ReencryptString(stored)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", column, err)
+		}
+
+		if changed {
+			changes[column] = value
+		}
+	}
+
+	for _, column := range binary {
+		stored, _ := row[column].([]byte)
+		if len(stored) == 0 {
+			continue
+		}
+
+		value, changed, err := utils.Rewrap(stored)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", column, err)
+		}
+
+		if changed {
+			changes[column] = value
+		}
+	}
+
+	return changes, nil
+}
+
+func rowID(value interface{}) (uint, error) {
+	switch id := value.(type) {
+	case int64:
+		return uint(id), nil
+	case int32:
+		return uint(id), nil
+	case uint:
+		return id, nil
+	}
+
+	return 0, fmt.Errorf("unexpected id type %T", value)
+}
@@ -1,7 +1,10 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"log"
+	"time"
 
 	"github.com/caarlos0/env"
 	"github.com/hutamy/invoice-generator-backend/models"
@@ -13,13 +16,71 @@ import (
 type Config struct {
 	Port int `env:"PORT" envDefault:"8080"`
 
-	JwtSecret string `env:"JWT_SECRET"`
+	JwtKeyDir       string        `env:"JWT_KEY_DIR"`    // directory of <kid>.pem RSA or Ed25519 private keys
+	JwtActiveKID    string        `env:"JWT_ACTIVE_KID"` // key used to sign new tokens
+	JwtIssuer       string        `env:"JWT_ISSUER" envDefault:"invoice-generator"`
+	JwtAudience     string        `env:"JWT_AUDIENCE" envDefault:"invoice-generator-api"`
+	AccessTokenTTL  time.Duration `env:"ACCESS_TOKEN_TTL" envDefault:"15m"`
+	RefreshTokenTTL time.Duration `env:"REFRESH_TOKEN_TTL" envDefault:"168h"`
+
+	AppURL               string        `env:"APP_URL" envDefault:"http://localhost:3000"` // frontend base URL used in email links
+	EmailVerificationTTL time.Duration `env:"EMAIL_VERIFICATION_TTL" envDefault:"48h"`
+	PasswordResetTTL     time.Duration `env:"PASSWORD_RESET_TTL" envDefault:"1h"`
+	EmailChangeTTL       time.Duration `env:"EMAIL_CHANGE_TTL" envDefault:"24h"`
+	InvitationTTL        time.Duration `env:"INVITATION_TTL" envDefault:"168h"` // organization invitations
+
+	TOTPIssuer            string        `env:"TOTP_ISSUER" envDefault:"Invoice Generator"` // name shown in authenticator apps
+	TwoFactorChallengeTTL time.Duration `env:"TWO_FACTOR_CHALLENGE_TTL" envDefault:"5m"`
+
+	OIDCProviders []string      `env:"OIDC_PROVIDERS" envSeparator:","` // names of the single sign-on providers, each configured with OIDC_<NAME>_* variables
+	OIDCStateTTL  time.Duration `env:"OIDC_STATE_TTL" envDefault:"10m"`
+
+	TrustProxy bool `env:"TRUST_PROXY" envDefault:"false"` // take the client IP from X-Forwarded-For
+
+	RateLimitStore             string        `env:"RATE_LIMIT_STORE" envDefault:"memory"`     // memory or postgres
+	RateLimitAuthRequests      int           `env:"RATE_LIMIT_AUTH_REQUESTS" envDefault:"20"` // per IP on public auth routes
+	RateLimitAuthWindow        time.Duration `env:"RATE_LIMIT_AUTH_WINDOW" envDefault:"1m"`
+	RateLimitPublicPDFRequests int           `env:"RATE_LIMIT_PUBLIC_PDF_REQUESTS" envDefault:"5"` // per IP on the public PDF generator
+	RateLimitPublicPDFWindow   time.Duration `env:"RATE_LIMIT_PUBLIC_PDF_WINDOW" envDefault:"1m"`
+	RateLimitUserRequests      int           `env:"RATE_LIMIT_USER_REQUESTS" envDefault:"300"` // per account on protected routes
+	RateLimitUserWindow        time.Duration `env:"RATE_LIMIT_USER_WINDOW" envDefault:"1m"`
+	RateLimitPDFRequests       int           `env:"RATE_LIMIT_PDF_REQUESTS" envDefault:"30"` // per account for PDF rendering and exports
+	RateLimitPDFWindow         time.Duration `env:"RATE_LIMIT_PDF_WINDOW" envDefault:"1m"`
+
+	LoginLockoutThreshold   int           `env:"LOGIN_LOCKOUT_THRESHOLD" envDefault:"5"` // failed attempts before locking
+	LoginLockoutDuration    time.Duration `env:"LOGIN_LOCKOUT_DURATION" envDefault:"1m"` // doubles with every further failure
+	LoginLockoutMaxDuration time.Duration `env:"LOGIN_LOCKOUT_MAX_DURATION" envDefault:"1h"`
+	LoginFailureWindow      time.Duration `env:"LOGIN_FAILURE_WINDOW" envDefault:"24h"`
+
+	MailDriver   string `env:"MAIL_DRIVER" envDefault:"log"` // smtp, file or log
+	MailFrom     string `env:"MAIL_FROM" envDefault:"Invoice Generator <no-reply@localhost>"`
+	MailDir      string `env:"MAIL_DIR" envDefault:"tmp/mail"` // used by the file driver
+	SmtpHost     string `env:"SMTP_HOST"`
+	SmtpPort     int    `env:"SMTP_PORT" envDefault:"587"`
+	SmtpUsername string `env:"SMTP_USERNAME"`
+	SmtpPassword string `env:"SMTP_PASSWORD"`
+
+	EncryptionKey         string   `env:"ENCRYPTION_KEY"`                   // base64 encoded 32 byte master key for data encrypted at rest
+	EncryptionKeys        []string `env:"ENCRYPTION_KEYS" envSeparator:","` // additional <id>:<base64 key> master keys, for rotation
+	EncryptionActiveKeyID string   `env:"ENCRYPTION_ACTIVE_KEY_ID"`         // key wrapping new data keys; "default" is ENCRYPTION_KEY
 
 	PostgresUser     string `env:"POSTGRES_USER"`
 	PostgresPassword string `env:"POSTGRES_PASSWORD"`
 	PostgresHost     string `env:"POSTGRES_HOST"`
 	PostgresPort     int    `env:"POSTGRES_PORT" envDefault:"5432"`
 	PostgresDB       string `env:"POSTGRES_DB"`
+
+	PdfCacheBackend string `env:"PDF_CACHE_BACKEND" envDefault:"memory"` // memory or disk
+	PdfCacheDir     string `env:"PDF_CACHE_DIR" envDefault:"tmp/pdf-cache"`
+	PdfCacheSize    int    `env:"PDF_CACHE_SIZE" envDefault:"200"`
+
+	ExportDir        string        `env:"EXPORT_DIR" envDefault:"tmp/exports"`
+	ExportWorkers    int           `env:"EXPORT_WORKERS" envDefault:"2"`     // exports rendered at the same time
+	ExportMaxPending int           `env:"EXPORT_MAX_PENDING" envDefault:"3"` // unfinished exports per user
+	ExportRetention  time.Duration `env:"EXPORT_RETENTION" envDefault:"24h"` // how long finished archives are kept
+
+	InvoiceCurrency string `env:"INVOICE_CURRENCY" envDefault:"IDR"` // ISO 4217, default currency of new invoices
+	InvoiceCountry  string `env:"INVOICE_COUNTRY" envDefault:"ID"`   // ISO 3166-1 alpha-2, used in e-invoice data
 }
 
 var (
@@ -43,8 +104,20 @@ func GetConfig() Config {
 	return configuration
 }
 
+// DatabaseURL returns the Postgres connection string
+func (c Config) DatabaseURL() string {
+	return fmt.Sprintf(
+		"host=%s user=%s password=%s dbname=%s port=%d sslmode=disable",
+		c.PostgresHost,
+		c.PostgresUser,
+		c.PostgresPassword,
+		c.PostgresDB,
+		c.PostgresPort,
+	)
+}
+
 func InitDB(dbUrl string) *gorm.DB {
-	db, err := gorm.Open(postgres.Open(dbUrl), &gorm.Config{})
+	db, err := gorm.Open(postgres.Open(dbUrl), &gorm.Config{TranslateError: true})
 	if err != nil {
 		log.Fatalf("failed to connect database: %v", err)
 	}
@@ -63,12 +136,244 @@ func InitDB(dbUrl string) *gorm.DB {
 }
 
 func migrate(db *gorm.DB) {
+	// Accounts created before email verification existed count as verified
+	backfillVerified := !db.Migrator().HasColumn(&models.User{}, "email_verified_at")
+	// Invoices used to be printed in the locale of their client record
+	backfillClientLocale := !db.Migrator().HasColumn(&models.Invoice{}, "client_locale")
+	// Invoices marked paid before payments were recorded count as paid in full
+	backfillPayments := !db.Migrator().HasTable(&models.Payment{})
+	// Signing certificates used to belong to the user who uploaded them
+	moveCertificates := db.Migrator().HasTable(&models.SigningCertificate{}) &&
+		!db.Migrator().HasColumn(&models.SigningCertificate{}, "organization_id")
+
+	// A user may now upload certificates for several organizations, so the
+	// unique index on user_id is recreated as a plain one
+	if moveCertificates && db.Migrator().HasIndex(&models.SigningCertificate{}, "idx_signing_certificates_user_id") {
+		if err := db.Migrator().DropIndex(&models.SigningCertificate{}, "idx_signing_certificates_user_id"); err != nil {
+			log.Fatalf("failed to migrate signing certificates: %v", err)
+		}
+	}
+
 	if err := db.AutoMigrate(
 		&models.User{},
 		&models.Client{},
+		&models.ClientContact{},
 		&models.Invoice{},
 		&models.InvoiceItem{},
+		&models.ExportJob{},
+		&models.SigningCertificate{},
+		&models.RefreshToken{},
+		&models.Session{},
+		&models.UserToken{},
+		&models.RecoveryCode{},
+		&models.RateLimitCounter{},
+		&models.APIKey{},
+		&models.OIDCLoginState{},
+		&models.UserIdentity{},
+		&models.Organization{},
+		&models.Membership{},
+		&models.Invitation{},
+		&models.SenderProfile{},
+		&models.Logo{},
+		&models.PaymentMethod{},
+		&models.InvoicePaymentMethod{},
+		&models.Payment{},
+		&models.ClientMerge{},
 	); err != nil {
 		log.Fatalf("failed to migrate database: %v", err)
 	}
+
+	if backfillVerified {
+		if err := db.Model(&models.User{}).Where("email_verified_at IS NULL").
+			Update("email_verified_at", gorm.Expr("created_at")).Error; err != nil {
+			log.Fatalf("failed to backfill email verification: %v", err)
+		}
+	}
+
+	if backfillClientLocale {
+		if err := db.Model(&models.Invoice{}).Where("client_id <> 0").
+			Update("client_locale", gorm.Expr("COALESCE((SELECT locale FROM clients WHERE clients.id = invoices.client_id), '')")).
+			Error; err != nil {
+			log.Fatalf("failed to backfill invoice client locales: %v", err)
+		}
+	}
+
+	if err := backfillOrganizations(db); err != nil {
+		log.Fatalf("failed to backfill organizations: %v", err)
+	}
+
+	if moveCertificates {
+		if err := moveSigningCertificates(db); err != nil {
+			log.Fatalf("failed to move signing certificates: %v", err)
+		}
+	}
+
+	if err := copyInvoiceSenders(db); err != nil {
+		log.Fatalf("failed to copy invoice sender details: %v", err)
+	}
+
+	if backfillPayments {
+		if err := db.Exec(`INSERT INTO payments (organization_id, client_id, invoice_id, type, amount, currency, date, automatic, created_at, updated_at)
+			SELECT organization_id, client_id, id, ?, total, currency, DATE(updated_at), TRUE, NOW(), NOW() FROM invoices WHERE status = ?`,
+			models.PaymentTypePayment, "paid").Error; err != nil {
+			log.Fatalf("failed to backfill payments: %v", err)
+		}
+	}
+}
+
+// backfillOrganizations turns every user without an organization, which is
+// everyone who signed up before organizations existed, into the owner of a
+// single-member organization holding their clients, invoices and exports.
+func backfillOrganizations(db *gorm.DB) error {
+	var users []models.User
+	err := db.Select("id", "name").
+		Where("NOT EXISTS (SELECT 1 FROM memberships WHERE memberships.user_id = users.id)").
+		Find(&users).Error
+	if err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			org := models.Organization{Name: user.Name}
+			if err := tx.Create(&org).Error; err != nil {
+				return err
+			}
+
+			err := tx.Create(&models.Membership{
+				OrganizationID: org.ID,
+				UserID:         user.ID,
+				Role:           models.RoleOwner,
+			}).Error
+			if err != nil {
+				return err
+			}
+
+			for _, model := range []interface{}{&models.Client{}, &models.Invoice{}, &models.ExportJob{}} {
+				err := tx.Model(model).
+					Where("user_id = ? AND organization_id IS NULL", user.ID).
+					Update("organization_id", org.ID).Error
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// moveSigningCertificates hands each certificate to the personal organization
+// of the user who uploaded it, which is their oldest membership and holds the
+// invoices they signed until then. Certificates whose organization already
+// has one are dropped.
+func moveSigningCertificates(db *gorm.DB) error {
+	var certs []models.SigningCertificate
+	if err := db.Select("id", "user_id").Where("organization_id IS NULL").Find(&certs).Error; err != nil {
+		return err
+	}
+
+	for _, cert := range certs {
+		var membership models.Membership
+		err := db.Where("user_id = ?", cert.UserID).Order("id").First(&membership).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		var taken int64
+		if err == nil {
+			err = db.Model(&models.SigningCertificate{}).
+				Where("organization_id = ?", membership.OrganizationID).
+				Count(&taken).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		if membership.ID == 0 || taken > 0 {
+			if err := db.Delete(&models.SigningCertificate{}, cert.ID).Error; err != nil {
+				return err
+			}
+			continue
+		}
+
+		err = db.Model(&models.SigningCertificate{}).Where("id = ?", cert.ID).
+			Update("organization_id", membership.OrganizationID).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// copyInvoiceSenders gives invoices from before sender details were stored on
+// the invoice a copy of their creator's current details and bank account,
+// which is what their PDFs showed until then.
+func copyInvoiceSenders(db *gorm.DB) error {
+	// Invoices issued from a sender profile were copied when they were created
+	err := db.Model(&models.Invoice{}).
+		Where("sender_snapshot_at IS NULL AND sender_profile_id IS NOT NULL").
+		Update("sender_snapshot_at", gorm.Expr("created_at")).Error
+	if err != nil {
+		return err
+	}
+
+	var invoices []models.Invoice
+	users := map[uint]*models.User{}
+	return db.Select("id", "user_id", "created_at").
+		Where("sender_snapshot_at IS NULL").
+		FindInBatches(&invoices, 500, func(_ *gorm.DB, batch int) error {
+			return db.Transaction(func(tx *gorm.DB) error {
+				for _, invoice := range invoices {
+					user, ok := users[invoice.UserID]
+					if !ok {
+						user = &models.User{}
+						err := tx.Unscoped().First(user, invoice.UserID).Error
+						if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+							return err
+						}
+						users[invoice.UserID] = user
+					}
+
+					invoice.Sender = models.SenderDetails{
+						Name:    user.Name,
+						Email:   user.Email,
+						Phone:   user.Phone,
+						Address: user.Address,
+					}
+					invoice.SenderSnapshotAt = &invoice.CreatedAt
+					err := tx.Model(&invoice).
+						Select("sender_name", "sender_email", "sender_phone", "sender_address", "sender_snapshot_at").
+						Updates(&invoice).Error
+					if err != nil {
+						return err
+					}
+
+					if user.BankAccountNumber == "" {
+						continue
+					}
+
+					err = tx.Create(&models.InvoicePaymentMethod{
+						InvoiceID: invoice.ID,
+						PaymentDetails: models.PaymentDetails{
+							Type:          models.PaymentMethodBankTransfer,
+							BankName:      user.BankName,
+							AccountName:   user.BankAccountName,
+							AccountNumber: user.BankAccountNumber,
+						},
+					}).Error
+					if err != nil {
+						return err
+					}
+				}
+
+				return nil
+			})
+		}).Error
 }
@@ -0,0 +1,53 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// OIDCProvider is the configuration of one single sign-on provider
+type OIDCProvider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// OIDCProviderConfigs reads the settings of every provider listed in
+// OIDC_PROVIDERS. A provider named "google" is configured with
+// OIDC_GOOGLE_ISSUER, OIDC_GOOGLE_CLIENT_ID, OIDC_GOOGLE_CLIENT_SECRET and
+// optionally OIDC_GOOGLE_REDIRECT_URL and OIDC_GOOGLE_SCOPES.
+func (c Config) OIDCProviderConfigs() ([]OIDCProvider, error) {
+	providers := make([]OIDCProvider, 0, len(c.OIDCProviders))
+	for _, name := range c.OIDCProviders {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		provider := OIDCProvider{
+			Name:         name,
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+			Scopes:       strings.Fields(strings.ReplaceAll(os.Getenv(prefix+"SCOPES"), ",", " ")),
+		}
+
+		if provider.Issuer == "" || provider.ClientID == "" {
+			return nil, fmt.Errorf("%sISSUER and %sCLIENT_ID are required", prefix, prefix)
+		}
+
+		if provider.RedirectURL == "" {
+			provider.RedirectURL = strings.TrimSuffix(c.AppURL, "/") + "/auth/oidc/" + name + "/callback"
+		}
+
+		providers = append(providers, provider)
+	}
+
+	return providers, nil
+}
@@ -0,0 +1,112 @@
+package controllers
+
+import (
+	e "errors"
+	"net/http"
+	"strconv"
+
+	"github.com/hutamy/invoice-generator-backend/dto"
+	"github.com/hutamy/invoice-generator-backend/services"
+	"github.com/hutamy/invoice-generator-backend/utils"
+	"github.com/hutamy/invoice-generator-backend/utils/errors"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type APIKeyController struct {
+	apiKeyService services.APIKeyService
+}
+
+func NewAPIKeyController(apiKeyService services.APIKeyService) *APIKeyController {
+	return &APIKeyController{apiKeyService: apiKeyService}
+}
+
+// @Summary      Create API Key
+// @Description  Create a personal API key. The key is returned only once; send it as "Authorization: Bearer <key>" or in the X-API-Key header.
+// @Description  Needs the owner, admin or accountant role in the current organization.
+// @Tags         api-keys
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        X-Organization-ID  header    int                      false  "Organization ID"
+// @Param        body               body      dto.CreateAPIKeyRequest  true   "Key name, scopes and optional expiry date (YYYY-MM-DD)"
+// @Success      201  {object}  utils.GenericResponse{data=dto.CreateAPIKeyResponse}
+// @Failure      400  {object}  utils.GenericResponse
+// @Failure      401  {object}  utils.GenericResponse
+// @Failure      403  {object}  utils.GenericResponse
+// @Failure      500  {object}  utils.GenericResponse
+// @Router       /v1/protected/api-keys [post]
+func (c *APIKeyController) CreateAPIKey(ctx echo.Context) error {
+	req := new(dto.CreateAPIKeyRequest)
+	if err := ctx.Bind(req); err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
+	}
+
+	if err := ctx.Validate(req); err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, err.Error(), nil)
+	}
+
+	req.UserID = ctx.Get("user_id").(uint)
+	key, err := c.apiKeyService.CreateAPIKey(*req)
+	if err != nil {
+		if err == errors.ErrInvalidDateFormat || err == errors.ErrInvalidExpiry {
+			return utils.Response(ctx, http.StatusBadRequest, err.Error(), nil)
+		}
+
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	return utils.Response(ctx, http.StatusCreated, "API key created successfully", key)
+}
+
+// @Summary      List API Keys
+// @Description  List the personal API keys of the authenticated user. Needs the owner, admin or accountant role in the current organization.
+// @Tags         api-keys
+// @Produce      json
+// @Security     BearerAuth
+// @Param        X-Organization-ID  header  int  false  "Organization ID"
+// @Success      200  {object}  utils.GenericResponse{data=[]models.APIKey}
+// @Failure      401  {object}  utils.GenericResponse
+// @Failure      403  {object}  utils.GenericResponse
+// @Failure      500  {object}  utils.GenericResponse
+// @Router       /v1/protected/api-keys [get]
+func (c *APIKeyController) ListAPIKeys(ctx echo.Context) error {
+	userID := ctx.Get("user_id").(uint)
+	keys, err := c.apiKeyService.ListAPIKeys(userID)
+	if err != nil {
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	return utils.Response(ctx, http.StatusOK, "API keys retrieved successfully", keys)
+}
+
+// @Summary      Revoke API Key
+// @Description  Delete a personal API key; requests using it are rejected immediately
+// @Tags         api-keys
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path      int  true  "API key ID"
+// @Success      200  {object}  utils.GenericResponse
+// @Failure      400  {object}  utils.GenericResponse
+// @Failure      401  {object}  utils.GenericResponse
+// @Failure      403  {object}  utils.GenericResponse
+// @Failure      404  {object}  utils.GenericResponse
+// @Failure      500  {object}  utils.GenericResponse
+// @Router       /v1/protected/api-keys/{id} [delete]
+func (c *APIKeyController) RevokeAPIKey(ctx echo.Context) error {
+	userID := ctx.Get("user_id").(uint)
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
+	}
+
+	if err := c.apiKeyService.RevokeAPIKey(uint(id), userID); err != nil {
+		if e.Is(err, gorm.ErrRecordNotFound) {
+			return utils.Response(ctx, http.StatusNotFound, errors.ErrNotFound.Error(), nil)
+		}
+
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	return utils.Response(ctx, http.StatusOK, "API key revoked successfully", nil)
+}
@@ -2,25 +2,38 @@ package controllers
 
 import (
 	"net/http"
-	"time"
+
+	e "errors"
 
 	"github.com/hutamy/invoice-generator-backend/dto"
+	"github.com/hutamy/invoice-generator-backend/models"
 	"github.com/hutamy/invoice-generator-backend/services"
 	"github.com/hutamy/invoice-generator-backend/utils"
 	"github.com/hutamy/invoice-generator-backend/utils/errors"
+	"github.com/hutamy/invoice-generator-backend/utils/ratelimit"
 	"github.com/labstack/echo/v4"
 )
 
 type AuthController struct {
-	authService services.AuthService
+	authService      services.AuthService
+	tokenService     services.TokenService
+	twoFactorService services.TwoFactorService
 }
 
-func NewAuthController(authService services.AuthService) *AuthController {
-	return &AuthController{authService: authService}
+func NewAuthController(
+	authService services.AuthService,
+	tokenService services.TokenService,
+	twoFactorService services.TwoFactorService,
+) *AuthController {
+	return &AuthController{
+		authService:      authService,
+		tokenService:     tokenService,
+		twoFactorService: twoFactorService,
+	}
 }
 
 // @Summary      User Sign Up
-// @Description  Register a new user
+// @Description  Register a new user. The account can sign in once the emailed verification link is used.
 // @Tags         auth
 // @Accept       json
 // @Produce      json
@@ -49,24 +62,15 @@ func (c *AuthController) SignUp(ctx echo.Context) error {
 		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
 	}
 
-	accessToken, err := utils.GenerateJWT(user.ID, time.Hour*24) // Token valid for 24 hours
-	if err != nil {
-		return utils.Response(ctx, http.StatusInternalServerError, errors.ErrFailedGenerateToken.Error(), nil)
-	}
-
-	refreshToken, err := utils.GenerateJWT(user.ID, time.Hour*24*7) // Token valid for 7 days
-	if err != nil {
-		return utils.Response(ctx, http.StatusInternalServerError, errors.ErrFailedGenerateToken.Error(), nil)
-	}
-
-	return utils.Response(ctx, http.StatusCreated, "User created successfully", echo.Map{
-		"access_token":  accessToken,
-		"refresh_token": refreshToken,
+	return utils.Response(ctx, http.StatusCreated, "User created successfully, check your email to verify your account", echo.Map{
+		"id":    user.ID,
+		"email": user.Email,
 	})
 }
 
 // @Summary      User Sign In
-// @Description  Authenticate user and return JWT token
+// @Description  Authenticate user and return JWT token. Accounts with two-factor authentication
+// @Description  get a challenge token instead, to be completed at /v1/public/auth/sign-in/2fa.
 // @Tags         auth
 // @Accept       json
 // @Produce      json
@@ -74,6 +78,8 @@ func (c *AuthController) SignUp(ctx echo.Context) error {
 // @Success      200   {object}  utils.GenericResponse
 // @Failure      400   {object}  utils.GenericResponse
 // @Failure      401   {object}  utils.GenericResponse
+// @Failure      403   {object}  utils.GenericResponse
+// @Failure      429   {object}  utils.GenericResponse
 // @Failure      500   {object}  utils.GenericResponse
 // @Router       /v1/public/auth/sign-in [post]
 func (c *AuthController) SignIn(ctx echo.Context) error {
@@ -86,36 +92,102 @@ func (c *AuthController) SignIn(ctx echo.Context) error {
 		return utils.Response(ctx, http.StatusBadRequest, err.Error(), nil)
 	}
 
-	user, err := c.authService.SignIn(req.Email, req.Password)
+	user, err := c.authService.SignIn(req.Email, req.Password, ctx.RealIP())
 	if err != nil {
+		var limitErr *ratelimit.LimitError
+		if e.As(err, &limitErr) {
+			return utils.TooManyRequests(ctx, limitErr.RetryAfter)
+		}
+
 		if err == errors.ErrLoginFailed {
 			return utils.Response(ctx, http.StatusUnauthorized, err.Error(), nil)
 		}
 
+		if err == errors.ErrEmailNotVerified {
+			return utils.Response(ctx, http.StatusForbidden, err.Error(), nil)
+		}
+
 		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
 	}
 
-	accessToken, err := utils.GenerateJWT(user.ID, time.Hour*24) // Token valid for 24 hours
+	return completeSignIn(ctx, user, c.tokenService, c.twoFactorService)
+}
+
+// clientInfo describes the device of the request for session tracking
+func clientInfo(ctx echo.Context) dto.ClientInfo {
+	return dto.ClientInfo{UserAgent: ctx.Request().UserAgent(), IPAddress: ctx.RealIP()}
+}
+
+// completeSignIn answers a successful first sign-in step with a two-factor
+// challenge when the account requires one and with a token pair otherwise.
+func completeSignIn(ctx echo.Context, user models.User, tokenService services.TokenService, twoFactorService services.TwoFactorService) error {
+	if user.TwoFactorEnabled {
+		challenge, err := twoFactorService.CreateChallenge(user.ID)
+		if err != nil {
+			return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+		}
+
+		return utils.Response(ctx, http.StatusOK, "Two-factor authentication required", challenge)
+	}
+
+	tokens, err := tokenService.IssueTokens(user.ID, clientInfo(ctx))
 	if err != nil {
 		return utils.Response(ctx, http.StatusInternalServerError, errors.ErrFailedGenerateToken.Error(), nil)
 	}
 
-	refreshToken, err := utils.GenerateJWT(user.ID, time.Hour*24*7) // Token valid for 7 days
+	return utils.Response(ctx, http.StatusOK, "Sign In successful", tokens)
+}
+
+// @Summary      Two-Factor Sign In
+// @Description  Complete a sign-in with the challenge token and a TOTP or recovery code
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        body  body      dto.TwoFactorSignInRequest  true  "Two-Factor Sign In Request"
+// @Success      200   {object}  utils.GenericResponse{data=dto.TokenResponse}
+// @Failure      400   {object}  utils.GenericResponse
+// @Failure      401   {object}  utils.GenericResponse
+// @Failure      429   {object}  utils.GenericResponse
+// @Failure      500   {object}  utils.GenericResponse
+// @Router       /v1/public/auth/sign-in/2fa [post]
+func (c *AuthController) SignInTwoFactor(ctx echo.Context) error {
+	req := new(dto.TwoFactorSignInRequest)
+	if err := ctx.Bind(req); err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
+	}
+
+	if err := ctx.Validate(req); err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, err.Error(), nil)
+	}
+
+	userID, err := c.twoFactorService.VerifyChallenge(req.ChallengeToken, req.Code)
+	if err != nil {
+		var limitErr *ratelimit.LimitError
+		if e.As(err, &limitErr) {
+			return utils.TooManyRequests(ctx, limitErr.RetryAfter)
+		}
+
+		if err == errors.ErrInvalidToken || err == errors.ErrInvalidTwoFactorCode || err == errors.ErrTwoFactorNotEnabled {
+			return utils.Response(ctx, http.StatusUnauthorized, err.Error(), nil)
+		}
+
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	tokens, err := c.tokenService.IssueTokens(userID, clientInfo(ctx))
 	if err != nil {
 		return utils.Response(ctx, http.StatusInternalServerError, errors.ErrFailedGenerateToken.Error(), nil)
 	}
 
-	return utils.Response(ctx, http.StatusOK, "Sign In successful", echo.Map{
-		"access_token":  accessToken,
-		"refresh_token": refreshToken,
-	})
+	return utils.Response(ctx, http.StatusOK, "Sign In successful", tokens)
 }
 
 // @Summary      Get Current User
-// @Description  Get details of the authenticated user
+// @Description  Get details of the authenticated user. The bank account number is masked unless unmask=true.
 // @Tags         auth
 // @Produce      json
 // @Security     BearerAuth
+// @Param        unmask  query     bool  false  "Return the full bank account number"
 // @Success      200   {object}  utils.GenericResponse
 // @Failure      401   {object}  utils.GenericResponse
 // @Failure      404   {object}  utils.GenericResponse
@@ -136,6 +208,11 @@ func (c *AuthController) Me(ctx echo.Context) error {
 		return utils.Response(ctx, http.StatusNotFound, errors.ErrNotFound.Error(), nil)
 	}
 
+	bankAccountNumber := utils.MaskAccountNumber(user.BankAccountNumber)
+	if ctx.QueryParam("unmask") == "true" {
+		bankAccountNumber = user.BankAccountNumber
+	}
+
 	return utils.Response(ctx, http.StatusOK, "User retrieved successfully", echo.Map{
 		"id":                  user.ID,
 		"name":                user.Name,
@@ -143,18 +220,21 @@ func (c *AuthController) Me(ctx echo.Context) error {
 		"phone":               user.Phone,
 		"address":             user.Address,
 		"bank_name":           user.BankName,
-		"bank_account_number": user.BankAccountNumber,
+		"bank_account_number": bankAccountNumber,
 		"bank_account_name":   user.BankAccountName,
+		"locale":              user.Locale,
+		"two_factor_enabled":  user.TwoFactorEnabled,
 	})
 }
 
 // @Summary      Refresh Token
-// @Description  Refresh access token using a valid refresh token
+// @Description  Exchange a refresh token for a new access and refresh token. Every refresh token
+// @Description  can be used once; reusing a rotated token signs out every session it belongs to.
 // @Tags         auth
 // @Accept       json
 // @Produce      json
 // @Param        body  body      dto.RefreshTokenRequest  true  "Refresh Token Request"
-// @Success      200   {object}  utils.GenericResponse
+// @Success      200   {object}  utils.GenericResponse{data=dto.TokenResponse}
 // @Failure      400   {object}  utils.GenericResponse
 // @Failure      401   {object}  utils.GenericResponse
 // @Failure      500   {object}  utils.GenericResponse
@@ -169,42 +249,74 @@ func (c *AuthController) RefreshToken(ctx echo.Context) error {
 		return utils.Response(ctx, http.StatusBadRequest, err.Error(), nil)
 	}
 
-	claims, err := utils.ParseJWT(req.RefreshToken)
+	tokens, err := c.tokenService.RefreshTokens(req.RefreshToken, clientInfo(ctx))
 	if err != nil {
-		return utils.Response(ctx, http.StatusUnauthorized, errors.ErrUnauthorized.Error(), nil)
+		if err == errors.ErrInvalidToken || err == errors.ErrRefreshTokenReused {
+			return utils.Response(ctx, http.StatusUnauthorized, err.Error(), nil)
+		}
+
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
 	}
 
-	userID, ok := claims["user_id"].(float64)
-	if !ok {
-		return utils.Response(ctx, http.StatusUnauthorized, errors.ErrUnauthorized.Error(), nil)
+	return utils.Response(ctx, http.StatusOK, "Token refreshed successfully", tokens)
+}
+
+// @Summary      Sign Out
+// @Description  Revoke the given refresh token and every token rotated from the same sign-in
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        body  body      dto.RefreshTokenRequest  true  "Refresh Token Request"
+// @Success      200   {object}  utils.GenericResponse
+// @Failure      400   {object}  utils.GenericResponse
+// @Failure      401   {object}  utils.GenericResponse
+// @Failure      500   {object}  utils.GenericResponse
+// @Router       /v1/public/auth/sign-out [post]
+func (c *AuthController) SignOut(ctx echo.Context) error {
+	req := new(dto.RefreshTokenRequest)
+	if err := ctx.Bind(req); err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
 	}
 
-	user, err := c.authService.GetUserByID(uint(userID))
-	if err != nil {
-		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	if err := ctx.Validate(req); err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, err.Error(), nil)
 	}
-	if user == nil {
-		return utils.Response(ctx, http.StatusNotFound, errors.ErrNotFound.Error(), nil)
+
+	if err := c.tokenService.SignOut(req.RefreshToken); err != nil {
+		if err == errors.ErrInvalidToken {
+			return utils.Response(ctx, http.StatusUnauthorized, err.Error(), nil)
+		}
+
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
 	}
 
-	accessToken, err := utils.GenerateJWT(user.ID, time.Hour*24)
-	if err != nil {
-		return utils.Response(ctx, http.StatusInternalServerError, errors.ErrFailedGenerateToken.Error(), nil)
+	return utils.Response(ctx, http.StatusOK, "Signed out successfully", nil)
+}
+
+// @Summary      Sign Out Everywhere
+// @Description  Revoke every refresh token of the authenticated user
+// @Tags         auth
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200   {object}  utils.GenericResponse
+// @Failure      401   {object}  utils.GenericResponse
+// @Failure      500   {object}  utils.GenericResponse
+// @Router       /v1/protected/auth/sign-out-everywhere [post]
+func (c *AuthController) SignOutEverywhere(ctx echo.Context) error {
+	userID, ok := ctx.Get("user_id").(uint)
+	if !ok {
+		return utils.Response(ctx, http.StatusUnauthorized, errors.ErrUnauthorized.Error(), nil)
 	}
 
-	refreshToken, err := utils.GenerateJWT(user.ID, time.Hour*24*7)
-	if err != nil {
-		return utils.Response(ctx, http.StatusInternalServerError, errors.ErrFailedGenerateToken.Error(), nil)
+	if err := c.tokenService.SignOutEverywhere(userID); err != nil {
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
 	}
 
-	return utils.Response(ctx, http.StatusOK, "Token refreshed successfully", echo.Map{
-		"access_token":  accessToken,
-		"refresh_token": refreshToken,
-	})
+	return utils.Response(ctx, http.StatusOK, "Signed out from all sessions successfully", nil)
 }
 
 // @Summary      Update User
-// @Description  Update user details
+// @Description  Update user details. The email address is changed with PUT /v1/protected/me/email instead.
 // @Tags         auth
 // @Accept       json
 // @Produce      json
@@ -233,8 +345,261 @@ func (c *AuthController) UpdateUser(ctx echo.Context) error {
 
 	req.UserID = userID
 	if err := c.authService.UpdateUser(*req); err != nil {
+		if err == errors.ErrEmailChangeNotAllowed {
+			return utils.Response(ctx, http.StatusBadRequest, err.Error(), nil)
+		}
+
 		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
 	}
 
 	return utils.Response(ctx, http.StatusOK, "User updated successfully", nil)
 }
+
+// @Summary      Verify Email
+// @Description  Verify the email address with the token from the verification email and sign in.
+// @Description  Accounts with two-factor authentication get a challenge token instead, like on sign-in.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        body  body      dto.VerifyEmailRequest  true  "Verify Email Request"
+// @Success      200   {object}  utils.GenericResponse
+// @Failure      400   {object}  utils.GenericResponse
+// @Failure      401   {object}  utils.GenericResponse
+// @Failure      500   {object}  utils.GenericResponse
+// @Router       /v1/public/auth/verify-email [post]
+func (c *AuthController) VerifyEmail(ctx echo.Context) error {
+	req := new(dto.VerifyEmailRequest)
+	if err := ctx.Bind(req); err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
+	}
+
+	if err := ctx.Validate(req); err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, err.Error(), nil)
+	}
+
+	user, err := c.authService.VerifyEmail(req.Token)
+	if err != nil {
+		if err == errors.ErrInvalidToken {
+			return utils.Response(ctx, http.StatusUnauthorized, err.Error(), nil)
+		}
+
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	return completeSignIn(ctx, user, c.tokenService, c.twoFactorService)
+}
+
+// @Summary      Resend Verification Email
+// @Description  Send a new verification link if the address belongs to an unverified account
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        body  body      dto.EmailRequest  true  "Email Request"
+// @Success      200   {object}  utils.GenericResponse
+// @Failure      400   {object}  utils.GenericResponse
+// @Failure      500   {object}  utils.GenericResponse
+// @Router       /v1/public/auth/verify-email/resend [post]
+func (c *AuthController) ResendVerification(ctx echo.Context) error {
+	req := new(dto.EmailRequest)
+	if err := ctx.Bind(req); err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
+	}
+
+	if err := ctx.Validate(req); err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, err.Error(), nil)
+	}
+
+	if err := c.authService.ResendVerification(req.Email); err != nil {
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	return utils.Response(ctx, http.StatusOK, "If the account exists and is not verified yet, a verification email has been sent", nil)
+}
+
+// @Summary      Forgot Password
+// @Description  Email a single-use password reset link
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        body  body      dto.EmailRequest  true  "Email Request"
+// @Success      200   {object}  utils.GenericResponse
+// @Failure      400   {object}  utils.GenericResponse
+// @Failure      500   {object}  utils.GenericResponse
+// @Router       /v1/public/auth/forgot-password [post]
+func (c *AuthController) ForgotPassword(ctx echo.Context) error {
+	req := new(dto.EmailRequest)
+	if err := ctx.Bind(req); err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
+	}
+
+	if err := ctx.Validate(req); err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, err.Error(), nil)
+	}
+
+	if err := c.authService.ForgotPassword(req.Email); err != nil {
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	return utils.Response(ctx, http.StatusOK, "If the account exists, a password reset email has been sent", nil)
+}
+
+// @Summary      Reset Password
+// @Description  Set a new password with the token from the password reset email. Signs out every session.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        body  body      dto.ResetPasswordRequest  true  "Reset Password Request"
+// @Success      200   {object}  utils.GenericResponse
+// @Failure      400   {object}  utils.GenericResponse
+// @Failure      401   {object}  utils.GenericResponse
+// @Failure      500   {object}  utils.GenericResponse
+// @Router       /v1/public/auth/reset-password [post]
+func (c *AuthController) ResetPassword(ctx echo.Context) error {
+	req := new(dto.ResetPasswordRequest)
+	if err := ctx.Bind(req); err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
+	}
+
+	if err := ctx.Validate(req); err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, err.Error(), nil)
+	}
+
+	if err := c.authService.ResetPassword(*req); err != nil {
+		if err == errors.ErrInvalidToken {
+			return utils.Response(ctx, http.StatusUnauthorized, err.Error(), nil)
+		}
+
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	return utils.Response(ctx, http.StatusOK, "Password reset successfully", nil)
+}
+
+// @Summary      Change Email
+// @Description  Request an email change. A confirmation link goes to the new address and a notice to the current one;
+// @Description  the address changes once the link is confirmed at /v1/public/auth/confirm-email-change.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        body  body      dto.ChangeEmailRequest  true  "New email and current password"
+// @Success      202   {object}  utils.GenericResponse
+// @Failure      400   {object}  utils.GenericResponse
+// @Failure      401   {object}  utils.GenericResponse
+// @Failure      403   {object}  utils.GenericResponse
+// @Failure      409   {object}  utils.GenericResponse
+// @Failure      500   {object}  utils.GenericResponse
+// @Router       /v1/protected/me/email [put]
+func (c *AuthController) ChangeEmail(ctx echo.Context) error {
+	req := new(dto.ChangeEmailRequest)
+	if err := ctx.Bind(req); err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
+	}
+
+	if err := ctx.Validate(req); err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, err.Error(), nil)
+	}
+
+	userID, ok := ctx.Get("user_id").(uint)
+	if !ok {
+		return utils.Response(ctx, http.StatusUnauthorized, errors.ErrUnauthorized.Error(), nil)
+	}
+
+	req.UserID = userID
+	if err := c.authService.RequestEmailChange(*req); err != nil {
+		switch err {
+		case errors.ErrInvalidPassword:
+			return utils.Response(ctx, http.StatusForbidden, err.Error(), nil)
+		case errors.ErrSameEmail:
+			return utils.Response(ctx, http.StatusBadRequest, err.Error(), nil)
+		case errors.ErrUserAlreadyExists:
+			return utils.Response(ctx, http.StatusConflict, err.Error(), nil)
+		}
+
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	return utils.Response(ctx, http.StatusAccepted, "Check the new email address to confirm the change", nil)
+}
+
+// @Summary      Confirm Email Change
+// @Description  Switch the account to the new email address with the token from the confirmation email
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        body  body      dto.ConfirmEmailChangeRequest  true  "Confirm Email Change Request"
+// @Success      200   {object}  utils.GenericResponse
+// @Failure      400   {object}  utils.GenericResponse
+// @Failure      401   {object}  utils.GenericResponse
+// @Failure      409   {object}  utils.GenericResponse
+// @Failure      500   {object}  utils.GenericResponse
+// @Router       /v1/public/auth/confirm-email-change [post]
+func (c *AuthController) ConfirmEmailChange(ctx echo.Context) error {
+	req := new(dto.ConfirmEmailChangeRequest)
+	if err := ctx.Bind(req); err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
+	}
+
+	if err := ctx.Validate(req); err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, err.Error(), nil)
+	}
+
+	if err := c.authService.ConfirmEmailChange(req.Token); err != nil {
+		if err == errors.ErrInvalidToken {
+			return utils.Response(ctx, http.StatusUnauthorized, err.Error(), nil)
+		}
+
+		if err == errors.ErrUserAlreadyExists {
+			return utils.Response(ctx, http.StatusConflict, err.Error(), nil)
+		}
+
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	return utils.Response(ctx, http.StatusOK, "Email address changed successfully", nil)
+}
+
+// @Summary      Change Password
+// @Description  Change the password of the authenticated user. Every other session is signed out and a new token pair is returned.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        body  body      dto.ChangePasswordRequest  true  "Change Password Request"
+// @Success      200   {object}  utils.GenericResponse{data=dto.TokenResponse}
+// @Failure      400   {object}  utils.GenericResponse
+// @Failure      401   {object}  utils.GenericResponse
+// @Failure      403   {object}  utils.GenericResponse
+// @Failure      500   {object}  utils.GenericResponse
+// @Router       /v1/protected/me/password [put]
+func (c *AuthController) ChangePassword(ctx echo.Context) error {
+	req := new(dto.ChangePasswordRequest)
+	if err := ctx.Bind(req); err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
+	}
+
+	if err := ctx.Validate(req); err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, err.Error(), nil)
+	}
+
+	userID, ok := ctx.Get("user_id").(uint)
+	if !ok {
+		return utils.Response(ctx, http.StatusUnauthorized, errors.ErrUnauthorized.Error(), nil)
+	}
+
+	req.UserID = userID
+	if err := c.authService.ChangePassword(*req); err != nil {
+		if err == errors.ErrInvalidPassword {
+			return utils.Response(ctx, http.StatusForbidden, err.Error(), nil)
+		}
+
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	tokens, err := c.tokenService.IssueTokens(userID, clientInfo(ctx))
+	if err != nil {
+		return utils.Response(ctx, http.StatusInternalServerError, errors.ErrFailedGenerateToken.Error(), nil)
+	}
+
+	return utils.Response(ctx, http.StatusOK, "Password changed successfully", tokens)
+}
@@ -0,0 +1,167 @@
+package controllers
+
+import (
+	"io"
+	"net/http"
+
+	e "errors"
+
+	"github.com/hutamy/invoice-generator-backend/dto"
+	"github.com/hutamy/invoice-generator-backend/services"
+	"github.com/hutamy/invoice-generator-backend/utils"
+	"github.com/hutamy/invoice-generator-backend/utils/errors"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// maxUploadSize limits uploaded certificates and documents
+const maxUploadSize = 10 << 20
+
+type CertificateController struct {
+	certService services.CertificateService
+}
+
+func NewCertificateController(certService services.CertificateService) *CertificateController {
+	return &CertificateController{certService: certService}
+}
+
+// @Summary      Upload signing certificate
+// @Description  Stores a PKCS#12 (.p12/.pfx) certificate the organization signs its invoice PDFs with, replacing the current one
+// @Tags         signing-certificate
+// @Accept       multipart/form-data
+// @Produce      json
+// @Security     BearerAuth
+// @Param        X-Organization-ID  header    int     false  "Organization ID"
+// @Param        file               formData  file    true   "PKCS#12 file"
+// @Param        password           formData  string  false  "PKCS#12 password"
+// @Success      201  {object}  utils.GenericResponse
+// @Failure      400  {object}  utils.GenericResponse
+// @Failure      403  {object}  utils.GenericResponse
+// @Failure      422  {object}  utils.GenericResponse
+// @Failure      500  {object}  utils.GenericResponse
+// @Router       /v1/protected/signing-certificate [post]
+func (c *CertificateController) UploadCertificate(ctx echo.Context) error {
+	data, err := readFormFile(ctx, "file")
+	if err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
+	}
+
+	cert, err := c.certService.UploadCertificate(dto.UploadCertificateRequest{
+		OrganizationID: ctx.Get("organization_id").(uint),
+		UserID:         ctx.Get("user_id").(uint),
+		Data:           data,
+		Password:       ctx.FormValue("password"),
+	})
+	if err != nil {
+		if e.Is(err, errors.ErrInvalidCertificate) || e.Is(err, errors.ErrCertificateExpired) {
+			return utils.Response(ctx, http.StatusUnprocessableEntity, err.Error(), nil)
+		}
+
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	return utils.Response(ctx, http.StatusCreated, "Signing certificate uploaded successfully", cert)
+}
+
+// @Summary      Get signing certificate
+// @Description  Returns the details of the organization's signing certificate
+// @Tags         signing-certificate
+// @Produce      json
+// @Security     BearerAuth
+// @Param        X-Organization-ID  header  int  false  "Organization ID"
+// @Success      200  {object}  utils.GenericResponse
+// @Failure      403  {object}  utils.GenericResponse
+// @Failure      404  {object}  utils.GenericResponse
+// @Failure      500  {object}  utils.GenericResponse
+// @Router       /v1/protected/signing-certificate [get]
+func (c *CertificateController) GetCertificate(ctx echo.Context) error {
+	cert, err := c.certService.GetCertificate(ctx.Get("organization_id").(uint))
+	if err != nil {
+		if e.Is(err, gorm.ErrRecordNotFound) {
+			return utils.Response(ctx, http.StatusNotFound, errors.ErrNotFound.Error(), nil)
+		}
+
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	return utils.Response(ctx, http.StatusOK, "Signing certificate retrieved successfully", cert)
+}
+
+// @Summary      Delete signing certificate
+// @Description  Removes the organization's signing certificate; its invoice PDFs are no longer signed
+// @Tags         signing-certificate
+// @Produce      json
+// @Security     BearerAuth
+// @Param        X-Organization-ID  header  int  false  "Organization ID"
+// @Success      200  {object}  utils.GenericResponse
+// @Failure      403  {object}  utils.GenericResponse
+// @Failure      404  {object}  utils.GenericResponse
+// @Failure      500  {object}  utils.GenericResponse
+// @Router       /v1/protected/signing-certificate [delete]
+func (c *CertificateController) DeleteCertificate(ctx echo.Context) error {
+	if err := c.certService.DeleteCertificate(ctx.Get("organization_id").(uint)); err != nil {
+		if e.Is(err, gorm.ErrRecordNotFound) {
+			return utils.Response(ctx, http.StatusNotFound, errors.ErrNotFound.Error(), nil)
+		}
+
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	return utils.Response(ctx, http.StatusOK, "Signing certificate deleted successfully", nil)
+}
+
+// @Summary      Verify signed PDF
+// @Description  Checks the signature of an uploaded PDF and whether it was made with the organization's signing certificate
+// @Tags         signing-certificate
+// @Accept       multipart/form-data
+// @Produce      json
+// @Security     BearerAuth
+// @Param        X-Organization-ID  header    int   false  "Organization ID"
+// @Param        file               formData  file  true   "Signed PDF"
+// @Success      200  {object}  utils.GenericResponse{data=dto.VerifySignatureResponse}
+// @Failure      400  {object}  utils.GenericResponse
+// @Failure      403  {object}  utils.GenericResponse
+// @Failure      404  {object}  utils.GenericResponse
+// @Failure      422  {object}  utils.GenericResponse
+// @Failure      500  {object}  utils.GenericResponse
+// @Router       /v1/protected/signing-certificate/verify [post]
+func (c *CertificateController) VerifyDocument(ctx echo.Context) error {
+	data, err := readFormFile(ctx, "file")
+	if err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
+	}
+
+	result, err := c.certService.VerifyDocument(ctx.Get("organization_id").(uint), data)
+	if err != nil {
+		if e.Is(err, gorm.ErrRecordNotFound) {
+			return utils.Response(ctx, http.StatusNotFound, errors.ErrNotFound.Error(), nil)
+		}
+
+		if e.Is(err, errors.ErrInvalidSignature) {
+			return utils.Response(ctx, http.StatusUnprocessableEntity, err.Error(), nil)
+		}
+
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	return utils.Response(ctx, http.StatusOK, "Signature verified", result)
+}
+
+func readFormFile(ctx echo.Context, name string) ([]byte, error) {
+	header, err := ctx.FormFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if header.Size > maxUploadSize {
+		return nil, errors.ErrBadRequest
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return io.ReadAll(io.LimitReader(file, maxUploadSize))
+}
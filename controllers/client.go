@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	e "errors"
 	"net/http"
 	"strconv"
 
@@ -9,6 +10,7 @@ import (
 	"github.com/hutamy/invoice-generator-backend/utils"
 	"github.com/hutamy/invoice-generator-backend/utils/errors"
 	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
 )
 
 type ClientController struct {
@@ -20,7 +22,8 @@ func NewClientController(clientService services.ClientService) *ClientController
 }
 
 // @Summary      Create a new client
-// @Description  Creates a new client for the authenticated user
+// @Description  Creates a new client in the current organization. Either address or billing_address.line1
+// @Description  is required. Contacts are kept in the order given.
 // @Tags         clients
 // @Accept       json
 // @Produce      json
@@ -31,14 +34,17 @@ func NewClientController(clientService services.ClientService) *ClientController
 // @Failure      500     {object}  utils.GenericResponse
 // @Router       /v1/protected/clients [post]
 func (c *ClientController) CreateClient(ctx echo.Context) error {
-	userID := ctx.Get("user_id").(uint)
-
 	var client dto.CreateClientRequest
 	if err := ctx.Bind(&client); err != nil {
 		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
 	}
 
-	client.UserID = userID
+	if err := ctx.Validate(client); err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, err.Error(), nil)
+	}
+
+	client.OrganizationID = ctx.Get("organization_id").(uint)
+	client.UserID = ctx.Get("user_id").(uint)
 	if err := c.clientService.CreateClient(client); err != nil {
 		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
 	}
@@ -47,7 +53,7 @@ func (c *ClientController) CreateClient(ctx echo.Context) error {
 }
 
 // @Summary      Get all clients
-// @Description  Retrieves all clients for the authenticated user with pagination (default: page=1, page_size=10)
+// @Description  Retrieves all clients in the current organization with pagination (default: page=1, page_size=10)
 // @Tags         clients
 // @Produce      json
 // @Security     BearerAuth
@@ -55,18 +61,20 @@ func (c *ClientController) CreateClient(ctx echo.Context) error {
 // @Param        page_size query     int     false  "Page size (default: 10, max: 100)"
 // @Param        search    query     string  false  "Search term for filtering clients"
 // @Param        all       query     bool    false  "Return all clients without pagination (use with caution)"
+// @Param        archived  query     bool    false  "List archived clients instead of active ones"
 // @Success      200  {object}  utils.GenericResponse
 // @Failure      400  {object}  utils.GenericResponse
 // @Failure      500  {object}  utils.GenericResponse
 // @Router       /v1/protected/clients [get]
 func (c *ClientController) GetAllClients(ctx echo.Context) error {
-	userID := ctx.Get("user_id").(uint)
+	organizationID := ctx.Get("organization_id").(uint)
 
 	// Check if user explicitly wants all clients without pagination
 	all := ctx.QueryParam("all") == "true"
-	if all {
+	archived := ctx.QueryParam("archived") == "true"
+	if all && !archived {
 		// Use non-paginated response (backward compatibility)
-		clients, err := c.clientService.GetAllClientsByUserID(userID)
+		clients, err := c.clientService.GetAllClientsByOrganizationID(organizationID)
 		if err != nil {
 			return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
 		}
@@ -78,11 +86,12 @@ func (c *ClientController) GetAllClients(ctx echo.Context) error {
 	ctx.Bind(&paginationReq) // Bind query parameters, ignore errors
 
 	req := dto.GetClientsRequest{
-		UserID:            userID,
+		OrganizationID:    organizationID,
+		Archived:          archived,
 		PaginationRequest: paginationReq,
 	}
 
-	paginatedClients, err := c.clientService.GetAllClientsByUserIDWithPagination(req)
+	paginatedClients, err := c.clientService.GetAllClientsByOrganizationIDWithPagination(req)
 	if err != nil {
 		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
 	}
@@ -91,7 +100,7 @@ func (c *ClientController) GetAllClients(ctx echo.Context) error {
 }
 
 // @Summary      Get client by ID
-// @Description  Retrieves a client by its ID for the authenticated user
+// @Description  Retrieves a client by its ID in the current organization, archived clients included
 // @Tags         clients
 // @Produce      json
 // @Security     BearerAuth
@@ -102,16 +111,16 @@ func (c *ClientController) GetAllClients(ctx echo.Context) error {
 // @Failure      500  {object}  utils.GenericResponse
 // @Router       /v1/protected/clients/{id} [get]
 func (c *ClientController) GetClientByID(ctx echo.Context) error {
-	userID := ctx.Get("user_id").(uint)
+	organizationID := ctx.Get("organization_id").(uint)
 	id, err := strconv.Atoi(ctx.Param("id"))
 	if err != nil {
 		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
 	}
 
-	client, err := c.clientService.GetClientByID(uint(id), userID)
+	client, err := c.clientService.GetClientByID(uint(id), organizationID)
 	if err != nil {
-		if err == errors.ErrNotFound {
-			return utils.Response(ctx, http.StatusNotFound, err.Error(), nil)
+		if e.Is(err, gorm.ErrRecordNotFound) {
+			return utils.Response(ctx, http.StatusNotFound, errors.ErrNotFound.Error(), nil)
 		}
 
 		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
@@ -121,7 +130,8 @@ func (c *ClientController) GetClientByID(ctx echo.Context) error {
 }
 
 // @Summary      Update client
-// @Description  Updates a client by its ID for the authenticated user
+// @Description  Updates a client by its ID in the current organization. billing_address and contacts
+// @Description  replace the current address and contacts as a whole.
 // @Tags         clients
 // @Accept       json
 // @Produce      json
@@ -130,6 +140,7 @@ func (c *ClientController) GetClientByID(ctx echo.Context) error {
 // @Param        client  body      dto.UpdateClientRequest true  "Client data"
 // @Success      200     {object}  utils.GenericResponse
 // @Failure      400     {object}  utils.GenericResponse
+// @Failure      404     {object}  utils.GenericResponse
 // @Failure      500     {object}  utils.GenericResponse
 // @Router       /v1/protected/clients/{id} [put]
 func (c *ClientController) UpdateClient(ctx echo.Context) error {
@@ -138,8 +149,16 @@ func (c *ClientController) UpdateClient(ctx echo.Context) error {
 		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
 	}
 
-	client.UserID = ctx.Get("user_id").(uint)
+	if err := ctx.Validate(client); err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, err.Error(), nil)
+	}
+
+	client.OrganizationID = ctx.Get("organization_id").(uint)
 	if err := c.clientService.UpdateClient(client); err != nil {
+		if e.Is(err, gorm.ErrRecordNotFound) {
+			return utils.Response(ctx, http.StatusNotFound, errors.ErrNotFound.Error(), nil)
+		}
+
 		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
 	}
 
@@ -147,26 +166,46 @@ func (c *ClientController) UpdateClient(ctx echo.Context) error {
 }
 
 // @Summary      Delete client
-// @Description  Deletes a client by its ID for the authenticated user
+// @Description  Archives a client by its ID in the current organization. Archived clients are left out of
+// @Description  lists and cannot be linked to new invoices until restored. With permanent=true the client
+// @Description  is deleted for good instead, which is refused while invoices or payments reference it.
 // @Tags         clients
 // @Produce      json
 // @Security     BearerAuth
-// @Param        id   path      int  true  "Client ID"
+// @Param        id         path      int   true   "Client ID"
+// @Param        permanent  query     bool  false  "Delete for good instead of archiving"
 // @Success      200  {object}  utils.GenericResponse
 // @Failure      400  {object}  utils.GenericResponse
 // @Failure      404  {object}  utils.GenericResponse
+// @Failure      409  {object}  utils.GenericResponse
 // @Failure      500  {object}  utils.GenericResponse
 // @Router       /v1/protected/clients/{id} [delete]
 func (c *ClientController) DeleteClient(ctx echo.Context) error {
-	userID := ctx.Get("user_id").(uint)
+	organizationID := ctx.Get("organization_id").(uint)
 	id, err := strconv.Atoi(ctx.Param("id"))
 	if err != nil {
 		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
 	}
 
-	if err := c.clientService.DeleteClient(uint(id), userID); err != nil {
-		if err == errors.ErrNotFound {
-			return utils.Response(ctx, http.StatusNotFound, err.Error(), nil)
+	if ctx.QueryParam("permanent") != "true" {
+		if err := c.clientService.ArchiveClient(uint(id), organizationID); err != nil {
+			if e.Is(err, gorm.ErrRecordNotFound) {
+				return utils.Response(ctx, http.StatusNotFound, errors.ErrNotFound.Error(), nil)
+			}
+
+			return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+		}
+
+		return utils.Response(ctx, http.StatusOK, "Client archived successfully", nil)
+	}
+
+	if err := c.clientService.DeleteClient(uint(id), organizationID); err != nil {
+		if e.Is(err, gorm.ErrRecordNotFound) {
+			return utils.Response(ctx, http.StatusNotFound, errors.ErrNotFound.Error(), nil)
+		}
+
+		if err == errors.ErrClientInUse {
+			return utils.Response(ctx, http.StatusConflict, err.Error(), nil)
 		}
 
 		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
@@ -174,3 +213,146 @@ func (c *ClientController) DeleteClient(ctx echo.Context) error {
 
 	return utils.Response(ctx, http.StatusOK, "Client deleted successfully", nil)
 }
+
+// @Summary      Restore client
+// @Description  Restores an archived client by its ID in the current organization
+// @Tags         clients
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path      int  true  "Client ID"
+// @Success      200  {object}  utils.GenericResponse
+// @Failure      400  {object}  utils.GenericResponse
+// @Failure      404  {object}  utils.GenericResponse
+// @Failure      500  {object}  utils.GenericResponse
+// @Router       /v1/protected/clients/{id}/restore [post]
+func (c *ClientController) RestoreClient(ctx echo.Context) error {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
+	}
+
+	if err := c.clientService.RestoreClient(uint(id), ctx.Get("organization_id").(uint)); err != nil {
+		if e.Is(err, gorm.ErrRecordNotFound) {
+			return utils.Response(ctx, http.StatusNotFound, errors.ErrNotFound.Error(), nil)
+		}
+
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	return utils.Response(ctx, http.StatusOK, "Client restored successfully", nil)
+}
+
+// @Summary      Suggest duplicate clients
+// @Description  Suggests pairs of active clients that look like the same customer, comparing names without
+// @Description  punctuation and legal forms (PT, CV, Ltd, ...), emails and the trailing digits of phone numbers.
+// @Description  The older client of each pair is the suggested survivor. Best matches come first, paginated
+// @Description  with page and page_size (default: page=1, page_size=10).
+// @Tags         clients
+// @Produce      json
+// @Security     BearerAuth
+// @Param        client_id  query     int  false  "Only suggest duplicates of this client"
+// @Param        page       query     int  false  "Page number"
+// @Param        page_size  query     int  false  "Suggestions per page, at most 100"
+// @Success      200  {object}  utils.GenericResponse{data=utils.PaginatedResponse{data=[]dto.ClientDuplicate}}
+// @Failure      400  {object}  utils.GenericResponse
+// @Failure      404  {object}  utils.GenericResponse
+// @Failure      500  {object}  utils.GenericResponse
+// @Router       /v1/protected/clients/duplicates [get]
+func (c *ClientController) SuggestDuplicates(ctx echo.Context) error {
+	req := dto.GetClientDuplicatesRequest{OrganizationID: ctx.Get("organization_id").(uint)}
+	if value := ctx.QueryParam("client_id"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil || id < 1 {
+			return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
+		}
+
+		req.ClientID = uint(id)
+	}
+
+	ctx.Bind(&req.PaginationRequest) // Bind query parameters, ignore errors
+
+	duplicates, err := c.clientService.SuggestDuplicates(req)
+	if err != nil {
+		if e.Is(err, gorm.ErrRecordNotFound) {
+			return utils.Response(ctx, http.StatusNotFound, errors.ErrNotFound.Error(), nil)
+		}
+
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	return utils.Response(ctx, http.StatusOK, "Duplicate clients retrieved successfully", duplicates)
+}
+
+// @Summary      Merge clients
+// @Description  Merges the duplicate into the client in the path in one transaction. Its invoices, payments,
+// @Description  contacts and earlier merges move to the surviving client, the duplicate is archived and a
+// @Description  merge record is kept. Invoices keep the client details they were issued with.
+// @Tags         clients
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id     path      int                     true  "Surviving client ID"
+// @Param        merge  body      dto.MergeClientRequest  true  "Duplicate to merge"
+// @Success      200  {object}  utils.GenericResponse{data=models.ClientMerge}
+// @Failure      400  {object}  utils.GenericResponse
+// @Failure      404  {object}  utils.GenericResponse
+// @Failure      409  {object}  utils.GenericResponse
+// @Failure      500  {object}  utils.GenericResponse
+// @Router       /v1/protected/clients/{id}/merge [post]
+func (c *ClientController) MergeClients(ctx echo.Context) error {
+	var req dto.MergeClientRequest
+	if err := ctx.Bind(&req); err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
+	}
+
+	if err := ctx.Validate(req); err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, err.Error(), nil)
+	}
+
+	req.OrganizationID = ctx.Get("organization_id").(uint)
+	req.UserID = ctx.Get("user_id").(uint)
+	merge, err := c.clientService.MergeClients(req)
+	if err != nil {
+		switch {
+		case e.Is(err, gorm.ErrRecordNotFound):
+			return utils.Response(ctx, http.StatusNotFound, errors.ErrNotFound.Error(), nil)
+		case err == errors.ErrMergeSameClient:
+			return utils.Response(ctx, http.StatusBadRequest, err.Error(), nil)
+		case err == errors.ErrClientArchived:
+			return utils.Response(ctx, http.StatusConflict, err.Error(), nil)
+		}
+
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	return utils.Response(ctx, http.StatusOK, "Clients merged successfully", merge)
+}
+
+// @Summary      List client merges
+// @Description  Lists the clients merged into a client, newest first
+// @Tags         clients
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path      int  true  "Client ID"
+// @Success      200  {object}  utils.GenericResponse{data=[]models.ClientMerge}
+// @Failure      400  {object}  utils.GenericResponse
+// @Failure      404  {object}  utils.GenericResponse
+// @Failure      500  {object}  utils.GenericResponse
+// @Router       /v1/protected/clients/{id}/merges [get]
+func (c *ClientController) ListClientMerges(ctx echo.Context) error {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
+	}
+
+	merges, err := c.clientService.ListClientMerges(uint(id), ctx.Get("organization_id").(uint))
+	if err != nil {
+		if e.Is(err, gorm.ErrRecordNotFound) {
+			return utils.Response(ctx, http.StatusNotFound, errors.ErrNotFound.Error(), nil)
+		}
+
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	return utils.Response(ctx, http.StatusOK, "Client merges retrieved successfully", merges)
+}
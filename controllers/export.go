@@ -0,0 +1,134 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	e "errors"
+
+	"github.com/hutamy/invoice-generator-backend/dto"
+	"github.com/hutamy/invoice-generator-backend/services"
+	"github.com/hutamy/invoice-generator-backend/utils"
+	"github.com/hutamy/invoice-generator-backend/utils/errors"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type ExportController struct {
+	exportService services.ExportService
+}
+
+func NewExportController(exportService services.ExportService) *ExportController {
+	return &ExportController{exportService: exportService}
+}
+
+// @Summary      Export invoice PDFs
+// @Description  Starts a background job that renders every matching invoice and packs the PDFs into a ZIP archive
+// @Tags         invoices
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        filters  body      dto.ExportInvoicesRequest  true  "Export filters"
+// @Success      202      {object}  utils.GenericResponse
+// @Failure      400      {object}  utils.GenericResponse
+// @Failure      429      {object}  utils.GenericResponse
+// @Failure      500      {object}  utils.GenericResponse
+// @Router       /v1/protected/invoices/exports [post]
+func (c *ExportController) CreateExport(ctx echo.Context) error {
+	var req dto.ExportInvoicesRequest
+	if err := ctx.Bind(&req); err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
+	}
+
+	if err := ctx.Validate(req); err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, err.Error(), nil)
+	}
+
+	req.OrganizationID = ctx.Get("organization_id").(uint)
+	req.UserID = ctx.Get("user_id").(uint)
+	job, err := c.exportService.CreateExport(req)
+	if err != nil {
+		if err == errors.ErrInvalidDateFormat {
+			return utils.Response(ctx, http.StatusBadRequest, err.Error(), nil)
+		}
+
+		if err == errors.ErrTooManyExports {
+			return utils.Response(ctx, http.StatusTooManyRequests, err.Error(), nil)
+		}
+
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	return utils.Response(ctx, http.StatusAccepted, "Export started", job)
+}
+
+// @Summary      Get export status
+// @Description  Returns the status and progress of an export job
+// @Tags         invoices
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path      int  true  "Export ID"
+// @Success      200  {object}  utils.GenericResponse
+// @Failure      400  {object}  utils.GenericResponse
+// @Failure      404  {object}  utils.GenericResponse
+// @Failure      500  {object}  utils.GenericResponse
+// @Router       /v1/protected/invoices/exports/{id} [get]
+func (c *ExportController) GetExport(ctx echo.Context) error {
+	organizationID := ctx.Get("organization_id").(uint)
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
+	}
+
+	job, err := c.exportService.GetExport(uint(id), organizationID)
+	if err != nil {
+		if e.Is(err, gorm.ErrRecordNotFound) {
+			return utils.Response(ctx, http.StatusNotFound, errors.ErrNotFound.Error(), nil)
+		}
+
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	return utils.Response(ctx, http.StatusOK, "Export retrieved successfully", job)
+}
+
+// @Summary      Download export
+// @Description  Streams the ZIP archive of a completed export job. Archives are deleted after EXPORT_RETENTION.
+// @Tags         invoices
+// @Produce      application/zip
+// @Security     BearerAuth
+// @Param        id   path      int  true  "Export ID"
+// @Success      200  {file}    file
+// @Failure      400  {object}  utils.GenericResponse
+// @Failure      404  {object}  utils.GenericResponse
+// @Failure      409  {object}  utils.GenericResponse
+// @Failure      410  {object}  utils.GenericResponse
+// @Failure      500  {object}  utils.GenericResponse
+// @Router       /v1/protected/invoices/exports/{id}/download [get]
+func (c *ExportController) DownloadExport(ctx echo.Context) error {
+	organizationID := ctx.Get("organization_id").(uint)
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
+	}
+
+	filePath, err := c.exportService.GetExportFile(uint(id), organizationID)
+	if err != nil {
+		if e.Is(err, gorm.ErrRecordNotFound) {
+			return utils.Response(ctx, http.StatusNotFound, errors.ErrNotFound.Error(), nil)
+		}
+
+		if err == errors.ErrExportNotReady {
+			return utils.Response(ctx, http.StatusConflict, err.Error(), nil)
+		}
+
+		if err == errors.ErrExportExpired {
+			return utils.Response(ctx, http.StatusGone, err.Error(), nil)
+		}
+
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	return ctx.Attachment(filePath, fmt.Sprintf("invoices-%d.zip", id))
+}
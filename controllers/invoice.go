@@ -25,7 +25,7 @@ func NewInvoiceController(invoiceService services.InvoiceService) *InvoiceContro
 }
 
 // @Summary      Create a new invoice
-// @Description  Creates a new invoice for the authenticated user
+// @Description  Creates a new invoice in the current organization
 // @Tags         invoices
 // @Accept       json
 // @Produce      json
@@ -45,30 +45,37 @@ func (c *InvoiceController) CreateInvoice(ctx echo.Context) error {
 		return utils.Response(ctx, http.StatusBadRequest, err.Error(), nil)
 	}
 
-	userID := ctx.Get("user_id").(uint)
-	dueDate, err := time.Parse(time.DateOnly, req.DueDate)
+	issueDate, err := time.Parse(time.DateOnly, req.IssueDate)
 	if err != nil {
 		return utils.Response(ctx, http.StatusBadRequest, errors.ErrInvalidDateFormat.Error(), nil)
 	}
 
-	issueDate, err := time.Parse(time.DateOnly, req.IssueDate)
-	if err != nil {
-		return utils.Response(ctx, http.StatusBadRequest, errors.ErrInvalidDateFormat.Error(), nil)
+	// Without a due date the service applies the client's payment terms
+	var dueDate time.Time
+	if req.DueDate != "" {
+		dueDate, err = time.Parse(time.DateOnly, req.DueDate)
+		if err != nil {
+			return utils.Response(ctx, http.StatusBadRequest, errors.ErrInvalidDateFormat.Error(), nil)
+		}
 	}
 
 	invoice := models.Invoice{
-		UserID:        userID,
-		InvoiceNumber: req.InvoiceNumber,
-		ClientID:      req.ClientID,
-		IssueDate:     issueDate,
-		DueDate:       dueDate,
-		Notes:         req.Notes,
-		Status:        "draft", // default status
-		TaxRate:       req.TaxRate,
-		ClientName:    req.ClientName,
-		ClientEmail:   req.ClientEmail,
-		ClientAddress: req.ClientAddress,
-		ClientPhone:   req.ClientPhone,
+		OrganizationID:  ctx.Get("organization_id").(uint),
+		UserID:          ctx.Get("user_id").(uint),
+		InvoiceNumber:   req.InvoiceNumber,
+		ClientID:        req.ClientID,
+		IssueDate:       issueDate,
+		DueDate:         dueDate,
+		Notes:           req.Notes,
+		Status:          "draft", // default status
+		TaxRate:         req.TaxRate,
+		ClientName:      req.ClientName,
+		ClientEmail:     req.ClientEmail,
+		ClientAddress:   req.ClientAddress,
+		ClientPhone:     req.ClientPhone,
+		ClientLocale:    req.ClientLocale,
+		SenderProfileID: req.SenderProfileID,
+		Currency:        req.Currency,
 	}
 
 	for _, item := range req.Items {
@@ -78,15 +85,22 @@ func (c *InvoiceController) CreateInvoice(ctx echo.Context) error {
 			UnitPrice:   item.UnitPrice,
 		})
 	}
-	if err := c.invoiceService.CreateInvoice(&invoice); err != nil {
+	if err := c.invoiceService.CreateInvoice(&invoice, req.PaymentMethodIDs); err != nil {
+		if err == errors.ErrInvalidClient || err == errors.ErrInvalidSenderProfile || err == errors.ErrInvoiceNumberRequired ||
+			err == errors.ErrInvalidPaymentMethod || err == errors.ErrPaymentMethodCurrency || err == errors.ErrDueDateRequired {
+			return utils.Response(ctx, http.StatusBadRequest, err.Error(), nil)
+		}
+
 		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
 	}
 
+	maskInvoicePaymentMethods(&invoice)
 	return utils.Response(ctx, http.StatusCreated, "Invoice created successfully", invoice)
 }
 
 // @Summary      Get invoice by ID
-// @Description  Retrieves an invoice by its ID
+// @Description  Retrieves an invoice by its ID. Account numbers, IBANs and wallet IDs of its payment methods
+// @Description  are masked to their last four characters, see the reveal endpoint for the full details.
 // @Tags         invoices
 // @Accept       json
 // @Produce      json
@@ -103,19 +117,49 @@ func (c *InvoiceController) GetInvoiceByID(ctx echo.Context) error {
 		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
 	}
 
-	invoice, err := c.invoiceService.GetInvoiceByID(uint(id))
+	invoice, err := c.invoiceService.GetInvoiceByID(uint(id), ctx.Get("organization_id").(uint))
 	if err != nil {
-		if err == errors.ErrNotFound {
-			return utils.Response(ctx, http.StatusNotFound, err.Error(), nil)
+		if e.Is(err, gorm.ErrRecordNotFound) {
+			return utils.Response(ctx, http.StatusNotFound, errors.ErrNotFound.Error(), nil)
 		}
 		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
 	}
 
+	maskInvoicePaymentMethods(invoice)
 	return utils.Response(ctx, http.StatusOK, "Invoice retrieved successfully", invoice)
 }
 
-// @Summary      List invoices by user
-// @Description  Retrieves all invoices for the authenticated user with pagination (default: page=1, page_size=10)
+// @Summary      Reveal invoice payment methods
+// @Description  Retrieves the payment methods printed on an invoice with their full account numbers, IBANs and wallet IDs
+// @Tags         invoices
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path      int  true  "Invoice ID"
+// @Success      200  {object}  utils.GenericResponse
+// @Failure      400  {object}  utils.GenericResponse
+// @Failure      403  {object}  utils.GenericResponse
+// @Failure      404  {object}  utils.GenericResponse
+// @Failure      500  {object}  utils.GenericResponse
+// @Router       /v1/protected/invoices/{id}/payment-methods/reveal [get]
+func (c *InvoiceController) RevealPaymentMethods(ctx echo.Context) error {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
+	}
+
+	invoice, err := c.invoiceService.GetInvoiceByID(uint(id), ctx.Get("organization_id").(uint))
+	if err != nil {
+		if e.Is(err, gorm.ErrRecordNotFound) {
+			return utils.Response(ctx, http.StatusNotFound, errors.ErrNotFound.Error(), nil)
+		}
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	return utils.Response(ctx, http.StatusOK, "Payment methods retrieved successfully", invoice.PaymentMethods)
+}
+
+// @Summary      List invoices
+// @Description  Retrieves all invoices in the current organization with pagination (default: page=1, page_size=10)
 // @Tags         invoices
 // @Accept       json
 // @Produce      json
@@ -129,14 +173,14 @@ func (c *InvoiceController) GetInvoiceByID(ctx echo.Context) error {
 // @Failure      400  {object}  utils.GenericResponse
 // @Failure      500  {object}  utils.GenericResponse
 // @Router       /v1/protected/invoices [get]
-func (c *InvoiceController) ListInvoicesByUserID(ctx echo.Context) error {
-	userID := ctx.Get("user_id").(uint)
+func (c *InvoiceController) ListInvoices(ctx echo.Context) error {
+	organizationID := ctx.Get("organization_id").(uint)
 
 	// Check if user explicitly wants all invoices without pagination
 	all := ctx.QueryParam("all") == "true"
 	if all {
 		// Use non-paginated response (backward compatibility)
-		invoices, err := c.invoiceService.ListInvoiceByUserID(userID)
+		invoices, err := c.invoiceService.ListInvoiceByOrganizationID(organizationID)
 		if err != nil {
 			return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
 		}
@@ -150,12 +194,12 @@ func (c *InvoiceController) ListInvoicesByUserID(ctx echo.Context) error {
 	status := ctx.QueryParam("status")
 
 	req := dto.GetInvoicesRequest{
-		UserID:            userID,
+		OrganizationID:    organizationID,
 		PaginationRequest: paginationReq,
 		Status:            status,
 	}
 
-	paginatedInvoices, err := c.invoiceService.ListInvoiceByUserIDWithPagination(req)
+	paginatedInvoices, err := c.invoiceService.ListInvoiceByOrganizationIDWithPagination(req)
 	if err != nil {
 		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
 	}
@@ -164,7 +208,8 @@ func (c *InvoiceController) ListInvoicesByUserID(ctx echo.Context) error {
 }
 
 // @Summary      Update an invoice
-// @Description  Updates an invoice by its ID
+// @Description  Updates an invoice by its ID. The client, sender, currency and payment methods can only be
+// @Description  changed on draft invoices.
 // @Tags         invoices
 // @Accept       json
 // @Produce      json
@@ -174,6 +219,7 @@ func (c *InvoiceController) ListInvoicesByUserID(ctx echo.Context) error {
 // @Success      200     {object}  utils.GenericResponse
 // @Failure      400     {object}  utils.GenericResponse
 // @Failure      404     {object}  utils.GenericResponse
+// @Failure      409     {object}  utils.GenericResponse
 // @Failure      500     {object}  utils.GenericResponse
 // @Router       /v1/protected/invoices/{id} [put]
 func (c *InvoiceController) UpdateInvoice(ctx echo.Context) error {
@@ -191,11 +237,20 @@ func (c *InvoiceController) UpdateInvoice(ctx echo.Context) error {
 		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
 	}
 
-	if err := c.invoiceService.UpdateInvoice(uint(id), &req); err != nil {
+	if err := c.invoiceService.UpdateInvoice(uint(id), ctx.Get("organization_id").(uint), &req); err != nil {
 		if e.Is(err, gorm.ErrRecordNotFound) {
 			return utils.Response(ctx, http.StatusNotFound, err.Error(), nil)
 		}
 
+		if err == errors.ErrInvalidClient || err == errors.ErrInvalidSenderProfile || err == errors.ErrInvalidDateFormat ||
+			err == errors.ErrInvalidPaymentMethod || err == errors.ErrPaymentMethodCurrency {
+			return utils.Response(ctx, http.StatusBadRequest, err.Error(), nil)
+		}
+
+		if err == errors.ErrInvoiceNotDraft || err == errors.ErrClientNotDraft {
+			return utils.Response(ctx, http.StatusConflict, err.Error(), nil)
+		}
+
 		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
 	}
 
@@ -204,30 +259,60 @@ func (c *InvoiceController) UpdateInvoice(ctx echo.Context) error {
 
 // DownloadInvoicePDF godoc
 // @Summary      Download invoice PDF
-// @Description  Generates and downloads the PDF for a given invoice ID
+// @Description  Generates and downloads the PDF for a given invoice ID. Rendered PDFs are cached and
+// @Description  served with an ETag; send it back in If-None-Match to get a 304 when nothing changed.
+// @Description  When the user has uploaded a signing certificate the PDF carries a PAdES signature;
+// @Description  an expired certificate is skipped and the PDF is rendered unsigned.
 // @Tags         invoices
 // @Produce      application/pdf
-// @Param        id   path      int  true  "Invoice ID"
+// @Security     BearerAuth
+// @Param        id             path      int     true   "Invoice ID"
+// @Param        lang           query     string  false  "Render in this language (en, id) instead of the client or user locale"
+// @Param        format         query     string  false  "Output mode: pdf (default) or pdfa3 (PDF/A-3 with embedded Factur-X XML)"
+// @Param        If-None-Match  header    string  false  "ETag of a previously downloaded PDF"
 // @Success      200  {file}    file
+// @Success      304  "Not Modified"
 // @Failure      400  {object}  utils.GenericResponse
 // @Failure      404  {object}  utils.GenericResponse
 // @Failure      500  {object}  utils.GenericResponse
-// @Router       /v1/protectted/invoices/{id}/pdf [post]
+// @Router       /v1/protected/invoices/{id}/pdf [post]
+// @Router       /v1/protected/invoices/{id}/pdf [get]
 func (c *InvoiceController) DownloadInvoicePDF(ctx echo.Context) error {
 	id, err := strconv.Atoi(ctx.Param("id"))
 	if err != nil {
 		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
 	}
 
-	pdfData, err := c.invoiceService.GenerateInvoicePDF(uint(id))
+	pdfData, etag, err := c.invoiceService.GenerateInvoicePDF(dto.InvoicePDFRequest{
+		InvoiceID:      uint(id),
+		OrganizationID: ctx.Get("organization_id").(uint),
+		Locale:         ctx.QueryParam("lang"),
+		Format:         ctx.QueryParam("format"),
+		IfNoneMatch:    ctx.Request().Header.Get("If-None-Match"),
+	})
 	if err != nil {
-		if e.Is(err, errors.ErrNotFound) {
-			return utils.Response(ctx, http.StatusNotFound, err.Error(), nil)
+		if e.Is(err, errors.ErrNotModified) {
+			ctx.Response().Header().Set("ETag", etag)
+			return ctx.NoContent(http.StatusNotModified)
+		}
+
+		if e.Is(err, errors.ErrUnsupportedLocale) || e.Is(err, errors.ErrUnsupportedFormat) {
+			return utils.Response(ctx, http.StatusBadRequest, err.Error(), nil)
+		}
+
+		if e.Is(err, errors.ErrInvalidEInvoice) {
+			return utils.Response(ctx, http.StatusUnprocessableEntity, err.Error(), nil)
+		}
+
+		if e.Is(err, errors.ErrNotFound) || e.Is(err, gorm.ErrRecordNotFound) {
+			return utils.Response(ctx, http.StatusNotFound, errors.ErrNotFound.Error(), nil)
 		}
 
 		return utils.Response(ctx, http.StatusInternalServerError, "Failed to generate PDF", nil)
 	}
 
+	ctx.Response().Header().Set("ETag", etag)
+	ctx.Response().Header().Set("Cache-Control", "private, no-cache")
 	return ctx.Blob(http.StatusOK, "application/pdf", pdfData)
 }
 
@@ -237,6 +322,7 @@ func (c *InvoiceController) DownloadInvoicePDF(ctx echo.Context) error {
 // @Tags         invoices
 // @Produce      application/pdf
 // @Param        invoice body   dto.GeneratePublicInvoiceRequest  true  "Invoice data"
+// @Param        format  query  string  false  "Output mode: pdf (default) or pdfa3 (PDF/A-3 with embedded Factur-X XML)"
 // @Success      200  {file}    file
 // @Failure      400  {object}  utils.GenericResponse
 // @Failure      404  {object}  utils.GenericResponse
@@ -252,8 +338,17 @@ func (c *InvoiceController) GeneratePublicInvoice(ctx echo.Context) error {
 		return utils.Response(ctx, http.StatusBadRequest, err.Error(), nil)
 	}
 
+	req.Format = ctx.QueryParam("format")
 	pdfData, err := c.invoiceService.GeneratePublicInvoicePDF(req)
 	if err != nil {
+		if e.Is(err, errors.ErrUnsupportedFormat) {
+			return utils.Response(ctx, http.StatusBadRequest, err.Error(), nil)
+		}
+
+		if e.Is(err, errors.ErrInvalidEInvoice) {
+			return utils.Response(ctx, http.StatusUnprocessableEntity, err.Error(), nil)
+		}
+
 		return utils.Response(ctx, http.StatusInternalServerError, "Failed to generate PDF", nil)
 	}
 
@@ -279,7 +374,7 @@ func (c *InvoiceController) DeleteInvoice(ctx echo.Context) error {
 		return ctx.JSON(http.StatusBadRequest, echo.Map{"error": "invalid invoice ID"})
 	}
 
-	if err := c.invoiceService.DeleteInvoice(uint(id)); err != nil {
+	if err := c.invoiceService.DeleteInvoice(uint(id), ctx.Get("organization_id").(uint)); err != nil {
 		if e.Is(err, gorm.ErrRecordNotFound) {
 			return utils.Response(ctx, http.StatusNotFound, err.Error(), nil)
 		}
@@ -291,7 +386,10 @@ func (c *InvoiceController) DeleteInvoice(ctx echo.Context) error {
 }
 
 // @Summary      Update invoice status
-// @Description  Updates the status of an invoice by its ID
+// @Description  Updates the status of an invoice (draft, open, paid or past_due). Issued invoices cannot be
+// @Description  moved back to draft. Issuing a draft copies the current sender details and payment methods
+// @Description  onto it. Marking an invoice paid records the outstanding amount as a payment,
+// @Description  which is removed again when the invoice is reopened.
 // @Tags         invoices
 // @Accept       json
 // @Produce      json
@@ -301,6 +399,7 @@ func (c *InvoiceController) DeleteInvoice(ctx echo.Context) error {
 // @Success      200    {object}  utils.GenericResponse
 // @Failure      400    {object}  utils.GenericResponse
 // @Failure      404    {object}  utils.GenericResponse
+// @Failure      409    {object}  utils.GenericResponse
 // @Failure      500    {object}  utils.GenericResponse
 // @Router       /v1/protected/invoices/{id}/status [put]
 
@@ -316,19 +415,108 @@ func (c *InvoiceController) UpdateInvoiceStatus(ctx echo.Context) error {
 		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
 	}
 
-	if err := c.invoiceService.UpdateInvoiceStatus(uint(id), req.Status); err != nil {
+	if err := ctx.Validate(req); err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, err.Error(), nil)
+	}
+
+	if err := c.invoiceService.UpdateInvoiceStatus(uint(id), ctx.Get("organization_id").(uint), req.Status); err != nil {
 		if e.Is(err, gorm.ErrRecordNotFound) {
 			return utils.Response(ctx, http.StatusNotFound, err.Error(), nil)
 		}
 
+		if err == errors.ErrInvoiceIssued || err == errors.ErrInvoiceSettled {
+			return utils.Response(ctx, http.StatusConflict, err.Error(), nil)
+		}
+
 		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
 	}
 
 	return utils.Response(ctx, http.StatusOK, "Invoice status updated successfully", nil)
 }
 
+// @Summary      Refresh sender details
+// @Description  Copies the current details, logo and payment methods of the sender profile (or of the
+// @Description  creator's account for invoices without one) onto a draft invoice. Invoices otherwise keep
+// @Description  the sender details they were created with.
+// @Tags         invoices
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path      int  true  "Invoice ID"
+// @Success      200  {object}  utils.GenericResponse
+// @Failure      400  {object}  utils.GenericResponse
+// @Failure      404  {object}  utils.GenericResponse
+// @Failure      409  {object}  utils.GenericResponse
+// @Failure      500  {object}  utils.GenericResponse
+// @Router       /v1/protected/invoices/{id}/refresh-sender [post]
+func (c *InvoiceController) RefreshSender(ctx echo.Context) error {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
+	}
+
+	invoice, err := c.invoiceService.RefreshSender(uint(id), ctx.Get("organization_id").(uint))
+	if err != nil {
+		if e.Is(err, gorm.ErrRecordNotFound) {
+			return utils.Response(ctx, http.StatusNotFound, errors.ErrNotFound.Error(), nil)
+		}
+
+		if err == errors.ErrInvalidSenderProfile {
+			return utils.Response(ctx, http.StatusBadRequest, err.Error(), nil)
+		}
+
+		if err == errors.ErrInvoiceNotDraft {
+			return utils.Response(ctx, http.StatusConflict, err.Error(), nil)
+		}
+
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	maskInvoicePaymentMethods(invoice)
+	return utils.Response(ctx, http.StatusOK, "Sender details refreshed successfully", invoice)
+}
+
+// @Summary      Refresh client details
+// @Description  Copies the current details of the linked client onto a draft invoice. Invoices otherwise
+// @Description  keep the client details they were created with, also when the client is changed or deleted.
+// @Tags         invoices
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path      int  true  "Invoice ID"
+// @Success      200  {object}  utils.GenericResponse
+// @Failure      400  {object}  utils.GenericResponse
+// @Failure      404  {object}  utils.GenericResponse
+// @Failure      409  {object}  utils.GenericResponse
+// @Failure      500  {object}  utils.GenericResponse
+// @Router       /v1/protected/invoices/{id}/refresh-client [post]
+func (c *InvoiceController) RefreshClient(ctx echo.Context) error {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
+	}
+
+	invoice, err := c.invoiceService.RefreshClient(uint(id), ctx.Get("organization_id").(uint))
+	if err != nil {
+		if e.Is(err, gorm.ErrRecordNotFound) {
+			return utils.Response(ctx, http.StatusNotFound, errors.ErrNotFound.Error(), nil)
+		}
+
+		if err == errors.ErrInvalidClient || err == errors.ErrInvoiceWithoutClient {
+			return utils.Response(ctx, http.StatusBadRequest, err.Error(), nil)
+		}
+
+		if err == errors.ErrClientRefreshNotDraft {
+			return utils.Response(ctx, http.StatusConflict, err.Error(), nil)
+		}
+
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	maskInvoicePaymentMethods(invoice)
+	return utils.Response(ctx, http.StatusOK, "Client details refreshed successfully", invoice)
+}
+
 // @Summary      Get invoice summary
-// @Description  Retrieves a summary of invoices for the authenticated user
+// @Description  Retrieves a summary of invoices in the current organization
 // @Tags         invoices
 // @Accept       json
 // @Produce      json
@@ -337,11 +525,18 @@ func (c *InvoiceController) UpdateInvoiceStatus(ctx echo.Context) error {
 // @Failure      500  {object}  utils.GenericResponse
 // @Router       /v1/protected/invoices/summary [get]
 func (c *InvoiceController) InvoiceSummary(ctx echo.Context) error {
-	userID := ctx.Get("user_id").(uint)
-	summary, err := c.invoiceService.InvoiceSummary(userID)
+	summary, err := c.invoiceService.InvoiceSummary(ctx.Get("organization_id").(uint))
 	if err != nil {
 		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
 	}
 
 	return utils.Response(ctx, http.StatusOK, "Invoice summary retrieved successfully", summary)
 }
+
+// maskInvoicePaymentMethods masks the account details of the payment methods
+// copied onto invoice before it is returned
+func maskInvoicePaymentMethods(invoice *models.Invoice) {
+	for i := range invoice.PaymentMethods {
+		utils.MaskPaymentDetails(&invoice.PaymentMethods[i].PaymentDetails)
+	}
+}
@@ -0,0 +1,115 @@
+package controllers
+
+import (
+	e "errors"
+	"log"
+	"net/http"
+
+	"github.com/hutamy/invoice-generator-backend/dto"
+	"github.com/hutamy/invoice-generator-backend/services"
+	"github.com/hutamy/invoice-generator-backend/utils"
+	"github.com/hutamy/invoice-generator-backend/utils/errors"
+	"github.com/labstack/echo/v4"
+)
+
+type OIDCController struct {
+	oidcService      services.OIDCService
+	tokenService     services.TokenService
+	twoFactorService services.TwoFactorService
+}
+
+func NewOIDCController(
+	oidcService services.OIDCService,
+	tokenService services.TokenService,
+	twoFactorService services.TwoFactorService,
+) *OIDCController {
+	return &OIDCController{
+		oidcService:      oidcService,
+		tokenService:     tokenService,
+		twoFactorService: twoFactorService,
+	}
+}
+
+// @Summary      List Single Sign-On Providers
+// @Description  Names of the configured OpenID Connect providers
+// @Tags         auth
+// @Produce      json
+// @Success      200  {object}  utils.GenericResponse{data=dto.OIDCProvidersResponse}
+// @Router       /v1/public/auth/oidc/providers [get]
+func (c *OIDCController) Providers(ctx echo.Context) error {
+	return utils.Response(ctx, http.StatusOK, "Providers retrieved successfully", dto.OIDCProvidersResponse{
+		Providers: c.oidcService.Providers(),
+	})
+}
+
+// @Summary      Start Single Sign-On
+// @Description  Start an authorization code + PKCE login. Redirect the browser to authorization_url; the provider
+// @Description  returns to the configured redirect URL with code and state, which go to the callback endpoint.
+// @Tags         auth
+// @Produce      json
+// @Param        provider  path      string  true  "Provider name"
+// @Success      200       {object}  utils.GenericResponse{data=dto.OIDCAuthorizeResponse}
+// @Failure      404       {object}  utils.GenericResponse
+// @Failure      429       {object}  utils.GenericResponse
+// @Failure      502       {object}  utils.GenericResponse
+// @Failure      500       {object}  utils.GenericResponse
+// @Router       /v1/public/auth/oidc/{provider}/authorize [post]
+func (c *OIDCController) Authorize(ctx echo.Context) error {
+	res, err := c.oidcService.Authorize(ctx.Request().Context(), ctx.Param("provider"))
+	if err != nil {
+		if err == errors.ErrUnknownProvider {
+			return utils.Response(ctx, http.StatusNotFound, err.Error(), nil)
+		}
+
+		log.Printf("failed to start %s login: %v", ctx.Param("provider"), err)
+		return utils.Response(ctx, http.StatusBadGateway, errors.ErrOIDCLoginFailed.Error(), nil)
+	}
+
+	return utils.Response(ctx, http.StatusOK, "Redirect to the provider to continue", res)
+}
+
+// @Summary      Complete Single Sign-On
+// @Description  Exchange the code returned by the provider. Responds like sign-in: a token pair, or a
+// @Description  two-factor challenge for accounts with two-factor authentication enabled.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        provider  path      string                   true  "Provider name"
+// @Param        body      body      dto.OIDCCallbackRequest  true  "Code and state from the provider redirect"
+// @Success      200       {object}  utils.GenericResponse
+// @Failure      400       {object}  utils.GenericResponse
+// @Failure      401       {object}  utils.GenericResponse
+// @Failure      403       {object}  utils.GenericResponse
+// @Failure      404       {object}  utils.GenericResponse
+// @Failure      429       {object}  utils.GenericResponse
+// @Failure      500       {object}  utils.GenericResponse
+// @Router       /v1/public/auth/oidc/{provider}/callback [post]
+func (c *OIDCController) Callback(ctx echo.Context) error {
+	req := new(dto.OIDCCallbackRequest)
+	if err := ctx.Bind(req); err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
+	}
+
+	if err := ctx.Validate(req); err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, err.Error(), nil)
+	}
+
+	user, err := c.oidcService.Callback(ctx.Request().Context(), ctx.Param("provider"), *req)
+	if err != nil {
+		switch {
+		case err == errors.ErrUnknownProvider:
+			return utils.Response(ctx, http.StatusNotFound, err.Error(), nil)
+		case err == errors.ErrInvalidOIDCState:
+			return utils.Response(ctx, http.StatusBadRequest, err.Error(), nil)
+		case err == errors.ErrOIDCEmailNotVerified:
+			return utils.Response(ctx, http.StatusForbidden, err.Error(), nil)
+		case e.Is(err, errors.ErrOIDCLoginFailed):
+			log.Printf("%s login failed: %v", ctx.Param("provider"), err)
+			return utils.Response(ctx, http.StatusUnauthorized, errors.ErrOIDCLoginFailed.Error(), nil)
+		}
+
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	return completeSignIn(ctx, user, c.tokenService, c.twoFactorService)
+}
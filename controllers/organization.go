@@ -0,0 +1,390 @@
+package controllers
+
+import (
+	e "errors"
+	"net/http"
+	"strconv"
+
+	"github.com/hutamy/invoice-generator-backend/dto"
+	"github.com/hutamy/invoice-generator-backend/services"
+	"github.com/hutamy/invoice-generator-backend/utils"
+	"github.com/hutamy/invoice-generator-backend/utils/errors"
+	"github.com/hutamy/invoice-generator-backend/utils/rbac"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type OrganizationController struct {
+	orgService services.OrganizationService
+}
+
+func NewOrganizationController(orgService services.OrganizationService) *OrganizationController {
+	return &OrganizationController{orgService: orgService}
+}
+
+// @Summary      List organizations
+// @Description  Lists the organizations the authenticated user belongs to, with their role in each. Send an organization's ID in the X-Organization-ID header to work in it; without the header the oldest membership is used.
+// @Tags         organizations
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {object}  utils.GenericResponse{data=[]models.Membership}
+// @Failure      401  {object}  utils.GenericResponse
+// @Failure      500  {object}  utils.GenericResponse
+// @Router       /v1/protected/organizations [get]
+func (c *OrganizationController) ListOrganizations(ctx echo.Context) error {
+	memberships, err := c.orgService.ListOrganizations(ctx.Get("user_id").(uint))
+	if err != nil {
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	return utils.Response(ctx, http.StatusOK, "Organizations retrieved successfully", memberships)
+}
+
+// @Summary      Create organization
+// @Description  Creates an organization owned by the authenticated user
+// @Tags         organizations
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        body  body      dto.CreateOrganizationRequest  true  "Organization name"
+// @Success      201   {object}  utils.GenericResponse{data=models.Organization}
+// @Failure      400   {object}  utils.GenericResponse
+// @Failure      500   {object}  utils.GenericResponse
+// @Router       /v1/protected/organizations [post]
+func (c *OrganizationController) CreateOrganization(ctx echo.Context) error {
+	var req dto.CreateOrganizationRequest
+	if err := ctx.Bind(&req); err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
+	}
+
+	if err := ctx.Validate(req); err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, err.Error(), nil)
+	}
+
+	req.UserID = ctx.Get("user_id").(uint)
+	org, err := c.orgService.CreateOrganization(req)
+	if err != nil {
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	return utils.Response(ctx, http.StatusCreated, "Organization created successfully", org)
+}
+
+// @Summary      Get current organization
+// @Description  Returns the organization selected by X-Organization-ID
+// @Tags         organizations
+// @Produce      json
+// @Security     BearerAuth
+// @Param        X-Organization-ID  header    int  false  "Organization ID"
+// @Success      200  {object}  utils.GenericResponse{data=models.Organization}
+// @Failure      403  {object}  utils.GenericResponse
+// @Failure      500  {object}  utils.GenericResponse
+// @Router       /v1/protected/organization [get]
+func (c *OrganizationController) GetOrganization(ctx echo.Context) error {
+	org, err := c.orgService.GetOrganization(ctx.Get("organization_id").(uint))
+	if err != nil {
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	return utils.Response(ctx, http.StatusOK, "Organization retrieved successfully", org)
+}
+
+// @Summary      Rename current organization
+// @Description  Renames the current organization. Needs the organization:update permission.
+// @Tags         organizations
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        X-Organization-ID  header    int                            false  "Organization ID"
+// @Param        body               body      dto.UpdateOrganizationRequest  true   "Organization name"
+// @Success      200  {object}  utils.GenericResponse{data=models.Organization}
+// @Failure      400  {object}  utils.GenericResponse
+// @Failure      403  {object}  utils.GenericResponse
+// @Failure      500  {object}  utils.GenericResponse
+// @Router       /v1/protected/organization [put]
+func (c *OrganizationController) UpdateOrganization(ctx echo.Context) error {
+	var req dto.UpdateOrganizationRequest
+	if err := ctx.Bind(&req); err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
+	}
+
+	if err := ctx.Validate(req); err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, err.Error(), nil)
+	}
+
+	req.OrganizationID = ctx.Get("organization_id").(uint)
+	org, err := c.orgService.UpdateOrganization(req)
+	if err != nil {
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	return utils.Response(ctx, http.StatusOK, "Organization updated successfully", org)
+}
+
+// @Summary      Get my permissions
+// @Description  Returns the role of the authenticated user in the current organization and the permissions it grants
+// @Tags         organizations
+// @Produce      json
+// @Security     BearerAuth
+// @Param        X-Organization-ID  header    int  false  "Organization ID"
+// @Success      200  {object}  utils.GenericResponse{data=dto.PermissionsResponse}
+// @Failure      403  {object}  utils.GenericResponse
+// @Router       /v1/protected/organization/permissions [get]
+func (c *OrganizationController) Permissions(ctx echo.Context) error {
+	role := ctx.Get("role").(string)
+	return utils.Response(ctx, http.StatusOK, "Permissions retrieved successfully", dto.PermissionsResponse{
+		OrganizationID: ctx.Get("organization_id").(uint),
+		Role:           role,
+		Permissions:    rbac.Permissions(role),
+	})
+}
+
+// @Summary      Leave current organization
+// @Description  Removes the authenticated user from the current organization. The last owner cannot leave, and every user keeps at least one organization.
+// @Tags         organizations
+// @Produce      json
+// @Security     BearerAuth
+// @Param        X-Organization-ID  header    int  false  "Organization ID"
+// @Success      200  {object}  utils.GenericResponse
+// @Failure      409  {object}  utils.GenericResponse
+// @Failure      500  {object}  utils.GenericResponse
+// @Router       /v1/protected/organization/leave [post]
+func (c *OrganizationController) LeaveOrganization(ctx echo.Context) error {
+	err := c.orgService.LeaveOrganization(ctx.Get("organization_id").(uint), ctx.Get("user_id").(uint))
+	if err != nil {
+		if err == errors.ErrLastOwner || err == errors.ErrLastOrganization {
+			return utils.Response(ctx, http.StatusConflict, err.Error(), nil)
+		}
+
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	return utils.Response(ctx, http.StatusOK, "Left organization successfully", nil)
+}
+
+// @Summary      List members
+// @Description  Lists the members of the current organization
+// @Tags         organizations
+// @Produce      json
+// @Security     BearerAuth
+// @Param        X-Organization-ID  header    int  false  "Organization ID"
+// @Success      200  {object}  utils.GenericResponse{data=[]dto.MemberResponse}
+// @Failure      403  {object}  utils.GenericResponse
+// @Failure      500  {object}  utils.GenericResponse
+// @Router       /v1/protected/organization/members [get]
+func (c *OrganizationController) ListMembers(ctx echo.Context) error {
+	members, err := c.orgService.ListMembers(ctx.Get("organization_id").(uint))
+	if err != nil {
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	return utils.Response(ctx, http.StatusOK, "Members retrieved successfully", members)
+}
+
+// @Summary      Change member role
+// @Description  Changes the role of a member. Needs members:manage; granting or taking away the owner role also needs owners:manage.
+// @Tags         organizations
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        X-Organization-ID  header    int                          false  "Organization ID"
+// @Param        user_id            path      int                          true   "User ID of the member"
+// @Param        body               body      dto.UpdateMemberRoleRequest  true   "New role"
+// @Success      200  {object}  utils.GenericResponse
+// @Failure      400  {object}  utils.GenericResponse
+// @Failure      403  {object}  utils.GenericResponse
+// @Failure      404  {object}  utils.GenericResponse
+// @Failure      409  {object}  utils.GenericResponse
+// @Failure      500  {object}  utils.GenericResponse
+// @Router       /v1/protected/organization/members/{user_id} [put]
+func (c *OrganizationController) UpdateMemberRole(ctx echo.Context) error {
+	var req dto.UpdateMemberRoleRequest
+	if err := ctx.Bind(&req); err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
+	}
+
+	if err := ctx.Validate(req); err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, err.Error(), nil)
+	}
+
+	req.OrganizationID = ctx.Get("organization_id").(uint)
+	req.ActorRole = ctx.Get("role").(string)
+	if err := c.orgService.UpdateMemberRole(req); err != nil {
+		return memberError(ctx, err)
+	}
+
+	return utils.Response(ctx, http.StatusOK, "Member role updated successfully", nil)
+}
+
+// @Summary      Remove member
+// @Description  Removes a member from the current organization. Needs members:manage; removing an owner also needs owners:manage.
+// @Tags         organizations
+// @Produce      json
+// @Security     BearerAuth
+// @Param        X-Organization-ID  header    int  false  "Organization ID"
+// @Param        user_id            path      int  true   "User ID of the member"
+// @Success      200  {object}  utils.GenericResponse
+// @Failure      400  {object}  utils.GenericResponse
+// @Failure      403  {object}  utils.GenericResponse
+// @Failure      404  {object}  utils.GenericResponse
+// @Failure      409  {object}  utils.GenericResponse
+// @Failure      500  {object}  utils.GenericResponse
+// @Router       /v1/protected/organization/members/{user_id} [delete]
+func (c *OrganizationController) RemoveMember(ctx echo.Context) error {
+	userID, err := strconv.Atoi(ctx.Param("user_id"))
+	if err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
+	}
+
+	err = c.orgService.RemoveMember(dto.RemoveMemberRequest{
+		UserID:         uint(userID),
+		OrganizationID: ctx.Get("organization_id").(uint),
+		ActorRole:      ctx.Get("role").(string),
+	})
+	if err != nil {
+		return memberError(ctx, err)
+	}
+
+	return utils.Response(ctx, http.StatusOK, "Member removed successfully", nil)
+}
+
+// @Summary      Invite member
+// @Description  Emails an invitation to join the current organization with the given role. Needs members:manage; inviting an owner also needs owners:manage.
+// @Tags         organizations
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        X-Organization-ID  header    int                      false  "Organization ID"
+// @Param        body               body      dto.InviteMemberRequest  true   "Email address and role"
+// @Success      201  {object}  utils.GenericResponse{data=models.Invitation}
+// @Failure      400  {object}  utils.GenericResponse
+// @Failure      403  {object}  utils.GenericResponse
+// @Failure      409  {object}  utils.GenericResponse
+// @Failure      500  {object}  utils.GenericResponse
+// @Router       /v1/protected/organization/invitations [post]
+func (c *OrganizationController) InviteMember(ctx echo.Context) error {
+	var req dto.InviteMemberRequest
+	if err := ctx.Bind(&req); err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
+	}
+
+	if err := ctx.Validate(req); err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, err.Error(), nil)
+	}
+
+	req.OrganizationID = ctx.Get("organization_id").(uint)
+	req.InvitedByID = ctx.Get("user_id").(uint)
+	req.ActorRole = ctx.Get("role").(string)
+	invitation, err := c.orgService.InviteMember(req)
+	if err != nil {
+		return memberError(ctx, err)
+	}
+
+	return utils.Response(ctx, http.StatusCreated, "Invitation sent", invitation)
+}
+
+// @Summary      List invitations
+// @Description  Lists the pending invitations of the current organization. Needs members:manage.
+// @Tags         organizations
+// @Produce      json
+// @Security     BearerAuth
+// @Param        X-Organization-ID  header    int  false  "Organization ID"
+// @Success      200  {object}  utils.GenericResponse{data=[]models.Invitation}
+// @Failure      403  {object}  utils.GenericResponse
+// @Failure      500  {object}  utils.GenericResponse
+// @Router       /v1/protected/organization/invitations [get]
+func (c *OrganizationController) ListInvitations(ctx echo.Context) error {
+	invitations, err := c.orgService.ListInvitations(ctx.Get("organization_id").(uint))
+	if err != nil {
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	return utils.Response(ctx, http.StatusOK, "Invitations retrieved successfully", invitations)
+}
+
+// @Summary      Revoke invitation
+// @Description  Revokes a pending invitation of the current organization. Needs members:manage.
+// @Tags         organizations
+// @Produce      json
+// @Security     BearerAuth
+// @Param        X-Organization-ID  header    int  false  "Organization ID"
+// @Param        id                 path      int  true   "Invitation ID"
+// @Success      200  {object}  utils.GenericResponse
+// @Failure      400  {object}  utils.GenericResponse
+// @Failure      403  {object}  utils.GenericResponse
+// @Failure      404  {object}  utils.GenericResponse
+// @Failure      500  {object}  utils.GenericResponse
+// @Router       /v1/protected/organization/invitations/{id} [delete]
+func (c *OrganizationController) RevokeInvitation(ctx echo.Context) error {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
+	}
+
+	if err := c.orgService.RevokeInvitation(uint(id), ctx.Get("organization_id").(uint)); err != nil {
+		if e.Is(err, gorm.ErrRecordNotFound) {
+			return utils.Response(ctx, http.StatusNotFound, errors.ErrNotFound.Error(), nil)
+		}
+
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	return utils.Response(ctx, http.StatusOK, "Invitation revoked successfully", nil)
+}
+
+// @Summary      Accept invitation
+// @Description  Joins the organization of an emailed invitation. The invitation must have been sent to the authenticated user's email address.
+// @Tags         organizations
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        body  body      dto.AcceptInvitationRequest  true  "Token from the invitation email"
+// @Success      200   {object}  utils.GenericResponse{data=models.Membership}
+// @Failure      400   {object}  utils.GenericResponse
+// @Failure      403   {object}  utils.GenericResponse
+// @Failure      409   {object}  utils.GenericResponse
+// @Failure      500   {object}  utils.GenericResponse
+// @Router       /v1/protected/invitations/accept [post]
+func (c *OrganizationController) AcceptInvitation(ctx echo.Context) error {
+	var req dto.AcceptInvitationRequest
+	if err := ctx.Bind(&req); err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
+	}
+
+	if err := ctx.Validate(req); err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, err.Error(), nil)
+	}
+
+	membership, err := c.orgService.AcceptInvitation(req.Token, ctx.Get("user_id").(uint))
+	if err != nil {
+		if err == errors.ErrInvalidToken {
+			return utils.Response(ctx, http.StatusBadRequest, err.Error(), nil)
+		}
+
+		if err == errors.ErrInvitationEmailMismatch {
+			return utils.Response(ctx, http.StatusForbidden, err.Error(), nil)
+		}
+
+		if err == errors.ErrAlreadyMember {
+			return utils.Response(ctx, http.StatusConflict, err.Error(), nil)
+		}
+
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	return utils.Response(ctx, http.StatusOK, "Invitation accepted", membership)
+}
+
+// memberError maps the errors of member management to responses
+func memberError(ctx echo.Context, err error) error {
+	switch {
+	case e.Is(err, gorm.ErrRecordNotFound):
+		return utils.Response(ctx, http.StatusNotFound, errors.ErrNotFound.Error(), nil)
+	case err == errors.ErrForbidden:
+		return utils.Response(ctx, http.StatusForbidden, err.Error(), nil)
+	case err == errors.ErrLastOwner, err == errors.ErrLastOrganization, err == errors.ErrAlreadyMember:
+		return utils.Response(ctx, http.StatusConflict, err.Error(), nil)
+	default:
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+}
@@ -0,0 +1,127 @@
+package controllers
+
+import (
+	e "errors"
+	"net/http"
+	"strconv"
+
+	"github.com/hutamy/invoice-generator-backend/dto"
+	"github.com/hutamy/invoice-generator-backend/services"
+	"github.com/hutamy/invoice-generator-backend/utils"
+	"github.com/hutamy/invoice-generator-backend/utils/errors"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type PaymentController struct {
+	paymentService services.PaymentService
+}
+
+func NewPaymentController(paymentService services.PaymentService) *PaymentController {
+	return &PaymentController{paymentService: paymentService}
+}
+
+// @Summary      Record a payment
+// @Description  Records a payment received from a client, or a credit granted to it. Payments applied to an
+// @Description  invoice take the invoice currency and mark it paid once it is settled.
+// @Tags         payments
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id       path      int                       true  "Client ID"
+// @Param        payment  body      dto.CreatePaymentRequest  true  "Payment data"
+// @Success      201      {object}  utils.GenericResponse
+// @Failure      400      {object}  utils.GenericResponse
+// @Failure      404      {object}  utils.GenericResponse
+// @Failure      500      {object}  utils.GenericResponse
+// @Router       /v1/protected/clients/{id}/payments [post]
+func (c *PaymentController) RecordPayment(ctx echo.Context) error {
+	var req dto.CreatePaymentRequest
+	if err := ctx.Bind(&req); err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
+	}
+
+	if err := ctx.Validate(req); err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, err.Error(), nil)
+	}
+
+	req.OrganizationID = ctx.Get("organization_id").(uint)
+	payment, err := c.paymentService.RecordPayment(req)
+	if err != nil {
+		if e.Is(err, gorm.ErrRecordNotFound) {
+			return utils.Response(ctx, http.StatusNotFound, errors.ErrNotFound.Error(), nil)
+		}
+
+		if err == errors.ErrInvalidDateFormat || err == errors.ErrInvalidPaymentInvoice || err == errors.ErrPaymentCurrencyMismatch {
+			return utils.Response(ctx, http.StatusBadRequest, err.Error(), nil)
+		}
+
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	return utils.Response(ctx, http.StatusCreated, "Payment recorded successfully", payment)
+}
+
+// @Summary      List payments
+// @Description  Lists the payments and credits of a client, newest first
+// @Tags         payments
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path      int  true  "Client ID"
+// @Success      200  {object}  utils.GenericResponse
+// @Failure      400  {object}  utils.GenericResponse
+// @Failure      404  {object}  utils.GenericResponse
+// @Failure      500  {object}  utils.GenericResponse
+// @Router       /v1/protected/clients/{id}/payments [get]
+func (c *PaymentController) ListPayments(ctx echo.Context) error {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
+	}
+
+	payments, err := c.paymentService.ListPayments(uint(id), ctx.Get("organization_id").(uint))
+	if err != nil {
+		if e.Is(err, gorm.ErrRecordNotFound) {
+			return utils.Response(ctx, http.StatusNotFound, errors.ErrNotFound.Error(), nil)
+		}
+
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	return utils.Response(ctx, http.StatusOK, "Payments retrieved successfully", payments)
+}
+
+// @Summary      Delete payment
+// @Description  Deletes a payment or credit of a client. A paid invoice it was applied to is opened again
+// @Description  when it is no longer settled.
+// @Tags         payments
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id          path      int  true  "Client ID"
+// @Param        payment_id  path      int  true  "Payment ID"
+// @Success      200         {object}  utils.GenericResponse
+// @Failure      400         {object}  utils.GenericResponse
+// @Failure      404         {object}  utils.GenericResponse
+// @Failure      500         {object}  utils.GenericResponse
+// @Router       /v1/protected/clients/{id}/payments/{payment_id} [delete]
+func (c *PaymentController) DeletePayment(ctx echo.Context) error {
+	clientID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
+	}
+
+	id, err := strconv.Atoi(ctx.Param("payment_id"))
+	if err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
+	}
+
+	if err := c.paymentService.DeletePayment(uint(id), uint(clientID), ctx.Get("organization_id").(uint)); err != nil {
+		if e.Is(err, gorm.ErrRecordNotFound) {
+			return utils.Response(ctx, http.StatusNotFound, errors.ErrNotFound.Error(), nil)
+		}
+
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	return utils.Response(ctx, http.StatusOK, "Payment deleted successfully", nil)
+}
@@ -0,0 +1,460 @@
+package controllers
+
+import (
+	e "errors"
+	"net/http"
+	"strconv"
+
+	"github.com/hutamy/invoice-generator-backend/dto"
+	"github.com/hutamy/invoice-generator-backend/models"
+	"github.com/hutamy/invoice-generator-backend/services"
+	"github.com/hutamy/invoice-generator-backend/utils"
+	"github.com/hutamy/invoice-generator-backend/utils/errors"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type SenderProfileController struct {
+	profileService services.SenderProfileService
+}
+
+func NewSenderProfileController(profileService services.SenderProfileService) *SenderProfileController {
+	return &SenderProfileController{profileService: profileService}
+}
+
+// @Summary      Create sender profile
+// @Description  Adds a business entity that invoices of the current organization can be issued from.
+// @Description  The first profile becomes the default.
+// @Tags         sender-profiles
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        profile  body      dto.CreateSenderProfileRequest  true  "Sender profile"
+// @Success      201      {object}  utils.GenericResponse
+// @Failure      400      {object}  utils.GenericResponse
+// @Failure      500      {object}  utils.GenericResponse
+// @Router       /v1/protected/sender-profiles [post]
+func (c *SenderProfileController) CreateSenderProfile(ctx echo.Context) error {
+	var req dto.CreateSenderProfileRequest
+	if err := ctx.Bind(&req); err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
+	}
+
+	if err := ctx.Validate(req); err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, err.Error(), nil)
+	}
+
+	req.OrganizationID = ctx.Get("organization_id").(uint)
+	profile, err := c.profileService.CreateSenderProfile(req)
+	if err != nil {
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	maskPaymentMethods(profile.PaymentMethods)
+	return utils.Response(ctx, http.StatusCreated, "Sender profile created successfully", profile)
+}
+
+// @Summary      List sender profiles
+// @Description  Lists the sender profiles of the current organization, default first
+// @Tags         sender-profiles
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {object}  utils.GenericResponse
+// @Failure      500  {object}  utils.GenericResponse
+// @Router       /v1/protected/sender-profiles [get]
+func (c *SenderProfileController) ListSenderProfiles(ctx echo.Context) error {
+	profiles, err := c.profileService.ListSenderProfiles(ctx.Get("organization_id").(uint))
+	if err != nil {
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	for i := range profiles {
+		maskPaymentMethods(profiles[i].PaymentMethods)
+	}
+
+	return utils.Response(ctx, http.StatusOK, "Sender profiles retrieved successfully", profiles)
+}
+
+// @Summary      Get sender profile
+// @Description  Retrieves a sender profile of the current organization
+// @Tags         sender-profiles
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path      int  true  "Sender profile ID"
+// @Success      200  {object}  utils.GenericResponse
+// @Failure      400  {object}  utils.GenericResponse
+// @Failure      404  {object}  utils.GenericResponse
+// @Failure      500  {object}  utils.GenericResponse
+// @Router       /v1/protected/sender-profiles/{id} [get]
+func (c *SenderProfileController) GetSenderProfile(ctx echo.Context) error {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
+	}
+
+	profile, err := c.profileService.GetSenderProfile(uint(id), ctx.Get("organization_id").(uint))
+	if err != nil {
+		if e.Is(err, gorm.ErrRecordNotFound) {
+			return utils.Response(ctx, http.StatusNotFound, errors.ErrNotFound.Error(), nil)
+		}
+
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	maskPaymentMethods(profile.PaymentMethods)
+	return utils.Response(ctx, http.StatusOK, "Sender profile retrieved successfully", profile)
+}
+
+// @Summary      Update sender profile
+// @Description  Updates a sender profile. Invoices already issued from it keep their details.
+// @Tags         sender-profiles
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id       path      int                             true  "Sender profile ID"
+// @Param        profile  body      dto.UpdateSenderProfileRequest  true  "Sender profile"
+// @Success      200      {object}  utils.GenericResponse
+// @Failure      400      {object}  utils.GenericResponse
+// @Failure      404      {object}  utils.GenericResponse
+// @Failure      500      {object}  utils.GenericResponse
+// @Router       /v1/protected/sender-profiles/{id} [put]
+func (c *SenderProfileController) UpdateSenderProfile(ctx echo.Context) error {
+	var req dto.UpdateSenderProfileRequest
+	if err := ctx.Bind(&req); err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
+	}
+
+	if err := ctx.Validate(req); err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, err.Error(), nil)
+	}
+
+	req.OrganizationID = ctx.Get("organization_id").(uint)
+	profile, err := c.profileService.UpdateSenderProfile(req)
+	if err != nil {
+		if e.Is(err, gorm.ErrRecordNotFound) {
+			return utils.Response(ctx, http.StatusNotFound, errors.ErrNotFound.Error(), nil)
+		}
+
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	maskPaymentMethods(profile.PaymentMethods)
+	return utils.Response(ctx, http.StatusOK, "Sender profile updated successfully", profile)
+}
+
+// @Summary      Delete sender profile
+// @Description  Deletes a sender profile. Invoices issued from it keep their details.
+// @Tags         sender-profiles
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path      int  true  "Sender profile ID"
+// @Success      200  {object}  utils.GenericResponse
+// @Failure      400  {object}  utils.GenericResponse
+// @Failure      404  {object}  utils.GenericResponse
+// @Failure      500  {object}  utils.GenericResponse
+// @Router       /v1/protected/sender-profiles/{id} [delete]
+func (c *SenderProfileController) DeleteSenderProfile(ctx echo.Context) error {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
+	}
+
+	if err := c.profileService.DeleteSenderProfile(uint(id), ctx.Get("organization_id").(uint)); err != nil {
+		if e.Is(err, gorm.ErrRecordNotFound) {
+			return utils.Response(ctx, http.StatusNotFound, errors.ErrNotFound.Error(), nil)
+		}
+
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	return utils.Response(ctx, http.StatusOK, "Sender profile deleted successfully", nil)
+}
+
+// @Summary      Upload sender logo
+// @Description  Sets the logo printed on invoices issued from the profile (PNG or JPEG, at most 1 MiB)
+// @Tags         sender-profiles
+// @Accept       multipart/form-data
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id    path      int   true  "Sender profile ID"
+// @Param        logo  formData  file  true  "Logo image"
+// @Success      200  {object}  utils.GenericResponse
+// @Failure      400  {object}  utils.GenericResponse
+// @Failure      404  {object}  utils.GenericResponse
+// @Failure      500  {object}  utils.GenericResponse
+// @Router       /v1/protected/sender-profiles/{id}/logo [post]
+func (c *SenderProfileController) UploadLogo(ctx echo.Context) error {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
+	}
+
+	data, err := readFormFile(ctx, "logo")
+	if err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
+	}
+
+	profile, err := c.profileService.UploadLogo(dto.UploadLogoRequest{
+		SenderProfileID: uint(id),
+		OrganizationID:  ctx.Get("organization_id").(uint),
+		Data:            data,
+	})
+	if err != nil {
+		if e.Is(err, gorm.ErrRecordNotFound) {
+			return utils.Response(ctx, http.StatusNotFound, errors.ErrNotFound.Error(), nil)
+		}
+
+		if err == errors.ErrUnsupportedLogo {
+			return utils.Response(ctx, http.StatusBadRequest, err.Error(), nil)
+		}
+
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	maskPaymentMethods(profile.PaymentMethods)
+	return utils.Response(ctx, http.StatusOK, "Logo uploaded successfully", profile)
+}
+
+// @Summary      Get sender logo
+// @Description  Returns the current logo image of the profile
+// @Tags         sender-profiles
+// @Produce      image/png
+// @Produce      image/jpeg
+// @Security     BearerAuth
+// @Param        id   path      int  true  "Sender profile ID"
+// @Success      200  {file}    file
+// @Failure      400  {object}  utils.GenericResponse
+// @Failure      404  {object}  utils.GenericResponse
+// @Failure      500  {object}  utils.GenericResponse
+// @Router       /v1/protected/sender-profiles/{id}/logo [get]
+func (c *SenderProfileController) GetLogo(ctx echo.Context) error {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
+	}
+
+	logo, err := c.profileService.GetLogo(uint(id), ctx.Get("organization_id").(uint))
+	if err != nil {
+		if e.Is(err, gorm.ErrRecordNotFound) {
+			return utils.Response(ctx, http.StatusNotFound, errors.ErrNotFound.Error(), nil)
+		}
+
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	return ctx.Blob(http.StatusOK, logo.ContentType, logo.Data)
+}
+
+// @Summary      Remove sender logo
+// @Description  Stops printing a logo on new invoices of the profile. Issued invoices keep theirs.
+// @Tags         sender-profiles
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path      int  true  "Sender profile ID"
+// @Success      200  {object}  utils.GenericResponse
+// @Failure      400  {object}  utils.GenericResponse
+// @Failure      404  {object}  utils.GenericResponse
+// @Failure      500  {object}  utils.GenericResponse
+// @Router       /v1/protected/sender-profiles/{id}/logo [delete]
+func (c *SenderProfileController) DeleteLogo(ctx echo.Context) error {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
+	}
+
+	if err := c.profileService.DeleteLogo(uint(id), ctx.Get("organization_id").(uint)); err != nil {
+		if e.Is(err, gorm.ErrRecordNotFound) {
+			return utils.Response(ctx, http.StatusNotFound, errors.ErrNotFound.Error(), nil)
+		}
+
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	return utils.Response(ctx, http.StatusOK, "Logo removed successfully", nil)
+}
+
+// @Summary      List payment methods
+// @Description  Lists the payment methods of a sender profile. Account numbers, IBANs and wallet IDs are
+// @Description  masked to their last four characters, see the reveal endpoint for the full details.
+// @Tags         sender-profiles
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path      int  true  "Sender profile ID"
+// @Success      200  {object}  utils.GenericResponse
+// @Failure      400  {object}  utils.GenericResponse
+// @Failure      404  {object}  utils.GenericResponse
+// @Failure      500  {object}  utils.GenericResponse
+// @Router       /v1/protected/sender-profiles/{id}/payment-methods [get]
+func (c *SenderProfileController) ListPaymentMethods(ctx echo.Context) error {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
+	}
+
+	methods, err := c.profileService.ListPaymentMethods(uint(id), ctx.Get("organization_id").(uint))
+	if err != nil {
+		if e.Is(err, gorm.ErrRecordNotFound) {
+			return utils.Response(ctx, http.StatusNotFound, errors.ErrNotFound.Error(), nil)
+		}
+
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	maskPaymentMethods(methods)
+	return utils.Response(ctx, http.StatusOK, "Payment methods retrieved successfully", methods)
+}
+
+// @Summary      Add payment method
+// @Description  Adds a bank transfer, IBAN, e-wallet or free-text payment method to a sender profile.
+// @Description  Methods with a currency are only printed on invoices in that currency.
+// @Tags         sender-profiles
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id      path      int                       true  "Sender profile ID"
+// @Param        method  body      dto.PaymentMethodRequest  true  "Payment method"
+// @Success      201     {object}  utils.GenericResponse
+// @Failure      400     {object}  utils.GenericResponse
+// @Failure      404     {object}  utils.GenericResponse
+// @Failure      500     {object}  utils.GenericResponse
+// @Router       /v1/protected/sender-profiles/{id}/payment-methods [post]
+func (c *SenderProfileController) CreatePaymentMethod(ctx echo.Context) error {
+	var req dto.CreatePaymentMethodRequest
+	if err := ctx.Bind(&req); err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
+	}
+
+	if err := ctx.Validate(req); err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, err.Error(), nil)
+	}
+
+	req.OrganizationID = ctx.Get("organization_id").(uint)
+	method, err := c.profileService.CreatePaymentMethod(req)
+	if err != nil {
+		if e.Is(err, gorm.ErrRecordNotFound) {
+			return utils.Response(ctx, http.StatusNotFound, errors.ErrNotFound.Error(), nil)
+		}
+
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	utils.MaskPaymentDetails(&method.PaymentDetails)
+	return utils.Response(ctx, http.StatusCreated, "Payment method created successfully", method)
+}
+
+// @Summary      Reveal payment method
+// @Description  Retrieves a payment method of a sender profile with its full account number, IBAN and wallet ID
+// @Tags         sender-profiles
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id         path      int  true  "Sender profile ID"
+// @Param        method_id  path      int  true  "Payment method ID"
+// @Success      200        {object}  utils.GenericResponse
+// @Failure      400        {object}  utils.GenericResponse
+// @Failure      403        {object}  utils.GenericResponse
+// @Failure      404        {object}  utils.GenericResponse
+// @Failure      500        {object}  utils.GenericResponse
+// @Router       /v1/protected/sender-profiles/{id}/payment-methods/{method_id}/reveal [get]
+func (c *SenderProfileController) RevealPaymentMethod(ctx echo.Context) error {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
+	}
+
+	methodID, err := strconv.Atoi(ctx.Param("method_id"))
+	if err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
+	}
+
+	method, err := c.profileService.GetPaymentMethod(uint(methodID), uint(id), ctx.Get("organization_id").(uint))
+	if err != nil {
+		if e.Is(err, gorm.ErrRecordNotFound) {
+			return utils.Response(ctx, http.StatusNotFound, errors.ErrNotFound.Error(), nil)
+		}
+
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	return utils.Response(ctx, http.StatusOK, "Payment method retrieved successfully", method)
+}
+
+// @Summary      Update payment method
+// @Description  Replaces a payment method of a sender profile. Invoices already issued keep their copy.
+// @Description  An account number, IBAN or wallet ID sent back masked as it was returned is kept unchanged.
+// @Tags         sender-profiles
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id         path      int                       true  "Sender profile ID"
+// @Param        method_id  path      int                       true  "Payment method ID"
+// @Param        method     body      dto.PaymentMethodRequest  true  "Payment method"
+// @Success      200        {object}  utils.GenericResponse
+// @Failure      400        {object}  utils.GenericResponse
+// @Failure      404        {object}  utils.GenericResponse
+// @Failure      500        {object}  utils.GenericResponse
+// @Router       /v1/protected/sender-profiles/{id}/payment-methods/{method_id} [put]
+func (c *SenderProfileController) UpdatePaymentMethod(ctx echo.Context) error {
+	var req dto.UpdatePaymentMethodRequest
+	if err := ctx.Bind(&req); err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
+	}
+
+	if err := ctx.Validate(req); err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, err.Error(), nil)
+	}
+
+	req.OrganizationID = ctx.Get("organization_id").(uint)
+	method, err := c.profileService.UpdatePaymentMethod(req)
+	if err != nil {
+		if e.Is(err, gorm.ErrRecordNotFound) {
+			return utils.Response(ctx, http.StatusNotFound, errors.ErrNotFound.Error(), nil)
+		}
+
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	utils.MaskPaymentDetails(&method.PaymentDetails)
+	return utils.Response(ctx, http.StatusOK, "Payment method updated successfully", method)
+}
+
+// @Summary      Delete payment method
+// @Description  Removes a payment method from a sender profile. Invoices already issued keep their copy.
+// @Tags         sender-profiles
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id         path      int  true  "Sender profile ID"
+// @Param        method_id  path      int  true  "Payment method ID"
+// @Success      200        {object}  utils.GenericResponse
+// @Failure      400        {object}  utils.GenericResponse
+// @Failure      404        {object}  utils.GenericResponse
+// @Failure      500        {object}  utils.GenericResponse
+// @Router       /v1/protected/sender-profiles/{id}/payment-methods/{method_id} [delete]
+func (c *SenderProfileController) DeletePaymentMethod(ctx echo.Context) error {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
+	}
+
+	methodID, err := strconv.Atoi(ctx.Param("method_id"))
+	if err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
+	}
+
+	if err := c.profileService.DeletePaymentMethod(uint(methodID), uint(id), ctx.Get("organization_id").(uint)); err != nil {
+		if e.Is(err, gorm.ErrRecordNotFound) {
+			return utils.Response(ctx, http.StatusNotFound, errors.ErrNotFound.Error(), nil)
+		}
+
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	return utils.Response(ctx, http.StatusOK, "Payment method deleted successfully", nil)
+}
+
+// maskPaymentMethods masks the account details of methods before they are
+// returned. Only the reveal endpoint returns them in full.
+func maskPaymentMethods(methods []models.PaymentMethod) {
+	for i := range methods {
+		utils.MaskPaymentDetails(&methods[i].PaymentDetails)
+	}
+}
@@ -0,0 +1,69 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/hutamy/invoice-generator-backend/services"
+	"github.com/hutamy/invoice-generator-backend/utils"
+	"github.com/hutamy/invoice-generator-backend/utils/errors"
+	"github.com/labstack/echo/v4"
+)
+
+type SessionController struct {
+	tokenService services.TokenService
+}
+
+func NewSessionController(tokenService services.TokenService) *SessionController {
+	return &SessionController{tokenService: tokenService}
+}
+
+// @Summary      List Sessions
+// @Description  Devices the user is signed in on, most recently active first
+// @Tags         sessions
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {object}  utils.GenericResponse{data=[]dto.SessionResponse}
+// @Failure      401  {object}  utils.GenericResponse
+// @Failure      500  {object}  utils.GenericResponse
+// @Router       /v1/protected/sessions [get]
+func (c *SessionController) ListSessions(ctx echo.Context) error {
+	userID := ctx.Get("user_id").(uint)
+	sessionID, _ := ctx.Get("session_id").(string)
+	sessions, err := c.tokenService.ListSessions(userID, sessionID)
+	if err != nil {
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	return utils.Response(ctx, http.StatusOK, "Sessions retrieved successfully", sessions)
+}
+
+// @Summary      Revoke Session
+// @Description  Sign a device out. Its refresh token stops working and its access tokens are rejected.
+// @Tags         sessions
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path      int  true  "Session ID"
+// @Success      200  {object}  utils.GenericResponse
+// @Failure      400  {object}  utils.GenericResponse
+// @Failure      401  {object}  utils.GenericResponse
+// @Failure      404  {object}  utils.GenericResponse
+// @Failure      500  {object}  utils.GenericResponse
+// @Router       /v1/protected/sessions/{id} [delete]
+func (c *SessionController) RevokeSession(ctx echo.Context) error {
+	userID := ctx.Get("user_id").(uint)
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
+	}
+
+	if err := c.tokenService.RevokeSession(uint(id), userID); err != nil {
+		if err == errors.ErrNotFound {
+			return utils.Response(ctx, http.StatusNotFound, err.Error(), nil)
+		}
+
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	return utils.Response(ctx, http.StatusOK, "Session revoked successfully", nil)
+}
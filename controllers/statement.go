@@ -0,0 +1,105 @@
+package controllers
+
+import (
+	e "errors"
+	"net/http"
+
+	"github.com/hutamy/invoice-generator-backend/dto"
+	"github.com/hutamy/invoice-generator-backend/services"
+	"github.com/hutamy/invoice-generator-backend/utils"
+	"github.com/hutamy/invoice-generator-backend/utils/errors"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type StatementController struct {
+	statementService services.StatementService
+}
+
+func NewStatementController(statementService services.StatementService) *StatementController {
+	return &StatementController{statementService: statementService}
+}
+
+// @Summary      Get client statement
+// @Description  Lists the issued invoices, payments and credits of a client between from and to with a running
+// @Description  balance, the opening and closing balance and the aging of what is outstanding on the to date.
+// @Tags         clients
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id        path      int     true   "Client ID"
+// @Param        from      query     string  false  "Start date (YYYY-MM-DD), defaults to the first day of the month of to"
+// @Param        to        query     string  false  "End date (YYYY-MM-DD), defaults to today"
+// @Param        currency  query     string  false  "Currency of the statement, defaults to the client currency"
+// @Success      200       {object}  utils.GenericResponse
+// @Failure      400       {object}  utils.GenericResponse
+// @Failure      404       {object}  utils.GenericResponse
+// @Failure      500       {object}  utils.GenericResponse
+// @Router       /v1/protected/clients/{id}/statement [get]
+func (c *StatementController) GetStatement(ctx echo.Context) error {
+	req, err := bindStatementRequest(ctx)
+	if err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, err.Error(), nil)
+	}
+
+	statement, err := c.statementService.GetStatement(req)
+	if err != nil {
+		return statementError(ctx, err)
+	}
+
+	return utils.Response(ctx, http.StatusOK, "Statement retrieved successfully", statement)
+}
+
+// @Summary      Download client statement PDF
+// @Description  Renders the client statement as a PDF, issued by the default sender profile
+// @Tags         clients
+// @Produce      application/pdf
+// @Security     BearerAuth
+// @Param        id        path      int     true   "Client ID"
+// @Param        from      query     string  false  "Start date (YYYY-MM-DD), defaults to the first day of the month of to"
+// @Param        to        query     string  false  "End date (YYYY-MM-DD), defaults to today"
+// @Param        currency  query     string  false  "Currency of the statement, defaults to the client currency"
+// @Param        lang      query     string  false  "Render in this language (en, id) instead of the client locale"
+// @Success      200       {file}    file
+// @Failure      400       {object}  utils.GenericResponse
+// @Failure      404       {object}  utils.GenericResponse
+// @Failure      500       {object}  utils.GenericResponse
+// @Router       /v1/protected/clients/{id}/statement/pdf [get]
+func (c *StatementController) DownloadStatementPDF(ctx echo.Context) error {
+	req, err := bindStatementRequest(ctx)
+	if err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, err.Error(), nil)
+	}
+
+	pdfData, err := c.statementService.GenerateStatementPDF(req)
+	if err != nil {
+		return statementError(ctx, err)
+	}
+
+	return ctx.Blob(http.StatusOK, "application/pdf", pdfData)
+}
+
+func bindStatementRequest(ctx echo.Context) (dto.StatementRequest, error) {
+	var req dto.StatementRequest
+	if err := ctx.Bind(&req); err != nil {
+		return req, errors.ErrBadRequest
+	}
+
+	if err := ctx.Validate(req); err != nil {
+		return req, err
+	}
+
+	req.OrganizationID = ctx.Get("organization_id").(uint)
+	return req, nil
+}
+
+func statementError(ctx echo.Context, err error) error {
+	if e.Is(err, gorm.ErrRecordNotFound) {
+		return utils.Response(ctx, http.StatusNotFound, errors.ErrNotFound.Error(), nil)
+	}
+
+	if err == errors.ErrInvalidDateFormat || err == errors.ErrInvalidDateRange || err == errors.ErrUnsupportedLocale {
+		return utils.Response(ctx, http.StatusBadRequest, err.Error(), nil)
+	}
+
+	return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+}
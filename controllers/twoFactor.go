@@ -0,0 +1,187 @@
+package controllers
+
+import (
+	"net/http"
+
+	e "errors"
+
+	"github.com/hutamy/invoice-generator-backend/dto"
+	"github.com/hutamy/invoice-generator-backend/services"
+	"github.com/hutamy/invoice-generator-backend/utils"
+	"github.com/hutamy/invoice-generator-backend/utils/errors"
+	"github.com/hutamy/invoice-generator-backend/utils/ratelimit"
+	"github.com/labstack/echo/v4"
+)
+
+type TwoFactorController struct {
+	twoFactorService services.TwoFactorService
+}
+
+func NewTwoFactorController(twoFactorService services.TwoFactorService) *TwoFactorController {
+	return &TwoFactorController{twoFactorService: twoFactorService}
+}
+
+// @Summary      Enroll Two-Factor Authentication
+// @Description  Create a TOTP secret. Show the otpauth URI as a QR code, then confirm with a code from the app.
+// @Tags         two-factor
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200   {object}  utils.GenericResponse{data=dto.TwoFactorEnrollResponse}
+// @Failure      401   {object}  utils.GenericResponse
+// @Failure      409   {object}  utils.GenericResponse
+// @Failure      500   {object}  utils.GenericResponse
+// @Router       /v1/protected/2fa/enroll [post]
+func (c *TwoFactorController) Enroll(ctx echo.Context) error {
+	userID, ok := ctx.Get("user_id").(uint)
+	if !ok {
+		return utils.Response(ctx, http.StatusUnauthorized, errors.ErrUnauthorized.Error(), nil)
+	}
+
+	enrollment, err := c.twoFactorService.Enroll(userID)
+	if err != nil {
+		if err == errors.ErrTwoFactorAlreadyEnabled {
+			return utils.Response(ctx, http.StatusConflict, err.Error(), nil)
+		}
+
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	return utils.Response(ctx, http.StatusOK, "Two-factor enrollment started", enrollment)
+}
+
+// @Summary      Confirm Two-Factor Authentication
+// @Description  Enable two-factor authentication with a code from the authenticator app. Returns the recovery codes once.
+// @Tags         two-factor
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        body  body      dto.TwoFactorCodeRequest  true  "TOTP code"
+// @Success      200   {object}  utils.GenericResponse{data=dto.RecoveryCodesResponse}
+// @Failure      400   {object}  utils.GenericResponse
+// @Failure      401   {object}  utils.GenericResponse
+// @Failure      409   {object}  utils.GenericResponse
+// @Failure      500   {object}  utils.GenericResponse
+// @Router       /v1/protected/2fa/confirm [post]
+func (c *TwoFactorController) Confirm(ctx echo.Context) error {
+	req := new(dto.TwoFactorCodeRequest)
+	if err := ctx.Bind(req); err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
+	}
+
+	if err := ctx.Validate(req); err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, err.Error(), nil)
+	}
+
+	userID, ok := ctx.Get("user_id").(uint)
+	if !ok {
+		return utils.Response(ctx, http.StatusUnauthorized, errors.ErrUnauthorized.Error(), nil)
+	}
+
+	codes, err := c.twoFactorService.Confirm(userID, req.Code)
+	if err != nil {
+		if err == errors.ErrTwoFactorAlreadyEnabled {
+			return utils.Response(ctx, http.StatusConflict, err.Error(), nil)
+		}
+
+		if err == errors.ErrInvalidTwoFactorCode || err == errors.ErrTwoFactorNotEnabled {
+			return utils.Response(ctx, http.StatusBadRequest, err.Error(), nil)
+		}
+
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	return utils.Response(ctx, http.StatusOK, "Two-factor authentication enabled", dto.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// @Summary      Disable Two-Factor Authentication
+// @Description  Turn off two-factor authentication with the password and a TOTP or recovery code
+// @Tags         two-factor
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        body  body      dto.DisableTwoFactorRequest  true  "Password and code"
+// @Success      200   {object}  utils.GenericResponse
+// @Failure      400   {object}  utils.GenericResponse
+// @Failure      401   {object}  utils.GenericResponse
+// @Failure      403   {object}  utils.GenericResponse
+// @Failure      500   {object}  utils.GenericResponse
+// @Router       /v1/protected/2fa/disable [post]
+func (c *TwoFactorController) Disable(ctx echo.Context) error {
+	req := new(dto.DisableTwoFactorRequest)
+	if err := ctx.Bind(req); err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
+	}
+
+	if err := ctx.Validate(req); err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, err.Error(), nil)
+	}
+
+	userID, ok := ctx.Get("user_id").(uint)
+	if !ok {
+		return utils.Response(ctx, http.StatusUnauthorized, errors.ErrUnauthorized.Error(), nil)
+	}
+
+	req.UserID = userID
+	if err := c.twoFactorService.Disable(*req); err != nil {
+		var limitErr *ratelimit.LimitError
+		if e.As(err, &limitErr) {
+			return utils.TooManyRequests(ctx, limitErr.RetryAfter)
+		}
+
+		if err == errors.ErrInvalidPassword {
+			return utils.Response(ctx, http.StatusForbidden, err.Error(), nil)
+		}
+
+		if err == errors.ErrInvalidTwoFactorCode || err == errors.ErrTwoFactorNotEnabled {
+			return utils.Response(ctx, http.StatusBadRequest, err.Error(), nil)
+		}
+
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	return utils.Response(ctx, http.StatusOK, "Two-factor authentication disabled", nil)
+}
+
+// @Summary      Regenerate Recovery Codes
+// @Description  Replace all recovery codes. The previous codes stop working.
+// @Tags         two-factor
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        body  body      dto.TwoFactorCodeRequest  true  "TOTP or recovery code"
+// @Success      200   {object}  utils.GenericResponse{data=dto.RecoveryCodesResponse}
+// @Failure      400   {object}  utils.GenericResponse
+// @Failure      401   {object}  utils.GenericResponse
+// @Failure      500   {object}  utils.GenericResponse
+// @Router       /v1/protected/2fa/recovery-codes [post]
+func (c *TwoFactorController) RegenerateRecoveryCodes(ctx echo.Context) error {
+	req := new(dto.TwoFactorCodeRequest)
+	if err := ctx.Bind(req); err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, errors.ErrBadRequest.Error(), nil)
+	}
+
+	if err := ctx.Validate(req); err != nil {
+		return utils.Response(ctx, http.StatusBadRequest, err.Error(), nil)
+	}
+
+	userID, ok := ctx.Get("user_id").(uint)
+	if !ok {
+		return utils.Response(ctx, http.StatusUnauthorized, errors.ErrUnauthorized.Error(), nil)
+	}
+
+	codes, err := c.twoFactorService.RegenerateRecoveryCodes(userID, req.Code)
+	if err != nil {
+		var limitErr *ratelimit.LimitError
+		if e.As(err, &limitErr) {
+			return utils.TooManyRequests(ctx, limitErr.RetryAfter)
+		}
+
+		if err == errors.ErrInvalidTwoFactorCode || err == errors.ErrTwoFactorNotEnabled {
+			return utils.Response(ctx, http.StatusBadRequest, err.Error(), nil)
+		}
+
+		return utils.Response(ctx, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	return utils.Response(ctx, http.StatusOK, "Recovery codes regenerated", dto.RecoveryCodesResponse{RecoveryCodes: codes})
+}
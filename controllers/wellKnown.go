@@ -0,0 +1,25 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/hutamy/invoice-generator-backend/utils"
+	"github.com/labstack/echo/v4"
+)
+
+type WellKnownController struct{}
+
+func NewWellKnownController() *WellKnownController {
+	return &WellKnownController{}
+}
+
+// @Summary      JSON Web Key Set
+// @Description  Public keys for verifying access tokens issued by this service, selected by the token's kid header
+// @Tags         auth
+// @Produce      json
+// @Success      200  {object}  utils.JWKSet
+// @Router       /.well-known/jwks.json [get]
+func (c *WellKnownController) JWKS(ctx echo.Context) error {
+	ctx.Response().Header().Set("Cache-Control", "public, max-age=300")
+	return ctx.JSON(http.StatusOK, utils.PublicJWKS())
+}
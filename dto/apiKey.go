@@ -0,0 +1,17 @@
+package dto
+
+import (
+	"github.com/hutamy/invoice-generator-backend/models"
+)
+
+type CreateAPIKeyRequest struct {
+	Name      string   `json:"name" validate:"required,max=100"`
+	Scopes    []string `json:"scopes" validate:"required,min=1,dive,oneof=invoices:read invoices:write clients:read clients:write clients:*"`
+	ExpiresAt string   `json:"expires_at" validate:"omitempty,datetime=2006-01-02"` // optional, the key never expires when empty
+	UserID    uint     `json:"-"`
+}
+
+type CreateAPIKeyResponse struct {
+	models.APIKey
+	Key string `json:"key"` // shown only once
+}
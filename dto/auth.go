@@ -9,6 +9,7 @@ type SignUpRequest struct {
 	BankName          string `json:"bank_name" binding:"required"`
 	BankAccountName   string `json:"bank_account_name" binding:"required"`
 	BankAccountNumber string `json:"bank_account_number" binding:"required,numeric,gt=0"`
+	Locale            string `json:"locale" validate:"omitempty,oneof=en id"`
 }
 
 type SignInRequest struct {
@@ -24,9 +25,82 @@ type UpdateUserRequest struct {
 	BankName          *string `json:"bank_name"`
 	BankAccountName   *string `json:"bank_account_name"`
 	BankAccountNumber *string `json:"bank_account_number" validate:"omitempty,numeric,gt=0"` // Validate bank account number format (numeric and > 0)
-	UserID            uint    `json:"-"`                                                     // This field is used internally to identify the user being updated
+	Locale            *string `json:"locale" validate:"omitempty,oneof=en id"`
+	UserID            uint    `json:"-"` // This field is used internally to identify the user being updated
+}
+
+type ChangeEmailRequest struct {
+	NewEmail        string `json:"new_email" validate:"required,email"`
+	CurrentPassword string `json:"current_password" validate:"required"`
+	UserID          uint   `json:"-"`
 }
 
 type RefreshTokenRequest struct {
-	RefreshToken string `json:"refresh_token" binding:"required"`
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"` // access token lifetime in seconds
+}
+
+type EmailRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type ConfirmEmailChangeRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=8"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required,min=8"`
+	UserID          uint   `json:"-"`
+}
+
+type TwoFactorEnrollResponse struct {
+	Secret     string `json:"secret"`      // base32, for manual entry
+	OtpauthURI string `json:"otpauth_uri"` // encode as QR code for authenticator apps
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+type DisableTwoFactorRequest struct {
+	Password string `json:"password" validate:"required"`
+	Code     string `json:"code" validate:"required"` // TOTP or recovery code
+	UserID   uint   `json:"-"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type TwoFactorChallengeResponse struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	ChallengeToken    string `json:"challenge_token"`
+	ExpiresIn         int    `json:"expires_in"`
+}
+
+type TwoFactorSignInRequest struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	Code           string `json:"code" validate:"required"` // TOTP or recovery code
+}
+
+// ClientInfo describes the device a sign-in or token refresh came from
+type ClientInfo struct {
+	UserAgent string
+	IPAddress string
 }
@@ -0,0 +1,17 @@
+package dto
+
+type UploadCertificateRequest struct {
+	OrganizationID uint   `json:"-"`
+	UserID         uint   `json:"-"`
+	Data           []byte `json:"-"`
+	Password       string `json:"password"`
+}
+
+type VerifySignatureResponse struct {
+	Valid               bool   `json:"valid"`
+	Signer              string `json:"signer"`
+	Issuer              string `json:"issuer"`
+	SerialNumber        string `json:"serial_number"`
+	MatchesCertificate  bool   `json:"matches_certificate"`
+	CoversWholeDocument bool   `json:"covers_whole_document"`
+}
@@ -1,20 +1,59 @@
 package dto
 
+import "github.com/hutamy/invoice-generator-backend/models"
+
+type PostalAddressRequest struct {
+	Line1      string `json:"line1"`
+	Line2      string `json:"line2"`
+	City       string `json:"city"`
+	Region     string `json:"region"`
+	PostalCode string `json:"postal_code"`
+	Country    string `json:"country" validate:"omitempty,iso3166_1_alpha2"`
+}
+
+type ClientContactRequest struct {
+	Name  string `json:"name" validate:"required"`
+	Role  string `json:"role" validate:"required,oneof=primary billing technical other"`
+	Email string `json:"email" validate:"omitempty,email"`
+	Phone string `json:"phone"`
+}
+
 type CreateClientRequest struct {
-	Name    string `json:"name" validate:"required"`
-	Email   string `json:"email" validate:"required,email"`
-	Address string `json:"address" validate:"required"`
-	Phone   string `json:"phone" validate:"required"`
-	UserID  uint   `json:"-"`
+	Name            string                 `json:"name" validate:"required"`
+	Email           string                 `json:"email" validate:"required,email"`
+	Address         string                 `json:"address" validate:"required_without=BillingAddress.Line1"`
+	BillingAddress  PostalAddressRequest   `json:"billing_address"`
+	Phone           string                 `json:"phone" validate:"required"`
+	TaxID           string                 `json:"tax_id"`
+	CCEmails        []string               `json:"cc_emails" validate:"omitempty,dive,email"`
+	BCCEmails       []string               `json:"bcc_emails" validate:"omitempty,dive,email"`
+	Currency        string                 `json:"currency" validate:"omitempty,iso4217"`
+	Locale          string                 `json:"locale" validate:"omitempty,oneof=en id"`
+	PaymentTermDays int                    `json:"payment_term_days" validate:"min=0,max=365"`
+	Contacts        []ClientContactRequest `json:"contacts" validate:"omitempty,dive"`
+
+	OrganizationID uint `json:"-"`
+	UserID         uint `json:"-"`
 }
 
+// UpdateClientRequest changes the fields it sets. BillingAddress and Contacts
+// replace the current address and contacts as a whole.
 type UpdateClientRequest struct {
-	Name    *string `json:"name" validate:"omitempty"`
-	Email   *string `json:"email" validate:"omitempty,email"`
-	Address *string `json:"address" validate:"omitempty"`
-	Phone   *string `json:"phone" validate:"omitempty"`
-	ID      uint    `param:"id" validate:"required"`
-	UserID  uint    `json:"-"`
+	Name            *string                 `json:"name" validate:"omitempty"`
+	Email           *string                 `json:"email" validate:"omitempty,email"`
+	Address         *string                 `json:"address" validate:"omitempty"`
+	BillingAddress  *PostalAddressRequest   `json:"billing_address"`
+	Phone           *string                 `json:"phone" validate:"omitempty"`
+	TaxID           *string                 `json:"tax_id"`
+	CCEmails        *[]string               `json:"cc_emails" validate:"omitempty,dive,email"`
+	BCCEmails       *[]string               `json:"bcc_emails" validate:"omitempty,dive,email"`
+	Currency        *string                 `json:"currency" validate:"omitempty,iso4217"`
+	Locale          *string                 `json:"locale" validate:"omitempty,oneof=en id"`
+	PaymentTermDays *int                    `json:"payment_term_days" validate:"omitempty,min=0,max=365"`
+	Contacts        *[]ClientContactRequest `json:"contacts" validate:"omitempty,dive"`
+	ID              uint                    `param:"id" validate:"required"`
+
+	OrganizationID uint `json:"-"`
 }
 
 type PaginationRequest struct {
@@ -30,7 +69,31 @@ type PaginationResponse struct {
 	TotalPages int   `json:"total_pages"`
 }
 
+type MergeClientRequest struct {
+	DuplicateID uint `json:"duplicate_id" validate:"required"` // Client folded into the one in the path
+	SurvivorID  uint `param:"id" validate:"required"`
+
+	OrganizationID uint `json:"-"`
+	UserID         uint `json:"-"`
+}
+
+type GetClientDuplicatesRequest struct {
+	OrganizationID uint `json:"-"`
+	ClientID       uint `json:"-"` // Only compare this client against the others
+	PaginationRequest
+}
+
+// ClientDuplicate pairs a client with one that looks like the same customer.
+// Client is the older of the two and the suggested survivor.
+type ClientDuplicate struct {
+	Client    models.Client `json:"client"`
+	Duplicate models.Client `json:"duplicate"`
+	Score     float64       `json:"score"`   // 0 to 1, higher is more alike
+	Reasons   []string      `json:"reasons"` // name, email and/or phone
+}
+
 type GetClientsRequest struct {
-	UserID uint `json:"-"`
+	OrganizationID uint `json:"-"`
+	Archived       bool `json:"-"` // List archived clients instead of active ones
 	PaginationRequest
 }
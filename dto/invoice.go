@@ -1,5 +1,7 @@
 package dto
 
+import "github.com/hutamy/invoice-generator-backend/models"
+
 type InvoiceItemRequest struct {
 	Description string  `json:"description" validate:"required"`
 	Quantity    int     `json:"quantity" validate:"required,min=1"`
@@ -8,16 +10,26 @@ type InvoiceItemRequest struct {
 
 type CreateInvoiceRequest struct {
 	ClientID      uint                 `json:"client_id"`
-	DueDate       string               `json:"due_date" validate:"required,datetime=2006-01-02"`
+	DueDate       string               `json:"due_date" validate:"required_without=ClientID,omitempty,datetime=2006-01-02"` // Defaults to the client's payment terms
 	IssueDate     string               `json:"issue_date" validate:"required,datetime=2006-01-02"`
 	Items         []InvoiceItemRequest `json:"items" validate:"required,dive"`
 	Notes         string               `json:"notes"`
-	InvoiceNumber string               `json:"invoice_number" validate:"required"`
+	InvoiceNumber string               `json:"invoice_number"` // Taken from the sender profile sequence when empty
 	TaxRate       float64              `json:"tax_rate"`
-	ClientName    string               `json:"client_name" validate:"required"`
-	ClientEmail   string               `json:"client_email" validate:"required,email"`
-	ClientAddress string               `json:"client_address" validate:"required"`
-	ClientPhone   string               `json:"client_phone" validate:"required"`
+	// The client details are copied from the client record when ClientID is
+	// set, values given here take precedence
+	ClientName    string `json:"client_name" validate:"required_without=ClientID"`
+	ClientEmail   string `json:"client_email" validate:"required_without=ClientID,omitempty,email"`
+	ClientAddress string `json:"client_address" validate:"required_without=ClientID"`
+	ClientPhone   string `json:"client_phone" validate:"required_without=ClientID"`
+	ClientLocale  string `json:"client_locale" validate:"omitempty,oneof=en id"`
+	// SenderProfileID picks the issuing profile, the organization default is
+	// used when it is not set
+	SenderProfileID *uint  `json:"sender_profile_id"`
+	Currency        string `json:"currency" validate:"omitempty,iso4217"` // Defaults to INVOICE_CURRENCY
+	// PaymentMethodIDs lists the payment methods of the sender profile to
+	// print. When it is left out every method accepting the currency is used.
+	PaymentMethodIDs []uint `json:"payment_method_ids"`
 }
 
 type InvoiceItemUpdateRequest struct {
@@ -32,7 +44,6 @@ type UpdateInvoiceRequest struct {
 	DueDate       *string                    `json:"due_date,omitempty" validate:"omitempty,datetime=2006-01-02"`
 	IssueDate     *string                    `json:"issue_date,omitempty" validate:"omitempty,datetime=2006-01-02"`
 	Notes         *string                    `json:"notes,omitempty"`
-	Status        *string                    `json:"status,omitempty"`
 	TaxRate       *float64                   `json:"tax_rate,omitempty"`
 	InvoiceNumber *string                    `json:"invoice_number,omitempty"`
 	Items         []InvoiceItemUpdateRequest `json:"items,omitempty"`
@@ -40,6 +51,19 @@ type UpdateInvoiceRequest struct {
 	ClientEmail   *string                    `json:"client_email,omitempty"`
 	ClientAddress *string                    `json:"client_address,omitempty"`
 	ClientPhone   *string                    `json:"client_phone,omitempty"`
+	ClientLocale  *string                    `json:"client_locale,omitempty" validate:"omitempty,oneof=en id"`
+	// SenderProfileID, Currency and PaymentMethodIDs can only be changed on
+	// draft invoices
+	SenderProfileID  *uint   `json:"sender_profile_id,omitempty"`
+	Currency         *string `json:"currency,omitempty" validate:"omitempty,iso4217"`
+	PaymentMethodIDs *[]uint `json:"payment_method_ids,omitempty"`
+
+	// Filled by the service from the sender profile
+	Sender         models.SenderDetails           `json:"-"`
+	PaymentMethods *[]models.InvoicePaymentMethod `json:"-"`
+	// Filled by the service with the newly linked client, its details are
+	// copied unless the request sets them
+	Client *models.Client `json:"-"`
 }
 
 type GeneratePublicInvoiceRequest struct {
@@ -51,10 +75,14 @@ type GeneratePublicInvoiceRequest struct {
 	Items         []InvoiceItemUpdateRequest `json:"items,omitempty"`
 	TaxRate       float64                    `json:"tax_rate,omitempty"`
 	Notes         string                     `json:"notes"`
+	Locale        string                     `json:"locale" validate:"omitempty,oneof=en id"`
+	Currency      string                     `json:"currency" validate:"omitempty,iso4217"`
+	Format        string                     `json:"-"` // Output mode, taken from the query string
 }
 
 type SenderRequest struct {
 	SenderRecipientRequest
+	TaxID             string `json:"tax_id"`
 	BankName          string `json:"bank_name" validate:"required"`
 	BankAccountName   string `json:"bank_account_name" validate:"required"`
 	BankAccountNumber string `json:"bank_account_number" validate:"required"`
@@ -67,8 +95,26 @@ type SenderRecipientRequest struct {
 	Phone   string `json:"phone"`
 }
 
+type InvoicePDFRequest struct {
+	InvoiceID      uint
+	OrganizationID uint
+	Locale         string // Overrides the client and user locale when set
+	Format         string // Output mode: pdf (default) or pdfa3
+	IfNoneMatch    string // ETag the caller already has
+}
+
+type ExportInvoicesRequest struct {
+	DateFrom string `json:"date_from" validate:"omitempty,datetime=2006-01-02"`
+	DateTo   string `json:"date_to" validate:"omitempty,datetime=2006-01-02"`
+	Status   string `json:"status"` // Filter by status (draft, open, paid, past_due)
+	ClientID uint   `json:"client_id"`
+
+	OrganizationID uint `json:"-"`
+	UserID         uint `json:"-"`
+}
+
 type UpdateInvoiceStatusRequest struct {
-	Status string `json:"status" validate:"required"`
+	Status string `json:"status" validate:"required,oneof=draft open paid past_due"`
 }
 
 type SummaryInvoice struct {
@@ -78,7 +124,7 @@ type SummaryInvoice struct {
 }
 
 type GetInvoicesRequest struct {
-	UserID uint `json:"-"`
+	OrganizationID uint `json:"-"`
 	PaginationRequest
 	Status string `query:"status"` // Filter by status (draft, open, paid, past_due)
 }
@@ -0,0 +1,15 @@
+package dto
+
+type OIDCAuthorizeResponse struct {
+	AuthorizationURL string `json:"authorization_url"`
+	State            string `json:"state"`
+}
+
+type OIDCCallbackRequest struct {
+	Code  string `json:"code" validate:"required"`
+	State string `json:"state" validate:"required"`
+}
+
+type OIDCProvidersResponse struct {
+	Providers []string `json:"providers"`
+}
@@ -0,0 +1,59 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/hutamy/invoice-generator-backend/utils/rbac"
+)
+
+type CreateOrganizationRequest struct {
+	Name   string `json:"name" validate:"required"`
+	UserID uint   `json:"-"`
+}
+
+type UpdateOrganizationRequest struct {
+	Name           string `json:"name" validate:"required"`
+	OrganizationID uint   `json:"-"`
+}
+
+type MemberResponse struct {
+	UserID   uint      `json:"user_id"`
+	Name     string    `json:"name"`
+	Email    string    `json:"email"`
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+type PermissionsResponse struct {
+	OrganizationID uint              `json:"organization_id"`
+	Role           string            `json:"role"`
+	Permissions    []rbac.Permission `json:"permissions"`
+}
+
+type UpdateMemberRoleRequest struct {
+	Role   string `json:"role" validate:"required,oneof=owner admin accountant viewer"`
+	UserID uint   `param:"user_id" validate:"required"`
+
+	OrganizationID uint   `json:"-"`
+	ActorRole      string `json:"-"` // role of the member making the change
+}
+
+type RemoveMemberRequest struct {
+	UserID uint
+
+	OrganizationID uint
+	ActorRole      string // role of the member making the change
+}
+
+type InviteMemberRequest struct {
+	Email string `json:"email" validate:"required,email"`
+	Role  string `json:"role" validate:"required,oneof=owner admin accountant viewer"`
+
+	OrganizationID uint   `json:"-"`
+	InvitedByID    uint   `json:"-"`
+	ActorRole      string `json:"-"` // role of the member sending the invitation
+}
+
+type AcceptInvitationRequest struct {
+	Token string `json:"token" validate:"required"`
+}
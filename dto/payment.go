@@ -0,0 +1,14 @@
+package dto
+
+type CreatePaymentRequest struct {
+	Type      string  `json:"type" validate:"required,oneof=payment credit"`
+	Amount    float64 `json:"amount" validate:"required,gt=0"`
+	Currency  string  `json:"currency" validate:"omitempty,iso4217"` // Defaults to the invoice or client currency
+	Date      string  `json:"date" validate:"required,datetime=2006-01-02"`
+	InvoiceID *uint   `json:"invoice_id"` // Applies the payment to an invoice of the client
+	Reference string  `json:"reference"`
+	Notes     string  `json:"notes"`
+	ClientID  uint    `param:"id" validate:"required"`
+
+	OrganizationID uint `json:"-"`
+}
@@ -0,0 +1,31 @@
+package dto
+
+type PaymentMethodRequest struct {
+	Type          string `json:"type" validate:"required,oneof=bank_transfer iban ewallet instructions"`
+	Label         string `json:"label"`
+	Currency      string `json:"currency" validate:"omitempty,iso4217"` // Leave empty to accept any currency
+	BankName      string `json:"bank_name" validate:"required_if=Type bank_transfer"`
+	AccountName   string `json:"account_name" validate:"required_if=Type bank_transfer"`
+	AccountNumber string `json:"account_number" validate:"required_if=Type bank_transfer"`
+	IBAN          string `json:"iban" validate:"required_if=Type iban"`
+	SWIFT         string `json:"swift" validate:"omitempty,bic"`
+	Provider      string `json:"provider" validate:"required_if=Type ewallet"`
+	WalletID      string `json:"wallet_id" validate:"required_if=Type ewallet"`
+	Instructions  string `json:"instructions" validate:"required_if=Type instructions"`
+	Position      int    `json:"position"`
+}
+
+type CreatePaymentMethodRequest struct {
+	PaymentMethodRequest
+	SenderProfileID uint `param:"id" validate:"required"`
+
+	OrganizationID uint `json:"-"`
+}
+
+type UpdatePaymentMethodRequest struct {
+	PaymentMethodRequest
+	SenderProfileID uint `param:"id" validate:"required"`
+	ID              uint `param:"method_id" validate:"required"`
+
+	OrganizationID uint `json:"-"`
+}
@@ -0,0 +1,36 @@
+package dto
+
+type CreateSenderProfileRequest struct {
+	Name          string `json:"name" validate:"required"`
+	Email         string `json:"email" validate:"omitempty,email"`
+	Phone         string `json:"phone"`
+	Address       string `json:"address" validate:"required"`
+	TaxID         string `json:"tax_id"`
+	NumberPrefix  string `json:"number_prefix"`
+	NumberPadding int    `json:"number_padding" validate:"omitempty,min=1,max=12"`
+	NextNumber    int    `json:"next_number" validate:"omitempty,min=1"`
+	IsDefault     bool   `json:"is_default"`
+
+	OrganizationID uint `json:"-"`
+}
+
+type UpdateSenderProfileRequest struct {
+	Name          *string `json:"name" validate:"omitempty,min=1"`
+	Email         *string `json:"email" validate:"omitempty,email"`
+	Phone         *string `json:"phone"`
+	Address       *string `json:"address" validate:"omitempty,min=1"`
+	TaxID         *string `json:"tax_id"`
+	NumberPrefix  *string `json:"number_prefix"`
+	NumberPadding *int    `json:"number_padding" validate:"omitempty,min=1,max=12"`
+	NextNumber    *int    `json:"next_number" validate:"omitempty,min=1"`
+	IsDefault     *bool   `json:"is_default"`
+	ID            uint    `param:"id" validate:"required"`
+
+	OrganizationID uint `json:"-"`
+}
+
+type UploadLogoRequest struct {
+	SenderProfileID uint
+	OrganizationID  uint
+	Data            []byte
+}
@@ -0,0 +1,10 @@
+package dto
+
+import (
+	"github.com/hutamy/invoice-generator-backend/models"
+)
+
+type SessionResponse struct {
+	models.Session
+	Current bool `json:"current"` // the session of the access token used for the request
+}
@@ -0,0 +1,55 @@
+package dto
+
+import "time"
+
+type StatementRequest struct {
+	ClientID uint   `param:"id" validate:"required"`
+	From     string `query:"from" validate:"omitempty,datetime=2006-01-02"` // Defaults to the first day of the month of To
+	To       string `query:"to" validate:"omitempty,datetime=2006-01-02"`   // Defaults to today
+	Currency string `query:"currency" validate:"omitempty,iso4217"`         // Defaults to the client currency
+	Locale   string `query:"lang"`                                          // Overrides the client locale on the PDF
+
+	OrganizationID uint `json:"-"`
+}
+
+// Statement is the account of a client over a period in one currency
+type Statement struct {
+	ClientID       uint             `json:"client_id"`
+	ClientName     string           `json:"client_name"`
+	Currency       string           `json:"currency"`
+	From           time.Time        `json:"from"`
+	To             time.Time        `json:"to"`
+	OpeningBalance float64          `json:"opening_balance"`
+	Entries        []StatementEntry `json:"entries"`
+	TotalInvoiced  float64          `json:"total_invoiced"`
+	TotalPaid      float64          `json:"total_paid"`
+	TotalCredited  float64          `json:"total_credited"`
+	ClosingBalance float64          `json:"closing_balance"`
+	Aging          StatementAging   `json:"aging"`
+}
+
+// StatementEntry is an invoice, payment or credit on the statement. Invoices
+// are debits, payments and credits are credits.
+type StatementEntry struct {
+	Date      time.Time  `json:"date"`
+	Type      string     `json:"type"` // invoice, payment or credit
+	Reference string     `json:"reference"`
+	InvoiceID *uint      `json:"invoice_id,omitempty"`
+	PaymentID *uint      `json:"payment_id,omitempty"`
+	DueDate   *time.Time `json:"due_date,omitempty"`
+	Debit     float64    `json:"debit"`
+	Credit    float64    `json:"credit"`
+	Balance   float64    `json:"balance"` // running balance after the entry
+}
+
+// StatementAging splits the closing balance by how long invoices have been
+// past due on the statement's end date. Unapplied holds payments and credits
+// not set off against an invoice, and is subtracted from the buckets.
+type StatementAging struct {
+	Current    float64 `json:"current"`
+	Days1To30  float64 `json:"days_1_30"`
+	Days31To60 float64 `json:"days_31_60"`
+	Days61To90 float64 `json:"days_61_90"`
+	Over90     float64 `json:"over_90"`
+	Unapplied  float64 `json:"unapplied"`
+}
@@ -4,25 +4,76 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/hutamy/invoice-generator-backend/models"
 	"github.com/hutamy/invoice-generator-backend/utils"
 	"github.com/hutamy/invoice-generator-backend/utils/errors"
 	"github.com/labstack/echo/v4"
 )
 
-func JWTMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
-	return func(c echo.Context) error {
-		authHeader := c.Request().Header.Get("Authorization")
-		if !strings.HasPrefix(authHeader, "Bearer ") {
-			return utils.Response(c, http.StatusUnauthorized, errors.ErrInvalidToken.Error(), nil)
-		}
+// APIKeyAuthenticator resolves a personal API key to its stored record
+type APIKeyAuthenticator interface {
+	Authenticate(key string) (*models.APIKey, error)
+}
 
-		tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
-		claims, err := utils.ParseJWT(tokenStr)
-		if err != nil {
-			return utils.Response(c, http.StatusUnauthorized, errors.ErrInvalidToken.Error(), nil)
-		}
+// SessionValidator reports whether the session of an access token is active
+type SessionValidator interface {
+	ValidateSession(sessionID string, userID uint) error
+}
+
+// JWTMiddleware authenticates requests with an access token or, as an
+// alternative, a personal API key sent as a bearer token or in X-API-Key.
+// Access tokens of revoked sessions are rejected; the session is set under
+// "session_id". Requests made with an API key carry the key under "api_key"
+// so RequireScope and SessionOnly can restrict them.
+func JWTMiddleware(apiKeys APIKeyAuthenticator, sessions SessionValidator) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			tokenStr := c.Request().Header.Get("X-API-Key")
+			if tokenStr == "" {
+				authHeader := c.Request().Header.Get("Authorization")
+				if !strings.HasPrefix(authHeader, "Bearer ") {
+					return utils.Response(c, http.StatusUnauthorized, errors.ErrInvalidToken.Error(), nil)
+				}
+				tokenStr = strings.TrimPrefix(authHeader, "Bearer ")
+			}
+
+			if strings.HasPrefix(tokenStr, models.APIKeyPrefix) {
+				key, err := apiKeys.Authenticate(tokenStr)
+				if err != nil {
+					if err == errors.ErrInvalidToken {
+						return utils.Response(c, http.StatusUnauthorized, err.Error(), nil)
+					}
+
+					return utils.Response(c, http.StatusInternalServerError, err.Error(), nil)
+				}
 
-		c.Set("user_id", uint(claims["user_id"].(float64)))
-		return next(c)
+				c.Set("user_id", key.UserID)
+				c.Set("api_key", key)
+				return next(c)
+			}
+
+			claims, err := utils.ParseJWT(tokenStr)
+			if err != nil || claims["typ"] != utils.TokenTypeAccess {
+				return utils.Response(c, http.StatusUnauthorized, errors.ErrInvalidToken.Error(), nil)
+			}
+
+			userID, ok := claims["user_id"].(float64)
+			sessionID, hasSession := claims["sid"].(string)
+			if !ok || !hasSession {
+				return utils.Response(c, http.StatusUnauthorized, errors.ErrInvalidToken.Error(), nil)
+			}
+
+			if err := sessions.ValidateSession(sessionID, uint(userID)); err != nil {
+				if err == errors.ErrInvalidToken {
+					return utils.Response(c, http.StatusUnauthorized, err.Error(), nil)
+				}
+
+				return utils.Response(c, http.StatusInternalServerError, err.Error(), nil)
+			}
+
+			c.Set("user_id", uint(userID))
+			c.Set("session_id", sessionID)
+			return next(c)
+		}
 	}
 }
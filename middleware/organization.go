@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/hutamy/invoice-generator-backend/models"
+	"github.com/hutamy/invoice-generator-backend/utils"
+	"github.com/hutamy/invoice-generator-backend/utils/errors"
+	"github.com/hutamy/invoice-generator-backend/utils/rbac"
+	"github.com/labstack/echo/v4"
+)
+
+// MembershipResolver finds the organization membership a request acts under
+type MembershipResolver interface {
+	ResolveMembership(userID, organizationID uint) (*models.Membership, error)
+}
+
+// Organization selects the organization named in the X-Organization-ID
+// header, or the user's default organization without it. The organization is
+// set under "organization_id" and the user's role in it under "role".
+func Organization(resolver MembershipResolver) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			var organizationID uint
+			if header := c.Request().Header.Get("X-Organization-ID"); header != "" {
+				id, err := strconv.ParseUint(header, 10, 64)
+				if err != nil || id == 0 {
+					return utils.Response(c, http.StatusBadRequest, errors.ErrInvalidOrganization.Error(), nil)
+				}
+				organizationID = uint(id)
+			}
+
+			membership, err := resolver.ResolveMembership(c.Get("user_id").(uint), organizationID)
+			if err != nil {
+				if err == errors.ErrNotMember {
+					return utils.Response(c, http.StatusForbidden, err.Error(), nil)
+				}
+
+				return utils.Response(c, http.StatusInternalServerError, err.Error(), nil)
+			}
+
+			c.Set("organization_id", membership.OrganizationID)
+			c.Set("role", membership.Role)
+			return next(c)
+		}
+	}
+}
+
+// Authorize rejects requests from members whose role in the current
+// organization does not grant permission.
+func Authorize(permission rbac.Permission) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			role, _ := c.Get("role").(string)
+			if !rbac.Allowed(role, permission) {
+				return utils.Response(c, http.StatusForbidden, errors.ErrForbidden.Error(), nil)
+			}
+
+			return next(c)
+		}
+	}
+}
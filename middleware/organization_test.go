@@ -0,0 +1,170 @@
+package middleware
+
+import (
+	e "errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/hutamy/invoice-generator-backend/models"
+	"github.com/hutamy/invoice-generator-backend/utils/errors"
+	"github.com/hutamy/invoice-generator-backend/utils/rbac"
+	"github.com/labstack/echo/v4"
+)
+
+// memberships resolves memberships of user 1: owner of organization 1, which
+// is the default, accountant in 2 and viewer in 3
+type memberships struct{}
+
+func (memberships) ResolveMembership(userID, organizationID uint) (*models.Membership, error) {
+	roles := map[uint]string{1: models.RoleOwner, 2: models.RoleAccountant, 3: models.RoleViewer}
+	switch {
+	case organizationID == 99:
+		return nil, e.New("database is down")
+	case organizationID == 0:
+		organizationID = 1
+	}
+
+	role, ok := roles[organizationID]
+	if userID != 1 || !ok {
+		return nil, errors.ErrNotMember
+	}
+
+	return &models.Membership{OrganizationID: organizationID, UserID: userID, Role: role}, nil
+}
+
+// serve runs a request through the protected middleware chain in the order
+// the routes use: authentication, organization, scopes and permission
+func serve(t *testing.T, header string, apiKey *models.APIKey, middlewares ...echo.MiddlewareFunc) (*httptest.ResponseRecorder, uint) {
+	t.Helper()
+	var organizationID uint
+	authenticate := func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set("user_id", uint(1))
+			if apiKey != nil {
+				c.Set("api_key", apiKey)
+			}
+			return next(c)
+		}
+	}
+
+	e := echo.New()
+	e.Use(authenticate, Organization(memberships{}))
+	e.GET("/resource", func(c echo.Context) error {
+		organizationID = c.Get("organization_id").(uint)
+		return c.NoContent(http.StatusOK)
+	}, middlewares...)
+
+	req := httptest.NewRequest(http.MethodGet, "/resource", nil)
+	if header != "" {
+		req.Header.Set("X-Organization-ID", header)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	return rec, organizationID
+}
+
+func TestOrganization(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		status int
+		org    uint
+	}{
+		{name: "default organization", status: http.StatusOK, org: 1},
+		{name: "selected organization", header: "3", status: http.StatusOK, org: 3},
+		{name: "not a member", header: "4", status: http.StatusForbidden},
+		{name: "not a number", header: "acme", status: http.StatusBadRequest},
+		{name: "zero", header: "0", status: http.StatusBadRequest},
+		{name: "negative", header: "-1", status: http.StatusBadRequest},
+		{name: "lookup fails", header: "99", status: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, org := serve(t, tt.header, nil)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+
+			if org != tt.org {
+				t.Fatalf("organization_id = %d, want %d", org, tt.org)
+			}
+		})
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	tests := []struct {
+		name       string
+		org        uint
+		permission rbac.Permission
+		status     int
+	}{
+		{"owner manages members", 1, rbac.MembersManage, http.StatusOK},
+		{"owner manages the signing certificate", 1, rbac.SigningCertificateManage, http.StatusOK},
+		{"accountant exports", 2, rbac.InvoicesExport, http.StatusOK},
+		{"accountant manages API keys", 2, rbac.APIKeysManage, http.StatusOK},
+		{"accountant cannot edit invoices", 2, rbac.InvoicesEdit, http.StatusForbidden},
+		{"accountant changes invoice status", 2, rbac.InvoicesRecordPayment, http.StatusOK},
+		{"viewer cannot change invoice status", 3, rbac.InvoicesRecordPayment, http.StatusForbidden},
+		{"accountant cannot manage the signing certificate", 2, rbac.SigningCertificateManage, http.StatusForbidden},
+		{"accountant cannot reveal payment details", 2, rbac.PaymentDetailsReveal, http.StatusForbidden},
+		{"viewer reads invoices", 3, rbac.InvoicesRead, http.StatusOK},
+		{"viewer cannot create clients", 3, rbac.ClientsWrite, http.StatusForbidden},
+		{"viewer cannot manage API keys", 3, rbac.APIKeysManage, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, _ := serve(t, strconv.Itoa(int(tt.org)), nil, Authorize(tt.permission))
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+		})
+	}
+}
+
+func TestAuthorizeWithoutRole(t *testing.T) {
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+
+	handler := Authorize(rbac.OrganizationRead)(func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+	if err := handler(c); err != nil {
+		t.Fatalf("handler error = %v", err)
+	}
+
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+}
+
+func TestAPIKeyLimits(t *testing.T) {
+	readOnly := &models.APIKey{Scopes: []string{models.ScopeInvoicesRead, models.ScopeClientsAll}}
+	tests := []struct {
+		name        string
+		header      string
+		middlewares []echo.MiddlewareFunc
+		status      int
+	}{
+		{"scope granted", "1", []echo.MiddlewareFunc{RequireScope(models.ScopeInvoicesRead), Authorize(rbac.InvoicesRead)}, http.StatusOK},
+		{"wildcard scope", "1", []echo.MiddlewareFunc{RequireScope(models.ScopeClientsWrite), Authorize(rbac.ClientsWrite)}, http.StatusOK},
+		{"scope missing", "1", []echo.MiddlewareFunc{RequireScope(models.ScopeInvoicesWrite), Authorize(rbac.InvoicesCreate)}, http.StatusForbidden},
+		{"scope granted but role too low", "3", []echo.MiddlewareFunc{RequireScope(models.ScopeClientsWrite), Authorize(rbac.ClientsWrite)}, http.StatusForbidden},
+		{"account route", "1", []echo.MiddlewareFunc{SessionOnly}, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, _ := serve(t, tt.header, readOnly, tt.middlewares...)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+		})
+	}
+}
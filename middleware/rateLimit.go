@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/hutamy/invoice-generator-backend/utils"
+	"github.com/hutamy/invoice-generator-backend/utils/ratelimit"
+	"github.com/labstack/echo/v4"
+)
+
+// RateLimitByIP limits requests per client IP. name separates the budgets of
+// different route groups.
+func RateLimitByIP(store ratelimit.Store, name string, rule ratelimit.Rule) echo.MiddlewareFunc {
+	return rateLimit(store, rule, func(c echo.Context) string {
+		return fmt.Sprintf("ip:%s:%s", name, c.RealIP())
+	})
+}
+
+// RateLimitByUser limits requests per authenticated account and must run after
+// JWTMiddleware. Requests without a user fall back to the client IP.
+func RateLimitByUser(store ratelimit.Store, name string, rule ratelimit.Rule) echo.MiddlewareFunc {
+	return rateLimit(store, rule, func(c echo.Context) string {
+		if userID, ok := c.Get("user_id").(uint); ok {
+			return fmt.Sprintf("user:%s:%d", name, userID)
+		}
+
+		return fmt.Sprintf("ip:%s:%s", name, c.RealIP())
+	})
+}
+
+func rateLimit(store ratelimit.Store, rule ratelimit.Rule, key func(echo.Context) string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if rule.Limit <= 0 {
+				return next(c)
+			}
+
+			result, err := ratelimit.Allow(store, key(c), rule)
+			if err != nil {
+				// Fail open, an unavailable store should not take the API down
+				log.Printf("rate limit store error: %v", err)
+				return next(c)
+			}
+
+			c.Response().Header().Set("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+			c.Response().Header().Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			if !result.Allowed {
+				return utils.TooManyRequests(c, result.RetryAfter)
+			}
+
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/hutamy/invoice-generator-backend/models"
+	"github.com/hutamy/invoice-generator-backend/utils"
+	"github.com/hutamy/invoice-generator-backend/utils/errors"
+	"github.com/labstack/echo/v4"
+)
+
+// RequireScope rejects API key requests whose key does not grant scope.
+// Signed-in users are not limited by scopes.
+func RequireScope(scope string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if key, ok := c.Get("api_key").(*models.APIKey); ok && !key.HasScope(scope) {
+				return utils.Response(c, http.StatusForbidden, errors.ErrInsufficientScope.Error(), nil)
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// SessionOnly rejects API key requests for account management endpoints,
+// which need a signed-in user.
+func SessionOnly(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if _, ok := c.Get("api_key").(*models.APIKey); ok {
+			return utils.Response(c, http.StatusForbidden, errors.ErrAPIKeyNotAllowed.Error(), nil)
+		}
+
+		return next(c)
+	}
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	// APIKeyPrefix starts every personal API key so it can be told apart from a JWT
+	APIKeyPrefix = "igk_"
+
+	ScopeInvoicesRead  = "invoices:read"
+	ScopeInvoicesWrite = "invoices:write"
+	ScopeClientsRead   = "clients:read"
+	ScopeClientsWrite  = "clients:write"
+	ScopeClientsAll    = "clients:*"
+)
+
+// APIKey is a long-lived credential for server-to-server integrations. Only
+// the hash of the key is stored; Prefix is kept to help users recognise it.
+type APIKey struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	UserID     uint       `json:"user_id" gorm:"not null;index"`
+	Name       string     `json:"name" gorm:"not null"`
+	Prefix     string     `json:"prefix" gorm:"not null"`
+	KeyHash    string     `json:"-" gorm:"not null;uniqueIndex"`
+	Scopes     []string   `json:"scopes" gorm:"serializer:json;not null"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// HasScope reports whether the key grants scope. A resource wildcard such as
+// clients:* grants every action on that resource.
+func (k *APIKey) HasScope(scope string) bool {
+	resource, _, _ := strings.Cut(scope, ":")
+	for _, granted := range k.Scopes {
+		if granted == scope || granted == resource+":*" {
+			return true
+		}
+	}
+
+	return false
+}
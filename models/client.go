@@ -1,16 +1,105 @@
 package models
 
 import (
+	"strings"
 	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	ContactRolePrimary   = "primary"
+	ContactRoleBilling   = "billing"
+	ContactRoleTechnical = "technical"
+	ContactRoleOther     = "other"
 )
 
 type Client struct {
-	ID        uint      `json:"id" gorm:"primaryKey"`
-	UserID    uint      `json:"user_id" gorm:"not null;index"`
-	Name      string    `json:"name" gorm:"not null;"`
-	Email     string    `json:"email"`
-	Phone     string    `json:"phone"`
-	Address   string    `json:"address"`
-	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
-	UpdatedAt time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+	ID             uint          `json:"id" gorm:"primaryKey"`
+	OrganizationID uint          `json:"organization_id" gorm:"index"`
+	UserID         uint          `json:"user_id" gorm:"not null;index"` // creator
+	Name           string        `json:"name" gorm:"not null;"`
+	Email          string        `json:"email"`
+	Phone          string        `json:"phone"`
+	Address        string        `json:"address"` // Free-form, printed when BillingAddress is empty
+	BillingAddress PostalAddress `json:"billing_address" gorm:"embedded;embeddedPrefix:billing_"`
+	TaxID          string        `json:"tax_id"` // NPWP or VAT number
+	CCEmails       []string      `json:"cc_emails" gorm:"serializer:json"`
+	BCCEmails      []string      `json:"bcc_emails" gorm:"serializer:json"`
+	Currency       string        `json:"currency" gorm:"size:3"` // Empty means INVOICE_CURRENCY is used
+	Locale         string        `json:"locale"`                 // Empty means the user's locale is used
+	// PaymentTermDays is the number of days after issue invoices fall due, 0
+	// when invoices need an explicit due date
+	PaymentTermDays int             `json:"payment_term_days" gorm:"not null;default:0"`
+	Contacts        []ClientContact `json:"contacts" gorm:"foreignKey:ClientID;constraint:OnDelete:CASCADE"`
+	CreatedAt       time.Time       `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt       time.Time       `json:"updated_at" gorm:"autoUpdateTime"`
+	// DeletedAt archives the client, archived clients are left out of lists
+	// and cannot be linked to new invoices
+	DeletedAt gorm.DeletedAt `json:"archived_at" gorm:"index" swaggertype:"string"`
+}
+
+// BillingContact returns the first contact with the billing role, or nil
+func (c Client) BillingContact() *ClientContact {
+	for i, contact := range c.Contacts {
+		if contact.Role == ContactRoleBilling {
+			return &c.Contacts[i]
+		}
+	}
+
+	return nil
+}
+
+// ClientContact is a person at a client
+type ClientContact struct {
+	ID       uint   `json:"id" gorm:"primaryKey"`
+	ClientID uint   `json:"client_id" gorm:"not null;index"`
+	Name     string `json:"name" gorm:"not null"`
+	Role     string `json:"role" gorm:"not null"`
+	Email    string `json:"email"`
+	Phone    string `json:"phone"`
+	Position int    `json:"position" gorm:"not null;default:0"`
+}
+
+// PostalAddress is a structured postal address
+type PostalAddress struct {
+	Line1      string `json:"line1"`
+	Line2      string `json:"line2"`
+	City       string `json:"city"`
+	Region     string `json:"region"`
+	PostalCode string `json:"postal_code"`
+	Country    string `json:"country" gorm:"size:2"` // ISO 3166-1 alpha-2
+}
+
+// IsZero reports whether no part of the address is set
+func (a PostalAddress) IsZero() bool {
+	return a == PostalAddress{}
+}
+
+// Lines formats the address for printing, leaving out empty parts
+func (a PostalAddress) Lines() []string {
+	var lines []string
+	for _, line := range []string{
+		a.Line1,
+		a.Line2,
+		strings.TrimSpace(strings.Join(nonEmpty(a.City, a.Region), ", ") + " " + a.PostalCode),
+		a.Country,
+	} {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines
+}
+
+func nonEmpty(values ...string) []string {
+	var kept []string
+	for _, value := range values {
+		if value != "" {
+			kept = append(kept, value)
+		}
+	}
+
+	return kept
 }
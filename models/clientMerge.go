@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// ClientMerge records a duplicate client folded into a surviving one. The
+// duplicate's details are kept as they were at the time of the merge.
+type ClientMerge struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	OrganizationID uint      `json:"organization_id" gorm:"not null;index"`
+	UserID         uint      `json:"user_id" gorm:"not null"` // who merged
+	SurvivorID     uint      `json:"survivor_id" gorm:"not null;index"`
+	DuplicateID    uint      `json:"duplicate_id" gorm:"not null"` // archived by the merge
+	DuplicateName  string    `json:"duplicate_name"`
+	DuplicateEmail string    `json:"duplicate_email"`
+	DuplicatePhone string    `json:"duplicate_phone"`
+	Invoices       int64     `json:"invoices"` // number of invoices moved to the survivor
+	Payments       int64     `json:"payments"`
+	Contacts       int64     `json:"contacts"`
+	CreatedAt      time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
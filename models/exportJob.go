@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	ExportStatusPending   = "pending"
+	ExportStatusRunning   = "running"
+	ExportStatusCompleted = "completed"
+	ExportStatusFailed    = "failed"
+	ExportStatusExpired   = "expired" // the archive was deleted after the retention period
+)
+
+type ExportJob struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	OrganizationID uint       `json:"organization_id" gorm:"index"`
+	UserID         uint       `json:"user_id" gorm:"not null;index"` // creator
+	Status         string     `json:"status" gorm:"not null;default:'pending'"`
+	DateFrom       *time.Time `json:"date_from"`
+	DateTo         *time.Time `json:"date_to"`
+	InvoiceStatus  string     `json:"invoice_status"`
+	ClientID       uint       `json:"client_id"`
+	Total          int        `json:"total" gorm:"not null;default:0"`
+	Processed      int        `json:"processed" gorm:"not null;default:0"`
+	Attempts       int        `json:"-" gorm:"not null;default:0"`
+	FilePath       string     `json:"-"`
+	Error          string     `json:"error,omitempty" gorm:"type:text"`
+	CompletedAt    *time.Time `json:"completed_at"`
+	ExpiresAt      *time.Time `json:"expires_at" gorm:"index"` // when the archive is deleted
+	CreatedAt      time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt      time.Time  `json:"updated_at" gorm:"autoUpdateTime"`
+}
@@ -5,23 +5,49 @@ import (
 )
 
 type Invoice struct {
-	ID            uint          `json:"id" gorm:"primaryKey"`
-	UserID        uint          `json:"user_id" gorm:"not null;index"`
-	ClientID      uint          `json:"client_id" gorm:"index"`
-	ClientName    string        `json:"client_name" gorm:"not null"`
-	ClientEmail   string        `json:"client_email" gorm:"not null"`
-	ClientAddress string        `json:"client_address" gorm:"not null"`
-	ClientPhone   string        `json:"client_phone" gorm:"not null"`
-	InvoiceNumber string        `json:"invoice_number" gorm:"not null"`
-	IssueDate     time.Time     `json:"issue_date" gorm:"not null"`
-	DueDate       time.Time     `json:"due_date" gorm:"not null"`
-	Status        string        `json:"status" gorm:"not null;default:'draft'"`
-	Notes         string        `json:"notes" gorm:"type:text"`
-	Subtotal      float64       `json:"subtotal" gorm:"not null;default:0"`
-	Tax           float64       `json:"tax" gorm:"not null;default:0"`
-	TaxRate       float64       `json:"tax_rate" gorm:"not null;default:0"`
-	Total         float64       `json:"total" gorm:"not null;default:0"`
-	Items         []InvoiceItem `json:"items" gorm:"foreignKey:InvoiceID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
-	CreatedAt     time.Time     `json:"created_at" gorm:"autoCreateTime"`
-	UpdatedAt     time.Time     `json:"updated_at" gorm:"autoUpdateTime"`
+	ID                   uint                   `json:"id" gorm:"primaryKey"`
+	OrganizationID       uint                   `json:"organization_id" gorm:"index"`
+	UserID               uint                   `json:"user_id" gorm:"not null;index"` // creator
+	ClientID             uint                   `json:"client_id" gorm:"index"`
+	ClientName           string                 `json:"client_name" gorm:"not null"`
+	ClientEmail          string                 `json:"client_email" gorm:"not null"`
+	ClientAddress        string                 `json:"client_address" gorm:"not null"`
+	ClientPhone          string                 `json:"client_phone" gorm:"not null"`
+	ClientLocale         string                 `json:"client_locale"` // Empty means the user's locale is used
+	ClientBillingAddress PostalAddress          `json:"client_billing_address" gorm:"embedded;embeddedPrefix:client_billing_"`
+	ClientTaxID          string                 `json:"client_tax_id"`
+	ClientContact        string                 `json:"client_contact"` // billing contact the invoice is addressed to
+	SenderProfileID      *uint                  `json:"sender_profile_id" gorm:"index"`
+	Sender               SenderDetails          `json:"sender" gorm:"embedded;embeddedPrefix:sender_"` // copy of the sender profile, or of the creator without one
+	SenderSnapshotAt     *time.Time             `json:"sender_snapshot_at"`                            // when Sender and PaymentMethods were copied
+	InvoiceNumber        string                 `json:"invoice_number" gorm:"not null"`
+	IssueDate            time.Time              `json:"issue_date" gorm:"not null"`
+	DueDate              time.Time              `json:"due_date" gorm:"not null"`
+	PaymentTermDays      int                    `json:"payment_term_days" gorm:"not null;default:0"` // set when DueDate follows from the client's payment terms
+	Status               string                 `json:"status" gorm:"not null;default:'draft'"`
+	Notes                string                 `json:"notes" gorm:"type:text"`
+	Subtotal             float64                `json:"subtotal" gorm:"not null;default:0"`
+	Tax                  float64                `json:"tax" gorm:"not null;default:0"`
+	TaxRate              float64                `json:"tax_rate" gorm:"not null;default:0"`
+	Currency             string                 `json:"currency" gorm:"size:3;not null;default:'IDR'"` // ISO 4217, older invoices were all printed in IDR
+	Total                float64                `json:"total" gorm:"not null;default:0"`
+	Items                []InvoiceItem          `json:"items" gorm:"foreignKey:InvoiceID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	PaymentMethods       []InvoicePaymentMethod `json:"payment_methods" gorm:"foreignKey:InvoiceID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"` // copied along with Sender
+	CreatedAt            time.Time              `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt            time.Time              `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// SetClient copies the details of client onto the invoice
+func (i *Invoice) SetClient(client *Client) {
+	i.ClientName = client.Name
+	i.ClientEmail = client.Email
+	i.ClientAddress = client.Address
+	i.ClientPhone = client.Phone
+	i.ClientLocale = client.Locale
+	i.ClientBillingAddress = client.BillingAddress
+	i.ClientTaxID = client.TaxID
+	i.ClientContact = ""
+	if contact := client.BillingContact(); contact != nil {
+		i.ClientContact = contact.Name
+	}
 }
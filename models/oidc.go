@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+)
+
+// OIDCLoginState is a pending single sign-on login. It is created when the
+// user is sent to the provider and consumed by the callback. Only the hash
+// of the state parameter is stored.
+type OIDCLoginState struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	Provider     string    `json:"provider" gorm:"not null"`
+	StateHash    string    `json:"-" gorm:"not null;uniqueIndex"`
+	Nonce        string    `json:"-" gorm:"not null"`
+	CodeVerifier string    `json:"-" gorm:"not null"`
+	ExpiresAt    time.Time `json:"expires_at" gorm:"not null;index"`
+	CreatedAt    time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// UserIdentity links a user to an account at an OpenID provider
+type UserIdentity struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"not null;index"`
+	Provider  string    `json:"provider" gorm:"not null;uniqueIndex:idx_user_identities_provider_subject"`
+	Subject   string    `json:"subject" gorm:"not null;uniqueIndex:idx_user_identities_provider_subject"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
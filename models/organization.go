@@ -0,0 +1,59 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	RoleOwner      = "owner"
+	RoleAdmin      = "admin"
+	RoleAccountant = "accountant"
+	RoleViewer     = "viewer"
+)
+
+// Roles lists the organization roles from most to least privileged
+var Roles = []string{RoleOwner, RoleAdmin, RoleAccountant, RoleViewer}
+
+// Organization is the workspace that owns clients, invoices and exports.
+// Every user gets a personal organization when signing up.
+type Organization struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Name      string    `json:"name" gorm:"not null"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+type Membership struct {
+	ID             uint          `json:"id" gorm:"primaryKey"`
+	OrganizationID uint          `json:"organization_id" gorm:"not null;uniqueIndex:idx_memberships_org_user"`
+	UserID         uint          `json:"user_id" gorm:"not null;uniqueIndex:idx_memberships_org_user;index"`
+	Role           string        `json:"role" gorm:"not null"`
+	Organization   *Organization `json:"organization,omitempty"`
+	CreatedAt      time.Time     `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt      time.Time     `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// Invitation asks someone to join an organization. Only the hash of the
+// emailed token is stored.
+type Invitation struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	OrganizationID uint       `json:"organization_id" gorm:"not null;index"`
+	Email          string     `json:"email" gorm:"not null"`
+	Role           string     `json:"role" gorm:"not null"`
+	TokenHash      string     `json:"-" gorm:"not null;uniqueIndex"`
+	InvitedByID    uint       `json:"invited_by_id" gorm:"not null"`
+	ExpiresAt      time.Time  `json:"expires_at" gorm:"not null"`
+	AcceptedAt     *time.Time `json:"accepted_at"`
+	CreatedAt      time.Time  `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// IsValidRole reports whether role is one of the organization roles
+func IsValidRole(role string) bool {
+	for _, r := range Roles {
+		if r == role {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+const (
+	PaymentTypePayment = "payment"
+	// PaymentTypeCredit is a credit granted to the client, such as a credit
+	// note or a write-off, rather than money received
+	PaymentTypeCredit = "credit"
+)
+
+// Payment reduces what a client owes. Payments applied to an invoice count
+// towards settling it, the others stay on the client's account.
+type Payment struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	OrganizationID uint      `json:"organization_id" gorm:"not null;index"`
+	ClientID       uint      `json:"client_id" gorm:"index"`
+	InvoiceID      *uint     `json:"invoice_id" gorm:"index"`
+	Invoice        *Invoice  `json:"-" gorm:"constraint:OnDelete:SET NULL"`
+	Type           string    `json:"type" gorm:"not null;default:'payment'"`
+	Amount         float64   `json:"amount" gorm:"not null"`
+	Currency       string    `json:"currency" gorm:"size:3;not null"` // ISO 4217
+	Date           time.Time `json:"date" gorm:"not null"`
+	Reference      string    `json:"reference"`
+	Notes          string    `json:"notes" gorm:"type:text"`
+	Automatic      bool      `json:"automatic" gorm:"not null;default:false"` // recorded by marking the invoice paid, removed when it is reopened
+	CreatedAt      time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt      time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
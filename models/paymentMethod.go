@@ -0,0 +1,54 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	PaymentMethodBankTransfer = "bank_transfer"
+	PaymentMethodIBAN         = "iban"
+	PaymentMethodEWallet      = "ewallet"
+	PaymentMethodInstructions = "instructions"
+)
+
+// PaymentDetails describe one way of paying an invoice. Which fields are
+// filled depends on Type.
+type PaymentDetails struct {
+	Type          string `json:"type" gorm:"not null"`
+	Label         string `json:"label"`
+	Currency      string `json:"currency" gorm:"size:3"` // ISO 4217, empty when any currency is accepted
+	BankName      string `json:"bank_name" gorm:"serializer:encrypted"`
+	AccountName   string `json:"account_name" gorm:"serializer:encrypted"`
+	AccountNumber string `json:"account_number" gorm:"serializer:encrypted"`
+	IBAN          string `json:"iban" gorm:"serializer:encrypted"`
+	SWIFT         string `json:"swift"`
+	Provider      string `json:"provider"` // e-wallet provider, e.g. GoPay or PayPal
+	WalletID      string `json:"wallet_id" gorm:"serializer:encrypted"`
+	Instructions  string `json:"instructions" gorm:"type:text"`
+}
+
+// AcceptsCurrency reports whether the method can be used for invoices in currency
+func (d PaymentDetails) AcceptsCurrency(currency string) bool {
+	return d.Currency == "" || strings.EqualFold(d.Currency, currency)
+}
+
+// PaymentMethod is a payment option of a sender profile
+type PaymentMethod struct {
+	ID              uint `json:"id" gorm:"primaryKey"`
+	OrganizationID  uint `json:"organization_id" gorm:"not null;index"`
+	SenderProfileID uint `json:"sender_profile_id" gorm:"not null;index"`
+	PaymentDetails  `gorm:"embedded"`
+	Position        int       `json:"position" gorm:"not null;default:0"`
+	CreatedAt       time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt       time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// InvoicePaymentMethod is the copy of a payment method printed on an invoice
+type InvoicePaymentMethod struct {
+	ID              uint  `json:"id" gorm:"primaryKey"`
+	InvoiceID       uint  `json:"invoice_id" gorm:"not null;index"`
+	PaymentMethodID *uint `json:"payment_method_id"` // the method it was copied from
+	PaymentDetails  `gorm:"embedded"`
+	Position        int `json:"position" gorm:"not null;default:0"`
+}
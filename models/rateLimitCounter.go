@@ -0,0 +1,12 @@
+package models
+
+import (
+	"time"
+)
+
+// RateLimitCounter backs the shared rate limit store used by multi-replica deployments
+type RateLimitCounter struct {
+	Key       string    `gorm:"primaryKey"`
+	Count     int       `gorm:"not null"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+}
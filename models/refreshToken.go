@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+)
+
+// RefreshToken is an opaque, single-use token exchanged for a new access
+// token. Tokens issued from the same sign-in share a FamilyID so that reuse of
+// a rotated token can revoke the whole chain.
+type RefreshToken struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"not null;index"`
+	FamilyID  string     `json:"family_id" gorm:"not null;index"`
+	TokenHash string     `json:"-" gorm:"not null;uniqueIndex"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"not null"`
+	RotatedAt *time.Time `json:"rotated_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+	CreatedAt time.Time  `json:"created_at" gorm:"autoCreateTime"`
+}
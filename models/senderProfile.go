@@ -0,0 +1,48 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// SenderDetails are the issuer details printed on an invoice. Sender profiles
+// hold the current values and invoices keep a copy taken when they are issued.
+type SenderDetails struct {
+	Name    string `json:"name"`
+	Email   string `json:"email"`
+	Phone   string `json:"phone"`
+	Address string `json:"address"`
+	TaxID   string `json:"tax_id"`
+	LogoID  *uint  `json:"logo_id"`
+}
+
+// SenderProfile is a business entity of an organization that issues
+// invoices, with its own details and invoice numbering sequence.
+type SenderProfile struct {
+	ID             uint `json:"id" gorm:"primaryKey"`
+	OrganizationID uint `json:"organization_id" gorm:"not null;index"`
+	SenderDetails  `gorm:"embedded"`
+	IsDefault      bool            `json:"is_default" gorm:"not null;default:false"`
+	NumberPrefix   string          `json:"number_prefix"`
+	NumberPadding  int             `json:"number_padding" gorm:"not null;default:4"`
+	NextNumber     int             `json:"next_number" gorm:"not null;default:1"`
+	PaymentMethods []PaymentMethod `json:"payment_methods,omitempty" gorm:"foreignKey:SenderProfileID;constraint:OnDelete:CASCADE"`
+	CreatedAt      time.Time       `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt      time.Time       `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// FormatNumber renders sequence number n as an invoice number of the profile
+func (p SenderProfile) FormatNumber(n int) string {
+	return fmt.Sprintf("%s%0*d", p.NumberPrefix, p.NumberPadding, n)
+}
+
+// Logo is an uploaded sender logo. Logos are never changed, uploading a new
+// one creates a new row so issued invoices keep showing the old logo.
+type Logo struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	OrganizationID uint      `json:"organization_id" gorm:"not null;index"`
+	ContentType    string    `json:"content_type" gorm:"not null"`
+	Data           []byte    `json:"-" gorm:"not null"`
+	SHA256         string    `json:"sha256" gorm:"not null"`
+	CreatedAt      time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+)
+
+// Session is a signed-in device. It follows one refresh token family: it
+// starts at sign-in, is refreshed with every token rotation and ends when the
+// family is revoked. Access tokens carry the FamilyID in their "sid" claim.
+type Session struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	UserID     uint       `json:"user_id" gorm:"not null;index"`
+	FamilyID   string     `json:"-" gorm:"not null;uniqueIndex"`
+	UserAgent  string     `json:"user_agent"`
+	IPAddress  string     `json:"ip_address"`
+	ExpiresAt  time.Time  `json:"expires_at" gorm:"not null"`
+	LastSeenAt time.Time  `json:"last_seen_at" gorm:"not null"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at" gorm:"autoCreateTime"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+)
+
+// SigningCertificate is the certificate an organization signs its invoice PDFs
+// with, whichever member issued the invoice. The private key is kept
+// encrypted with the application encryption key.
+type SigningCertificate struct {
+	ID               uint      `json:"id" gorm:"primaryKey"`
+	OrganizationID   uint      `json:"organization_id" gorm:"uniqueIndex"`
+	UserID           uint      `json:"user_id" gorm:"not null;index"` // member who uploaded it
+	Subject          string    `json:"subject" gorm:"not null"`
+	Issuer           string    `json:"issuer" gorm:"not null"`
+	SerialNumber     string    `json:"serial_number" gorm:"not null"`
+	Fingerprint      string    `json:"fingerprint" gorm:"not null"` // SHA-256 of the DER certificate
+	NotBefore        time.Time `json:"not_before"`
+	NotAfter         time.Time `json:"not_after"`
+	CertificateChain string    `json:"-" gorm:"type:text;not null"` // PEM, signing certificate first
+	EncryptedKey     []byte    `json:"-" gorm:"not null"`
+	CreatedAt        time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt        time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+
+	// Expired is set when the certificate is outside its validity window;
+	// invoice PDFs are then rendered without a signature
+	Expired bool `json:"expired" gorm:"-"`
+}
+
+// ValidAt reports whether the certificate can sign at t
+func (c *SigningCertificate) ValidAt(t time.Time) bool {
+	return !t.Before(c.NotBefore) && !t.After(c.NotAfter)
+}
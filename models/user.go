@@ -10,12 +10,17 @@ type User struct {
 	ID                uint           `json:"id" gorm:"primaryKey"`
 	Name              string         `json:"name" gorm:"not null"`
 	Email             string         `json:"email" gorm:"not null;uniqueIndex"`
+	EmailVerifiedAt   *time.Time     `json:"email_verified_at"`
 	Password          string         `json:"-" gorm:"not null"`
 	Address           string         `json:"address"`
 	Phone             string         `json:"phone"`
-	BankName          string         `json:"bank_name"`
-	BankAccountName   string         `json:"bank_account_name"`
-	BankAccountNumber string         `json:"bank_account_number"`
+	BankName          string         `json:"bank_name" gorm:"serializer:encrypted"`
+	BankAccountName   string         `json:"bank_account_name" gorm:"serializer:encrypted"`
+	BankAccountNumber string         `json:"bank_account_number" gorm:"serializer:encrypted"`
+	Locale            string         `json:"locale" gorm:"not null;default:'en'"`
+	TwoFactorEnabled  bool           `json:"two_factor_enabled" gorm:"not null;default:false"`
+	TOTPSecret        []byte         `json:"-"` // encrypted, set during enrollment
+	TOTPLastStep      int64          `json:"-" gorm:"not null;default:0"`
 	CreatedAt         time.Time      `json:"created_at" gorm:"autoCreateTime"`
 	UpdatedAt         time.Time      `json:"updated_at" gorm:"autoUpdateTime"`
 	DeletedAt         gorm.DeletedAt `json:"-" gorm:"index" swaggerignore:"true"`
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	UserTokenEmailVerification = "email_verification"
+	UserTokenPasswordReset     = "password_reset"
+	UserTokenEmailChange       = "email_change"
+)
+
+// UserToken is a single-use token sent to the user by email. Only the hash of
+// the token is stored.
+type UserToken struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"not null;index"`
+	Purpose   string     `json:"purpose" gorm:"not null;index"`
+	TokenHash string     `json:"-" gorm:"not null;uniqueIndex"`
+	NewEmail  string     `json:"-"` // address being confirmed, for email changes
+	ExpiresAt time.Time  `json:"expires_at" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at" gorm:"autoCreateTime"`
+}
@@ -0,0 +1,61 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/hutamy/invoice-generator-backend/models"
+	"gorm.io/gorm"
+)
+
+type APIKeyRepository interface {
+	CreateAPIKey(key *models.APIKey) error
+	ListAPIKeys(userID uint) ([]models.APIKey, error)
+	GetAPIKeyByHash(hash string) (*models.APIKey, error)
+	DeleteAPIKey(id, userID uint) error
+	TouchAPIKey(id uint, usedAt time.Time) error
+}
+
+type apiKeyRepository struct {
+	db *gorm.DB
+}
+
+func NewAPIKeyRepository(db *gorm.DB) APIKeyRepository {
+	return &apiKeyRepository{db: db}
+}
+
+func (r *apiKeyRepository) CreateAPIKey(key *models.APIKey) error {
+	return r.db.Create(key).Error
+}
+
+func (r *apiKeyRepository) ListAPIKeys(userID uint) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	err := r.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&keys).Error
+	return keys, err
+}
+
+func (r *apiKeyRepository) GetAPIKeyByHash(hash string) (*models.APIKey, error) {
+	var key models.APIKey
+	err := r.db.Where("key_hash = ?", hash).First(&key).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &key, nil
+}
+
+func (r *apiKeyRepository) DeleteAPIKey(id, userID uint) error {
+	result := r.db.Where("id = ? AND user_id = ?", id, userID).Delete(&models.APIKey{})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (r *apiKeyRepository) TouchAPIKey(id uint, usedAt time.Time) error {
+	return r.db.Model(&models.APIKey{}).Where("id = ?", id).Update("last_used_at", usedAt).Error
+}
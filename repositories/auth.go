@@ -22,8 +22,15 @@ func NewAuthRepository(db *gorm.DB) AuthRepository {
 	return &authRepository{db: db}
 }
 
+// CreateUser stores user together with their personal organization
 func (r *authRepository) CreateUser(user *models.User) error {
-	return r.db.Create(&user).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+
+		return createPersonalOrganization(tx, user)
+	})
 }
 
 func (r *authRepository) GetUserByEmail(email string) (*models.User, error) {
@@ -0,0 +1,55 @@
+package repositories
+
+import (
+	"github.com/hutamy/invoice-generator-backend/models"
+	"gorm.io/gorm"
+)
+
+type CertificateRepository interface {
+	GetCertificateByOrganizationID(orgID uint) (*models.SigningCertificate, error)
+	SaveCertificate(cert *models.SigningCertificate) error
+	DeleteCertificate(orgID uint) error
+}
+
+type certificateRepository struct {
+	db *gorm.DB
+}
+
+func NewCertificateRepository(db *gorm.DB) CertificateRepository {
+	return &certificateRepository{db: db}
+}
+
+func (r *certificateRepository) GetCertificateByOrganizationID(orgID uint) (*models.SigningCertificate, error) {
+	var cert models.SigningCertificate
+	err := r.db.Where("organization_id = ?", orgID).First(&cert).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &cert, nil
+}
+
+// SaveCertificate stores cert as the organization's only signing certificate,
+// replacing a previously uploaded one.
+func (r *certificateRepository) SaveCertificate(cert *models.SigningCertificate) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("organization_id = ?", cert.OrganizationID).Delete(&models.SigningCertificate{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(cert).Error
+	})
+}
+
+func (r *certificateRepository) DeleteCertificate(orgID uint) error {
+	result := r.db.Where("organization_id = ?", orgID).Delete(&models.SigningCertificate{})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
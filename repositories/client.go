@@ -3,16 +3,25 @@ package repositories
 import (
 	"github.com/hutamy/invoice-generator-backend/dto"
 	"github.com/hutamy/invoice-generator-backend/models"
+	"github.com/hutamy/invoice-generator-backend/utils/errors"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type ClientRepository interface {
 	CreateClient(client *models.Client) error
-	GetAllByUserID(userID uint) ([]models.Client, error)
-	GetAllByUserIDWithPagination(req dto.GetClientsRequest) ([]models.Client, int64, error)
-	GetClientByID(id, userID uint) (*models.Client, error)
-	UpdateClient(client *models.Client) error
-	DeleteClient(id, userID uint) error
+	GetAllByOrganizationID(organizationID uint) ([]models.Client, error)
+	GetAllByOrganizationIDWithPagination(req dto.GetClientsRequest) ([]models.Client, int64, error)
+	GetClientByID(id, organizationID uint) (*models.Client, error)
+	GetClientByIDWithArchived(id, organizationID uint) (*models.Client, error)
+	ListDuplicateCandidates(organizationID uint) ([]models.Client, error)
+	GetClientsByIDs(ids []uint, organizationID uint) ([]models.Client, error)
+	UpdateClient(client *models.Client, contacts *[]models.ClientContact) error
+	ArchiveClient(id, organizationID uint) error
+	RestoreClient(id, organizationID uint) error
+	DeleteClient(id, organizationID uint) error
+	MergeClients(merge *models.ClientMerge) error
+	ListClientMerges(survivorID, organizationID uint) ([]models.ClientMerge, error)
 }
 
 type clientRepository struct {
@@ -27,9 +36,12 @@ func (r *clientRepository) CreateClient(client *models.Client) error {
 	return r.db.Create(client).Error
 }
 
-func (r *clientRepository) GetAllByUserID(userID uint) ([]models.Client, error) {
+func (r *clientRepository) GetAllByOrganizationID(organizationID uint) ([]models.Client, error) {
 	var clients []models.Client
-	err := r.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&clients).Error
+	err := r.db.Preload("Contacts", orderContacts).
+		Where("organization_id = ?", organizationID).
+		Order("created_at DESC").
+		Find(&clients).Error
 	if err != nil {
 		return nil, err
 	}
@@ -37,17 +49,20 @@ func (r *clientRepository) GetAllByUserID(userID uint) ([]models.Client, error)
 	return clients, nil
 }
 
-func (r *clientRepository) GetAllByUserIDWithPagination(req dto.GetClientsRequest) ([]models.Client, int64, error) {
+func (r *clientRepository) GetAllByOrganizationIDWithPagination(req dto.GetClientsRequest) ([]models.Client, int64, error) {
 	var clients []models.Client
 	var totalItems int64
 
-	query := r.db.Where("user_id = ?", req.UserID)
+	query := r.db.Where("organization_id = ?", req.OrganizationID)
+	if req.Archived {
+		query = r.db.Unscoped().Where("organization_id = ? AND deleted_at IS NOT NULL", req.OrganizationID)
+	}
 
 	// Add search functionality if search term is provided
 	if req.Search != "" {
 		searchTerm := "%" + req.Search + "%"
-		query = query.Where("name ILIKE ? OR email ILIKE ? OR phone ILIKE ? OR address ILIKE ?",
-			searchTerm, searchTerm, searchTerm, searchTerm)
+		query = query.Where("name ILIKE ? OR email ILIKE ? OR phone ILIKE ? OR address ILIKE ? OR tax_id ILIKE ?",
+			searchTerm, searchTerm, searchTerm, searchTerm, searchTerm)
 	}
 
 	// Count total items
@@ -57,7 +72,8 @@ func (r *clientRepository) GetAllByUserIDWithPagination(req dto.GetClientsReques
 
 	// Apply pagination
 	offset := (req.Page - 1) * req.PageSize
-	err := query.Order("created_at DESC").
+	err := query.Preload("Contacts", orderContacts).
+		Order("created_at DESC").
 		Offset(offset).
 		Limit(req.PageSize).
 		Find(&clients).Error
@@ -69,9 +85,11 @@ func (r *clientRepository) GetAllByUserIDWithPagination(req dto.GetClientsReques
 	return clients, totalItems, nil
 }
 
-func (r *clientRepository) GetClientByID(id, userID uint) (*models.Client, error) {
+func (r *clientRepository) GetClientByID(id, organizationID uint) (*models.Client, error) {
 	var client models.Client
-	err := r.db.Where("id = ? AND user_id = ?", id, userID).First(&client).Error
+	err := r.db.Preload("Contacts", orderContacts).
+		Where("id = ? AND organization_id = ?", id, organizationID).
+		First(&client).Error
 	if err != nil {
 		return nil, err
 	}
@@ -79,10 +97,238 @@ func (r *clientRepository) GetClientByID(id, userID uint) (*models.Client, error
 	return &client, nil
 }
 
-func (r *clientRepository) UpdateClient(client *models.Client) error {
-	return r.db.Save(client).Error
+// ListDuplicateCandidates lists the active clients of the organization with
+// only the fields duplicates are compared on, without their contacts
+func (r *clientRepository) ListDuplicateCandidates(organizationID uint) ([]models.Client, error) {
+	var clients []models.Client
+	err := r.db.Select("id", "name", "email", "phone", "created_at").
+		Where("organization_id = ?", organizationID).
+		Order("id").
+		Find(&clients).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return clients, nil
+}
+
+// GetClientsByIDs loads the active clients of the organization among ids
+func (r *clientRepository) GetClientsByIDs(ids []uint, organizationID uint) ([]models.Client, error) {
+	var clients []models.Client
+	err := r.db.Preload("Contacts", orderContacts).
+		Where("id IN ? AND organization_id = ?", ids, organizationID).
+		Find(&clients).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return clients, nil
+}
+
+// GetClientByIDWithArchived is GetClientByID that also finds archived clients
+func (r *clientRepository) GetClientByIDWithArchived(id, organizationID uint) (*models.Client, error) {
+	var client models.Client
+	err := r.db.Unscoped().
+		Preload("Contacts", orderContacts).
+		Where("id = ? AND organization_id = ?", id, organizationID).
+		First(&client).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &client, nil
+}
+
+// UpdateClient saves the client, and replaces its contacts when contacts is
+// not nil
+func (r *clientRepository) UpdateClient(client *models.Client, contacts *[]models.ClientContact) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Contacts").Save(client).Error; err != nil {
+			return err
+		}
+
+		if contacts == nil {
+			return nil
+		}
+
+		if err := tx.Where("client_id = ?", client.ID).Delete(&models.ClientContact{}).Error; err != nil {
+			return err
+		}
+
+		for i := range *contacts {
+			(*contacts)[i].ClientID = client.ID
+		}
+
+		if len(*contacts) > 0 {
+			if err := tx.Create(contacts).Error; err != nil {
+				return err
+			}
+		}
+
+		client.Contacts = *contacts
+		return nil
+	})
+}
+
+func orderContacts(db *gorm.DB) *gorm.DB {
+	return db.Order("position")
 }
 
-func (r *clientRepository) DeleteClient(id, userID uint) error {
-	return r.db.Where("id = ? AND user_id = ?", id, userID).Delete(&models.Client{}).Error
+func (r *clientRepository) ArchiveClient(id, organizationID uint) error {
+	result := r.db.Where("id = ? AND organization_id = ?", id, organizationID).Delete(&models.Client{})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (r *clientRepository) RestoreClient(id, organizationID uint) error {
+	result := r.db.Unscoped().Model(&models.Client{}).
+		Where("id = ? AND organization_id = ? AND deleted_at IS NOT NULL", id, organizationID).
+		Update("deleted_at", nil)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// DeleteClient removes an active or archived client for good. Clients still
+// referenced by invoices or payments are kept, errors.ErrClientInUse is
+// returned for them.
+func (r *clientRepository) DeleteClient(id, organizationID uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var client models.Client
+		err := tx.Unscoped().
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND organization_id = ?", id, organizationID).
+			First(&client).Error
+		if err != nil {
+			return err
+		}
+
+		for _, model := range []interface{}{&models.Invoice{}, &models.Payment{}} {
+			var references int64
+			if err := tx.Unscoped().Model(model).Where("client_id = ?", client.ID).Count(&references).Error; err != nil {
+				return err
+			}
+
+			if references > 0 {
+				return errors.ErrClientInUse
+			}
+		}
+
+		if err := tx.Where("survivor_id = ?", client.ID).Delete(&models.ClientMerge{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Unscoped().Delete(&client).Error
+	})
+}
+
+// MergeClients moves the invoices, payments, contacts and earlier merges of
+// merge.DuplicateID to merge.SurvivorID, archives the duplicate and saves
+// merge with what was moved. The survivor must not be archived.
+func (r *clientRepository) MergeClients(merge *models.ClientMerge) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var clients []models.Client
+		err := tx.Unscoped().
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id IN ? AND organization_id = ?", []uint{merge.SurvivorID, merge.DuplicateID}, merge.OrganizationID).
+			Order("id").
+			Find(&clients).Error
+		if err != nil {
+			return err
+		}
+
+		if len(clients) != 2 {
+			return gorm.ErrRecordNotFound
+		}
+
+		survivor, duplicate := clients[0], clients[1]
+		if survivor.ID != merge.SurvivorID {
+			survivor, duplicate = duplicate, survivor
+		}
+
+		if survivor.DeletedAt.Valid {
+			return errors.ErrClientArchived
+		}
+
+		result := tx.Model(&models.Invoice{}).
+			Where("client_id = ? AND organization_id = ?", duplicate.ID, merge.OrganizationID).
+			Update("client_id", survivor.ID)
+		if result.Error != nil {
+			return result.Error
+		}
+		merge.Invoices = result.RowsAffected
+
+		result = tx.Model(&models.Payment{}).
+			Where("client_id = ? AND organization_id = ?", duplicate.ID, merge.OrganizationID).
+			Update("client_id", survivor.ID)
+		if result.Error != nil {
+			return result.Error
+		}
+		merge.Payments = result.RowsAffected
+
+		// The duplicate's contacts go after the survivor's own
+		var position int
+		err = tx.Model(&models.ClientContact{}).
+			Where("client_id = ?", survivor.ID).
+			Select("COALESCE(MAX(position) + 1, 0)").
+			Scan(&position).Error
+		if err != nil {
+			return err
+		}
+
+		result = tx.Model(&models.ClientContact{}).
+			Where("client_id = ?", duplicate.ID).
+			Updates(map[string]interface{}{
+				"client_id": survivor.ID,
+				"position":  gorm.Expr("position + ?", position),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		merge.Contacts = result.RowsAffected
+
+		err = tx.Model(&models.ClientMerge{}).
+			Where("survivor_id = ?", duplicate.ID).
+			Update("survivor_id", survivor.ID).Error
+		if err != nil {
+			return err
+		}
+
+		if !duplicate.DeletedAt.Valid {
+			if err := tx.Delete(&duplicate).Error; err != nil {
+				return err
+			}
+		}
+
+		merge.DuplicateName = duplicate.Name
+		merge.DuplicateEmail = duplicate.Email
+		merge.DuplicatePhone = duplicate.Phone
+		return tx.Create(merge).Error
+	})
+}
+
+// ListClientMerges lists the clients merged into survivorID, newest first
+func (r *clientRepository) ListClientMerges(survivorID, organizationID uint) ([]models.ClientMerge, error) {
+	var merges []models.ClientMerge
+	err := r.db.Where("survivor_id = ? AND organization_id = ?", survivorID, organizationID).
+		Order("created_at DESC, id DESC").
+		Find(&merges).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return merges, nil
 }
@@ -0,0 +1,105 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/hutamy/invoice-generator-backend/models"
+	"gorm.io/gorm"
+)
+
+type ExportRepository interface {
+	CreateJob(job *models.ExportJob) error
+	GetJobByID(id, organizationID uint) (*models.ExportJob, error)
+	UpdateJob(job *models.ExportJob) error
+	UpdateProgress(id uint, processed int) error
+	ClaimJob(job *models.ExportJob) (bool, error)
+	CountUnfinishedJobs(userID uint) (int64, error)
+	ListStaleJobs(before time.Time) ([]models.ExportJob, error)
+	ListExpiredJobs(now time.Time) ([]models.ExportJob, error)
+}
+
+type exportRepository struct {
+	db *gorm.DB
+}
+
+func NewExportRepository(db *gorm.DB) ExportRepository {
+	return &exportRepository{db: db}
+}
+
+func (r *exportRepository) CreateJob(job *models.ExportJob) error {
+	return r.db.Create(job).Error
+}
+
+func (r *exportRepository) GetJobByID(id, organizationID uint) (*models.ExportJob, error) {
+	var job models.ExportJob
+	err := r.db.Where("id = ? AND organization_id = ?", id, organizationID).First(&job).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+func (r *exportRepository) UpdateJob(job *models.ExportJob) error {
+	return r.db.Save(job).Error
+}
+
+func (r *exportRepository) UpdateProgress(id uint, processed int) error {
+	return r.db.Model(&models.ExportJob{}).Where("id = ?", id).Update("processed", processed).Error
+}
+
+// ClaimJob moves a pending job to running and counts the attempt. It reports
+// false when the job is no longer pending, for example because another
+// instance claimed it first.
+func (r *exportRepository) ClaimJob(job *models.ExportJob) (bool, error) {
+	result := r.db.Model(&models.ExportJob{}).
+		Where("id = ? AND status = ?", job.ID, models.ExportStatusPending).
+		Updates(map[string]interface{}{
+			"status":    models.ExportStatusRunning,
+			"processed": 0,
+			"attempts":  gorm.Expr("attempts + 1"),
+		})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false, result.Error
+	}
+
+	job.Status = models.ExportStatusRunning
+	job.Processed = 0
+	job.Attempts++
+	return true, nil
+}
+
+func (r *exportRepository) CountUnfinishedJobs(userID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.ExportJob{}).
+		Where("user_id = ? AND status IN ?", userID, []string{models.ExportStatusPending, models.ExportStatusRunning}).
+		Count(&count).Error
+	return count, err
+}
+
+// ListStaleJobs lists pending and running jobs without progress since before,
+// which were left behind by a restart
+func (r *exportRepository) ListStaleJobs(before time.Time) ([]models.ExportJob, error) {
+	var jobs []models.ExportJob
+	err := r.db.Where("status IN ? AND updated_at < ?",
+		[]string{models.ExportStatusPending, models.ExportStatusRunning}, before).
+		Order("id").
+		Find(&jobs).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+// ListExpiredJobs lists completed jobs whose archive is past its expiry
+func (r *exportRepository) ListExpiredJobs(now time.Time) ([]models.ExportJob, error) {
+	var jobs []models.ExportJob
+	err := r.db.Where("status = ? AND expires_at < ?", models.ExportStatusCompleted, now).
+		Find(&jobs).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return jobs, nil
+}
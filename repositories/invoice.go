@@ -8,17 +8,22 @@ import (
 	"github.com/hutamy/invoice-generator-backend/models"
 	"github.com/hutamy/invoice-generator-backend/utils/errors"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type InvoiceRepository interface {
 	CreateInvoice(invoice *models.Invoice) error
-	GetInvoiceByID(id uint) (*models.Invoice, error)
-	ListInvoiceByUserID(userID uint) ([]models.Invoice, error)
-	ListInvoiceByUserIDWithPagination(req dto.GetInvoicesRequest) ([]models.Invoice, int64, error)
-	UpdateInvoice(id uint, req *dto.UpdateInvoiceRequest) error
-	DeleteInvoice(id uint) error
-	UpdateInvoiceStatus(id uint, status string) error
-	InvoiceSummary(userID uint) (dto.SummaryInvoice, error)
+	GetInvoiceByID(id, organizationID uint) (*models.Invoice, error)
+	ListInvoiceByOrganizationID(organizationID uint) ([]models.Invoice, error)
+	ListInvoiceByOrganizationIDWithPagination(req dto.GetInvoicesRequest) ([]models.Invoice, int64, error)
+	UpdateInvoice(id, organizationID uint, req *dto.UpdateInvoiceRequest) error
+	UpdateInvoiceSender(invoice *models.Invoice) error
+	UpdateInvoiceClient(invoice *models.Invoice) error
+	DeleteInvoice(id, organizationID uint) error
+	UpdateInvoiceStatus(id, organizationID uint, status string) error
+	InvoiceSummary(organizationID uint) (dto.SummaryInvoice, error)
+	ListInvoicesForExport(job *models.ExportJob) ([]models.Invoice, error)
+	ListIssuedInvoicesUntil(clientID, organizationID uint, currency string, until time.Time) ([]models.Invoice, error)
 }
 
 type invoiceRepository struct {
@@ -29,33 +34,52 @@ func NewInvoiceRepository(db *gorm.DB) InvoiceRepository {
 	return &invoiceRepository{db: db}
 }
 
+// CreateInvoice stores the invoice. Invoices without a number get the next one
+// from their sender profile's sequence.
 func (r *invoiceRepository) CreateInvoice(invoice *models.Invoice) error {
-	return r.db.Create(invoice).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if invoice.InvoiceNumber == "" && invoice.SenderProfileID != nil {
+			number, err := allocateInvoiceNumber(tx, *invoice.SenderProfileID)
+			if err != nil {
+				return err
+			}
+
+			invoice.InvoiceNumber = number
+		}
+
+		return tx.Create(invoice).Error
+	})
 }
 
-func (r *invoiceRepository) GetInvoiceByID(id uint) (*models.Invoice, error) {
+func (r *invoiceRepository) GetInvoiceByID(id, organizationID uint) (*models.Invoice, error) {
 	var invoice models.Invoice
-	if err := r.db.Preload("Items").First(&invoice, id).Error; err != nil {
+	err := r.db.Preload("Items").
+		Preload("PaymentMethods", func(db *gorm.DB) *gorm.DB {
+			return db.Order("position ASC")
+		}).
+		Where("organization_id = ?", organizationID).
+		First(&invoice, id).Error
+	if err != nil {
 		return nil, err
 	}
 
 	return &invoice, nil
 }
 
-func (r *invoiceRepository) ListInvoiceByUserID(userID uint) ([]models.Invoice, error) {
+func (r *invoiceRepository) ListInvoiceByOrganizationID(organizationID uint) ([]models.Invoice, error) {
 	var invoices []models.Invoice
-	if err := r.db.Where("user_id = ?", userID).Preload("Items").Order("created_at DESC").Find(&invoices).Error; err != nil {
+	if err := r.db.Where("organization_id = ?", organizationID).Preload("Items").Order("created_at DESC").Find(&invoices).Error; err != nil {
 		return nil, err
 	}
 
 	return invoices, nil
 }
 
-func (r *invoiceRepository) ListInvoiceByUserIDWithPagination(req dto.GetInvoicesRequest) ([]models.Invoice, int64, error) {
+func (r *invoiceRepository) ListInvoiceByOrganizationIDWithPagination(req dto.GetInvoicesRequest) ([]models.Invoice, int64, error) {
 	var invoices []models.Invoice
 	var totalItems int64
 
-	query := r.db.Where("user_id = ?", req.UserID)
+	query := r.db.Where("organization_id = ?", req.OrganizationID)
 
 	// Add status filter if provided
 	if req.Status != "" {
@@ -89,139 +113,236 @@ func (r *invoiceRepository) ListInvoiceByUserIDWithPagination(req dto.GetInvoice
 	return invoices, totalItems, nil
 }
 
-func (r *invoiceRepository) UpdateInvoice(id uint, req *dto.UpdateInvoiceRequest) error {
-	var invoice models.Invoice
-	if err := r.db.Preload("Items").First(&invoice, id).Error; err != nil {
-		return err
+// changesClient reports whether req changes the client details copied onto
+// invoice. Values sent back unchanged are not a change.
+func changesClient(invoice *models.Invoice, req *dto.UpdateInvoiceRequest) bool {
+	changed := func(value *string, current string) bool {
+		return value != nil && *value != current
 	}
 
-	// Update simple fields if present
-	if req.ClientID != nil {
-		invoice.ClientID = *req.ClientID
-	}
+	return (req.ClientID != nil && *req.ClientID != invoice.ClientID) ||
+		changed(req.ClientName, invoice.ClientName) ||
+		changed(req.ClientEmail, invoice.ClientEmail) ||
+		changed(req.ClientAddress, invoice.ClientAddress) ||
+		changed(req.ClientPhone, invoice.ClientPhone) ||
+		changed(req.ClientLocale, invoice.ClientLocale)
+}
 
-	if req.DueDate != nil {
-		dueDate, err := time.Parse(time.DateOnly, *req.DueDate)
+// UpdateInvoice applies req to the invoice in one transaction, marking an
+// issued invoice paid or open again when its new total calls for it
+func (r *invoiceRepository) UpdateInvoice(id, organizationID uint, req *dto.UpdateInvoiceRequest) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var invoice models.Invoice
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Preload("Items").
+			Where("organization_id = ?", organizationID).
+			First(&invoice, id).Error
 		if err != nil {
-			return errors.ErrInvalidDateFormat
+			return err
 		}
 
-		invoice.DueDate = dueDate
-	}
+		// The client details are a copy of who the invoice was issued to, like
+		// RefreshClient they can only be changed while it is a draft
+		if invoice.Status != "draft" && changesClient(&invoice, req) {
+			return errors.ErrClientNotDraft
+		}
 
-	if req.IssueDate != nil {
-		issueDate, err := time.Parse(time.DateOnly, *req.IssueDate)
-		if err != nil {
-			return errors.ErrInvalidDateFormat
+		// Update simple fields if present
+		if req.ClientID != nil {
+			invoice.ClientID = *req.ClientID
 		}
 
-		invoice.IssueDate = issueDate
-	}
+		if req.DueDate != nil {
+			dueDate, err := time.Parse(time.DateOnly, *req.DueDate)
+			if err != nil {
+				return errors.ErrInvalidDateFormat
+			}
 
-	if req.Notes != nil {
-		invoice.Notes = *req.Notes
-	}
+			invoice.DueDate = dueDate
+		}
 
-	if req.Status != nil {
-		invoice.Status = *req.Status
-	}
+		if req.IssueDate != nil {
+			issueDate, err := time.Parse(time.DateOnly, *req.IssueDate)
+			if err != nil {
+				return errors.ErrInvalidDateFormat
+			}
 
-	if req.TaxRate != nil {
-		invoice.TaxRate = *req.TaxRate
-	}
+			invoice.IssueDate = issueDate
+		}
 
-	if req.InvoiceNumber != nil {
-		invoice.InvoiceNumber = *req.InvoiceNumber
-	}
+		if req.Notes != nil {
+			invoice.Notes = *req.Notes
+		}
 
-	if req.ClientID != nil {
-		invoice.ClientID = *req.ClientID
-	}
+		if req.TaxRate != nil {
+			invoice.TaxRate = *req.TaxRate
+		}
 
-	if req.ClientName != nil {
-		invoice.ClientName = *req.ClientName
-	}
+		if req.InvoiceNumber != nil {
+			invoice.InvoiceNumber = *req.InvoiceNumber
+		}
 
-	if req.ClientEmail != nil {
-		invoice.ClientEmail = *req.ClientEmail
-	}
+		if req.Client != nil {
+			invoice.SetClient(req.Client)
+		}
 
-	if req.ClientAddress != nil {
-		invoice.ClientAddress = *req.ClientAddress
-	}
+		if req.SenderProfileID != nil {
+			invoice.SenderProfileID = req.SenderProfileID
+			invoice.Sender = req.Sender
+		}
 
-	if req.ClientPhone != nil {
-		invoice.ClientPhone = *req.ClientPhone
-	}
+		if req.Currency != nil {
+			invoice.Currency = *req.Currency
+		}
 
-	// Map existing items by ID
-	existingItems := map[uint]models.InvoiceItem{}
-	for _, item := range invoice.Items {
-		existingItems[item.ID] = item
-	}
+		if req.PaymentMethods != nil {
+			if err := replacePaymentMethods(r.db, invoice.ID, *req.PaymentMethods); err != nil {
+				return err
+			}
 
-	// Track IDs from request to keep
-	var idsToKeep []uint
-	var subtotal float64
-	for _, itemReq := range req.Items {
-		if itemReq.ID != nil {
-			// Update existing item
-			if existingItem, ok := existingItems[*itemReq.ID]; ok {
-				existingItem.Description = itemReq.Description
-				existingItem.Quantity = itemReq.Quantity
-				existingItem.UnitPrice = itemReq.UnitPrice
-				existingItem.Total = float64(itemReq.Quantity) * itemReq.UnitPrice
-				subtotal += existingItem.Total
-				if err := r.db.Save(&existingItem).Error; err != nil {
-					return err
+			now := time.Now()
+			invoice.SenderSnapshotAt = &now
+		}
+
+		if req.ClientName != nil {
+			invoice.ClientName = *req.ClientName
+		}
+
+		if req.ClientEmail != nil {
+			invoice.ClientEmail = *req.ClientEmail
+		}
+
+		if req.ClientAddress != nil {
+			invoice.ClientAddress = *req.ClientAddress
+		}
+
+		if req.ClientPhone != nil {
+			invoice.ClientPhone = *req.ClientPhone
+		}
+
+		if req.ClientLocale != nil {
+			invoice.ClientLocale = *req.ClientLocale
+		}
+
+		// Map existing items by ID
+		existingItems := map[uint]models.InvoiceItem{}
+		for _, item := range invoice.Items {
+			existingItems[item.ID] = item
+		}
+
+		// Track IDs from request to keep
+		var idsToKeep []uint
+		var subtotal float64
+		for _, itemReq := range req.Items {
+			if itemReq.ID != nil {
+				// Update existing item
+				if existingItem, ok := existingItems[*itemReq.ID]; ok {
+					existingItem.Description = itemReq.Description
+					existingItem.Quantity = itemReq.Quantity
+					existingItem.UnitPrice = itemReq.UnitPrice
+					existingItem.Total = float64(itemReq.Quantity) * itemReq.UnitPrice
+					subtotal += existingItem.Total
+					if err := tx.Save(&existingItem).Error; err != nil {
+						return err
+					}
+					idsToKeep = append(idsToKeep, *itemReq.ID)
+				} else {
+					// ID not found in DB, return error or ignore
+					return fmt.Errorf("invoice item with ID %d not found", *itemReq.ID)
 				}
-				idsToKeep = append(idsToKeep, *itemReq.ID)
 			} else {
-				// ID not found in DB, return error or ignore
-				return fmt.Errorf("invoice item with ID %d not found", *itemReq.ID)
+				// New item to create
+				newItem := models.InvoiceItem{
+					InvoiceID:   invoice.ID,
+					Description: itemReq.Description,
+					Quantity:    itemReq.Quantity,
+					UnitPrice:   itemReq.UnitPrice,
+				}
+				newItem.Total = float64(itemReq.Quantity) * itemReq.UnitPrice
+				subtotal += newItem.Total
+				if err := tx.Create(&newItem).Error; err != nil {
+					return err
+				}
+				idsToKeep = append(idsToKeep, newItem.ID)
 			}
-		} else {
-			// New item to create
-			newItem := models.InvoiceItem{
-				InvoiceID:   invoice.ID,
-				Description: itemReq.Description,
-				Quantity:    itemReq.Quantity,
-				UnitPrice:   itemReq.UnitPrice,
+		}
+
+		// Delete items not in idsToKeep
+		for _, existingItem := range invoice.Items {
+			found := false
+			for _, id := range idsToKeep {
+				if existingItem.ID == id {
+					found = true
+					break
+				}
 			}
-			newItem.Total = float64(itemReq.Quantity) * itemReq.UnitPrice
-			subtotal += newItem.Total
-			if err := r.db.Create(&newItem).Error; err != nil {
-				return err
+			if !found {
+				if err := tx.Delete(&existingItem).Error; err != nil {
+					return err
+				}
 			}
-			idsToKeep = append(idsToKeep, newItem.ID)
 		}
-	}
 
-	// Delete items not in idsToKeep
-	for _, existingItem := range invoice.Items {
-		found := false
-		for _, id := range idsToKeep {
-			if existingItem.ID == id {
-				found = true
-				break
-			}
+		invoice.Subtotal = subtotal
+		invoice.Tax = invoice.TaxRate * subtotal / 100
+		invoice.Total = invoice.Subtotal + invoice.Tax
+		if err := tx.Save(&invoice).Error; err != nil {
+			return err
 		}
-		if !found {
-			if err := r.db.Delete(&existingItem).Error; err != nil {
-				return err
-			}
+
+		// A changed total can settle an issued invoice or leave it short
+		if invoice.Status == "draft" {
+			return nil
+		}
+
+		return syncInvoiceStatus(tx, invoice.ID)
+	})
+}
+
+// UpdateInvoiceSender stores the copy of the sender details and payment
+// methods held by invoice
+func (r *invoiceRepository) UpdateInvoiceSender(invoice *models.Invoice) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(invoice).
+			Select("sender_profile_id", "sender_name", "sender_email", "sender_phone", "sender_address",
+				"sender_tax_id", "sender_logo_id", "sender_snapshot_at").
+			Updates(invoice).Error
+		if err != nil {
+			return err
+		}
+
+		return replacePaymentMethods(tx, invoice.ID, invoice.PaymentMethods)
+	})
+}
+
+// UpdateInvoiceClient stores the copy of the client details held by invoice
+func (r *invoiceRepository) UpdateInvoiceClient(invoice *models.Invoice) error {
+	return r.db.Model(invoice).
+		Select("client_name", "client_email", "client_address", "client_phone", "client_locale",
+			"client_billing_line1", "client_billing_line2", "client_billing_city", "client_billing_region",
+			"client_billing_postal_code", "client_billing_country", "client_tax_id", "client_contact").
+		Updates(invoice).Error
+}
+
+func replacePaymentMethods(tx *gorm.DB, invoiceID uint, methods []models.InvoicePaymentMethod) error {
+	if err := tx.Where("invoice_id = ?", invoiceID).Delete(&models.InvoicePaymentMethod{}).Error; err != nil {
+		return err
+	}
+
+	for i := range methods {
+		methods[i].ID = 0
+		methods[i].InvoiceID = invoiceID
+		if err := tx.Create(&methods[i]).Error; err != nil {
+			return err
 		}
 	}
 
-	invoice.Subtotal = subtotal
-	invoice.Tax = invoice.TaxRate * subtotal / 100
-	invoice.Total = invoice.Subtotal + invoice.Tax
-	return r.db.Save(&invoice).Error
+	return nil
 }
 
-func (r *invoiceRepository) DeleteInvoice(id uint) error {
+func (r *invoiceRepository) DeleteInvoice(id, organizationID uint) error {
 	var invoice models.Invoice
-	if err := r.db.First(&invoice, id).Error; err != nil {
+	if err := r.db.Where("organization_id = ?", organizationID).First(&invoice, id).Error; err != nil {
 		return err
 	}
 
@@ -233,31 +354,123 @@ func (r *invoiceRepository) DeleteInvoice(id uint) error {
 	return r.db.Delete(&invoice).Error
 }
 
-func (r *invoiceRepository) UpdateInvoiceStatus(id uint, status string) error {
-	var invoice models.Invoice
-	if err := r.db.First(&invoice, id).Error; err != nil {
-		return err
-	}
+// UpdateInvoiceStatus changes the status of the invoice. Marking it paid
+// records whatever is still outstanding as a payment received today, and
+// reopening it removes that payment again so the client's ledger keeps
+// matching the invoice.
+func (r *invoiceRepository) UpdateInvoiceStatus(id, organizationID uint, status string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var invoice models.Invoice
+		if err := tx.Where("organization_id = ?", organizationID).First(&invoice, id).Error; err != nil {
+			return err
+		}
+
+		// The client and sender details are only editable on drafts, so an
+		// issued invoice must not become one again
+		if status == "draft" && invoice.Status != "draft" {
+			return errors.ErrInvoiceIssued
+		}
+
+		if status == "paid" && invoice.Status != "paid" {
+			applied, err := appliedAmount(tx, invoice.ID)
+			if err != nil {
+				return err
+			}
+
+			if outstanding := invoice.Total - applied; outstanding > 0.005 {
+				err := tx.Create(&models.Payment{
+					OrganizationID: invoice.OrganizationID,
+					ClientID:       invoice.ClientID,
+					InvoiceID:      &invoice.ID,
+					Type:           models.PaymentTypePayment,
+					Amount:         outstanding,
+					Currency:       invoice.Currency,
+					Date:           time.Now().UTC().Truncate(24 * time.Hour),
+					Automatic:      true,
+				}).Error
+				if err != nil {
+					return err
+				}
+			}
+		}
 
-	invoice.Status = status
-	return r.db.Save(&invoice).Error
+		if invoice.Status == "paid" && status != "paid" {
+			err := tx.Where("invoice_id = ? AND automatic = ?", invoice.ID, true).Delete(&models.Payment{}).Error
+			if err != nil {
+				return err
+			}
+
+			applied, err := appliedAmount(tx, invoice.ID)
+			if err != nil {
+				return err
+			}
+
+			if applied >= invoice.Total-0.005 {
+				return errors.ErrInvoiceSettled
+			}
+		}
+
+		invoice.Status = status
+		return tx.Save(&invoice).Error
+	})
 }
 
-func (r *invoiceRepository) InvoiceSummary(userID uint) (summary dto.SummaryInvoice, err error) {
+func (r *invoiceRepository) InvoiceSummary(organizationID uint) (summary dto.SummaryInvoice, err error) {
 	r.db.Model(&models.Invoice{}).
-		Where("user_id = ? AND status = ?", userID, "paid").
+		Where("organization_id = ? AND status = ?", organizationID, "paid").
 		Select("SUM(total) as total").
 		Scan(&summary.Paid)
 
 	r.db.Model(&models.Invoice{}).
-		Where("user_id = ? AND status IN ?", userID, []string{"draft", "open"}).
+		Where("organization_id = ? AND status IN ?", organizationID, []string{"draft", "open"}).
 		Select("SUM(total) as total").
 		Scan(&summary.Unpaid)
 
 	r.db.Model(&models.Invoice{}).
-		Where("user_id = ? AND status = ?", userID, "past_due").
+		Where("organization_id = ? AND status = ?", organizationID, "past_due").
 		Select("SUM(total) as total").
 		Scan(&summary.PastDue)
 
 	return summary, nil
 }
+
+func (r *invoiceRepository) ListInvoicesForExport(job *models.ExportJob) ([]models.Invoice, error) {
+	query := r.db.Where("organization_id = ?", job.OrganizationID)
+	if job.DateFrom != nil {
+		query = query.Where("issue_date >= ?", *job.DateFrom)
+	}
+
+	if job.DateTo != nil {
+		query = query.Where("issue_date <= ?", *job.DateTo)
+	}
+
+	if job.InvoiceStatus != "" {
+		query = query.Where("status = ?", job.InvoiceStatus)
+	}
+
+	if job.ClientID != 0 {
+		query = query.Where("client_id = ?", job.ClientID)
+	}
+
+	var invoices []models.Invoice
+	if err := query.Select("id", "invoice_number").Order("issue_date ASC, id ASC").Find(&invoices).Error; err != nil {
+		return nil, err
+	}
+
+	return invoices, nil
+}
+
+// ListIssuedInvoicesUntil lists the invoices of a client in currency issued up
+// to and including until, oldest first. Drafts are not issued yet.
+func (r *invoiceRepository) ListIssuedInvoicesUntil(clientID, organizationID uint, currency string, until time.Time) ([]models.Invoice, error) {
+	var invoices []models.Invoice
+	err := r.db.Where("client_id = ? AND organization_id = ? AND currency = ? AND status <> ? AND issue_date <= ?",
+		clientID, organizationID, currency, "draft", until).
+		Order("issue_date ASC, id ASC").
+		Find(&invoices).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return invoices, nil
+}
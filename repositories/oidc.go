@@ -0,0 +1,98 @@
+package repositories
+
+import (
+	"errors"
+	"time"
+
+	"github.com/hutamy/invoice-generator-backend/models"
+	"gorm.io/gorm"
+)
+
+type OIDCRepository interface {
+	CreateState(state *models.OIDCLoginState) error
+	ConsumeState(hash, provider string) (*models.OIDCLoginState, error)
+	GetIdentity(provider, subject string) (*models.UserIdentity, error)
+	CreateIdentity(identity *models.UserIdentity) error
+	CreateUserWithIdentity(user *models.User, identity *models.UserIdentity) error
+}
+
+type oidcRepository struct {
+	db *gorm.DB
+}
+
+func NewOIDCRepository(db *gorm.DB) OIDCRepository {
+	return &oidcRepository{db: db}
+}
+
+// CreateState stores a pending login and drops expired ones on the way
+func (r *oidcRepository) CreateState(state *models.OIDCLoginState) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("expires_at <= ?", time.Now()).Delete(&models.OIDCLoginState{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(state).Error
+	})
+}
+
+// ConsumeState deletes an unexpired pending login and returns it, so a state
+// can only be used once. It returns gorm.ErrRecordNotFound when no such
+// login exists.
+func (r *oidcRepository) ConsumeState(hash, provider string) (*models.OIDCLoginState, error) {
+	var state models.OIDCLoginState
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("state_hash = ? AND provider = ? AND expires_at > ?", hash, provider, time.Now()).
+			First(&state).Error
+		if err != nil {
+			return err
+		}
+
+		result := tx.Delete(&models.OIDCLoginState{}, state.ID)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &state, nil
+}
+
+func (r *oidcRepository) GetIdentity(provider, subject string) (*models.UserIdentity, error) {
+	var identity models.UserIdentity
+	err := r.db.Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+
+	return &identity, err
+}
+
+func (r *oidcRepository) CreateIdentity(identity *models.UserIdentity) error {
+	return r.db.Create(identity).Error
+}
+
+// CreateUserWithIdentity provisions a new user together with its personal
+// organization and first identity, so a failed link never leaves an account
+// behind.
+func (r *oidcRepository) CreateUserWithIdentity(user *models.User, identity *models.UserIdentity) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+
+		if err := createPersonalOrganization(tx, user); err != nil {
+			return err
+		}
+
+		identity.UserID = user.ID
+		return tx.Create(identity).Error
+	})
+}
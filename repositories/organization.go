@@ -0,0 +1,267 @@
+package repositories
+
+import (
+	"strings"
+	"time"
+
+	"github.com/hutamy/invoice-generator-backend/dto"
+	"github.com/hutamy/invoice-generator-backend/models"
+	"github.com/hutamy/invoice-generator-backend/utils/errors"
+	"gorm.io/gorm"
+)
+
+type OrganizationRepository interface {
+	CreateOrganization(org *models.Organization, ownerID uint) error
+	GetOrganization(id uint) (*models.Organization, error)
+	UpdateOrganization(org *models.Organization) error
+	ListMemberships(userID uint) ([]models.Membership, error)
+	GetMembership(organizationID, userID uint) (*models.Membership, error)
+	GetDefaultMembership(userID uint) (*models.Membership, error)
+	CountMemberships(userID uint) (int64, error)
+	ListMembers(organizationID uint) ([]dto.MemberResponse, error)
+	IsMember(organizationID uint, email string) (bool, error)
+	CountOwners(organizationID uint) (int64, error)
+	UpdateMemberRole(organizationID, userID uint, role string) error
+	RemoveMember(organizationID, userID uint) error
+	CreateInvitation(invitation *models.Invitation) error
+	ListInvitations(organizationID uint) ([]models.Invitation, error)
+	DeleteInvitation(id, organizationID uint) error
+	AcceptInvitation(hash string, user *models.User) (*models.Membership, error)
+}
+
+type organizationRepository struct {
+	db *gorm.DB
+}
+
+func NewOrganizationRepository(db *gorm.DB) OrganizationRepository {
+	return &organizationRepository{db: db}
+}
+
+// CreateOrganization stores org and makes ownerID its owner
+func (r *organizationRepository) CreateOrganization(org *models.Organization, ownerID uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return createOrganization(tx, org, ownerID)
+	})
+}
+
+func (r *organizationRepository) GetOrganization(id uint) (*models.Organization, error) {
+	var org models.Organization
+	if err := r.db.First(&org, id).Error; err != nil {
+		return nil, err
+	}
+
+	return &org, nil
+}
+
+func (r *organizationRepository) UpdateOrganization(org *models.Organization) error {
+	return r.db.Save(org).Error
+}
+
+func (r *organizationRepository) ListMemberships(userID uint) ([]models.Membership, error) {
+	var memberships []models.Membership
+	err := r.db.Preload("Organization").Where("user_id = ?", userID).Order("id ASC").Find(&memberships).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return memberships, nil
+}
+
+func (r *organizationRepository) GetMembership(organizationID, userID uint) (*models.Membership, error) {
+	var membership models.Membership
+	err := r.db.Where("organization_id = ? AND user_id = ?", organizationID, userID).First(&membership).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &membership, nil
+}
+
+// GetDefaultMembership returns the oldest membership of the user, which is
+// their personal organization unless they left it.
+func (r *organizationRepository) GetDefaultMembership(userID uint) (*models.Membership, error) {
+	var membership models.Membership
+	if err := r.db.Where("user_id = ?", userID).Order("id ASC").First(&membership).Error; err != nil {
+		return nil, err
+	}
+
+	return &membership, nil
+}
+
+func (r *organizationRepository) CountMemberships(userID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.Membership{}).Where("user_id = ?", userID).Count(&count).Error
+	return count, err
+}
+
+func (r *organizationRepository) ListMembers(organizationID uint) ([]dto.MemberResponse, error) {
+	var members []dto.MemberResponse
+	err := r.db.Model(&models.Membership{}).
+		Select("memberships.user_id, users.name, users.email, memberships.role, memberships.created_at AS joined_at").
+		Joins("JOIN users ON users.id = memberships.user_id AND users.deleted_at IS NULL").
+		Where("memberships.organization_id = ?", organizationID).
+		Order("memberships.id ASC").
+		Scan(&members).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// IsMember reports whether the user with the given email belongs to the
+// organization.
+func (r *organizationRepository) IsMember(organizationID uint, email string) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.Membership{}).
+		Joins("JOIN users ON users.id = memberships.user_id AND users.deleted_at IS NULL").
+		Where("memberships.organization_id = ? AND LOWER(users.email) = ?", organizationID, strings.ToLower(email)).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (r *organizationRepository) CountOwners(organizationID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.Membership{}).
+		Where("organization_id = ? AND role = ?", organizationID, models.RoleOwner).
+		Count(&count).Error
+	return count, err
+}
+
+func (r *organizationRepository) UpdateMemberRole(organizationID, userID uint, role string) error {
+	result := r.db.Model(&models.Membership{}).
+		Where("organization_id = ? AND user_id = ?", organizationID, userID).
+		Update("role", role)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (r *organizationRepository) RemoveMember(organizationID, userID uint) error {
+	result := r.db.Where("organization_id = ? AND user_id = ?", organizationID, userID).Delete(&models.Membership{})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// CreateInvitation stores invitation and drops any earlier pending invitation
+// for the same address, so only the most recent email works.
+func (r *organizationRepository) CreateInvitation(invitation *models.Invitation) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("organization_id = ? AND LOWER(email) = ? AND accepted_at IS NULL",
+			invitation.OrganizationID, strings.ToLower(invitation.Email)).
+			Delete(&models.Invitation{}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Create(invitation).Error
+	})
+}
+
+// ListInvitations returns the pending, unexpired invitations
+func (r *organizationRepository) ListInvitations(organizationID uint) ([]models.Invitation, error) {
+	var invitations []models.Invitation
+	err := r.db.Where("organization_id = ? AND accepted_at IS NULL AND expires_at > ?", organizationID, time.Now()).
+		Order("created_at DESC").
+		Find(&invitations).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return invitations, nil
+}
+
+func (r *organizationRepository) DeleteInvitation(id, organizationID uint) error {
+	result := r.db.Where("id = ? AND organization_id = ? AND accepted_at IS NULL", id, organizationID).
+		Delete(&models.Invitation{})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// AcceptInvitation marks a pending invitation sent to the user's email as
+// accepted and adds the user to the organization with the invited role. It
+// returns gorm.ErrRecordNotFound when no such invitation exists.
+func (r *organizationRepository) AcceptInvitation(hash string, user *models.User) (*models.Membership, error) {
+	var membership models.Membership
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var invitation models.Invitation
+		now := time.Now()
+		err := tx.Where("token_hash = ? AND accepted_at IS NULL AND expires_at > ?", hash, now).
+			First(&invitation).Error
+		if err != nil {
+			return err
+		}
+
+		if !strings.EqualFold(invitation.Email, user.Email) {
+			return errors.ErrInvitationEmailMismatch
+		}
+
+		result := tx.Model(&models.Invitation{}).
+			Where("id = ? AND accepted_at IS NULL", invitation.ID).
+			Update("accepted_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		membership = models.Membership{
+			OrganizationID: invitation.OrganizationID,
+			UserID:         user.ID,
+			Role:           invitation.Role,
+		}
+		if err := tx.Create(&membership).Error; err != nil {
+			if err == gorm.ErrDuplicatedKey {
+				return errors.ErrAlreadyMember
+			}
+
+			return err
+		}
+
+		return tx.Preload("Organization").First(&membership, membership.ID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &membership, nil
+}
+
+func createOrganization(tx *gorm.DB, org *models.Organization, ownerID uint) error {
+	if err := tx.Create(org).Error; err != nil {
+		return err
+	}
+
+	return tx.Create(&models.Membership{
+		OrganizationID: org.ID,
+		UserID:         ownerID,
+		Role:           models.RoleOwner,
+	}).Error
+}
+
+// createPersonalOrganization gives a new user an organization of their own
+func createPersonalOrganization(tx *gorm.DB, user *models.User) error {
+	return createOrganization(tx, &models.Organization{Name: user.Name}, user.ID)
+}
@@ -0,0 +1,136 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/hutamy/invoice-generator-backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type PaymentRepository interface {
+	CreatePayment(payment *models.Payment) error
+	ListPayments(clientID, organizationID uint) ([]models.Payment, error)
+	GetPayment(id, clientID, organizationID uint) (*models.Payment, error)
+	DeletePayment(payment *models.Payment) error
+	ListPaymentsUntil(clientID, organizationID uint, currency string, until time.Time) ([]models.Payment, error)
+}
+
+type paymentRepository struct {
+	db *gorm.DB
+}
+
+func NewPaymentRepository(db *gorm.DB) PaymentRepository {
+	return &paymentRepository{db: db}
+}
+
+// CreatePayment stores a payment and, in the same transaction, marks the
+// invoice it is applied to paid once the invoice is settled
+func (r *paymentRepository) CreatePayment(payment *models.Payment) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(payment).Error; err != nil {
+			return err
+		}
+
+		if payment.InvoiceID == nil {
+			return nil
+		}
+
+		return syncInvoiceStatus(tx, *payment.InvoiceID)
+	})
+}
+
+func (r *paymentRepository) ListPayments(clientID, organizationID uint) ([]models.Payment, error) {
+	var payments []models.Payment
+	err := r.db.Where("client_id = ? AND organization_id = ?", clientID, organizationID).
+		Order("date DESC, id DESC").
+		Find(&payments).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return payments, nil
+}
+
+func (r *paymentRepository) GetPayment(id, clientID, organizationID uint) (*models.Payment, error) {
+	var payment models.Payment
+	err := r.db.Where("id = ? AND client_id = ? AND organization_id = ?", id, clientID, organizationID).
+		First(&payment).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &payment, nil
+}
+
+// DeletePayment removes a payment and, in the same transaction, opens the
+// paid invoice it was applied to again when it is no longer settled
+func (r *paymentRepository) DeletePayment(payment *models.Payment) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(payment).Error; err != nil {
+			return err
+		}
+
+		if payment.InvoiceID == nil {
+			return nil
+		}
+
+		return syncInvoiceStatus(tx, *payment.InvoiceID)
+	})
+}
+
+// ListPaymentsUntil lists the payments of a client in currency dated up to
+// and including until, oldest first
+func (r *paymentRepository) ListPaymentsUntil(clientID, organizationID uint, currency string, until time.Time) ([]models.Payment, error) {
+	var payments []models.Payment
+	err := r.db.Where("client_id = ? AND organization_id = ? AND currency = ? AND date <= ?",
+		clientID, organizationID, currency, until).
+		Order("date ASC, id ASC").
+		Find(&payments).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return payments, nil
+}
+
+// syncInvoiceStatus marks the invoice paid when the payments applied to it
+// settle it, and opens a paid invoice again when they no longer do. The
+// invoice row is locked so concurrent payments see each other's amounts.
+func syncInvoiceStatus(tx *gorm.DB, invoiceID uint) error {
+	var invoice models.Invoice
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id", "total", "status").
+		First(&invoice, invoiceID).Error
+	if err != nil {
+		return err
+	}
+
+	applied, err := appliedAmount(tx, invoice.ID)
+	if err != nil {
+		return err
+	}
+
+	settled := applied >= invoice.Total-0.005
+	var status string
+	switch {
+	case settled && invoice.Status != "paid":
+		status = "paid"
+	case !settled && invoice.Status == "paid":
+		status = "open"
+	default:
+		return nil
+	}
+
+	return tx.Model(&invoice).Update("status", status).Error
+}
+
+// appliedAmount sums the payments and credits applied to an invoice
+func appliedAmount(tx *gorm.DB, invoiceID uint) (float64, error) {
+	var applied float64
+	err := tx.Model(&models.Payment{}).
+		Where("invoice_id = ?", invoiceID).
+		Select("COALESCE(SUM(amount), 0)").
+		Scan(&applied).Error
+	return applied, err
+}
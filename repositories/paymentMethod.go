@@ -0,0 +1,62 @@
+package repositories
+
+import (
+	"github.com/hutamy/invoice-generator-backend/models"
+	"gorm.io/gorm"
+)
+
+type PaymentMethodRepository interface {
+	CreatePaymentMethod(method *models.PaymentMethod) error
+	ListPaymentMethods(senderProfileID uint) ([]models.PaymentMethod, error)
+	GetPaymentMethod(id, senderProfileID uint) (*models.PaymentMethod, error)
+	UpdatePaymentMethod(method *models.PaymentMethod) error
+	DeletePaymentMethod(id, senderProfileID uint) error
+}
+
+type paymentMethodRepository struct {
+	db *gorm.DB
+}
+
+func NewPaymentMethodRepository(db *gorm.DB) PaymentMethodRepository {
+	return &paymentMethodRepository{db: db}
+}
+
+func (r *paymentMethodRepository) CreatePaymentMethod(method *models.PaymentMethod) error {
+	return r.db.Create(method).Error
+}
+
+func (r *paymentMethodRepository) ListPaymentMethods(senderProfileID uint) ([]models.PaymentMethod, error) {
+	var methods []models.PaymentMethod
+	if err := r.db.Where("sender_profile_id = ?", senderProfileID).Order("position ASC, id ASC").Find(&methods).Error; err != nil {
+		return nil, err
+	}
+
+	return methods, nil
+}
+
+func (r *paymentMethodRepository) GetPaymentMethod(id, senderProfileID uint) (*models.PaymentMethod, error) {
+	var method models.PaymentMethod
+	if err := r.db.Where("id = ? AND sender_profile_id = ?", id, senderProfileID).First(&method).Error; err != nil {
+		return nil, err
+	}
+
+	return &method, nil
+}
+
+func (r *paymentMethodRepository) UpdatePaymentMethod(method *models.PaymentMethod) error {
+	return r.db.Save(method).Error
+}
+
+// DeletePaymentMethod removes the method. Invoices keep their copy of it.
+func (r *paymentMethodRepository) DeletePaymentMethod(id, senderProfileID uint) error {
+	result := r.db.Where("id = ? AND sender_profile_id = ?", id, senderProfileID).Delete(&models.PaymentMethod{})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
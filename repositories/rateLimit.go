@@ -0,0 +1,76 @@
+package repositories
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/hutamy/invoice-generator-backend/models"
+	"github.com/hutamy/invoice-generator-backend/utils/ratelimit"
+	"gorm.io/gorm"
+)
+
+// rateLimitSweepInterval is how often each replica deletes expired counters
+const rateLimitSweepInterval = 5 * time.Minute
+
+type rateLimitRepository struct {
+	db        *gorm.DB
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+// NewRateLimitRepository returns a rate limit store shared through Postgres
+func NewRateLimitRepository(db *gorm.DB) ratelimit.Store {
+	return &rateLimitRepository{db: db, lastSweep: time.Now()}
+}
+
+// Increment upserts the counter in a single statement so concurrent replicas
+// never lose a hit.
+func (r *rateLimitRepository) Increment(key string, window time.Duration) (ratelimit.Counter, error) {
+	now := time.Now()
+	r.sweep(now)
+
+	var counter models.RateLimitCounter
+	err := r.db.Raw(`
+		INSERT INTO rate_limit_counters (key, count, expires_at) VALUES (?, 1, ?)
+		ON CONFLICT (key) DO UPDATE SET
+			count = CASE WHEN rate_limit_counters.expires_at <= ? THEN 1 ELSE rate_limit_counters.count + 1 END,
+			expires_at = CASE WHEN rate_limit_counters.expires_at <= ? THEN EXCLUDED.expires_at ELSE rate_limit_counters.expires_at END
+		RETURNING key, count, expires_at`,
+		key, now.Add(window), now, now,
+	).Scan(&counter).Error
+	if err != nil {
+		return ratelimit.Counter{}, err
+	}
+
+	return ratelimit.Counter{Count: counter.Count, ExpiresAt: counter.ExpiresAt}, nil
+}
+
+func (r *rateLimitRepository) Get(key string) (ratelimit.Counter, error) {
+	var counters []models.RateLimitCounter
+	err := r.db.Where("key = ? AND expires_at > ?", key, time.Now()).Limit(1).Find(&counters).Error
+	if err != nil || len(counters) == 0 {
+		return ratelimit.Counter{}, err
+	}
+
+	return ratelimit.Counter{Count: counters[0].Count, ExpiresAt: counters[0].ExpiresAt}, nil
+}
+
+func (r *rateLimitRepository) Reset(key string) error {
+	return r.db.Where("key = ?", key).Delete(&models.RateLimitCounter{}).Error
+}
+
+// sweep removes counters whose window has passed, at most once per interval
+func (r *rateLimitRepository) sweep(now time.Time) {
+	r.mu.Lock()
+	if now.Sub(r.lastSweep) < rateLimitSweepInterval {
+		r.mu.Unlock()
+		return
+	}
+	r.lastSweep = now
+	r.mu.Unlock()
+
+	if err := r.db.Where("expires_at <= ?", now).Delete(&models.RateLimitCounter{}).Error; err != nil {
+		log.Printf("failed to delete expired rate limit counters: %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/hutamy/invoice-generator-backend/models"
+	"gorm.io/gorm"
+)
+
+type RefreshTokenRepository interface {
+	CreateToken(token *models.RefreshToken) error
+	GetTokenByHash(hash string) (*models.RefreshToken, error)
+	RotateToken(current *models.RefreshToken, next *models.RefreshToken) (bool, error)
+	RevokeFamily(familyID string) error
+	RevokeAllForUser(userID uint) error
+}
+
+type refreshTokenRepository struct {
+	db *gorm.DB
+}
+
+func NewRefreshTokenRepository(db *gorm.DB) RefreshTokenRepository {
+	return &refreshTokenRepository{db: db}
+}
+
+func (r *refreshTokenRepository) CreateToken(token *models.RefreshToken) error {
+	return r.db.Create(token).Error
+}
+
+func (r *refreshTokenRepository) GetTokenByHash(hash string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	err := r.db.Where("token_hash = ?", hash).First(&token).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// RotateToken marks current as used and stores next in the same transaction.
+// It returns false when current was already rotated or revoked, which means
+// the token has been used before.
+func (r *refreshTokenRepository) RotateToken(current *models.RefreshToken, next *models.RefreshToken) (bool, error) {
+	rotated := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND rotated_at IS NULL AND revoked_at IS NULL", current.ID).
+			Update("rotated_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		rotated = true
+		return tx.Create(next).Error
+	})
+
+	return rotated, err
+}
+
+// RevokeFamily revokes the refresh tokens of one sign-in and ends its session
+func (r *refreshTokenRepository) RevokeFamily(familyID string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		err := tx.Model(&models.RefreshToken{}).
+			Where("family_id = ? AND revoked_at IS NULL", familyID).
+			Update("revoked_at", now).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(&models.Session{}).
+			Where("family_id = ? AND revoked_at IS NULL", familyID).
+			Update("revoked_at", now).Error
+	})
+}
+
+// RevokeAllForUser revokes every refresh token and session of the user
+func (r *refreshTokenRepository) RevokeAllForUser(userID uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		err := tx.Model(&models.RefreshToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", now).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(&models.Session{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", now).Error
+	})
+}
@@ -0,0 +1,137 @@
+package repositories
+
+import (
+	"github.com/hutamy/invoice-generator-backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type SenderProfileRepository interface {
+	CreateSenderProfile(profile *models.SenderProfile) error
+	ListSenderProfiles(organizationID uint) ([]models.SenderProfile, error)
+	GetSenderProfile(id, organizationID uint) (*models.SenderProfile, error)
+	GetDefaultSenderProfile(organizationID uint) (*models.SenderProfile, error)
+	UpdateSenderProfile(profile *models.SenderProfile) error
+	SetNextNumber(id uint, next int) error
+	DeleteSenderProfile(id, organizationID uint) error
+	CreateLogo(logo *models.Logo) error
+	GetLogo(id uint) (*models.Logo, error)
+}
+
+type senderProfileRepository struct {
+	db *gorm.DB
+}
+
+func NewSenderProfileRepository(db *gorm.DB) SenderProfileRepository {
+	return &senderProfileRepository{db: db}
+}
+
+func (r *senderProfileRepository) CreateSenderProfile(profile *models.SenderProfile) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if profile.IsDefault {
+			if err := clearDefaultSenderProfile(tx, profile.OrganizationID); err != nil {
+				return err
+			}
+		}
+
+		return tx.Create(profile).Error
+	})
+}
+
+func (r *senderProfileRepository) ListSenderProfiles(organizationID uint) ([]models.SenderProfile, error) {
+	var profiles []models.SenderProfile
+	if err := r.db.Where("organization_id = ?", organizationID).Order("is_default DESC, name ASC").Find(&profiles).Error; err != nil {
+		return nil, err
+	}
+
+	return profiles, nil
+}
+
+func (r *senderProfileRepository) GetSenderProfile(id, organizationID uint) (*models.SenderProfile, error) {
+	var profile models.SenderProfile
+	if err := r.db.Where("id = ? AND organization_id = ?", id, organizationID).First(&profile).Error; err != nil {
+		return nil, err
+	}
+
+	return &profile, nil
+}
+
+func (r *senderProfileRepository) GetDefaultSenderProfile(organizationID uint) (*models.SenderProfile, error) {
+	var profile models.SenderProfile
+	if err := r.db.Where("organization_id = ? AND is_default", organizationID).First(&profile).Error; err != nil {
+		return nil, err
+	}
+
+	return &profile, nil
+}
+
+func (r *senderProfileRepository) UpdateSenderProfile(profile *models.SenderProfile) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if profile.IsDefault {
+			if err := clearDefaultSenderProfile(tx, profile.OrganizationID); err != nil {
+				return err
+			}
+		}
+
+		// next_number only moves through allocateInvoiceNumber and SetNextNumber
+		// so a concurrent invoice cannot be handed the same number twice
+		return tx.Select("*").Omit("next_number", "created_at").Updates(profile).Error
+	})
+}
+
+func (r *senderProfileRepository) SetNextNumber(id uint, next int) error {
+	return r.db.Model(&models.SenderProfile{}).Where("id = ?", id).Update("next_number", next).Error
+}
+
+// DeleteSenderProfile removes the profile. Invoices keep their copy of its
+// details and logo.
+func (r *senderProfileRepository) DeleteSenderProfile(id, organizationID uint) error {
+	result := r.db.Where("id = ? AND organization_id = ?", id, organizationID).Delete(&models.SenderProfile{})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (r *senderProfileRepository) CreateLogo(logo *models.Logo) error {
+	return r.db.Create(logo).Error
+}
+
+func (r *senderProfileRepository) GetLogo(id uint) (*models.Logo, error) {
+	var logo models.Logo
+	if err := r.db.First(&logo, id).Error; err != nil {
+		return nil, err
+	}
+
+	return &logo, nil
+}
+
+func clearDefaultSenderProfile(tx *gorm.DB, organizationID uint) error {
+	return tx.Model(&models.SenderProfile{}).
+		Where("organization_id = ? AND is_default", organizationID).
+		Update("is_default", false).Error
+}
+
+// allocateInvoiceNumber takes the next number from the profile's sequence.
+// The row is incremented in place so concurrent invoices never share a number.
+func allocateInvoiceNumber(tx *gorm.DB, profileID uint) (string, error) {
+	var profile models.SenderProfile
+	err := tx.Model(&profile).
+		Clauses(clause.Returning{}).
+		Where("id = ?", profileID).
+		Update("next_number", gorm.Expr("next_number + 1")).Error
+	if err != nil {
+		return "", err
+	}
+
+	if profile.ID == 0 {
+		return "", gorm.ErrRecordNotFound
+	}
+
+	return profile.FormatNumber(profile.NextNumber - 1), nil
+}
@@ -0,0 +1,71 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/hutamy/invoice-generator-backend/models"
+	"gorm.io/gorm"
+)
+
+type SessionRepository interface {
+	CreateSession(session *models.Session) error
+	GetSessionByFamily(familyID string) (*models.Session, error)
+	GetSession(id, userID uint) (*models.Session, error)
+	ListActiveSessions(userID uint) ([]models.Session, error)
+	TouchSession(familyID, userAgent, ipAddress string, expiresAt time.Time) (bool, error)
+}
+
+type sessionRepository struct {
+	db *gorm.DB
+}
+
+func NewSessionRepository(db *gorm.DB) SessionRepository {
+	return &sessionRepository{db: db}
+}
+
+func (r *sessionRepository) CreateSession(session *models.Session) error {
+	return r.db.Create(session).Error
+}
+
+func (r *sessionRepository) GetSessionByFamily(familyID string) (*models.Session, error) {
+	var session models.Session
+	err := r.db.Where("family_id = ?", familyID).First(&session).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+func (r *sessionRepository) GetSession(id, userID uint) (*models.Session, error) {
+	var session models.Session
+	err := r.db.Where("id = ? AND user_id = ?", id, userID).First(&session).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+func (r *sessionRepository) ListActiveSessions(userID uint) ([]models.Session, error) {
+	var sessions []models.Session
+	err := r.db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+// TouchSession records activity on an active session. It returns false when
+// the family has no session, e.g. for tokens issued before sessions existed.
+func (r *sessionRepository) TouchSession(familyID, userAgent, ipAddress string, expiresAt time.Time) (bool, error) {
+	result := r.db.Model(&models.Session{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Updates(map[string]interface{}{
+			"user_agent":   userAgent,
+			"ip_address":   ipAddress,
+			"expires_at":   expiresAt,
+			"last_seen_at": time.Now(),
+		})
+
+	return result.RowsAffected > 0, result.Error
+}
@@ -0,0 +1,103 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/hutamy/invoice-generator-backend/models"
+	"gorm.io/gorm"
+)
+
+type TwoFactorRepository interface {
+	SaveSecret(userID uint, encryptedSecret []byte) error
+	Enable(userID uint, step int64, codes []models.RecoveryCode) error
+	Disable(userID uint) error
+	ReplaceRecoveryCodes(userID uint, codes []models.RecoveryCode) error
+	UseRecoveryCode(userID uint, hash string) (bool, error)
+	AdvanceStep(userID uint, step int64) (bool, error)
+}
+
+type twoFactorRepository struct {
+	db *gorm.DB
+}
+
+func NewTwoFactorRepository(db *gorm.DB) TwoFactorRepository {
+	return &twoFactorRepository{db: db}
+}
+
+// SaveSecret stores a pending secret. It only takes effect once Enable is called.
+func (r *twoFactorRepository) SaveSecret(userID uint, encryptedSecret []byte) error {
+	return r.db.Model(&models.User{}).
+		Where("id = ?", userID).
+		Updates(map[string]interface{}{"totp_secret": encryptedSecret, "totp_last_step": 0}).Error
+}
+
+// Enable turns on two-factor authentication and stores the recovery codes
+func (r *twoFactorRepository) Enable(userID uint, step int64, codes []models.RecoveryCode) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.User{}).
+			Where("id = ?", userID).
+			Updates(map[string]interface{}{"two_factor_enabled": true, "totp_last_step": step}).Error
+		if err != nil {
+			return err
+		}
+
+		return replaceRecoveryCodes(tx, userID, codes)
+	})
+}
+
+func (r *twoFactorRepository) Disable(userID uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.User{}).
+			Where("id = ?", userID).
+			Updates(map[string]interface{}{"two_factor_enabled": false, "totp_secret": nil, "totp_last_step": 0}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error
+	})
+}
+
+func (r *twoFactorRepository) ReplaceRecoveryCodes(userID uint, codes []models.RecoveryCode) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return replaceRecoveryCodes(tx, userID, codes)
+	})
+}
+
+// UseRecoveryCode marks a matching unused code as used. It returns false when
+// no unused code matches.
+func (r *twoFactorRepository) UseRecoveryCode(userID uint, hash string) (bool, error) {
+	result := r.db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return result.RowsAffected > 0, nil
+}
+
+// AdvanceStep records the time step of an accepted code. It returns false when
+// that step or a later one was already used, which rejects replayed codes.
+func (r *twoFactorRepository) AdvanceStep(userID uint, step int64) (bool, error) {
+	result := r.db.Model(&models.User{}).
+		Where("id = ? AND totp_last_step < ?", userID, step).
+		Update("totp_last_step", step)
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return result.RowsAffected > 0, nil
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID uint, codes []models.RecoveryCode) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return err
+	}
+
+	if len(codes) == 0 {
+		return nil
+	}
+
+	return tx.Create(&codes).Error
+}
@@ -0,0 +1,77 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/hutamy/invoice-generator-backend/models"
+	"gorm.io/gorm"
+)
+
+type UserTokenRepository interface {
+	CreateToken(token *models.UserToken) error
+	ConsumeToken(hash, purpose string) (*models.UserToken, error)
+	InvalidateTokens(userID uint, purpose string) error
+}
+
+type userTokenRepository struct {
+	db *gorm.DB
+}
+
+func NewUserTokenRepository(db *gorm.DB) UserTokenRepository {
+	return &userTokenRepository{db: db}
+}
+
+// CreateToken stores token and invalidates every other unused token the user
+// has for the same purpose, so only the most recent email works.
+func (r *userTokenRepository) CreateToken(token *models.UserToken) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := invalidateTokens(tx, token.UserID, token.Purpose); err != nil {
+			return err
+		}
+
+		return tx.Create(token).Error
+	})
+}
+
+// ConsumeToken marks an unused, unexpired token as used and returns it. It
+// returns gorm.ErrRecordNotFound when no such token exists.
+func (r *userTokenRepository) ConsumeToken(hash, purpose string) (*models.UserToken, error) {
+	var token models.UserToken
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		err := tx.Where("token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?", hash, purpose, now).
+			First(&token).Error
+		if err != nil {
+			return err
+		}
+
+		result := tx.Model(&models.UserToken{}).
+			Where("id = ? AND used_at IS NULL", token.ID).
+			Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		token.UsedAt = &now
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+func (r *userTokenRepository) InvalidateTokens(userID uint, purpose string) error {
+	return invalidateTokens(r.db, userID, purpose)
+}
+
+func invalidateTokens(db *gorm.DB, userID uint, purpose string) error {
+	return db.Model(&models.UserToken{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+		Update("used_at", time.Now()).Error
+}
@@ -1,30 +1,153 @@
 package routes
 
 import (
+	"log"
+
+	"github.com/hutamy/invoice-generator-backend/config"
 	"github.com/hutamy/invoice-generator-backend/controllers"
 	_ "github.com/hutamy/invoice-generator-backend/docs"
 	"github.com/hutamy/invoice-generator-backend/middleware"
+	"github.com/hutamy/invoice-generator-backend/models"
 	"github.com/hutamy/invoice-generator-backend/repositories"
 	"github.com/hutamy/invoice-generator-backend/services"
 	"github.com/hutamy/invoice-generator-backend/utils"
+	"github.com/hutamy/invoice-generator-backend/utils/cache"
+	"github.com/hutamy/invoice-generator-backend/utils/mail"
+	"github.com/hutamy/invoice-generator-backend/utils/oidc"
+	"github.com/hutamy/invoice-generator-backend/utils/ratelimit"
+	"github.com/hutamy/invoice-generator-backend/utils/rbac"
 	"github.com/labstack/echo/v4"
 	echoSwagger "github.com/swaggo/echo-swagger"
 	"gorm.io/gorm"
 )
 
 func InitRoutes(e *echo.Echo, db *gorm.DB) {
+	cfg := config.GetConfig()
+
+	if err := utils.InitJWT(cfg); err != nil {
+		log.Fatalf("failed to initialize JWT keys: %v", err)
+	}
+	wellKnownController := controllers.NewWellKnownController()
+
+	mailer, err := mail.New(mail.Options{
+		Driver:       cfg.MailDriver,
+		From:         cfg.MailFrom,
+		SMTPHost:     cfg.SmtpHost,
+		SMTPPort:     cfg.SmtpPort,
+		SMTPUsername: cfg.SmtpUsername,
+		SMTPPassword: cfg.SmtpPassword,
+		Dir:          cfg.MailDir,
+	})
+	if err != nil {
+		log.Fatalf("failed to initialize mail sender: %v", err)
+	}
+
+	var rateLimitStore ratelimit.Store
+	switch cfg.RateLimitStore {
+	case "", ratelimit.StoreMemory:
+		rateLimitStore = ratelimit.NewMemoryStore()
+	case ratelimit.StorePostgres:
+		rateLimitStore = repositories.NewRateLimitRepository(db)
+	default:
+		log.Fatalf("unknown rate limit store %q", cfg.RateLimitStore)
+	}
+
+	lockout := &ratelimit.Lockout{
+		Store:         rateLimitStore,
+		Threshold:     cfg.LoginLockoutThreshold,
+		FailureWindow: cfg.LoginFailureWindow,
+		BaseDuration:  cfg.LoginLockoutDuration,
+		MaxDuration:   cfg.LoginLockoutMaxDuration,
+	}
+	authLimit := middleware.RateLimitByIP(rateLimitStore, "auth", ratelimit.Rule{
+		Limit:  cfg.RateLimitAuthRequests,
+		Window: cfg.RateLimitAuthWindow,
+	})
+	publicPDFLimit := middleware.RateLimitByIP(rateLimitStore, "public-pdf", ratelimit.Rule{
+		Limit:  cfg.RateLimitPublicPDFRequests,
+		Window: cfg.RateLimitPublicPDFWindow,
+	})
+	userLimit := middleware.RateLimitByUser(rateLimitStore, "api", ratelimit.Rule{
+		Limit:  cfg.RateLimitUserRequests,
+		Window: cfg.RateLimitUserWindow,
+	})
+	pdfLimit := middleware.RateLimitByUser(rateLimitStore, "pdf", ratelimit.Rule{
+		Limit:  cfg.RateLimitPDFRequests,
+		Window: cfg.RateLimitPDFWindow,
+	})
+
 	authRepo := repositories.NewAuthRepository(db)
-	authService := services.NewAuthService(authRepo)
-	authController := controllers.NewAuthController(authService)
+	refreshTokenRepo := repositories.NewRefreshTokenRepository(db)
+	sessionRepo := repositories.NewSessionRepository(db)
+	tokenService := services.NewTokenService(refreshTokenRepo, sessionRepo)
+	sessionController := controllers.NewSessionController(tokenService)
+	userTokenRepo := repositories.NewUserTokenRepository(db)
+	authService := services.NewAuthService(authRepo, userTokenRepo, tokenService, mailer, lockout)
+	twoFactorRepo := repositories.NewTwoFactorRepository(db)
+	twoFactorService := services.NewTwoFactorService(authRepo, twoFactorRepo, lockout)
+	twoFactorController := controllers.NewTwoFactorController(twoFactorService)
+	authController := controllers.NewAuthController(authService, tokenService, twoFactorService)
+	oidcConfigs, err := cfg.OIDCProviderConfigs()
+	if err != nil {
+		log.Fatalf("failed to load single sign-on providers: %v", err)
+	}
+	oidcProviders := make([]*oidc.Provider, 0, len(oidcConfigs))
+	for _, provider := range oidcConfigs {
+		oidcProviders = append(oidcProviders, oidc.New(oidc.Options{
+			Name:         provider.Name,
+			Issuer:       provider.Issuer,
+			ClientID:     provider.ClientID,
+			ClientSecret: provider.ClientSecret,
+			RedirectURL:  provider.RedirectURL,
+			Scopes:       provider.Scopes,
+		}))
+	}
+	oidcRepo := repositories.NewOIDCRepository(db)
+	oidcService := services.NewOIDCService(oidcProviders, oidcRepo, authRepo, tokenService)
+	oidcController := controllers.NewOIDCController(oidcService, tokenService, twoFactorService)
+
+	orgRepo := repositories.NewOrganizationRepository(db)
+	orgService := services.NewOrganizationService(orgRepo, authRepo, mailer)
+	orgController := controllers.NewOrganizationController(orgService)
+
+	apiKeyRepo := repositories.NewAPIKeyRepository(db)
+	apiKeyService := services.NewAPIKeyService(apiKeyRepo)
+	apiKeyController := controllers.NewAPIKeyController(apiKeyService)
 
 	clientRepo := repositories.NewClientRepository(db)
 	clientService := services.NewClientService(clientRepo)
 	clientController := controllers.NewClientController(clientService)
 
+	pdfCache, err := cache.New(cfg.PdfCacheBackend, cfg.PdfCacheDir, cfg.PdfCacheSize)
+	if err != nil {
+		log.Fatalf("failed to initialize PDF cache: %v", err)
+	}
+
+	certRepo := repositories.NewCertificateRepository(db)
+	certService := services.NewCertificateService(certRepo)
+	certController := controllers.NewCertificateController(certService)
+
 	invoiceRepo := repositories.NewInvoiceRepository(db)
-	invoiceService := services.NewInvoiceService(invoiceRepo, clientRepo, authRepo)
+	profileRepo := repositories.NewSenderProfileRepository(db)
+	paymentRepo := repositories.NewPaymentMethodRepository(db)
+	profileService := services.NewSenderProfileService(profileRepo, paymentRepo)
+	profileController := controllers.NewSenderProfileController(profileService)
+
+	invoiceService := services.NewInvoiceService(invoiceRepo, clientRepo, authRepo, profileRepo, paymentRepo, pdfCache, certService)
 	invoiceController := controllers.NewInvoiceController(invoiceService)
 
+	clientPaymentRepo := repositories.NewPaymentRepository(db)
+	clientPaymentService := services.NewPaymentService(clientPaymentRepo, clientRepo, invoiceRepo)
+	clientPaymentController := controllers.NewPaymentController(clientPaymentService)
+	statementService := services.NewStatementService(clientRepo, invoiceRepo, clientPaymentRepo, profileRepo)
+	statementController := controllers.NewStatementController(statementService)
+
+	exportRepo := repositories.NewExportRepository(db)
+	exportService := services.NewExportService(exportRepo, invoiceRepo, invoiceService,
+		cfg.ExportDir, cfg.ExportWorkers, cfg.ExportMaxPending, cfg.ExportRetention)
+	exportService.Start()
+	exportController := controllers.NewExportController(exportService)
+
 	// Routes for Health Check and Welcome Message
 	e.GET("/", func(c echo.Context) error {
 		return utils.Response(c, 200, "Welcome to Invoice Generator API", nil)
@@ -33,42 +156,137 @@ func InitRoutes(e *echo.Echo, db *gorm.DB) {
 		return utils.Response(c, 200, "Invoice Generator API is running", nil)
 	})
 	e.GET("/swagger/*", echoSwagger.WrapHandler)
+	e.GET("/.well-known/jwks.json", wellKnownController.JWKS)
 
 	// These routes are grouped under the "/v1" path
 	v1 := e.Group("/v1")
 	public := v1.Group("/public")
 
 	// Public Routes
-	authRoutes := public.Group("/auth")
+	authRoutes := public.Group("/auth", authLimit)
 	authRoutes.POST("/sign-up", authController.SignUp)
 	authRoutes.POST("/sign-in", authController.SignIn)
+	authRoutes.POST("/sign-in/2fa", authController.SignInTwoFactor)
+	authRoutes.POST("/refresh-token", authController.RefreshToken)
+	authRoutes.POST("/sign-out", authController.SignOut)
+	authRoutes.POST("/verify-email", authController.VerifyEmail)
+	authRoutes.POST("/verify-email/resend", authController.ResendVerification)
+	authRoutes.POST("/forgot-password", authController.ForgotPassword)
+	authRoutes.POST("/reset-password", authController.ResetPassword)
+	authRoutes.POST("/confirm-email-change", authController.ConfirmEmailChange)
+	authRoutes.GET("/oidc/providers", oidcController.Providers)
+	authRoutes.POST("/oidc/:provider/authorize", oidcController.Authorize)
+	authRoutes.POST("/oidc/:provider/callback", oidcController.Callback)
 
 	publicInvoiceRoutes := public.Group("/invoices")
-	publicInvoiceRoutes.POST("/generate-pdf", invoiceController.GeneratePublicInvoice)
+	publicInvoiceRoutes.POST("/generate-pdf", invoiceController.GeneratePublicInvoice, publicPDFLimit)
 
 	protected := v1.Group("/protected")
-	protected.Use(middleware.JWTMiddleware)
+	protected.Use(middleware.JWTMiddleware(apiKeyService, tokenService), middleware.Organization(orgService), userLimit)
+
+	// Account management needs a signed-in user, API keys are limited to the
+	// client and invoice routes their scopes allow
+	account := protected.Group("", middleware.SessionOnly)
+	account.GET("/me", authController.Me)
+	account.PUT("/me", authController.UpdateUser)
+	account.PUT("/me/password", authController.ChangePassword)
+	account.PUT("/me/email", authController.ChangeEmail)
+
+	authPrivateRoutes := account.Group("/auth")
+	authPrivateRoutes.POST("/sign-out-everywhere", authController.SignOutEverywhere)
+
+	sessionRoutes := account.Group("/sessions")
+	sessionRoutes.GET("", sessionController.ListSessions)
+	sessionRoutes.DELETE("/:id", sessionController.RevokeSession)
+
+	twoFactorRoutes := account.Group("/2fa")
+	twoFactorRoutes.POST("/enroll", twoFactorController.Enroll)
+	twoFactorRoutes.POST("/confirm", twoFactorController.Confirm)
+	twoFactorRoutes.POST("/disable", twoFactorController.Disable)
+	twoFactorRoutes.POST("/recovery-codes", twoFactorController.RegenerateRecoveryCodes)
+
+	// Client and invoice data belongs to the organization chosen with the
+	// X-Organization-ID header. Routes acting on it name the permission they
+	// need, see rbac for what each role is granted.
+	authorize := middleware.Authorize
+	account.GET("/organizations", orgController.ListOrganizations)
+	account.POST("/organizations", orgController.CreateOrganization)
+	account.POST("/invitations/accept", orgController.AcceptInvitation)
+
+	orgRoutes := account.Group("/organization")
+	orgRoutes.GET("", orgController.GetOrganization, authorize(rbac.OrganizationRead))
+	orgRoutes.PUT("", orgController.UpdateOrganization, authorize(rbac.OrganizationUpdate))
+	orgRoutes.GET("/permissions", orgController.Permissions)
+	orgRoutes.POST("/leave", orgController.LeaveOrganization)
+	orgRoutes.GET("/members", orgController.ListMembers, authorize(rbac.OrganizationRead))
+	orgRoutes.PUT("/members/:user_id", orgController.UpdateMemberRole, authorize(rbac.MembersManage))
+	orgRoutes.DELETE("/members/:user_id", orgController.RemoveMember, authorize(rbac.MembersManage))
+	orgRoutes.POST("/invitations", orgController.InviteMember, authorize(rbac.MembersManage))
+	orgRoutes.GET("/invitations", orgController.ListInvitations, authorize(rbac.MembersManage))
+	orgRoutes.DELETE("/invitations/:id", orgController.RevokeInvitation, authorize(rbac.MembersManage))
+
+	// Revoking stays open to everyone so a leaked key can always be disabled
+	apiKeyRoutes := account.Group("/api-keys")
+	apiKeyRoutes.POST("", apiKeyController.CreateAPIKey, authorize(rbac.APIKeysManage))
+	apiKeyRoutes.GET("", apiKeyController.ListAPIKeys, authorize(rbac.APIKeysManage))
+	apiKeyRoutes.DELETE("/:id", apiKeyController.RevokeAPIKey)
 
-	protected.GET("/me", authController.Me)
-	protected.PUT("/me", authController.UpdateUser)
+	certRoutes := account.Group("/signing-certificate")
+	certRoutes.POST("", certController.UploadCertificate, authorize(rbac.SigningCertificateManage))
+	certRoutes.GET("", certController.GetCertificate, authorize(rbac.OrganizationRead))
+	certRoutes.DELETE("", certController.DeleteCertificate, authorize(rbac.SigningCertificateManage))
+	certRoutes.POST("/verify", certController.VerifyDocument, authorize(rbac.OrganizationRead))
 
-	authPrivateRoutes := protected.Group("/auth")
-	authPrivateRoutes.POST("/refresh-token", authController.RefreshToken)
+	profileRoutes := account.Group("/sender-profiles")
+	profileRoutes.GET("", profileController.ListSenderProfiles, authorize(rbac.OrganizationRead))
+	profileRoutes.POST("", profileController.CreateSenderProfile, authorize(rbac.SenderProfilesManage))
+	profileRoutes.GET("/:id", profileController.GetSenderProfile, authorize(rbac.OrganizationRead))
+	profileRoutes.PUT("/:id", profileController.UpdateSenderProfile, authorize(rbac.SenderProfilesManage))
+	profileRoutes.DELETE("/:id", profileController.DeleteSenderProfile, authorize(rbac.SenderProfilesManage))
+	profileRoutes.GET("/:id/logo", profileController.GetLogo, authorize(rbac.OrganizationRead))
+	profileRoutes.POST("/:id/logo", profileController.UploadLogo, authorize(rbac.SenderProfilesManage))
+	profileRoutes.DELETE("/:id/logo", profileController.DeleteLogo, authorize(rbac.SenderProfilesManage))
+	profileRoutes.GET("/:id/payment-methods", profileController.ListPaymentMethods, authorize(rbac.OrganizationRead))
+	profileRoutes.POST("/:id/payment-methods", profileController.CreatePaymentMethod, authorize(rbac.SenderProfilesManage))
+	profileRoutes.GET("/:id/payment-methods/:method_id/reveal", profileController.RevealPaymentMethod, authorize(rbac.PaymentDetailsReveal))
+	profileRoutes.PUT("/:id/payment-methods/:method_id", profileController.UpdatePaymentMethod, authorize(rbac.SenderProfilesManage))
+	profileRoutes.DELETE("/:id/payment-methods/:method_id", profileController.DeletePaymentMethod, authorize(rbac.SenderProfilesManage))
 
+	clientRead := middleware.RequireScope(models.ScopeClientsRead)
+	clientWrite := middleware.RequireScope(models.ScopeClientsWrite)
 	clientRoutes := protected.Group("/clients")
-	clientRoutes.POST("", clientController.CreateClient)
-	clientRoutes.GET("", clientController.GetAllClients)
-	clientRoutes.GET("/:id", clientController.GetClientByID)
-	clientRoutes.PUT("/:id", clientController.UpdateClient)
-	clientRoutes.DELETE("/:id", clientController.DeleteClient)
+	clientRoutes.POST("", clientController.CreateClient, clientWrite, authorize(rbac.ClientsWrite))
+	clientRoutes.GET("", clientController.GetAllClients, clientRead, authorize(rbac.ClientsRead))
+	clientRoutes.GET("/duplicates", clientController.SuggestDuplicates, clientRead, authorize(rbac.ClientsRead))
+	clientRoutes.GET("/:id", clientController.GetClientByID, clientRead, authorize(rbac.ClientsRead))
+	clientRoutes.PUT("/:id", clientController.UpdateClient, clientWrite, authorize(rbac.ClientsWrite))
+	clientRoutes.DELETE("/:id", clientController.DeleteClient, clientWrite, authorize(rbac.ClientsDelete))
+	clientRoutes.POST("/:id/restore", clientController.RestoreClient, clientWrite, authorize(rbac.ClientsDelete))
+	clientRoutes.GET("/:id/merges", clientController.ListClientMerges, clientRead, authorize(rbac.ClientsRead))
 
+	invoiceRead := middleware.RequireScope(models.ScopeInvoicesRead)
+	invoiceWrite := middleware.RequireScope(models.ScopeInvoicesWrite)
+	clientRoutes.GET("/:id/statement", statementController.GetStatement, clientRead, invoiceRead, authorize(rbac.InvoicesRead))
+	clientRoutes.GET("/:id/statement/pdf", statementController.DownloadStatementPDF, clientRead, invoiceRead, authorize(rbac.InvoicesRead), pdfLimit)
+	clientRoutes.GET("/:id/payments", clientPaymentController.ListPayments, clientRead, invoiceRead, authorize(rbac.InvoicesRead))
+	clientRoutes.POST("/:id/payments", clientPaymentController.RecordPayment, invoiceWrite, authorize(rbac.InvoicesRecordPayment))
+	clientRoutes.DELETE("/:id/payments/:payment_id", clientPaymentController.DeletePayment, invoiceWrite, authorize(rbac.InvoicesRecordPayment))
+	// Merging archives the duplicate and moves its invoices and payments
+	clientRoutes.POST("/:id/merge", clientController.MergeClients, clientWrite, invoiceWrite, authorize(rbac.ClientsDelete))
 	protectedInvoiceRoutes := protected.Group("/invoices")
-	protectedInvoiceRoutes.GET("/summary", invoiceController.InvoiceSummary)
-	protectedInvoiceRoutes.POST("", invoiceController.CreateInvoice)
-	protectedInvoiceRoutes.GET("/:id", invoiceController.GetInvoiceByID)
-	protectedInvoiceRoutes.PUT("/:id", invoiceController.UpdateInvoice)
-	protectedInvoiceRoutes.DELETE("/:id", invoiceController.DeleteInvoice)
-	protectedInvoiceRoutes.GET("", invoiceController.ListInvoicesByUserID)
-	protectedInvoiceRoutes.PATCH("/:id/status", invoiceController.UpdateInvoiceStatus)
-	protectedInvoiceRoutes.POST("/:id/pdf", invoiceController.DownloadInvoicePDF)
+	protectedInvoiceRoutes.GET("/summary", invoiceController.InvoiceSummary, invoiceRead, authorize(rbac.InvoicesRead))
+	protectedInvoiceRoutes.POST("/exports", exportController.CreateExport, invoiceRead, authorize(rbac.InvoicesExport), pdfLimit)
+	protectedInvoiceRoutes.GET("/exports/:id", exportController.GetExport, invoiceRead, authorize(rbac.InvoicesExport))
+	protectedInvoiceRoutes.GET("/exports/:id/download", exportController.DownloadExport, invoiceRead, authorize(rbac.InvoicesExport))
+	protectedInvoiceRoutes.POST("", invoiceController.CreateInvoice, invoiceWrite, authorize(rbac.InvoicesCreate))
+	protectedInvoiceRoutes.GET("/:id", invoiceController.GetInvoiceByID, invoiceRead, authorize(rbac.InvoicesRead))
+	protectedInvoiceRoutes.GET("/:id/payment-methods/reveal", invoiceController.RevealPaymentMethods, invoiceRead, authorize(rbac.PaymentDetailsReveal))
+	protectedInvoiceRoutes.PUT("/:id", invoiceController.UpdateInvoice, invoiceWrite, authorize(rbac.InvoicesEdit))
+	protectedInvoiceRoutes.DELETE("/:id", invoiceController.DeleteInvoice, invoiceWrite, authorize(rbac.InvoicesDelete))
+	protectedInvoiceRoutes.GET("", invoiceController.ListInvoices, invoiceRead, authorize(rbac.InvoicesRead))
+	protectedInvoiceRoutes.POST("/:id/refresh-sender", invoiceController.RefreshSender, invoiceWrite, authorize(rbac.InvoicesEdit))
+	protectedInvoiceRoutes.POST("/:id/refresh-client", invoiceController.RefreshClient, invoiceWrite, authorize(rbac.InvoicesEdit))
+	protectedInvoiceRoutes.PATCH("/:id/status", invoiceController.UpdateInvoiceStatus, invoiceWrite, authorize(rbac.InvoicesRecordPayment))
+	protectedInvoiceRoutes.POST("/:id/pdf", invoiceController.DownloadInvoicePDF, invoiceRead, authorize(rbac.InvoicesRead), pdfLimit)
+	protectedInvoiceRoutes.GET("/:id/pdf", invoiceController.DownloadInvoicePDF, invoiceRead, authorize(rbac.InvoicesRead), pdfLimit)
 }
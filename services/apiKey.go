@@ -0,0 +1,121 @@
+package services
+
+import (
+	e "errors"
+	"time"
+
+	"github.com/hutamy/invoice-generator-backend/dto"
+	"github.com/hutamy/invoice-generator-backend/models"
+	"github.com/hutamy/invoice-generator-backend/repositories"
+	"github.com/hutamy/invoice-generator-backend/utils"
+	"github.com/hutamy/invoice-generator-backend/utils/errors"
+	"gorm.io/gorm"
+)
+
+const (
+	// apiKeyDisplayLength is how much of the key is kept in clear text so
+	// users can tell their keys apart
+	apiKeyDisplayLength = 12
+	// apiKeyTouchInterval limits how often last_used_at is written for a key
+	apiKeyTouchInterval = time.Minute
+)
+
+type APIKeyService interface {
+	CreateAPIKey(req dto.CreateAPIKeyRequest) (dto.CreateAPIKeyResponse, error)
+	ListAPIKeys(userID uint) ([]models.APIKey, error)
+	RevokeAPIKey(id, userID uint) error
+	Authenticate(key string) (*models.APIKey, error)
+}
+
+type apiKeyService struct {
+	apiKeyRepo repositories.APIKeyRepository
+}
+
+func NewAPIKeyService(apiKeyRepo repositories.APIKeyRepository) APIKeyService {
+	return &apiKeyService{apiKeyRepo: apiKeyRepo}
+}
+
+// CreateAPIKey generates a new key for the user. The plain key is only part of
+// this response, afterwards just its hash is known.
+func (s *apiKeyService) CreateAPIKey(req dto.CreateAPIKeyRequest) (dto.CreateAPIKeyResponse, error) {
+	var expiresAt *time.Time
+	if req.ExpiresAt != "" {
+		date, err := time.Parse("2006-01-02", req.ExpiresAt)
+		if err != nil {
+			return dto.CreateAPIKeyResponse{}, errors.ErrInvalidDateFormat
+		}
+
+		if !date.After(time.Now()) {
+			return dto.CreateAPIKeyResponse{}, errors.ErrInvalidExpiry
+		}
+		expiresAt = &date
+	}
+
+	token, _, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return dto.CreateAPIKeyResponse{}, err
+	}
+
+	key := models.APIKeyPrefix + token
+	record := models.APIKey{
+		UserID:    req.UserID,
+		Name:      req.Name,
+		Prefix:    key[:apiKeyDisplayLength],
+		KeyHash:   utils.HashToken(key),
+		Scopes:    uniqueScopes(req.Scopes),
+		ExpiresAt: expiresAt,
+	}
+	if err := s.apiKeyRepo.CreateAPIKey(&record); err != nil {
+		return dto.CreateAPIKeyResponse{}, err
+	}
+
+	return dto.CreateAPIKeyResponse{APIKey: record, Key: key}, nil
+}
+
+func (s *apiKeyService) ListAPIKeys(userID uint) ([]models.APIKey, error) {
+	return s.apiKeyRepo.ListAPIKeys(userID)
+}
+
+func (s *apiKeyService) RevokeAPIKey(id, userID uint) error {
+	return s.apiKeyRepo.DeleteAPIKey(id, userID)
+}
+
+// Authenticate resolves a presented key to its record and records its use.
+// Unknown and expired keys are reported as ErrInvalidToken.
+func (s *apiKeyService) Authenticate(key string) (*models.APIKey, error) {
+	record, err := s.apiKeyRepo.GetAPIKeyByHash(utils.HashToken(key))
+	if err != nil {
+		if e.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.ErrInvalidToken
+		}
+
+		return nil, err
+	}
+
+	now := time.Now()
+	if record.ExpiresAt != nil && !now.Before(*record.ExpiresAt) {
+		return nil, errors.ErrInvalidToken
+	}
+
+	if record.LastUsedAt == nil || now.Sub(*record.LastUsedAt) >= apiKeyTouchInterval {
+		if err := s.apiKeyRepo.TouchAPIKey(record.ID, now); err != nil {
+			return nil, err
+		}
+		record.LastUsedAt = &now
+	}
+
+	return record, nil
+}
+
+func uniqueScopes(scopes []string) []string {
+	seen := make(map[string]bool, len(scopes))
+	unique := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		if !seen[scope] {
+			seen[scope] = true
+			unique = append(unique, scope)
+		}
+	}
+
+	return unique
+}
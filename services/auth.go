@@ -1,26 +1,61 @@
 package services
 
 import (
+	e "errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/hutamy/invoice-generator-backend/config"
 	"github.com/hutamy/invoice-generator-backend/dto"
 	"github.com/hutamy/invoice-generator-backend/models"
 	"github.com/hutamy/invoice-generator-backend/repositories"
 	"github.com/hutamy/invoice-generator-backend/utils"
 	"github.com/hutamy/invoice-generator-backend/utils/errors"
+	"github.com/hutamy/invoice-generator-backend/utils/i18n"
+	"github.com/hutamy/invoice-generator-backend/utils/mail"
+	"github.com/hutamy/invoice-generator-backend/utils/ratelimit"
+	"gorm.io/gorm"
 )
 
 type AuthService interface {
 	SignUp(req dto.SignUpRequest) (models.User, error)
-	SignIn(email, password string) (models.User, error)
+	SignIn(email, password, ipAddress string) (models.User, error)
 	GetUserByID(id uint) (*models.User, error)
 	UpdateUser(req dto.UpdateUserRequest) error
+	ResendVerification(email string) error
+	VerifyEmail(token string) (models.User, error)
+	ForgotPassword(email string) error
+	ResetPassword(req dto.ResetPasswordRequest) error
+	ChangePassword(req dto.ChangePasswordRequest) error
+	RequestEmailChange(req dto.ChangeEmailRequest) error
+	ConfirmEmailChange(token string) error
 }
 
 type authService struct {
-	authRepo repositories.AuthRepository
+	authRepo      repositories.AuthRepository
+	userTokenRepo repositories.UserTokenRepository
+	tokenService  TokenService
+	mailer        mail.Sender
+	lockout       *ratelimit.Lockout
 }
 
-func NewAuthService(authRepo repositories.AuthRepository) AuthService {
-	return &authService{authRepo: authRepo}
+func NewAuthService(
+	authRepo repositories.AuthRepository,
+	userTokenRepo repositories.UserTokenRepository,
+	tokenService TokenService,
+	mailer mail.Sender,
+	lockout *ratelimit.Lockout,
+) AuthService {
+	return &authService{
+		authRepo:      authRepo,
+		userTokenRepo: userTokenRepo,
+		tokenService:  tokenService,
+		mailer:        mailer,
+		lockout:       lockout,
+	}
 }
 
 func (s *authService) SignUp(req dto.SignUpRequest) (models.User, error) {
@@ -47,6 +82,7 @@ func (s *authService) SignUp(req dto.SignUpRequest) (models.User, error) {
 		BankName:          req.BankName,
 		BankAccountName:   req.BankAccountName,
 		BankAccountNumber: req.BankAccountNumber,
+		Locale:            i18n.Resolve(req.Locale),
 	}
 
 	if err := s.authRepo.CreateUser(user); err != nil {
@@ -58,20 +94,42 @@ func (s *authService) SignUp(req dto.SignUpRequest) (models.User, error) {
 		return models.User{}, err
 	}
 
+	if err := s.sendVerification(user); err != nil {
+		log.Printf("failed to send verification email to user %d: %v", user.ID, err)
+	}
+
 	return *user, nil
 }
 
-func (s *authService) SignIn(email, password string) (models.User, error) {
+// SignIn checks the credentials. Repeated failures lock the email address out
+// for the client IP address that made them, for a growing period reported as a
+// *ratelimit.LimitError. Keying on the address keeps anyone else from locking
+// the owner out by guessing their password.
+func (s *authService) SignIn(email, password, ipAddress string) (models.User, error) {
+	lockoutKey := fmt.Sprintf("login:%s:%s", strings.ToLower(email), ipAddress)
+	if err := s.lockout.Check(lockoutKey); err != nil {
+		return models.User{}, err
+	}
+
 	user, err := s.authRepo.GetUserByEmail(email)
 	if err != nil {
 		return models.User{}, err
 	}
-	if user == nil {
+
+	if user == nil || !utils.CheckPasswordHash(password, user.Password) {
+		if err := s.lockout.Fail(lockoutKey); err != nil {
+			return models.User{}, err
+		}
+
 		return models.User{}, errors.ErrLoginFailed
 	}
 
-	if !utils.CheckPasswordHash(password, user.Password) {
-		return models.User{}, errors.ErrLoginFailed
+	if err := s.lockout.Succeed(lockoutKey); err != nil {
+		return models.User{}, err
+	}
+
+	if user.EmailVerifiedAt == nil {
+		return models.User{}, errors.ErrEmailNotVerified
 	}
 
 	return *user, nil
@@ -95,8 +153,10 @@ func (s *authService) UpdateUser(req dto.UpdateUserRequest) error {
 		existingUser.Name = *req.Name
 	}
 
-	if req.Email != nil {
-		existingUser.Email = *req.Email
+	// Changing the address needs the password and a confirmation from the new
+	// inbox, see RequestEmailChange
+	if req.Email != nil && !strings.EqualFold(*req.Email, existingUser.Email) {
+		return errors.ErrEmailChangeNotAllowed
 	}
 
 	if req.Address != nil {
@@ -119,5 +179,289 @@ func (s *authService) UpdateUser(req dto.UpdateUserRequest) error {
 		existingUser.BankAccountNumber = *req.BankAccountNumber
 	}
 
+	if req.Locale != nil {
+		existingUser.Locale = i18n.Resolve(*req.Locale)
+	}
+
 	return s.authRepo.UpdateUser(existingUser)
 }
+
+// ResendVerification sends a new verification link when the address belongs to
+// an unverified account. Unknown addresses are ignored so the response does not
+// reveal which emails are registered.
+func (s *authService) ResendVerification(email string) error {
+	user, err := s.authRepo.GetUserByEmail(email)
+	if err != nil {
+		return err
+	}
+
+	if user == nil || user.EmailVerifiedAt != nil {
+		return nil
+	}
+
+	return s.sendVerification(user)
+}
+
+func (s *authService) VerifyEmail(token string) (models.User, error) {
+	userToken, err := s.consumeToken(token, models.UserTokenEmailVerification)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	user, err := s.authRepo.GetUserByID(userToken.UserID)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	if user.EmailVerifiedAt == nil {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+		if err := s.authRepo.UpdateUser(user); err != nil {
+			return models.User{}, err
+		}
+	}
+
+	return *user, nil
+}
+
+// ForgotPassword emails a password reset link. Like ResendVerification it
+// succeeds for unknown addresses.
+func (s *authService) ForgotPassword(email string) error {
+	user, err := s.authRepo.GetUserByEmail(email)
+	if err != nil {
+		return err
+	}
+
+	if user == nil {
+		return nil
+	}
+
+	ttl := config.GetConfig().PasswordResetTTL
+	token, err := s.createToken(models.UserToken{UserID: user.ID, Purpose: models.UserTokenPasswordReset}, ttl)
+	if err != nil {
+		return err
+	}
+
+	return sendTemplate(s.mailer, user.Email, "password_reset", map[string]string{
+		"Name":      user.Name,
+		"Link":      appLink("/reset-password", token),
+		"ExpiresIn": humanDuration(ttl),
+	})
+}
+
+// ResetPassword sets a new password using a reset token and signs the user out
+// of every session.
+func (s *authService) ResetPassword(req dto.ResetPasswordRequest) error {
+	userToken, err := s.consumeToken(req.Token, models.UserTokenPasswordReset)
+	if err != nil {
+		return err
+	}
+
+	user, err := s.authRepo.GetUserByID(userToken.UserID)
+	if err != nil {
+		return err
+	}
+
+	// Following the emailed link proves the user owns the address
+	if user.EmailVerifiedAt == nil {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+
+	return s.setPassword(user, req.Password)
+}
+
+// ChangePassword replaces the password of a signed in user after checking the
+// current one, and signs out every session.
+func (s *authService) ChangePassword(req dto.ChangePasswordRequest) error {
+	user, err := s.authRepo.GetUserByID(req.UserID)
+	if err != nil {
+		return err
+	}
+
+	if !utils.CheckPasswordHash(req.CurrentPassword, user.Password) {
+		return errors.ErrInvalidPassword
+	}
+
+	return s.setPassword(user, req.NewPassword)
+}
+
+// RequestEmailChange sends a confirmation link to the new address after
+// checking the current password, and tells the current address about the
+// request. The email only changes once the link is followed.
+func (s *authService) RequestEmailChange(req dto.ChangeEmailRequest) error {
+	user, err := s.authRepo.GetUserByID(req.UserID)
+	if err != nil {
+		return err
+	}
+
+	if !utils.CheckPasswordHash(req.CurrentPassword, user.Password) {
+		return errors.ErrInvalidPassword
+	}
+
+	if strings.EqualFold(req.NewEmail, user.Email) {
+		return errors.ErrSameEmail
+	}
+
+	if err := s.ensureEmailAvailable(req.NewEmail, user.ID); err != nil {
+		return err
+	}
+
+	ttl := config.GetConfig().EmailChangeTTL
+	token, err := s.createToken(models.UserToken{
+		UserID:   user.ID,
+		Purpose:  models.UserTokenEmailChange,
+		NewEmail: req.NewEmail,
+	}, ttl)
+	if err != nil {
+		return err
+	}
+
+	err = sendTemplate(s.mailer, req.NewEmail, "confirm_email_change", map[string]string{
+		"Name":      user.Name,
+		"Link":      appLink("/confirm-email-change", token),
+		"ExpiresIn": humanDuration(ttl),
+	})
+	if err != nil {
+		return err
+	}
+
+	err = sendTemplate(s.mailer, user.Email, "email_change_requested", map[string]string{
+		"Name":     user.Name,
+		"NewEmail": req.NewEmail,
+	})
+	if err != nil {
+		log.Printf("failed to send email change notice to user %d: %v", user.ID, err)
+	}
+
+	return nil
+}
+
+// ConfirmEmailChange switches the account to the address the token was sent
+// to. Following the link proves the user owns that address.
+func (s *authService) ConfirmEmailChange(token string) error {
+	userToken, err := s.consumeToken(token, models.UserTokenEmailChange)
+	if err != nil {
+		return err
+	}
+
+	user, err := s.authRepo.GetUserByID(userToken.UserID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.ensureEmailAvailable(userToken.NewEmail, user.ID); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	user.Email = userToken.NewEmail
+	user.EmailVerifiedAt = &now
+	if err := s.authRepo.UpdateUser(user); err != nil {
+		if e.Is(err, gorm.ErrDuplicatedKey) {
+			return errors.ErrUserAlreadyExists
+		}
+
+		return err
+	}
+
+	// Links sent to the old address must not work for the new one
+	return s.userTokenRepo.InvalidateTokens(user.ID, models.UserTokenPasswordReset)
+}
+
+func (s *authService) ensureEmailAvailable(email string, userID uint) error {
+	existingUser, err := s.authRepo.GetUserByEmail(email)
+	if err != nil {
+		return err
+	}
+
+	if existingUser != nil && existingUser.ID != userID {
+		return errors.ErrUserAlreadyExists
+	}
+
+	return nil
+}
+
+func (s *authService) setPassword(user *models.User, password string) error {
+	hashedPassword, err := utils.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	user.Password = hashedPassword
+	if err := s.authRepo.UpdateUser(user); err != nil {
+		return err
+	}
+
+	if err := s.userTokenRepo.InvalidateTokens(user.ID, models.UserTokenPasswordReset); err != nil {
+		return err
+	}
+
+	if err := s.tokenService.SignOutEverywhere(user.ID); err != nil {
+		return err
+	}
+
+	if err := sendTemplate(s.mailer, user.Email, "password_changed", map[string]string{"Name": user.Name}); err != nil {
+		log.Printf("failed to send password change notice to user %d: %v", user.ID, err)
+	}
+
+	return nil
+}
+
+func (s *authService) sendVerification(user *models.User) error {
+	ttl := config.GetConfig().EmailVerificationTTL
+	token, err := s.createToken(models.UserToken{UserID: user.ID, Purpose: models.UserTokenEmailVerification}, ttl)
+	if err != nil {
+		return err
+	}
+
+	return sendTemplate(s.mailer, user.Email, "verify_email", map[string]string{
+		"Name":      user.Name,
+		"Link":      appLink("/verify-email", token),
+		"ExpiresIn": humanDuration(ttl),
+	})
+}
+
+func (s *authService) createToken(record models.UserToken, ttl time.Duration) (string, error) {
+	token, hash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	record.TokenHash = hash
+	record.ExpiresAt = time.Now().Add(ttl)
+	if err := s.userTokenRepo.CreateToken(&record); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+func (s *authService) consumeToken(token, purpose string) (*models.UserToken, error) {
+	userToken, err := s.userTokenRepo.ConsumeToken(utils.HashToken(token), purpose)
+	if err != nil {
+		if e.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.ErrInvalidToken
+		}
+
+		return nil, err
+	}
+
+	return userToken, nil
+}
+
+// appLink builds a frontend link carrying token as query parameter
+func appLink(path, token string) string {
+	return config.GetConfig().AppURL + path + "?token=" + url.QueryEscape(token)
+}
+
+func humanDuration(d time.Duration) string {
+	if d >= time.Hour && d%time.Hour == 0 {
+		if hours := int(d.Hours()); hours != 1 {
+			return fmt.Sprintf("%d hours", hours)
+		}
+		return "1 hour"
+	}
+
+	return fmt.Sprintf("%d minutes", int(d.Minutes()))
+}
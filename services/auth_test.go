@@ -0,0 +1,102 @@
+package services
+
+import (
+	e "errors"
+	"testing"
+	"time"
+
+	"github.com/hutamy/invoice-generator-backend/models"
+	"github.com/hutamy/invoice-generator-backend/repositories"
+	"github.com/hutamy/invoice-generator-backend/utils"
+	"github.com/hutamy/invoice-generator-backend/utils/errors"
+	"github.com/hutamy/invoice-generator-backend/utils/ratelimit"
+)
+
+// signInUsers finds the single verified user of the sign-in tests
+type signInUsers struct {
+	repositories.AuthRepository
+	user models.User
+}
+
+func (r *signInUsers) GetUserByEmail(email string) (*models.User, error) {
+	if email != r.user.Email {
+		return nil, nil
+	}
+
+	user := r.user
+	return &user, nil
+}
+
+func TestSignInLockout(t *testing.T) {
+	password, err := utils.HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verified := time.Now()
+	store := ratelimit.NewMemoryStore()
+	service := &authService{
+		authRepo: &signInUsers{user: models.User{ID: 1, Email: "owner@example.com", Password: string(password), EmailVerifiedAt: &verified}},
+		lockout: &ratelimit.Lockout{
+			Store:         store,
+			Threshold:     3,
+			FailureWindow: time.Hour,
+			BaseDuration:  time.Minute,
+			MaxDuration:   3 * time.Minute,
+		},
+	}
+
+	const (
+		attacker = "203.0.113.9"
+		owner    = "198.51.100.4"
+	)
+
+	tests := []struct {
+		name     string
+		email    string
+		password string
+		ip       string
+		// expire lifts the lock of the attacker before the attempt
+		expire bool
+		err    error
+		// retryAfter is the lock reported when err is errors.ErrTooManyRequests
+		retryAfter time.Duration
+	}{
+		{name: "first failure", email: "owner@example.com", password: "guess 1", ip: attacker, err: errors.ErrLoginFailed},
+		{name: "second failure", email: "OWNER@example.com", password: "guess 2", ip: attacker, err: errors.ErrLoginFailed},
+		{name: "failure reaching the threshold", email: "owner@example.com", password: "guess 3", ip: attacker, err: errors.ErrLoginFailed},
+		{name: "locked address with the right password", email: "owner@example.com", password: "correct horse", ip: attacker, err: errors.ErrTooManyRequests, retryAfter: time.Minute},
+		{name: "owner from another address", email: "owner@example.com", password: "correct horse", ip: owner},
+		{name: "owner failure counted apart", email: "owner@example.com", password: "typo", ip: owner, err: errors.ErrLoginFailed},
+		{name: "failure after the lock doubles it", email: "owner@example.com", password: "guess 4", ip: attacker, expire: true, err: errors.ErrLoginFailed},
+		{name: "doubled lock", email: "owner@example.com", password: "guess 5", ip: attacker, err: errors.ErrTooManyRequests, retryAfter: 2 * time.Minute},
+		{name: "failure after the doubled lock", email: "owner@example.com", password: "guess 5", ip: attacker, expire: true, err: errors.ErrLoginFailed},
+		{name: "lock capped at the maximum", email: "owner@example.com", password: "guess 6", ip: attacker, expire: true, err: errors.ErrLoginFailed},
+		{name: "capped lock", email: "owner@example.com", password: "guess 7", ip: attacker, err: errors.ErrTooManyRequests, retryAfter: 3 * time.Minute},
+		{name: "unknown email counted apart", email: "nobody@example.com", password: "guess", ip: attacker, err: errors.ErrLoginFailed},
+		{name: "success after the lock", email: "owner@example.com", password: "correct horse", ip: attacker, expire: true},
+		{name: "success cleared the failures", email: "owner@example.com", password: "guess 8", ip: attacker, err: errors.ErrLoginFailed},
+	}
+
+	for _, tt := range tests {
+		if tt.expire {
+			if err := store.Reset("lock:login:owner@example.com:" + attacker); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		user, err := service.SignIn(tt.email, tt.password, tt.ip)
+		if !e.Is(err, tt.err) {
+			t.Fatalf("%s: SignIn() error = %v, want %v", tt.name, err, tt.err)
+		}
+
+		if tt.err == nil && user.ID != 1 {
+			t.Fatalf("%s: SignIn() user = %d, want 1", tt.name, user.ID)
+		}
+
+		var limitErr *ratelimit.LimitError
+		if e.As(err, &limitErr) && (limitErr.RetryAfter > tt.retryAfter || limitErr.RetryAfter < tt.retryAfter-time.Second) {
+			t.Fatalf("%s: RetryAfter = %s, want %s", tt.name, limitErr.RetryAfter, tt.retryAfter)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package services
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"time"
+
+	"github.com/hutamy/invoice-generator-backend/dto"
+	"github.com/hutamy/invoice-generator-backend/models"
+	"github.com/hutamy/invoice-generator-backend/repositories"
+	"github.com/hutamy/invoice-generator-backend/utils"
+	"github.com/hutamy/invoice-generator-backend/utils/errors"
+	"github.com/hutamy/invoice-generator-backend/utils/pdfsign"
+	"golang.org/x/crypto/pkcs12"
+)
+
+const signatureReason = "Invoice issued by the signer"
+
+type CertificateService interface {
+	UploadCertificate(req dto.UploadCertificateRequest) (*models.SigningCertificate, error)
+	GetCertificate(orgID uint) (*models.SigningCertificate, error)
+	DeleteCertificate(orgID uint) error
+	Signer(cert *models.SigningCertificate) (*pdfsign.Signer, error)
+	VerifyDocument(orgID uint, pdf []byte) (dto.VerifySignatureResponse, error)
+}
+
+type certificateService struct {
+	certRepo repositories.CertificateRepository
+}
+
+func NewCertificateService(certRepo repositories.CertificateRepository) CertificateService {
+	return &certificateService{certRepo: certRepo}
+}
+
+// UploadCertificate decodes a PKCS#12 bundle, checks it can sign and stores the
+// certificate chain together with the encrypted private key.
+func (s *certificateService) UploadCertificate(req dto.UploadCertificateRequest) (*models.SigningCertificate, error) {
+	blocks, err := pkcs12.ToPEM(req.Data, req.Password)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errors.ErrInvalidCertificate, err)
+	}
+
+	var key crypto.Signer
+	var certs []*x509.Certificate
+	for _, block := range blocks {
+		switch block.Type {
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", errors.ErrInvalidCertificate, err)
+			}
+			certs = append(certs, cert)
+		case "PRIVATE KEY":
+			key, err = parsePrivateKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", errors.ErrInvalidCertificate, err)
+			}
+		}
+	}
+
+	if key == nil {
+		return nil, fmt.Errorf("%w: no private key found", errors.ErrInvalidCertificate)
+	}
+
+	chain, err := orderChain(certs, key)
+	if err != nil {
+		return nil, err
+	}
+
+	leaf := chain[0]
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	encryptedKey, err := utils.Encrypt(keyDER)
+	if err != nil {
+		return nil, err
+	}
+
+	var chainPEM bytes.Buffer
+	for _, cert := range chain {
+		if err := pem.Encode(&chainPEM, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}); err != nil {
+			return nil, err
+		}
+	}
+
+	fingerprint := sha256.Sum256(leaf.Raw)
+	cert := &models.SigningCertificate{
+		OrganizationID:   req.OrganizationID,
+		UserID:           req.UserID,
+		Subject:          leaf.Subject.String(),
+		Issuer:           leaf.Issuer.String(),
+		SerialNumber:     leaf.SerialNumber.String(),
+		Fingerprint:      hex.EncodeToString(fingerprint[:]),
+		NotBefore:        leaf.NotBefore,
+		NotAfter:         leaf.NotAfter,
+		CertificateChain: chainPEM.String(),
+		EncryptedKey:     encryptedKey,
+	}
+
+	// Expired certificates are refused here so that signing only lapses
+	// when a stored certificate runs out
+	if !cert.ValidAt(time.Now()) {
+		return nil, errors.ErrCertificateExpired
+	}
+
+	if err := s.certRepo.SaveCertificate(cert); err != nil {
+		return nil, err
+	}
+
+	return cert, nil
+}
+
+func (s *certificateService) GetCertificate(orgID uint) (*models.SigningCertificate, error) {
+	cert, err := s.certRepo.GetCertificateByOrganizationID(orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	cert.Expired = !cert.ValidAt(time.Now())
+	return cert, nil
+}
+
+func (s *certificateService) DeleteCertificate(orgID uint) error {
+	return s.certRepo.DeleteCertificate(orgID)
+}
+
+// Signer decrypts the stored key and returns a signer for PDF documents
+func (s *certificateService) Signer(cert *models.SigningCertificate) (*pdfsign.Signer, error) {
+	now := time.Now()
+	if !cert.ValidAt(now) {
+		return nil, errors.ErrCertificateExpired
+	}
+
+	chain, err := parseChain(cert.CertificateChain)
+	if err != nil {
+		return nil, err
+	}
+
+	keyDER, err := utils.Decrypt(cert.EncryptedKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt signing key: %w", err)
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(keyDER)
+	if err != nil {
+		return nil, err
+	}
+
+	key, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported signing key type %T", parsed)
+	}
+
+	return &pdfsign.Signer{
+		Certificate: chain[0],
+		Chain:       chain[1:],
+		Key:         key,
+		Name:        chain[0].Subject.CommonName,
+		Reason:      signatureReason,
+		SignedAt:    now,
+	}, nil
+}
+
+// VerifyDocument checks the signature of pdf and whether it was produced with
+// the certificate currently stored for the organization.
+func (s *certificateService) VerifyDocument(orgID uint, pdf []byte) (dto.VerifySignatureResponse, error) {
+	cert, err := s.certRepo.GetCertificateByOrganizationID(orgID)
+	if err != nil {
+		return dto.VerifySignatureResponse{}, err
+	}
+
+	verification, err := pdfsign.Verify(pdf)
+	if err != nil {
+		return dto.VerifySignatureResponse{}, fmt.Errorf("%w: %v", errors.ErrInvalidSignature, err)
+	}
+
+	fingerprint := sha256.Sum256(verification.Signer.Raw)
+	matches := hex.EncodeToString(fingerprint[:]) == cert.Fingerprint
+	return dto.VerifySignatureResponse{
+		Valid:               matches && verification.CoversWholeDocument,
+		Signer:              verification.Signer.Subject.String(),
+		Issuer:              verification.Signer.Issuer.String(),
+		SerialNumber:        verification.Signer.SerialNumber.String(),
+		MatchesCertificate:  matches,
+		CoversWholeDocument: verification.CoversWholeDocument,
+	}, nil
+}
+
+// parsePrivateKey parses the key blocks produced by pkcs12.ToPEM, which hold
+// PKCS#1 RSA or SEC 1 EC keys rather than PKCS#8.
+func parsePrivateKey(der []byte) (crypto.Signer, error) {
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("unsupported private key type")
+}
+
+// orderChain returns the certificate matching key first, followed by the
+// remaining certificates of the bundle.
+func orderChain(certs []*x509.Certificate, key crypto.Signer) ([]*x509.Certificate, error) {
+	type publicKey interface {
+		Equal(crypto.PublicKey) bool
+	}
+
+	for i, cert := range certs {
+		if pub, ok := cert.PublicKey.(publicKey); ok && pub.Equal(key.Public()) {
+			chain := []*x509.Certificate{cert}
+			chain = append(chain, certs[:i]...)
+			return append(chain, certs[i+1:]...), nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: no certificate matches the private key", errors.ErrInvalidCertificate)
+}
+
+func parseChain(chainPEM string) ([]*x509.Certificate, error) {
+	var chain []*x509.Certificate
+	rest := []byte(chainPEM)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, cert)
+	}
+
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("stored certificate chain is empty")
+	}
+
+	return chain, nil
+}
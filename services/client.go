@@ -1,19 +1,50 @@
 package services
 
 import (
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+
 	"github.com/hutamy/invoice-generator-backend/dto"
 	"github.com/hutamy/invoice-generator-backend/models"
 	"github.com/hutamy/invoice-generator-backend/repositories"
 	"github.com/hutamy/invoice-generator-backend/utils"
+	"github.com/hutamy/invoice-generator-backend/utils/errors"
+	"gorm.io/gorm"
+)
+
+const (
+	// duplicateNameScore is the name similarity from which two clients are
+	// suggested as duplicates on their names alone
+	duplicateNameScore = 0.8
+	// duplicatePhoneDigits is how many trailing digits two phone numbers have
+	// to share, which ignores country and trunk prefixes
+	duplicatePhoneDigits = 9
 )
 
+// legalForms are left out when comparing names, "PT. Maju" and "Maju" are the
+// same client
+var legalForms = map[string]bool{
+	"pt": true, "cv": true, "ud": true, "tbk": true, "persero": true,
+	"ltd": true, "limited": true, "inc": true, "llc": true, "llp": true, "plc": true,
+	"co": true, "corp": true, "corporation": true, "company": true,
+	"gmbh": true, "ag": true, "bv": true, "sa": true, "pte": true, "sdn": true, "bhd": true,
+}
+
 type ClientService interface {
 	CreateClient(req dto.CreateClientRequest) error
-	GetAllClientsByUserID(userID uint) ([]models.Client, error)
-	GetAllClientsByUserIDWithPagination(req dto.GetClientsRequest) (utils.PaginatedResponse, error)
-	GetClientByID(id, userID uint) (*models.Client, error)
+	GetAllClientsByOrganizationID(organizationID uint) ([]models.Client, error)
+	GetAllClientsByOrganizationIDWithPagination(req dto.GetClientsRequest) (utils.PaginatedResponse, error)
+	GetClientByID(id, organizationID uint) (*models.Client, error)
 	UpdateClient(req dto.UpdateClientRequest) error
-	DeleteClient(id, userID uint) error
+	ArchiveClient(id, organizationID uint) error
+	RestoreClient(id, organizationID uint) error
+	DeleteClient(id, organizationID uint) error
+	SuggestDuplicates(req dto.GetClientDuplicatesRequest) (utils.PaginatedResponse, error)
+	MergeClients(req dto.MergeClientRequest) (*models.ClientMerge, error)
+	ListClientMerges(survivorID, organizationID uint) ([]models.ClientMerge, error)
 }
 
 type clientService struct {
@@ -26,20 +57,30 @@ func NewClientService(clientRepo repositories.ClientRepository) ClientService {
 
 func (s *clientService) CreateClient(req dto.CreateClientRequest) error {
 	client := &models.Client{
-		Name:    req.Name,
-		Email:   req.Email,
-		Phone:   req.Phone,
-		Address: req.Address,
-		UserID:  req.UserID,
+		Name:            req.Name,
+		Email:           req.Email,
+		Phone:           req.Phone,
+		Address:         req.Address,
+		BillingAddress:  postalAddress(req.BillingAddress),
+		TaxID:           req.TaxID,
+		CCEmails:        req.CCEmails,
+		BCCEmails:       req.BCCEmails,
+		Currency:        strings.ToUpper(req.Currency),
+		Locale:          req.Locale,
+		PaymentTermDays: req.PaymentTermDays,
+		Contacts:        clientContacts(req.Contacts),
+
+		OrganizationID: req.OrganizationID,
+		UserID:         req.UserID,
 	}
 	return s.clientRepo.CreateClient(client)
 }
 
-func (s *clientService) GetAllClientsByUserID(userID uint) ([]models.Client, error) {
-	return s.clientRepo.GetAllByUserID(userID)
+func (s *clientService) GetAllClientsByOrganizationID(organizationID uint) ([]models.Client, error) {
+	return s.clientRepo.GetAllByOrganizationID(organizationID)
 }
 
-func (s *clientService) GetAllClientsByUserIDWithPagination(req dto.GetClientsRequest) (utils.PaginatedResponse, error) {
+func (s *clientService) GetAllClientsByOrganizationIDWithPagination(req dto.GetClientsRequest) (utils.PaginatedResponse, error) {
 	// Set default values for pagination
 	if req.Page < 1 {
 		req.Page = 1
@@ -51,7 +92,7 @@ func (s *clientService) GetAllClientsByUserIDWithPagination(req dto.GetClientsRe
 		req.PageSize = 100
 	}
 
-	clients, totalItems, err := s.clientRepo.GetAllByUserIDWithPagination(req)
+	clients, totalItems, err := s.clientRepo.GetAllByOrganizationIDWithPagination(req)
 	if err != nil {
 		return utils.PaginatedResponse{}, err
 	}
@@ -60,12 +101,13 @@ func (s *clientService) GetAllClientsByUserIDWithPagination(req dto.GetClientsRe
 	return utils.PaginatedData(clients, pagination), nil
 }
 
-func (s *clientService) GetClientByID(id, userID uint) (*models.Client, error) {
-	return s.clientRepo.GetClientByID(id, userID)
+// GetClientByID finds active and archived clients
+func (s *clientService) GetClientByID(id, organizationID uint) (*models.Client, error) {
+	return s.clientRepo.GetClientByIDWithArchived(id, organizationID)
 }
 
 func (s *clientService) UpdateClient(req dto.UpdateClientRequest) error {
-	client, err := s.GetClientByID(req.ID, req.UserID)
+	client, err := s.clientRepo.GetClientByID(req.ID, req.OrganizationID)
 	if err != nil {
 		return err
 	}
@@ -82,13 +124,357 @@ func (s *clientService) UpdateClient(req dto.UpdateClientRequest) error {
 		client.Address = *req.Address
 	}
 
+	if req.BillingAddress != nil {
+		client.BillingAddress = postalAddress(*req.BillingAddress)
+	}
+
 	if req.Phone != nil {
 		client.Phone = *req.Phone
 	}
 
-	return s.clientRepo.UpdateClient(client)
+	if req.TaxID != nil {
+		client.TaxID = *req.TaxID
+	}
+
+	if req.CCEmails != nil {
+		client.CCEmails = *req.CCEmails
+	}
+
+	if req.BCCEmails != nil {
+		client.BCCEmails = *req.BCCEmails
+	}
+
+	if req.Currency != nil {
+		client.Currency = strings.ToUpper(*req.Currency)
+	}
+
+	if req.Locale != nil {
+		client.Locale = *req.Locale
+	}
+
+	if req.PaymentTermDays != nil {
+		client.PaymentTermDays = *req.PaymentTermDays
+	}
+
+	var contacts *[]models.ClientContact
+	if req.Contacts != nil {
+		replaced := clientContacts(*req.Contacts)
+		contacts = &replaced
+	}
+
+	return s.clientRepo.UpdateClient(client, contacts)
+}
+
+func postalAddress(req dto.PostalAddressRequest) models.PostalAddress {
+	return models.PostalAddress{
+		Line1:      req.Line1,
+		Line2:      req.Line2,
+		City:       req.City,
+		Region:     req.Region,
+		PostalCode: req.PostalCode,
+		Country:    strings.ToUpper(req.Country),
+	}
+}
+
+// clientContacts keeps the contacts in the order they were given
+func clientContacts(reqs []dto.ClientContactRequest) []models.ClientContact {
+	contacts := make([]models.ClientContact, len(reqs))
+	for i, req := range reqs {
+		contacts[i] = models.ClientContact{
+			Name:     req.Name,
+			Role:     req.Role,
+			Email:    req.Email,
+			Phone:    req.Phone,
+			Position: i,
+		}
+	}
+
+	return contacts
+}
+
+// ArchiveClient hides the client from lists and new invoices. Existing
+// invoices keep their copy of its details.
+func (s *clientService) ArchiveClient(id, organizationID uint) error {
+	return s.clientRepo.ArchiveClient(id, organizationID)
+}
+
+func (s *clientService) RestoreClient(id, organizationID uint) error {
+	return s.clientRepo.RestoreClient(id, organizationID)
+}
+
+// DeleteClient removes the client for good, which is refused while invoices
+// or payments reference it
+func (s *clientService) DeleteClient(id, organizationID uint) error {
+	return s.clientRepo.DeleteClient(id, organizationID)
+}
+
+// SuggestDuplicates compares the active clients of the organization by their
+// normalized name, email and phone, best matches first. With a ClientID only
+// that client is compared against the others. Only the clients of the
+// requested page are loaded in full.
+func (s *clientService) SuggestDuplicates(req dto.GetClientDuplicatesRequest) (utils.PaginatedResponse, error) {
+	clients, err := s.clientRepo.ListDuplicateCandidates(req.OrganizationID)
+	if err != nil {
+		return utils.PaginatedResponse{}, err
+	}
+
+	if req.ClientID != 0 && !slices.ContainsFunc(clients, func(client models.Client) bool { return client.ID == req.ClientID }) {
+		return utils.PaginatedResponse{}, gorm.ErrRecordNotFound
+	}
+
+	matches := findDuplicates(clients, req.ClientID)
+	pagination := utils.CalculatePagination(req.Page, req.PageSize, int64(len(matches)))
+	start := min((pagination.Page-1)*pagination.PageSize, len(matches))
+	matches = matches[start:min(start+pagination.PageSize, len(matches))]
+
+	loaded := make(map[uint]models.Client, 2*len(matches))
+	if len(matches) > 0 {
+		ids := make([]uint, 0, 2*len(matches))
+		for _, match := range matches {
+			ids = append(ids, clients[match.older].ID, clients[match.newer].ID)
+		}
+
+		full, err := s.clientRepo.GetClientsByIDs(ids, req.OrganizationID)
+		if err != nil {
+			return utils.PaginatedResponse{}, err
+		}
+
+		for _, client := range full {
+			loaded[client.ID] = client
+		}
+	}
+
+	duplicates := make([]dto.ClientDuplicate, len(matches))
+	for i, match := range matches {
+		duplicates[i] = dto.ClientDuplicate{
+			Client:    loaded[clients[match.older].ID],
+			Duplicate: loaded[clients[match.newer].ID],
+			Score:     match.score,
+			Reasons:   match.reasons,
+		}
+	}
+
+	return utils.PaginatedData(duplicates, pagination), nil
+}
+
+// MergeClients folds the duplicate into the survivor in one transaction. The
+// invoices keep their copy of the duplicate's details, drafts pick up the
+// survivor's on a client refresh.
+func (s *clientService) MergeClients(req dto.MergeClientRequest) (*models.ClientMerge, error) {
+	if req.DuplicateID == req.SurvivorID {
+		return nil, errors.ErrMergeSameClient
+	}
+
+	merge := &models.ClientMerge{
+		OrganizationID: req.OrganizationID,
+		UserID:         req.UserID,
+		SurvivorID:     req.SurvivorID,
+		DuplicateID:    req.DuplicateID,
+	}
+	if err := s.clientRepo.MergeClients(merge); err != nil {
+		return nil, err
+	}
+
+	return merge, nil
+}
+
+func (s *clientService) ListClientMerges(survivorID, organizationID uint) ([]models.ClientMerge, error) {
+	if _, err := s.clientRepo.GetClientByIDWithArchived(survivorID, organizationID); err != nil {
+		return nil, err
+	}
+
+	return s.clientRepo.ListClientMerges(survivorID, organizationID)
 }
 
-func (s *clientService) DeleteClient(id, userID uint) error {
-	return s.clientRepo.DeleteClient(id, userID)
+// duplicateMatch pairs two clients by their index in the compared list
+type duplicateMatch struct {
+	older, newer int
+	score        float64
+	reasons      []string
+}
+
+// findDuplicates compares every pair of clients, or only the client with
+// clientID against the others when it is set. The older client of a pair
+// comes first, and the best matches first.
+func findDuplicates(clients []models.Client, clientID uint) []duplicateMatch {
+	keys := make([]duplicateKey, len(clients))
+	for i, client := range clients {
+		keys[i] = newDuplicateKey(client)
+	}
+
+	var matches []duplicateMatch
+	match := func(i, j int) {
+		score, reasons := keys[i].compare(keys[j])
+		if len(reasons) == 0 {
+			return
+		}
+
+		if clients[j].CreatedAt.Before(clients[i].CreatedAt) ||
+			(clients[j].CreatedAt.Equal(clients[i].CreatedAt) && clients[j].ID < clients[i].ID) {
+			i, j = j, i
+		}
+
+		matches = append(matches, duplicateMatch{older: i, newer: j, score: score, reasons: reasons})
+	}
+
+	for i := range clients {
+		switch {
+		case clientID == 0:
+			for j := i + 1; j < len(clients); j++ {
+				match(i, j)
+			}
+		case clients[i].ID == clientID:
+			for j := range clients {
+				if j != i {
+					match(i, j)
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(matches, func(a, b int) bool {
+		if matches[a].score != matches[b].score {
+			return matches[a].score > matches[b].score
+		}
+
+		if older := clients[matches[a].older].ID; older != clients[matches[b].older].ID {
+			return older < clients[matches[b].older].ID
+		}
+
+		return clients[matches[a].newer].ID < clients[matches[b].newer].ID
+	})
+
+	return matches
+}
+
+// duplicateKey is a client reduced to what duplicates are compared on
+type duplicateKey struct {
+	name  []string       // lower case words without punctuation and legal forms
+	pairs map[string]int // letter pairs of the joined name words
+	email string
+	phone string // trailing digits, empty when too short to compare
+}
+
+func newDuplicateKey(client models.Client) duplicateKey {
+	key := duplicateKey{
+		name:  normalizeName(client.Name),
+		pairs: map[string]int{},
+		email: strings.ToLower(strings.TrimSpace(client.Email)),
+	}
+
+	joined := []rune(strings.Join(key.name, ""))
+	for i := 0; i+1 < len(joined); i++ {
+		key.pairs[string(joined[i:i+2])]++
+	}
+
+	var digits strings.Builder
+	for _, r := range client.Phone {
+		if r >= '0' && r <= '9' {
+			digits.WriteRune(r)
+		}
+	}
+	if phone := digits.String(); len(phone) >= duplicatePhoneDigits {
+		key.phone = phone[len(phone)-duplicatePhoneDigits:]
+	}
+
+	return key
+}
+
+// compare scores how alike two clients are. Each matching email or phone,
+// and a name similarity of at least duplicateNameScore, is a reason.
+func (k duplicateKey) compare(other duplicateKey) (float64, []string) {
+	var score float64
+	var reasons []string
+	if name := nameSimilarity(k, other); name >= duplicateNameScore {
+		score = name
+		reasons = append(reasons, "name")
+	}
+
+	if k.email != "" && k.email == other.email {
+		score = math.Max(score, 0.95)
+		reasons = append(reasons, "email")
+	}
+
+	if k.phone != "" && k.phone == other.phone {
+		score = math.Max(score, 0.9)
+		reasons = append(reasons, "phone")
+	}
+
+	if len(reasons) > 1 {
+		score = math.Min(1, score+0.05*float64(len(reasons)-1))
+	}
+
+	return math.Round(score*100) / 100, reasons
+}
+
+func normalizeName(name string) []string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	var kept []string
+	for _, word := range words {
+		if !legalForms[word] {
+			kept = append(kept, word)
+		}
+	}
+
+	// A name made only of legal forms is compared as is
+	if len(kept) == 0 {
+		return words
+	}
+
+	return kept
+}
+
+// nameSimilarity is the Dice coefficient of the letter pairs of both names.
+// A name whose words all appear in the other, like "Maju" in "Maju Jaya",
+// counts as similar.
+func nameSimilarity(a, b duplicateKey) float64 {
+	if len(a.name) == 0 || len(b.name) == 0 {
+		return 0
+	}
+
+	if strings.Join(a.name, "") == strings.Join(b.name, "") {
+		return 1
+	}
+
+	var shared, total int
+	for pair, count := range a.pairs {
+		shared += min(count, b.pairs[pair])
+		total += count
+	}
+	for _, count := range b.pairs {
+		total += count
+	}
+
+	var score float64
+	if total > 0 {
+		score = 2 * float64(shared) / float64(total)
+	}
+
+	shorter, longer := a.name, b.name
+	if len(shorter) > len(longer) {
+		shorter, longer = longer, shorter
+	}
+	if containsWords(longer, shorter) {
+		score = math.Max(score, 0.85)
+	}
+
+	return score
+}
+
+func containsWords(words, subset []string) bool {
+	set := make(map[string]bool, len(words))
+	for _, word := range words {
+		set[word] = true
+	}
+
+	for _, word := range subset {
+		if !set[word] {
+			return false
+		}
+	}
+
+	return true
 }
@@ -0,0 +1,223 @@
+package services
+
+import (
+	e "errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/hutamy/invoice-generator-backend/dto"
+	"github.com/hutamy/invoice-generator-backend/models"
+	"github.com/hutamy/invoice-generator-backend/repositories"
+	"gorm.io/gorm"
+)
+
+func TestDuplicateKeyCompare(t *testing.T) {
+	tests := []struct {
+		name    string
+		a, b    models.Client
+		score   float64
+		reasons []string
+	}{
+		{
+			name:    "legal form and extra word",
+			a:       models.Client{Name: "PT Maju"},
+			b:       models.Client{Name: "PT. Maju Jaya"},
+			score:   0.85,
+			reasons: []string{"name"},
+		},
+		{
+			name:    "legal form and punctuation only",
+			a:       models.Client{Name: "CV. Sinar-Abadi"},
+			b:       models.Client{Name: "sinar abadi"},
+			score:   1,
+			reasons: []string{"name"},
+		},
+		{
+			name:    "words run together",
+			a:       models.Client{Name: "Majujaya"},
+			b:       models.Client{Name: "Maju Jaya Tbk"},
+			score:   1,
+			reasons: []string{"name"},
+		},
+		{
+			name:    "email case and spaces",
+			a:       models.Client{Name: "Budi Santoso", Email: " Budi@Example.com"},
+			b:       models.Client{Name: "Toko Kelontong", Email: "budi@example.com "},
+			score:   0.95,
+			reasons: []string{"email"},
+		},
+		{
+			name:    "phone with country and trunk prefixes",
+			a:       models.Client{Name: "Budi Santoso", Phone: "+62 812-3456-7890"},
+			b:       models.Client{Name: "Toko Kelontong", Phone: "(0812) 3456 7890"},
+			score:   0.9,
+			reasons: []string{"phone"},
+		},
+		{
+			name:    "every reason",
+			a:       models.Client{Name: "PT Maju", Email: "info@maju.co.id", Phone: "081234567890"},
+			b:       models.Client{Name: "Maju", Email: "INFO@maju.co.id", Phone: "+6281234567890"},
+			score:   1,
+			reasons: []string{"name", "email", "phone"},
+		},
+		{
+			name: "different names sharing a word",
+			a:    models.Client{Name: "PT Maju Jaya"},
+			b:    models.Client{Name: "PT Jaya Abadi"},
+		},
+		{
+			name: "similar looking names",
+			a:    models.Client{Name: "PT Maju"},
+			b:    models.Client{Name: "PT Mulia"},
+		},
+		{
+			name: "only legal forms",
+			a:    models.Client{Name: "PT"},
+			b:    models.Client{Name: "CV"},
+		},
+		{
+			name: "no emails",
+			a:    models.Client{Name: "Budi Santoso"},
+			b:    models.Client{Name: "Toko Kelontong"},
+		},
+		{
+			name: "phones too short to compare",
+			a:    models.Client{Name: "Budi Santoso", Phone: "1234567"},
+			b:    models.Client{Name: "Toko Kelontong", Phone: "1234567"},
+		},
+		{
+			name: "phones differing in the last digit",
+			a:    models.Client{Name: "Budi Santoso", Phone: "+62 812 3456 7890"},
+			b:    models.Client{Name: "Toko Kelontong", Phone: "+62 812 3456 7891"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			score, reasons := newDuplicateKey(tt.a).compare(newDuplicateKey(tt.b))
+			if score != tt.score || !slices.Equal(reasons, tt.reasons) {
+				t.Fatalf("compare() = %v %v, want %v %v", score, reasons, tt.score, tt.reasons)
+			}
+
+			// The comparison does not depend on the order of the clients
+			if reversed, _ := newDuplicateKey(tt.b).compare(newDuplicateKey(tt.a)); reversed != score {
+				t.Fatalf("compare() reversed = %v, want %v", reversed, score)
+			}
+		})
+	}
+}
+
+// duplicateClients serves the clients of organization 1 to SuggestDuplicates
+type duplicateClients struct {
+	repositories.ClientRepository
+	clients []models.Client
+}
+
+func (r *duplicateClients) ListDuplicateCandidates(organizationID uint) ([]models.Client, error) {
+	return r.clients, nil
+}
+
+func (r *duplicateClients) GetClientsByIDs(ids []uint, organizationID uint) ([]models.Client, error) {
+	var clients []models.Client
+	for _, client := range r.clients {
+		if slices.Contains(ids, client.ID) {
+			clients = append(clients, client)
+		}
+	}
+
+	return clients, nil
+}
+
+func TestSuggestDuplicates(t *testing.T) {
+	created := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	repo := &duplicateClients{clients: []models.Client{
+		{ID: 1, Name: "PT. Maju Jaya", CreatedAt: created.AddDate(0, 1, 0)},
+		{ID: 2, Name: "PT Maju", CreatedAt: created},
+		{ID: 3, Name: "Sinar Abadi", Email: "info@sinar.id", CreatedAt: created},
+		{ID: 4, Name: "CV Sinar Abadi", Email: "INFO@sinar.id", CreatedAt: created},
+		{ID: 5, Name: "Toko Kelontong", Phone: "0812 3456 7890", CreatedAt: created},
+		{ID: 6, Name: "Budi Santoso", Phone: "+62 812 3456 7890", CreatedAt: created},
+		{ID: 7, Name: "Mulia Abadi", CreatedAt: created},
+	}}
+	service := &clientService{clientRepo: repo}
+
+	tests := []struct {
+		name     string
+		req      dto.GetClientDuplicatesRequest
+		pairs    [][2]uint
+		total    int64
+		pageSize int
+	}{
+		{
+			name:     "organization",
+			req:      dto.GetClientDuplicatesRequest{},
+			pairs:    [][2]uint{{3, 4}, {5, 6}, {2, 1}},
+			total:    3,
+			pageSize: 10,
+		},
+		{
+			name:     "second page",
+			req:      dto.GetClientDuplicatesRequest{PaginationRequest: dto.PaginationRequest{Page: 2, PageSize: 2}},
+			pairs:    [][2]uint{{2, 1}},
+			total:    3,
+			pageSize: 2,
+		},
+		{
+			name:     "page past the end",
+			req:      dto.GetClientDuplicatesRequest{PaginationRequest: dto.PaginationRequest{Page: 5, PageSize: 2}},
+			pairs:    [][2]uint{},
+			total:    3,
+			pageSize: 2,
+		},
+		{
+			name:     "one client, older in its pair",
+			req:      dto.GetClientDuplicatesRequest{ClientID: 2},
+			pairs:    [][2]uint{{2, 1}},
+			total:    1,
+			pageSize: 10,
+		},
+		{
+			name:     "one client, newer in its pair",
+			req:      dto.GetClientDuplicatesRequest{ClientID: 1},
+			pairs:    [][2]uint{{2, 1}},
+			total:    1,
+			pageSize: 10,
+		},
+		{
+			name:     "one client without duplicates",
+			req:      dto.GetClientDuplicatesRequest{ClientID: 7},
+			pairs:    [][2]uint{},
+			total:    0,
+			pageSize: 10,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.req.OrganizationID = 1
+			result, err := service.SuggestDuplicates(tt.req)
+			if err != nil {
+				t.Fatalf("SuggestDuplicates() error = %v", err)
+			}
+
+			duplicates := result.Data.([]dto.ClientDuplicate)
+			pairs := make([][2]uint, len(duplicates))
+			for i, duplicate := range duplicates {
+				pairs[i] = [2]uint{duplicate.Client.ID, duplicate.Duplicate.ID}
+			}
+
+			if !slices.Equal(pairs, tt.pairs) {
+				t.Errorf("pairs = %v, want %v", pairs, tt.pairs)
+			}
+
+			if result.Pagination.TotalItems != tt.total || result.Pagination.PageSize != tt.pageSize {
+				t.Errorf("pagination = %+v, want %d items in pages of %d", result.Pagination, tt.total, tt.pageSize)
+			}
+		})
+	}
+
+	if _, err := service.SuggestDuplicates(dto.GetClientDuplicatesRequest{OrganizationID: 1, ClientID: 99}); !e.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("SuggestDuplicates() of an unknown client error = %v, want %v", err, gorm.ErrRecordNotFound)
+	}
+}
@@ -0,0 +1,339 @@
+package services
+
+import (
+	"archive/zip"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/hutamy/invoice-generator-backend/dto"
+	"github.com/hutamy/invoice-generator-backend/models"
+	"github.com/hutamy/invoice-generator-backend/repositories"
+	"github.com/hutamy/invoice-generator-backend/utils/errors"
+)
+
+const (
+	// exportStaleAfter is how long a pending or running job can go without
+	// progress before it is taken to be left behind by a restart
+	exportStaleAfter = 10 * time.Minute
+	// exportMaxAttempts is how often an interrupted job is started again
+	exportMaxAttempts   = 3
+	exportSweepInterval = 5 * time.Minute
+)
+
+var unsafeFilenameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+type ExportService interface {
+	// Start picks up jobs interrupted by a restart and deletes expired
+	// archives, now and then periodically
+	Start()
+	CreateExport(req dto.ExportInvoicesRequest) (*models.ExportJob, error)
+	GetExport(id, organizationID uint) (*models.ExportJob, error)
+	GetExportFile(id, organizationID uint) (string, error)
+}
+
+type exportService struct {
+	exportRepo     repositories.ExportRepository
+	invoiceRepo    repositories.InvoiceRepository
+	invoiceService InvoiceService
+	exportDir      string
+	maxPending     int
+	retention      time.Duration
+	workers        chan struct{} // one slot per export being rendered
+	queued         sync.Map      // ids of jobs waiting for or holding a slot
+}
+
+func NewExportService(
+	exportRepo repositories.ExportRepository,
+	invoiceRepo repositories.InvoiceRepository,
+	invoiceService InvoiceService,
+	exportDir string,
+	workers int,
+	maxPending int,
+	retention time.Duration,
+) ExportService {
+	if workers < 1 {
+		workers = 1
+	}
+
+	return &exportService{
+		exportRepo:     exportRepo,
+		invoiceRepo:    invoiceRepo,
+		invoiceService: invoiceService,
+		exportDir:      exportDir,
+		maxPending:     maxPending,
+		retention:      retention,
+		workers:        make(chan struct{}, workers),
+	}
+}
+
+func (s *exportService) Start() {
+	go func() {
+		ticker := time.NewTicker(exportSweepInterval)
+		defer ticker.Stop()
+		for {
+			s.resumeStaleJobs()
+			s.deleteExpiredArchives()
+			<-ticker.C
+		}
+	}()
+}
+
+// CreateExport records a new export job and builds the archive in the background.
+// Progress can be polled with GetExport.
+func (s *exportService) CreateExport(req dto.ExportInvoicesRequest) (*models.ExportJob, error) {
+	job := &models.ExportJob{
+		OrganizationID: req.OrganizationID,
+		UserID:         req.UserID,
+		Status:         models.ExportStatusPending,
+		InvoiceStatus:  req.Status,
+		ClientID:       req.ClientID,
+	}
+
+	if req.DateFrom != "" {
+		dateFrom, err := time.Parse(time.DateOnly, req.DateFrom)
+		if err != nil {
+			return nil, errors.ErrInvalidDateFormat
+		}
+
+		job.DateFrom = &dateFrom
+	}
+
+	if req.DateTo != "" {
+		dateTo, err := time.Parse(time.DateOnly, req.DateTo)
+		if err != nil {
+			return nil, errors.ErrInvalidDateFormat
+		}
+
+		job.DateTo = &dateTo
+	}
+
+	if s.maxPending > 0 {
+		unfinished, err := s.exportRepo.CountUnfinishedJobs(req.UserID)
+		if err != nil {
+			return nil, err
+		}
+
+		if unfinished >= int64(s.maxPending) {
+			return nil, errors.ErrTooManyExports
+		}
+	}
+
+	if err := s.exportRepo.CreateJob(job); err != nil {
+		return nil, err
+	}
+
+	s.enqueue(*job)
+	return job, nil
+}
+
+func (s *exportService) GetExport(id, organizationID uint) (*models.ExportJob, error) {
+	return s.exportRepo.GetJobByID(id, organizationID)
+}
+
+// GetExportFile returns the path of a finished export archive
+func (s *exportService) GetExportFile(id, organizationID uint) (string, error) {
+	job, err := s.exportRepo.GetJobByID(id, organizationID)
+	if err != nil {
+		return "", err
+	}
+
+	if job.Status == models.ExportStatusExpired {
+		return "", errors.ErrExportExpired
+	}
+
+	if job.Status != models.ExportStatusCompleted {
+		return "", errors.ErrExportNotReady
+	}
+
+	return job.FilePath, nil
+}
+
+// enqueue runs the job once a worker slot is free, unless it is already
+// waiting in this instance
+func (s *exportService) enqueue(job models.ExportJob) {
+	if _, queued := s.queued.LoadOrStore(job.ID, true); queued {
+		return
+	}
+
+	go func() {
+		defer s.queued.Delete(job.ID)
+		s.workers <- struct{}{}
+		defer func() { <-s.workers }()
+		s.run(job)
+	}()
+}
+
+func (s *exportService) run(job models.ExportJob) {
+	claimed, err := s.exportRepo.ClaimJob(&job)
+	if err != nil {
+		log.Printf("failed to start export job %d: %v", job.ID, err)
+		return
+	}
+
+	if !claimed {
+		return
+	}
+
+	filePath, err := s.buildArchive(&job)
+	if err != nil {
+		job.Status = models.ExportStatusFailed
+		job.Error = err.Error()
+	} else {
+		job.Status = models.ExportStatusCompleted
+		job.FilePath = filePath
+	}
+
+	now := time.Now()
+	job.CompletedAt = &now
+	if job.Status == models.ExportStatusCompleted && s.retention > 0 {
+		expiresAt := now.Add(s.retention)
+		job.ExpiresAt = &expiresAt
+	}
+
+	if err := s.exportRepo.UpdateJob(&job); err != nil {
+		log.Printf("failed to finish export job %d: %v", job.ID, err)
+	}
+}
+
+// resumeStaleJobs starts jobs that stopped making progress again, or fails
+// them once they were interrupted exportMaxAttempts times
+func (s *exportService) resumeStaleJobs() {
+	jobs, err := s.exportRepo.ListStaleJobs(time.Now().Add(-exportStaleAfter))
+	if err != nil {
+		log.Printf("failed to list stale export jobs: %v", err)
+		return
+	}
+
+	for _, job := range jobs {
+		if _, queued := s.queued.Load(job.ID); queued {
+			continue
+		}
+
+		if job.Status == models.ExportStatusRunning && job.Attempts >= exportMaxAttempts {
+			now := time.Now()
+			job.Status = models.ExportStatusFailed
+			job.Error = "export was interrupted too many times"
+			job.CompletedAt = &now
+		} else {
+			job.Status = models.ExportStatusPending
+		}
+
+		if err := s.exportRepo.UpdateJob(&job); err != nil {
+			log.Printf("failed to recover export job %d: %v", job.ID, err)
+			continue
+		}
+
+		if job.Status == models.ExportStatusPending {
+			s.enqueue(job)
+		}
+	}
+}
+
+func (s *exportService) deleteExpiredArchives() {
+	jobs, err := s.exportRepo.ListExpiredJobs(time.Now())
+	if err != nil {
+		log.Printf("failed to list expired export jobs: %v", err)
+		return
+	}
+
+	for _, job := range jobs {
+		if err := os.Remove(job.FilePath); err != nil && !os.IsNotExist(err) {
+			log.Printf("failed to delete export archive %d: %v", job.ID, err)
+			continue
+		}
+
+		job.Status = models.ExportStatusExpired
+		job.FilePath = ""
+		if err := s.exportRepo.UpdateJob(&job); err != nil {
+			log.Printf("failed to expire export job %d: %v", job.ID, err)
+		}
+	}
+}
+
+func (s *exportService) buildArchive(job *models.ExportJob) (string, error) {
+	invoices, err := s.invoiceRepo.ListInvoicesForExport(job)
+	if err != nil {
+		return "", err
+	}
+
+	job.Total = len(invoices)
+	if err := s.exportRepo.UpdateJob(job); err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(s.exportDir, 0o755); err != nil {
+		return "", err
+	}
+
+	filePath := filepath.Join(s.exportDir, fmt.Sprintf("export-%d.zip", job.ID))
+	file, err := os.Create(filePath)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.writeArchive(file, job, invoices); err != nil {
+		file.Close()
+		os.Remove(filePath)
+		return "", err
+	}
+
+	if err := file.Close(); err != nil {
+		os.Remove(filePath)
+		return "", err
+	}
+
+	return filePath, nil
+}
+
+func (s *exportService) writeArchive(file *os.File, job *models.ExportJob, invoices []models.Invoice) error {
+	archive := zip.NewWriter(file)
+	usedNames := map[string]bool{}
+	for i, invoice := range invoices {
+		pdfData, _, err := s.invoiceService.GenerateInvoicePDF(dto.InvoicePDFRequest{
+			InvoiceID:      invoice.ID,
+			OrganizationID: job.OrganizationID,
+		})
+		if err != nil {
+			return fmt.Errorf("invoice %s: %w", invoice.InvoiceNumber, err)
+		}
+
+		name := exportFileName(invoice, usedNames)
+		entry, err := archive.Create(name)
+		if err != nil {
+			return err
+		}
+
+		if _, err := entry.Write(pdfData); err != nil {
+			return err
+		}
+
+		job.Processed = i + 1
+		if err := s.exportRepo.UpdateProgress(job.ID, job.Processed); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+// exportFileName names the archive entry after the invoice number, keeping it
+// unique when two invoices share a number or sanitize to the same name.
+func exportFileName(invoice models.Invoice, usedNames map[string]bool) string {
+	base := unsafeFilenameChars.ReplaceAllString(invoice.InvoiceNumber, "-")
+	if base == "" || base == "-" {
+		base = fmt.Sprintf("invoice-%d", invoice.ID)
+	}
+
+	name := base + ".pdf"
+	if usedNames[name] {
+		name = fmt.Sprintf("%s-%d.pdf", base, invoice.ID)
+	}
+
+	usedNames[name] = true
+	return name
+}
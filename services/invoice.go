@@ -3,51 +3,131 @@ package services
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	e "errors"
+	"fmt"
 	"html/template"
+	"log"
+	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/chromedp/cdproto/page"
 	"github.com/chromedp/chromedp"
-	"github.com/dustin/go-humanize"
+	"github.com/hutamy/invoice-generator-backend/config"
 	"github.com/hutamy/invoice-generator-backend/dto"
 	"github.com/hutamy/invoice-generator-backend/models"
 	"github.com/hutamy/invoice-generator-backend/repositories"
 	"github.com/hutamy/invoice-generator-backend/utils"
+	"github.com/hutamy/invoice-generator-backend/utils/cache"
+	"github.com/hutamy/invoice-generator-backend/utils/errors"
+	"github.com/hutamy/invoice-generator-backend/utils/facturx"
+	"github.com/hutamy/invoice-generator-backend/utils/i18n"
+	"github.com/hutamy/invoice-generator-backend/utils/pdfa"
+	"github.com/hutamy/invoice-generator-backend/utils/pdfsign"
+	"gorm.io/gorm"
+)
+
+const invoiceTemplatePath = "templates/invoice.html"
+
+const (
+	PDFFormatStandard = "pdf"
+	// PDFFormatPDFA3 produces a PDF/A-3 document with embedded Factur-X data
+	PDFFormatPDFA3 = "pdfa3"
 )
 
 type InvoiceService interface {
-	CreateInvoice(invoice *models.Invoice) error
-	GetInvoiceByID(id uint) (*models.Invoice, error)
-	ListInvoiceByUserID(userID uint) ([]models.Invoice, error)
-	ListInvoiceByUserIDWithPagination(req dto.GetInvoicesRequest) (utils.PaginatedResponse, error)
-	UpdateInvoice(id uint, req *dto.UpdateInvoiceRequest) error
-	GenerateInvoicePDF(invoiceID uint) ([]byte, error)
+	CreateInvoice(invoice *models.Invoice, paymentMethodIDs []uint) error
+	GetInvoiceByID(id, organizationID uint) (*models.Invoice, error)
+	ListInvoiceByOrganizationID(organizationID uint) ([]models.Invoice, error)
+	ListInvoiceByOrganizationIDWithPagination(req dto.GetInvoicesRequest) (utils.PaginatedResponse, error)
+	UpdateInvoice(id, organizationID uint, req *dto.UpdateInvoiceRequest) error
+	GenerateInvoicePDF(req dto.InvoicePDFRequest) ([]byte, string, error)
 	GeneratePublicInvoicePDF(req dto.GeneratePublicInvoiceRequest) ([]byte, error)
-	DeleteInvoice(id uint) error
-	UpdateInvoiceStatus(id uint, status string) error
-	InvoiceSummary(userID uint) (dto.SummaryInvoice, error)
+	DeleteInvoice(id, organizationID uint) error
+	UpdateInvoiceStatus(id, organizationID uint, status string) error
+	InvoiceSummary(organizationID uint) (dto.SummaryInvoice, error)
+	RefreshSender(id, organizationID uint) (*models.Invoice, error)
+	RefreshClient(id, organizationID uint) (*models.Invoice, error)
 }
 
 type invoiceService struct {
 	invoiceRepo repositories.InvoiceRepository
 	clientRepo  repositories.ClientRepository
 	authRepo    repositories.AuthRepository
+	profileRepo repositories.SenderProfileRepository
+	paymentRepo repositories.PaymentMethodRepository
+	pdfCache    cache.Cache
+	certService CertificateService
 }
 
 func NewInvoiceService(
 	invoiceRepo repositories.InvoiceRepository,
 	clientRepo repositories.ClientRepository,
 	authRepo repositories.AuthRepository,
+	profileRepo repositories.SenderProfileRepository,
+	paymentRepo repositories.PaymentMethodRepository,
+	pdfCache cache.Cache,
+	certService CertificateService,
 ) InvoiceService {
 	return &invoiceService{
 		invoiceRepo: invoiceRepo,
 		clientRepo:  clientRepo,
 		authRepo:    authRepo,
+		profileRepo: profileRepo,
+		paymentRepo: paymentRepo,
+		pdfCache:    pdfCache,
+		certService: certService,
 	}
 }
 
-func (s *invoiceService) CreateInvoice(invoice *models.Invoice) error {
+// CreateInvoice stores a new draft invoice together with a copy of its sender
+// and of the payment methods it prints, which is taken again when the draft
+// is issued. paymentMethodIDs selects the methods,
+// nil picks every method of the sender profile accepting the currency. Client
+// details left empty are copied from the linked client, and without a due date
+// the client's payment terms apply.
+func (s *invoiceService) CreateInvoice(invoice *models.Invoice, paymentMethodIDs []uint) error {
+	client, err := s.lookupClient(invoice.ClientID, invoice.OrganizationID)
+	if err != nil {
+		return err
+	}
+
+	if client != nil {
+		fillClient(invoice, client)
+	}
+
+	if invoice.DueDate.IsZero() {
+		if client == nil || client.PaymentTermDays == 0 {
+			return errors.ErrDueDateRequired
+		}
+
+		invoice.PaymentTermDays = client.PaymentTermDays
+		invoice.DueDate = invoice.IssueDate.AddDate(0, 0, client.PaymentTermDays)
+	}
+
+	if invoice.Currency == "" {
+		invoice.Currency = config.GetConfig().InvoiceCurrency
+	}
+	invoice.Currency = strings.ToUpper(invoice.Currency)
+
+	profile, err := s.senderProfile(invoice.SenderProfileID, invoice.OrganizationID)
+	if err != nil {
+		return err
+	}
+
+	if profile == nil && invoice.InvoiceNumber == "" {
+		return errors.ErrInvoiceNumberRequired
+	}
+
+	if err := s.copySender(invoice, profile, paymentMethodIDs); err != nil {
+		return err
+	}
+
 	var subtotal float64
 	for i, item := range invoice.Items {
 		total := float64(item.Quantity) * item.UnitPrice
@@ -62,15 +142,15 @@ func (s *invoiceService) CreateInvoice(invoice *models.Invoice) error {
 	return s.invoiceRepo.CreateInvoice(invoice)
 }
 
-func (s *invoiceService) GetInvoiceByID(id uint) (*models.Invoice, error) {
-	return s.invoiceRepo.GetInvoiceByID(id)
+func (s *invoiceService) GetInvoiceByID(id, organizationID uint) (*models.Invoice, error) {
+	return s.invoiceRepo.GetInvoiceByID(id, organizationID)
 }
 
-func (s *invoiceService) ListInvoiceByUserID(userID uint) ([]models.Invoice, error) {
-	return s.invoiceRepo.ListInvoiceByUserID(userID)
+func (s *invoiceService) ListInvoiceByOrganizationID(organizationID uint) ([]models.Invoice, error) {
+	return s.invoiceRepo.ListInvoiceByOrganizationID(organizationID)
 }
 
-func (s *invoiceService) ListInvoiceByUserIDWithPagination(req dto.GetInvoicesRequest) (utils.PaginatedResponse, error) {
+func (s *invoiceService) ListInvoiceByOrganizationIDWithPagination(req dto.GetInvoicesRequest) (utils.PaginatedResponse, error) {
 	// Set default values for pagination
 	if req.Page < 1 {
 		req.Page = 1
@@ -82,7 +162,7 @@ func (s *invoiceService) ListInvoiceByUserIDWithPagination(req dto.GetInvoicesRe
 		req.PageSize = 100
 	}
 
-	invoices, totalItems, err := s.invoiceRepo.ListInvoiceByUserIDWithPagination(req)
+	invoices, totalItems, err := s.invoiceRepo.ListInvoiceByOrganizationIDWithPagination(req)
 	if err != nil {
 		return utils.PaginatedResponse{}, err
 	}
@@ -91,45 +171,547 @@ func (s *invoiceService) ListInvoiceByUserIDWithPagination(req dto.GetInvoicesRe
 	return utils.PaginatedData(invoices, pagination), nil
 }
 
-func (s *invoiceService) UpdateInvoice(id uint, req *dto.UpdateInvoiceRequest) error {
-	return s.invoiceRepo.UpdateInvoice(id, req)
+// UpdateInvoice applies req to the invoice. Linking another client copies
+// its details for every client field the request leaves out.
+func (s *invoiceService) UpdateInvoice(id, organizationID uint, req *dto.UpdateInvoiceRequest) error {
+	if req.ClientID != nil {
+		client, err := s.lookupClient(*req.ClientID, organizationID)
+		if err != nil {
+			return err
+		}
+
+		req.Client = client
+	}
+
+	if req.SenderProfileID != nil || req.Currency != nil || req.PaymentMethodIDs != nil {
+		if err := s.updateSender(id, organizationID, req); err != nil {
+			return err
+		}
+	}
+
+	return s.invoiceRepo.UpdateInvoice(id, organizationID, req)
+}
+
+// updateSender fills in the sender and payment method copies for a change of
+// sender profile, currency or payment methods. Payment methods are picked
+// again by currency unless the request lists them.
+func (s *invoiceService) updateSender(id, organizationID uint, req *dto.UpdateInvoiceRequest) error {
+	invoice, err := s.invoiceRepo.GetInvoiceByID(id, organizationID)
+	if err != nil {
+		return err
+	}
+
+	if invoice.Status != "draft" {
+		return errors.ErrInvoiceNotDraft
+	}
+
+	currency := invoice.Currency
+	if req.Currency != nil {
+		currency = strings.ToUpper(*req.Currency)
+		req.Currency = &currency
+	}
+
+	profileID := invoice.SenderProfileID
+	if req.SenderProfileID != nil {
+		profile, err := s.senderProfile(req.SenderProfileID, organizationID)
+		if err != nil {
+			return err
+		}
+
+		req.Sender = profile.SenderDetails
+		profileID = &profile.ID
+	}
+
+	var ids []uint
+	if req.PaymentMethodIDs != nil {
+		ids = *req.PaymentMethodIDs
+	}
+
+	if profileID == nil {
+		if len(ids) > 0 {
+			return errors.ErrInvalidPaymentMethod
+		}
+
+		return nil
+	}
+
+	methods, err := s.selectPaymentMethods(*profileID, ids, currency)
+	if err != nil {
+		return err
+	}
+
+	req.PaymentMethods = &methods
+	return nil
 }
 
-func (s *invoiceService) GenerateInvoicePDF(invoiceID uint) ([]byte, error) {
-	invoice, err := s.invoiceRepo.GetInvoiceByID(invoiceID)
+// selectPaymentMethods copies the payment methods of a sender profile that
+// an invoice in currency prints. Without ids every method accepting the
+// currency is used, listed methods must all accept it.
+func (s *invoiceService) selectPaymentMethods(senderProfileID uint, ids []uint, currency string) ([]models.InvoicePaymentMethod, error) {
+	methods, err := s.paymentRepo.ListPaymentMethods(senderProfileID)
 	if err != nil {
 		return nil, err
 	}
 
-	client, err := s.clientRepo.GetClientByID(invoice.ClientID, invoice.UserID)
+	var selected []models.PaymentMethod
+	if ids == nil {
+		for _, method := range methods {
+			if method.AcceptsCurrency(currency) {
+				selected = append(selected, method)
+			}
+		}
+	} else {
+		byID := make(map[uint]models.PaymentMethod, len(methods))
+		for _, method := range methods {
+			byID[method.ID] = method
+		}
+
+		for _, id := range ids {
+			method, ok := byID[id]
+			if !ok {
+				return nil, errors.ErrInvalidPaymentMethod
+			}
+
+			if !method.AcceptsCurrency(currency) {
+				return nil, errors.ErrPaymentMethodCurrency
+			}
+
+			selected = append(selected, method)
+		}
+	}
+
+	copies := make([]models.InvoicePaymentMethod, len(selected))
+	for i, method := range selected {
+		copies[i] = models.InvoicePaymentMethod{
+			PaymentMethodID: &selected[i].ID,
+			PaymentDetails:  method.PaymentDetails,
+			Position:        i,
+		}
+	}
+
+	return copies, nil
+}
+
+// senderProfile loads the profile an invoice is issued from, or the
+// organization default when id is nil. Without any profile it returns nil.
+func (s *invoiceService) senderProfile(id *uint, organizationID uint) (*models.SenderProfile, error) {
+	if id == nil {
+		profile, err := s.profileRepo.GetDefaultSenderProfile(organizationID)
+		if e.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+
+		return profile, err
+	}
+
+	profile, err := s.profileRepo.GetSenderProfile(*id, organizationID)
 	if err != nil {
+		if e.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.ErrInvalidSenderProfile
+		}
+
 		return nil, err
 	}
 
+	return profile, nil
+}
+
+// copySender copies the sender details and payment methods onto the invoice.
+// They come from profile, or from the account of the creator when the
+// organization has no sender profile. Payment methods belong to sender
+// profiles only: the creator's own bank details are personal and are not
+// printed on the organization's invoices.
+func (s *invoiceService) copySender(invoice *models.Invoice, profile *models.SenderProfile, paymentMethodIDs []uint) error {
+	now := time.Now()
+	invoice.SenderSnapshotAt = &now
+	if profile != nil {
+		methods, err := s.selectPaymentMethods(profile.ID, paymentMethodIDs, invoice.Currency)
+		if err != nil {
+			return err
+		}
+
+		invoice.SenderProfileID = &profile.ID
+		invoice.Sender = profile.SenderDetails
+		invoice.PaymentMethods = methods
+		return nil
+	}
+
+	if len(paymentMethodIDs) > 0 {
+		return errors.ErrInvalidPaymentMethod
+	}
+
+	// The creator may have deleted their account since, the invoice then
+	// keeps the details copied while it still existed
 	user, err := s.authRepo.GetUserByID(invoice.UserID)
+	if e.Is(err, gorm.ErrRecordNotFound) && invoice.ID != 0 {
+		invoice.SenderProfileID = nil
+		invoice.PaymentMethods = nil
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	invoice.SenderProfileID = nil
+	invoice.Sender = models.SenderDetails{
+		Name:    user.Name,
+		Email:   user.Email,
+		Phone:   user.Phone,
+		Address: user.Address,
+	}
+	invoice.PaymentMethods = nil
+	return nil
+}
+
+// RefreshSender copies the current details of the sender onto a draft
+// invoice. The payment methods printed so far are kept, unless one of them
+// no longer exists and they are picked again by currency.
+func (s *invoiceService) RefreshSender(id, organizationID uint) (*models.Invoice, error) {
+	invoice, err := s.invoiceRepo.GetInvoiceByID(id, organizationID)
 	if err != nil {
 		return nil, err
 	}
 
-	// Load HTML template
-	htmlContent, err := s.generateHTMLContent(invoice, client, user)
+	if invoice.Status != "draft" {
+		return nil, errors.ErrInvoiceNotDraft
+	}
+
+	if err := s.snapshotSender(invoice, organizationID); err != nil {
+		return nil, err
+	}
+
+	return invoice, nil
+}
+
+// snapshotSender copies the current details of the sender onto the invoice
+// and stores them, keeping the payment methods printed so far where it can
+func (s *invoiceService) snapshotSender(invoice *models.Invoice, organizationID uint) error {
+	var profile *models.SenderProfile
+	if invoice.SenderProfileID != nil {
+		var err error
+		profile, err = s.senderProfile(invoice.SenderProfileID, organizationID)
+		if err != nil {
+			return err
+		}
+	}
+
+	var ids []uint
+	for _, method := range invoice.PaymentMethods {
+		if method.PaymentMethodID != nil {
+			ids = append(ids, *method.PaymentMethodID)
+		}
+	}
+
+	err := s.copySender(invoice, profile, ids)
+	if e.Is(err, errors.ErrInvalidPaymentMethod) || e.Is(err, errors.ErrPaymentMethodCurrency) {
+		err = s.copySender(invoice, profile, nil)
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.invoiceRepo.UpdateInvoiceSender(invoice)
+}
+
+// RefreshClient copies the current details of the linked client onto a draft
+// invoice, replacing the ones it was created with.
+func (s *invoiceService) RefreshClient(id, organizationID uint) (*models.Invoice, error) {
+	invoice, err := s.invoiceRepo.GetInvoiceByID(id, organizationID)
 	if err != nil {
 		return nil, err
 	}
 
-	return s.generatePdf(htmlContent)
+	if invoice.Status != "draft" {
+		return nil, errors.ErrClientRefreshNotDraft
+	}
+
+	if invoice.ClientID == 0 {
+		return nil, errors.ErrInvoiceWithoutClient
+	}
+
+	client, err := s.lookupClient(invoice.ClientID, organizationID)
+	if err != nil {
+		return nil, err
+	}
+
+	invoice.SetClient(client)
+	if err := s.invoiceRepo.UpdateInvoiceClient(invoice); err != nil {
+		return nil, err
+	}
+
+	return invoice, nil
+}
+
+// fillClient copies the details of client into the empty client fields of
+// the invoice, and its currency when the invoice has none
+func fillClient(invoice *models.Invoice, client *models.Client) {
+	given := *invoice
+	invoice.SetClient(client)
+
+	keep := func(field *string, value string) {
+		if value != "" {
+			*field = value
+		}
+	}
+
+	keep(&invoice.ClientName, given.ClientName)
+	keep(&invoice.ClientEmail, given.ClientEmail)
+	keep(&invoice.ClientAddress, given.ClientAddress)
+	keep(&invoice.ClientPhone, given.ClientPhone)
+	keep(&invoice.ClientLocale, given.ClientLocale)
+	keep(&invoice.Currency, given.Currency)
+	if invoice.Currency == "" {
+		invoice.Currency = client.Currency
+	}
+}
+
+// invoiceClient is the client as copied onto the invoice, which is what the
+// invoice prints even when the client record changed or was deleted since
+func invoiceClient(invoice *models.Invoice) *models.Client {
+	client := &models.Client{
+		ID:             invoice.ClientID,
+		OrganizationID: invoice.OrganizationID,
+		Name:           invoice.ClientName,
+		Email:          invoice.ClientEmail,
+		Address:        invoice.ClientAddress,
+		BillingAddress: invoice.ClientBillingAddress,
+		Phone:          invoice.ClientPhone,
+		TaxID:          invoice.ClientTaxID,
+		Locale:         invoice.ClientLocale,
+	}
+
+	if invoice.ClientContact != "" {
+		client.Contacts = []models.ClientContact{{Name: invoice.ClientContact, Role: models.ContactRoleBilling}}
+	}
+
+	return client
+}
+
+// printedPaymentMethods lists the payment methods printed on the invoice
+func printedPaymentMethods(invoice *models.Invoice) []models.PaymentDetails {
+	details := make([]models.PaymentDetails, len(invoice.PaymentMethods))
+	for i, method := range invoice.PaymentMethods {
+		details[i] = method.PaymentDetails
+	}
+
+	return details
+}
+
+// bankTransfer describes a single bank account as a payment method, or
+// nothing when no account number is known
+func bankTransfer(bankName, accountName, accountNumber string) []models.PaymentDetails {
+	if accountNumber == "" {
+		return nil
+	}
+
+	return []models.PaymentDetails{{
+		Type:          models.PaymentMethodBankTransfer,
+		BankName:      bankName,
+		AccountName:   accountName,
+		AccountNumber: accountNumber,
+	}}
+}
+
+// senderLogo loads the logo of the sender, or nil when it has none
+func (s *invoiceService) senderLogo(sender *models.SenderDetails) (*models.Logo, error) {
+	if sender.LogoID == nil {
+		return nil, nil
+	}
+
+	return s.profileRepo.GetLogo(*sender.LogoID)
+}
+
+// lookupClient loads a referenced client of the organization. Invoices
+// without a client are allowed, nil is returned for them.
+func (s *invoiceService) lookupClient(clientID, organizationID uint) (*models.Client, error) {
+	if clientID == 0 {
+		return nil, nil
+	}
+
+	client, err := s.clientRepo.GetClientByID(clientID, organizationID)
+	if err != nil {
+		if e.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.ErrInvalidClient
+		}
+
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// GenerateInvoicePDF renders the invoice PDF and returns it together with its ETag.
+// When req.IfNoneMatch already matches the ETag, errors.ErrNotModified is returned
+// without rendering anything.
+func (s *invoiceService) GenerateInvoicePDF(req dto.InvoicePDFRequest) ([]byte, string, error) {
+	if req.Locale != "" && !i18n.IsSupported(req.Locale) {
+		return nil, "", errors.ErrUnsupportedLocale
+	}
+
+	format, err := normalizeFormat(req.Format)
+	if err != nil {
+		return nil, "", err
+	}
+
+	invoice, err := s.invoiceRepo.GetInvoiceByID(req.InvoiceID, req.OrganizationID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	client := invoiceClient(invoice)
+	creatorLocale, err := s.creatorLocale(invoice.UserID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	localizer, err := i18n.NewLocalizer(i18n.Resolve(req.Locale, client.Locale, creatorLocale))
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Invoices are signed whenever the organization has uploaded a signing
+	// certificate. An expired certificate must not block downloads, so the
+	// PDF is then rendered unsigned and the certificate reports itself as
+	// expired.
+	cert, err := s.certService.GetCertificate(invoice.OrganizationID)
+	if err != nil && !e.Is(err, gorm.ErrRecordNotFound) {
+		return nil, "", err
+	}
+
+	if cert != nil && cert.Expired {
+		log.Printf("invoice %d rendered unsigned: signing certificate %d is valid from %s to %s",
+			invoice.ID, cert.ID, cert.NotBefore.Format(time.DateOnly), cert.NotAfter.Format(time.DateOnly))
+		cert = nil
+	}
+
+	sender := &invoice.Sender
+	payments := printedPaymentMethods(invoice)
+	logo, err := s.senderLogo(sender)
+	if err != nil {
+		return nil, "", err
+	}
+
+	key, err := s.renderKey(invoice, client, sender, payments, logo, localizer, format, cert)
+	if err != nil {
+		return nil, "", err
+	}
+
+	etag := `"` + key + `"`
+	if utils.ETagMatches(req.IfNoneMatch, etag) {
+		return nil, etag, errors.ErrNotModified
+	}
+
+	if pdfData, ok := s.pdfCache.Get(key); ok {
+		return pdfData, etag, nil
+	}
+
+	// Load HTML template
+	htmlContent, err := s.generateHTMLContent(invoice, client, sender, payments, logo, localizer)
+	if err != nil {
+		return nil, "", err
+	}
+
+	pdfData, err := generatePdf(htmlContent)
+	if err != nil {
+		return nil, "", err
+	}
+
+	pdfData, err = s.convertPDF(pdfData, format, invoice, client, sender)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if cert != nil {
+		signer, err := s.certService.Signer(cert)
+		if err != nil {
+			return nil, "", err
+		}
+
+		pdfData, err = pdfsign.Sign(pdfData, *signer)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	if err := s.pdfCache.Set(key, pdfData); err != nil {
+		log.Printf("failed to cache invoice %d PDF: %v", req.InvoiceID, err)
+	}
+
+	return pdfData, etag, nil
+}
+
+// creatorLocale returns the locale of the user who created an invoice, which
+// is used when neither the request nor the client picks one. Invoices outlive
+// the account of their creator, an empty locale is returned once it is deleted.
+func (s *invoiceService) creatorLocale(userID uint) (string, error) {
+	user, err := s.authRepo.GetUserByID(userID)
+	if e.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return user.Locale, nil
+}
+
+// renderKey hashes everything that ends up in the rendered PDF, including the
+// template itself, so any change to the inputs produces a new key.
+func (s *invoiceService) renderKey(
+	invoice *models.Invoice,
+	client *models.Client,
+	sender *models.SenderDetails,
+	payments []models.PaymentDetails,
+	logo *models.Logo,
+	localizer *i18n.Localizer,
+	format string,
+	cert *models.SigningCertificate,
+) (string, error) {
+	templateContent, err := os.ReadFile(invoiceTemplatePath)
+	if err != nil {
+		return "", err
+	}
+
+	var logoHash string
+	if logo != nil {
+		logoHash = logo.SHA256
+	}
+
+	templateHash := sha256.Sum256(templateContent)
+	payload, err := json.Marshal(map[string]interface{}{
+		"template": hex.EncodeToString(templateHash[:]),
+		"invoice":  invoice,
+		"client":   client,
+		"sender":   sender,
+		"payments": payments,
+		"logo":     logoHash,
+		"locale":   localizer.Locale(),
+		"messages": localizer.Messages(),
+		"format":   format,
+		"signing":  cert,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.Sum256(payload)
+	return hex.EncodeToString(hash[:]), nil
 }
 
 func (s *invoiceService) GeneratePublicInvoicePDF(req dto.GeneratePublicInvoiceRequest) ([]byte, error) {
-	user := &models.User{
-		Name:              req.Sender.Name,
-		Email:             req.Sender.Email,
-		Address:           req.Sender.Address,
-		Phone:             req.Sender.Phone,
-		BankName:          req.Sender.BankName,
-		BankAccountName:   req.Sender.BankAccountName,
-		BankAccountNumber: req.Sender.BankAccountNumber,
+	format, err := normalizeFormat(req.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	sender := &models.SenderDetails{
+		Name:    req.Sender.Name,
+		Email:   req.Sender.Email,
+		Address: req.Sender.Address,
+		Phone:   req.Sender.Phone,
+		TaxID:   req.Sender.TaxID,
 	}
+	payments := bankTransfer(req.Sender.BankName, req.Sender.BankAccountName, req.Sender.BankAccountNumber)
 
 	issueDate, _ := time.Parse(time.DateOnly, req.IssueDate)
 	dueDate, _ := time.Parse(time.DateOnly, req.DueDate)
@@ -139,9 +721,14 @@ func (s *invoiceService) GeneratePublicInvoicePDF(req dto.GeneratePublicInvoiceR
 		DueDate:       dueDate,
 		Notes:         req.Notes,
 		TaxRate:       req.TaxRate,
+		Currency:      strings.ToUpper(req.Currency),
 		Items:         make([]models.InvoiceItem, len(req.Items)),
 	}
 
+	if invoice.Currency == "" {
+		invoice.Currency = config.GetConfig().InvoiceCurrency
+	}
+
 	for i, item := range req.Items {
 		total := float64(item.Quantity) * item.UnitPrice
 		invoice.Subtotal += total
@@ -162,33 +749,134 @@ func (s *invoiceService) GeneratePublicInvoicePDF(req dto.GeneratePublicInvoiceR
 		Phone:   req.Recipient.Phone,
 	}
 
+	localizer, err := i18n.NewLocalizer(req.Locale)
+	if err != nil {
+		return nil, err
+	}
+
 	// Load HTML template
-	htmlContent, err := s.generateHTMLContent(invoice, client, user)
+	htmlContent, err := s.generateHTMLContent(invoice, client, sender, payments, nil, localizer)
 	if err != nil {
 		return nil, err
 	}
 
-	return s.generatePdf(htmlContent)
+	pdfData, err := generatePdf(htmlContent)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.convertPDF(pdfData, format, invoice, client, sender)
 }
 
-func (s *invoiceService) generateHTMLContent(invoice *models.Invoice, client *models.Client, user *models.User) (string, error) {
+func normalizeFormat(format string) (string, error) {
+	switch format {
+	case "", PDFFormatStandard:
+		return PDFFormatStandard, nil
+	case PDFFormatPDFA3:
+		return PDFFormatPDFA3, nil
+	default:
+		return "", errors.ErrUnsupportedFormat
+	}
+}
+
+// convertPDF post-processes the rendered PDF for the requested output format
+func (s *invoiceService) convertPDF(
+	pdfData []byte,
+	format string,
+	invoice *models.Invoice,
+	client *models.Client,
+	sender *models.SenderDetails,
+) ([]byte, error) {
+	if format != PDFFormatPDFA3 {
+		return pdfData, nil
+	}
+
+	cfg := config.GetConfig()
+	xmlData, err := facturx.Build(facturx.Document{
+		Invoice:  invoice,
+		Currency: invoice.Currency,
+		Seller: facturx.Party{
+			Name:      sender.Name,
+			Email:     sender.Email,
+			Address:   sender.Address,
+			CountryID: cfg.InvoiceCountry,
+			TaxID:     sender.TaxID,
+		},
+		Buyer: buyerParty(client, cfg.InvoiceCountry),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errors.ErrInvalidEInvoice, err)
+	}
+
+	return pdfa.Convert(pdfData, pdfa.Options{
+		Title:      "Invoice " + invoice.InvoiceNumber,
+		Author:     sender.Name,
+		CreatedAt:  invoice.CreatedAt,
+		ModifiedAt: invoice.UpdatedAt,
+		Attachment: &pdfa.Attachment{
+			Name:         facturx.FileName,
+			Description:  "Factur-X invoice data",
+			MimeType:     "text/xml",
+			Relationship: "Alternative",
+			Data:         xmlData,
+		},
+		ExtensionXMP: facturx.XMP(),
+	})
+}
+
+// buyerParty describes the client for the e-invoice, using the structured
+// billing address when it has one
+func buyerParty(client *models.Client, defaultCountry string) facturx.Party {
+	party := facturx.Party{
+		Name:      client.Name,
+		Email:     client.Email,
+		Address:   client.Address,
+		CountryID: defaultCountry,
+		TaxID:     client.TaxID,
+	}
+
+	if address := client.BillingAddress; !address.IsZero() {
+		party.Address = address.Line1
+		party.Address2 = address.Line2
+		party.City = address.City
+		party.Region = address.Region
+		party.PostalCode = address.PostalCode
+		if address.Country != "" {
+			party.CountryID = address.Country
+		}
+	}
+
+	return party
+}
+
+func (s *invoiceService) generateHTMLContent(
+	invoice *models.Invoice,
+	client *models.Client,
+	sender *models.SenderDetails,
+	payments []models.PaymentDetails,
+	logo *models.Logo,
+	localizer *i18n.Localizer,
+) (string, error) {
 	// Load HTML template
 	funcMap := template.FuncMap{
-		"humanize": func(value float64) string {
-			return humanize.CommafWithDigits(value, 2)
-		},
+		"t":      localizer.T,
+		"date":   localizer.Date,
+		"number": localizer.Number,
 	}
 	tmpl := template.New("invoice.html").Funcs(funcMap)
-	tmpl, err := tmpl.ParseFiles("templates/invoice.html")
+	tmpl, err := tmpl.ParseFiles(invoiceTemplatePath)
 	if err != nil {
 		return "", err
 	}
 
 	var htmlBuf bytes.Buffer
 	err = tmpl.Execute(&htmlBuf, map[string]interface{}{
-		"Invoice": invoice,
-		"Client":  client,
-		"User":    user,
+		"Invoice":        invoice,
+		"Client":         client,
+		"Sender":         sender,
+		"PaymentMethods": payments,
+		"Logo":           logoURL(logo),
+		"Locale":         localizer.Locale(),
 	})
 	if err != nil {
 		return "", err
@@ -197,7 +885,18 @@ func (s *invoiceService) generateHTMLContent(invoice *models.Invoice, client *mo
 	return htmlBuf.String(), nil
 }
 
-func (s *invoiceService) generatePdf(htmlContent string) ([]byte, error) {
+// logoURL inlines the logo as a data URI, since the page is rendered from
+// about:blank and cannot fetch it
+func logoURL(logo *models.Logo) template.URL {
+	if logo == nil {
+		return ""
+	}
+
+	return template.URL("data:" + logo.ContentType + ";base64," + base64.StdEncoding.EncodeToString(logo.Data))
+}
+
+// generatePdf prints htmlContent to PDF in a headless browser
+func generatePdf(htmlContent string) ([]byte, error) {
 	// Setup headless browser
 	ctx, cancel := chromedp.NewContext(context.Background())
 	defer cancel()
@@ -221,16 +920,34 @@ func (s *invoiceService) generatePdf(htmlContent string) ([]byte, error) {
 	return pdfBuf, nil
 }
 
-func (s *invoiceService) DeleteInvoice(id uint) error {
-	return s.invoiceRepo.DeleteInvoice(id)
+func (s *invoiceService) DeleteInvoice(id, organizationID uint) error {
+	return s.invoiceRepo.DeleteInvoice(id, organizationID)
 }
 
-func (s *invoiceService) UpdateInvoiceStatus(id uint, status string) error {
-	return s.invoiceRepo.UpdateInvoiceStatus(id, status)
+// UpdateInvoiceStatus changes the status of the invoice. A draft being issued
+// first takes a new copy of its sender and payment methods, so it goes out
+// with the details of the profile at that moment. When the profile has been
+// deleted since, the copy taken earlier is kept.
+func (s *invoiceService) UpdateInvoiceStatus(id, organizationID uint, status string) error {
+	if status != "draft" {
+		invoice, err := s.invoiceRepo.GetInvoiceByID(id, organizationID)
+		if err != nil {
+			return err
+		}
+
+		if invoice.Status == "draft" {
+			err := s.snapshotSender(invoice, organizationID)
+			if err != nil && err != errors.ErrInvalidSenderProfile {
+				return err
+			}
+		}
+	}
+
+	return s.invoiceRepo.UpdateInvoiceStatus(id, organizationID, status)
 }
 
-func (s *invoiceService) InvoiceSummary(userID uint) (dto.SummaryInvoice, error) {
-	summary, err := s.invoiceRepo.InvoiceSummary(userID)
+func (s *invoiceService) InvoiceSummary(organizationID uint) (dto.SummaryInvoice, error) {
+	summary, err := s.invoiceRepo.InvoiceSummary(organizationID)
 	if err != nil {
 		return dto.SummaryInvoice{}, err
 	}
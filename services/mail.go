@@ -0,0 +1,36 @@
+package services
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/hutamy/invoice-generator-backend/utils/mail"
+)
+
+const emailTemplateDir = "templates/email"
+
+// sendTemplate renders templates/email/<name>.txt, which defines a "subject"
+// and a "body" template, and sends the result to the given address.
+func sendTemplate(sender mail.Sender, to, name string, data interface{}) error {
+	tmpl, err := template.ParseFiles(filepath.Join(emailTemplateDir, name+".txt"))
+	if err != nil {
+		return err
+	}
+
+	var subject, body bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return err
+	}
+
+	if err := tmpl.ExecuteTemplate(&body, "body", data); err != nil {
+		return err
+	}
+
+	return sender.Send(mail.Message{
+		To:      to,
+		Subject: strings.TrimSpace(subject.String()),
+		Body:    body.String(),
+	})
+}
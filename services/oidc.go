@@ -0,0 +1,231 @@
+package services
+
+import (
+	"context"
+	e "errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hutamy/invoice-generator-backend/config"
+	"github.com/hutamy/invoice-generator-backend/dto"
+	"github.com/hutamy/invoice-generator-backend/models"
+	"github.com/hutamy/invoice-generator-backend/repositories"
+	"github.com/hutamy/invoice-generator-backend/utils"
+	"github.com/hutamy/invoice-generator-backend/utils/errors"
+	"github.com/hutamy/invoice-generator-backend/utils/i18n"
+	"github.com/hutamy/invoice-generator-backend/utils/oidc"
+	"gorm.io/gorm"
+)
+
+type OIDCService interface {
+	Providers() []string
+	Authorize(ctx context.Context, provider string) (dto.OIDCAuthorizeResponse, error)
+	Callback(ctx context.Context, provider string, req dto.OIDCCallbackRequest) (models.User, error)
+}
+
+type oidcService struct {
+	providers    map[string]*oidc.Provider
+	oidcRepo     repositories.OIDCRepository
+	authRepo     repositories.AuthRepository
+	tokenService TokenService
+}
+
+func NewOIDCService(
+	providers []*oidc.Provider,
+	oidcRepo repositories.OIDCRepository,
+	authRepo repositories.AuthRepository,
+	tokenService TokenService,
+) OIDCService {
+	byName := make(map[string]*oidc.Provider, len(providers))
+	for _, provider := range providers {
+		byName[provider.Name()] = provider
+	}
+
+	return &oidcService{
+		providers:    byName,
+		oidcRepo:     oidcRepo,
+		authRepo:     authRepo,
+		tokenService: tokenService,
+	}
+}
+
+func (s *oidcService) Providers() []string {
+	names := make([]string, 0, len(s.providers))
+	for name := range s.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Authorize starts a login at the provider. The state, nonce and PKCE verifier
+// are kept until the callback; the state is also returned so the frontend can
+// match the redirect to the login it started.
+func (s *oidcService) Authorize(ctx context.Context, provider string) (dto.OIDCAuthorizeResponse, error) {
+	p, ok := s.providers[provider]
+	if !ok {
+		return dto.OIDCAuthorizeResponse{}, errors.ErrUnknownProvider
+	}
+
+	state, stateHash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return dto.OIDCAuthorizeResponse{}, err
+	}
+
+	nonce, _, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return dto.OIDCAuthorizeResponse{}, err
+	}
+
+	verifier, _, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return dto.OIDCAuthorizeResponse{}, err
+	}
+
+	authURL, err := p.AuthCodeURL(ctx, state, nonce, verifier)
+	if err != nil {
+		return dto.OIDCAuthorizeResponse{}, err
+	}
+
+	record := &models.OIDCLoginState{
+		Provider:     provider,
+		StateHash:    stateHash,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(config.GetConfig().OIDCStateTTL),
+	}
+	if err := s.oidcRepo.CreateState(record); err != nil {
+		return dto.OIDCAuthorizeResponse{}, err
+	}
+
+	return dto.OIDCAuthorizeResponse{AuthorizationURL: authURL, State: state}, nil
+}
+
+// Callback completes a login and returns the signed-in user. Known identities
+// sign in directly; otherwise the verified email links an existing account or
+// provisions a new one.
+func (s *oidcService) Callback(ctx context.Context, provider string, req dto.OIDCCallbackRequest) (models.User, error) {
+	p, ok := s.providers[provider]
+	if !ok {
+		return models.User{}, errors.ErrUnknownProvider
+	}
+
+	state, err := s.oidcRepo.ConsumeState(utils.HashToken(req.State), provider)
+	if err != nil {
+		if e.Is(err, gorm.ErrRecordNotFound) {
+			return models.User{}, errors.ErrInvalidOIDCState
+		}
+
+		return models.User{}, err
+	}
+
+	claims, err := p.Exchange(ctx, req.Code, state.CodeVerifier, state.Nonce)
+	if err != nil {
+		return models.User{}, fmt.Errorf("%w: %v", errors.ErrOIDCLoginFailed, err)
+	}
+
+	identity, err := s.oidcRepo.GetIdentity(provider, claims.Subject)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	if identity != nil {
+		user, err := s.authRepo.GetUserByID(identity.UserID)
+		if err != nil {
+			if e.Is(err, gorm.ErrRecordNotFound) {
+				return models.User{}, errors.ErrOIDCLoginFailed
+			}
+
+			return models.User{}, err
+		}
+
+		return *user, nil
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return models.User{}, errors.ErrOIDCEmailNotVerified
+	}
+
+	identity = &models.UserIdentity{Provider: provider, Subject: claims.Subject, Email: claims.Email}
+	user, err := s.authRepo.GetUserByEmail(claims.Email)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	if user == nil {
+		return s.provision(claims, identity)
+	}
+
+	if err := s.link(user, identity); err != nil {
+		return models.User{}, err
+	}
+
+	return *user, nil
+}
+
+// link attaches the identity to an existing account. When the account never
+// verified its email, whoever registered it did not prove they own the
+// address, so its password is replaced and its sessions are ended before the
+// provider's verified owner gets in.
+func (s *oidcService) link(user *models.User, identity *models.UserIdentity) error {
+	if user.EmailVerifiedAt == nil {
+		password, err := unusablePassword()
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+		user.Password = password
+		if err := s.authRepo.UpdateUser(user); err != nil {
+			return err
+		}
+
+		if err := s.tokenService.SignOutEverywhere(user.ID); err != nil {
+			return err
+		}
+	}
+
+	identity.UserID = user.ID
+	return s.oidcRepo.CreateIdentity(identity)
+}
+
+// provision creates an account for a first-time single sign-on user. It has no
+// usable password until the user sets one with the password reset flow.
+func (s *oidcService) provision(claims *oidc.Claims, identity *models.UserIdentity) (models.User, error) {
+	password, err := unusablePassword()
+	if err != nil {
+		return models.User{}, err
+	}
+
+	name := claims.Name
+	if name == "" {
+		name = claims.Email
+	}
+
+	now := time.Now()
+	user := &models.User{
+		Name:            name,
+		Email:           claims.Email,
+		EmailVerifiedAt: &now,
+		Password:        password,
+		Locale:          i18n.Resolve(),
+	}
+	if err := s.oidcRepo.CreateUserWithIdentity(user, identity); err != nil {
+		return models.User{}, err
+	}
+
+	return *user, nil
+}
+
+// unusablePassword hashes a random secret nobody knows
+func unusablePassword() (string, error) {
+	secret, _, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	return utils.HashPassword(secret)
+}
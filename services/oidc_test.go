@@ -0,0 +1,333 @@
+package services
+
+import (
+	"context"
+	e "errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/hutamy/invoice-generator-backend/dto"
+	"github.com/hutamy/invoice-generator-backend/models"
+	"github.com/hutamy/invoice-generator-backend/utils/errors"
+	"github.com/hutamy/invoice-generator-backend/utils/oidc"
+	"github.com/hutamy/invoice-generator-backend/utils/oidc/oidctest"
+	"gorm.io/gorm"
+)
+
+// oidcStore keeps users, identities and pending logins in memory. It
+// implements both repositories.AuthRepository and repositories.OIDCRepository.
+type oidcStore struct {
+	users      map[uint]*models.User
+	identities []models.UserIdentity
+	states     []models.OIDCLoginState
+}
+
+func newOIDCStore() *oidcStore {
+	return &oidcStore{users: map[uint]*models.User{}}
+}
+
+func (s *oidcStore) CreateUser(user *models.User) error {
+	user.ID = uint(len(s.users) + 1)
+	stored := *user
+	s.users[user.ID] = &stored
+	return nil
+}
+
+func (s *oidcStore) GetUserByEmail(email string) (*models.User, error) {
+	for _, user := range s.users {
+		if user.Email == email {
+			found := *user
+			return &found, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (s *oidcStore) GetUserByID(id uint) (*models.User, error) {
+	user, ok := s.users[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	found := *user
+	return &found, nil
+}
+
+func (s *oidcStore) UpdateUser(user *models.User) error {
+	stored := *user
+	s.users[user.ID] = &stored
+	return nil
+}
+
+func (s *oidcStore) CreateState(state *models.OIDCLoginState) error {
+	s.states = append(s.states, *state)
+	return nil
+}
+
+func (s *oidcStore) ConsumeState(hash, provider string) (*models.OIDCLoginState, error) {
+	for i, state := range s.states {
+		if state.StateHash == hash && state.Provider == provider {
+			s.states = append(s.states[:i], s.states[i+1:]...)
+			return &state, nil
+		}
+	}
+
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (s *oidcStore) GetIdentity(provider, subject string) (*models.UserIdentity, error) {
+	for _, identity := range s.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			found := identity
+			return &found, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (s *oidcStore) CreateIdentity(identity *models.UserIdentity) error {
+	s.identities = append(s.identities, *identity)
+	return nil
+}
+
+func (s *oidcStore) CreateUserWithIdentity(user *models.User, identity *models.UserIdentity) error {
+	if err := s.CreateUser(user); err != nil {
+		return err
+	}
+
+	identity.UserID = user.ID
+	return s.CreateIdentity(identity)
+}
+
+// signOutRecorder records which users were signed out everywhere
+type signOutRecorder struct {
+	TokenService
+	signedOut []uint
+}
+
+func (r *signOutRecorder) SignOutEverywhere(userID uint) error {
+	r.signedOut = append(r.signedOut, userID)
+	return nil
+}
+
+type oidcTest struct {
+	mock    *oidctest.Provider
+	store   *oidcStore
+	tokens  *signOutRecorder
+	service OIDCService
+}
+
+func newOIDCTest(t *testing.T) *oidcTest {
+	t.Helper()
+	mock := oidctest.NewProvider("invoice-app")
+	t.Cleanup(mock.Close)
+
+	provider := oidc.New(oidc.Options{
+		Name:        "mock",
+		Issuer:      mock.Issuer(),
+		ClientID:    "invoice-app",
+		RedirectURL: "https://app.example.com/auth/callback",
+	})
+	store := newOIDCStore()
+	tokens := &signOutRecorder{}
+
+	return &oidcTest{
+		mock:    mock,
+		store:   store,
+		tokens:  tokens,
+		service: NewOIDCService([]*oidc.Provider{provider}, store, store, tokens),
+	}
+}
+
+// login starts a login and signs identity in at the provider, returning the
+// callback request the frontend would send
+func (tt *oidcTest) login(t *testing.T, identity oidctest.Identity) dto.OIDCCallbackRequest {
+	t.Helper()
+	started, err := tt.service.Authorize(context.Background(), "mock")
+	if err != nil {
+		t.Fatalf("Authorize() error = %v", err)
+	}
+
+	code, state, err := tt.mock.Login(started.AuthorizationURL, identity)
+	if err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+
+	if state != started.State {
+		t.Fatalf("provider returned state %q, want %q", state, started.State)
+	}
+
+	return dto.OIDCCallbackRequest{Code: code, State: state}
+}
+
+var janeIdentity = oidctest.Identity{
+	Subject:       "jane-1",
+	Email:         "jane@example.com",
+	EmailVerified: true,
+	Name:          "Jane Doe",
+}
+
+func TestOIDCCallbackProvisionsNewUser(t *testing.T) {
+	tt := newOIDCTest(t)
+	user, err := tt.service.Callback(context.Background(), "mock", tt.login(t, janeIdentity))
+	if err != nil {
+		t.Fatalf("Callback() error = %v", err)
+	}
+
+	if user.ID == 0 || user.Email != "jane@example.com" || user.Name != "Jane Doe" || user.EmailVerifiedAt == nil {
+		t.Fatalf("Callback() = %+v, want a verified account for jane@example.com", user)
+	}
+
+	if len(tt.store.identities) != 1 || tt.store.identities[0].UserID != user.ID {
+		t.Fatalf("identities = %+v, want one linked to user %d", tt.store.identities, user.ID)
+	}
+
+	// The second login finds the identity and signs in the same user
+	again, err := tt.service.Callback(context.Background(), "mock", tt.login(t, janeIdentity))
+	if err != nil {
+		t.Fatalf("second Callback() error = %v", err)
+	}
+
+	if again.ID != user.ID || len(tt.store.users) != 1 || len(tt.store.identities) != 1 {
+		t.Fatalf("second login created another account: user %d, %d users", again.ID, len(tt.store.users))
+	}
+}
+
+func TestOIDCCallbackLinksVerifiedAccount(t *testing.T) {
+	tt := newOIDCTest(t)
+	verifiedAt := time.Now().Add(-24 * time.Hour)
+	existing := &models.User{Name: "Jane", Email: "jane@example.com", Password: "hash", EmailVerifiedAt: &verifiedAt}
+	tt.store.CreateUser(existing)
+
+	user, err := tt.service.Callback(context.Background(), "mock", tt.login(t, janeIdentity))
+	if err != nil {
+		t.Fatalf("Callback() error = %v", err)
+	}
+
+	if user.ID != existing.ID {
+		t.Fatalf("signed in user %d, want the existing user %d", user.ID, existing.ID)
+	}
+
+	if stored := tt.store.users[existing.ID]; stored.Password != "hash" {
+		t.Error("linking a verified account must keep its password")
+	}
+
+	if len(tt.tokens.signedOut) != 0 {
+		t.Errorf("signed out %v, want no sessions ended", tt.tokens.signedOut)
+	}
+
+	if len(tt.store.identities) != 1 || tt.store.identities[0].UserID != existing.ID {
+		t.Fatalf("identities = %+v, want one linked to user %d", tt.store.identities, existing.ID)
+	}
+}
+
+func TestOIDCCallbackTakesOverUnverifiedAccount(t *testing.T) {
+	tt := newOIDCTest(t)
+	existing := &models.User{Name: "Squatter", Email: "jane@example.com", Password: "hash"}
+	tt.store.CreateUser(existing)
+
+	user, err := tt.service.Callback(context.Background(), "mock", tt.login(t, janeIdentity))
+	if err != nil {
+		t.Fatalf("Callback() error = %v", err)
+	}
+
+	stored := tt.store.users[existing.ID]
+	if user.ID != existing.ID || stored.EmailVerifiedAt == nil {
+		t.Fatalf("Callback() = %+v, want the existing account marked verified", user)
+	}
+
+	if stored.Password == "hash" {
+		t.Error("the password of an unverified account must be replaced when it is linked")
+	}
+
+	if len(tt.tokens.signedOut) != 1 || tt.tokens.signedOut[0] != existing.ID {
+		t.Errorf("signed out %v, want the sessions of user %d ended", tt.tokens.signedOut, existing.ID)
+	}
+}
+
+func TestOIDCCallbackRejectsUnverifiedEmail(t *testing.T) {
+	tests := []struct {
+		name     string
+		identity oidctest.Identity
+	}{
+		{"unverified", oidctest.Identity{Subject: "jane-1", Email: "jane@example.com"}},
+		{"no email", oidctest.Identity{Subject: "jane-1", EmailVerified: true}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tt := newOIDCTest(t)
+			tt.store.CreateUser(&models.User{Email: "jane@example.com", Password: "hash"})
+
+			_, err := tt.service.Callback(context.Background(), "mock", tt.login(t, tc.identity))
+			if !e.Is(err, errors.ErrOIDCEmailNotVerified) {
+				t.Fatalf("Callback() error = %v, want %v", err, errors.ErrOIDCEmailNotVerified)
+			}
+
+			if len(tt.store.identities) != 0 || tt.store.users[1].Password != "hash" {
+				t.Fatal("an unverified email must not link or change the account")
+			}
+		})
+	}
+}
+
+func TestOIDCCallbackRejectsStateMismatch(t *testing.T) {
+	tt := newOIDCTest(t)
+	req := tt.login(t, janeIdentity)
+
+	forged := req
+	forged.State = "forged-state"
+	if _, err := tt.service.Callback(context.Background(), "mock", forged); !e.Is(err, errors.ErrInvalidOIDCState) {
+		t.Fatalf("Callback() with a forged state error = %v, want %v", err, errors.ErrInvalidOIDCState)
+	}
+
+	if _, err := tt.service.Callback(context.Background(), "mock", req); err != nil {
+		t.Fatalf("Callback() error = %v", err)
+	}
+
+	if _, err := tt.service.Callback(context.Background(), "mock", req); !e.Is(err, errors.ErrInvalidOIDCState) {
+		t.Fatalf("Callback() with a used state error = %v, want %v", err, errors.ErrInvalidOIDCState)
+	}
+}
+
+func TestOIDCCallbackRejectsInvalidIDToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims func(claims jwt.MapClaims)
+	}{
+		{"nonce mismatch", func(c jwt.MapClaims) { c["nonce"] = "replayed-nonce" }},
+		{"other issuer", func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }},
+		{"other audience", func(c jwt.MapClaims) { c["aud"] = "another-app" }},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tt := newOIDCTest(t)
+			tt.mock.Claims = tc.claims
+
+			_, err := tt.service.Callback(context.Background(), "mock", tt.login(t, janeIdentity))
+			if !e.Is(err, errors.ErrOIDCLoginFailed) {
+				t.Fatalf("Callback() error = %v, want %v", err, errors.ErrOIDCLoginFailed)
+			}
+
+			if len(tt.store.users) != 0 {
+				t.Fatal("a rejected login must not provision an account")
+			}
+		})
+	}
+}
+
+func TestOIDCUnknownProvider(t *testing.T) {
+	tt := newOIDCTest(t)
+	if _, err := tt.service.Authorize(context.Background(), "other"); !e.Is(err, errors.ErrUnknownProvider) {
+		t.Fatalf("Authorize() error = %v, want %v", err, errors.ErrUnknownProvider)
+	}
+
+	req := tt.login(t, janeIdentity)
+	if _, err := tt.service.Callback(context.Background(), "other", req); !e.Is(err, errors.ErrUnknownProvider) {
+		t.Fatalf("Callback() error = %v, want %v", err, errors.ErrUnknownProvider)
+	}
+}
@@ -0,0 +1,271 @@
+package services
+
+import (
+	e "errors"
+	"log"
+	"time"
+
+	"github.com/hutamy/invoice-generator-backend/config"
+	"github.com/hutamy/invoice-generator-backend/dto"
+	"github.com/hutamy/invoice-generator-backend/models"
+	"github.com/hutamy/invoice-generator-backend/repositories"
+	"github.com/hutamy/invoice-generator-backend/utils"
+	"github.com/hutamy/invoice-generator-backend/utils/errors"
+	"github.com/hutamy/invoice-generator-backend/utils/mail"
+	"github.com/hutamy/invoice-generator-backend/utils/rbac"
+	"gorm.io/gorm"
+)
+
+type OrganizationService interface {
+	ResolveMembership(userID, organizationID uint) (*models.Membership, error)
+	ListOrganizations(userID uint) ([]models.Membership, error)
+	CreateOrganization(req dto.CreateOrganizationRequest) (*models.Organization, error)
+	GetOrganization(id uint) (*models.Organization, error)
+	UpdateOrganization(req dto.UpdateOrganizationRequest) (*models.Organization, error)
+	ListMembers(organizationID uint) ([]dto.MemberResponse, error)
+	UpdateMemberRole(req dto.UpdateMemberRoleRequest) error
+	RemoveMember(req dto.RemoveMemberRequest) error
+	LeaveOrganization(organizationID, userID uint) error
+	InviteMember(req dto.InviteMemberRequest) (*models.Invitation, error)
+	ListInvitations(organizationID uint) ([]models.Invitation, error)
+	RevokeInvitation(id, organizationID uint) error
+	AcceptInvitation(token string, userID uint) (*models.Membership, error)
+}
+
+type organizationService struct {
+	orgRepo  repositories.OrganizationRepository
+	authRepo repositories.AuthRepository
+	mailer   mail.Sender
+}
+
+func NewOrganizationService(
+	orgRepo repositories.OrganizationRepository,
+	authRepo repositories.AuthRepository,
+	mailer mail.Sender,
+) OrganizationService {
+	return &organizationService{
+		orgRepo:  orgRepo,
+		authRepo: authRepo,
+		mailer:   mailer,
+	}
+}
+
+// ResolveMembership returns the membership of the user in the organization,
+// or in their default organization when organizationID is 0.
+func (s *organizationService) ResolveMembership(userID, organizationID uint) (*models.Membership, error) {
+	var membership *models.Membership
+	var err error
+	if organizationID == 0 {
+		membership, err = s.orgRepo.GetDefaultMembership(userID)
+	} else {
+		membership, err = s.orgRepo.GetMembership(organizationID, userID)
+	}
+
+	if err != nil {
+		if e.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.ErrNotMember
+		}
+
+		return nil, err
+	}
+
+	return membership, nil
+}
+
+func (s *organizationService) ListOrganizations(userID uint) ([]models.Membership, error) {
+	return s.orgRepo.ListMemberships(userID)
+}
+
+func (s *organizationService) CreateOrganization(req dto.CreateOrganizationRequest) (*models.Organization, error) {
+	org := &models.Organization{Name: req.Name}
+	if err := s.orgRepo.CreateOrganization(org, req.UserID); err != nil {
+		return nil, err
+	}
+
+	return org, nil
+}
+
+func (s *organizationService) GetOrganization(id uint) (*models.Organization, error) {
+	return s.orgRepo.GetOrganization(id)
+}
+
+func (s *organizationService) UpdateOrganization(req dto.UpdateOrganizationRequest) (*models.Organization, error) {
+	org, err := s.orgRepo.GetOrganization(req.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+
+	org.Name = req.Name
+	if err := s.orgRepo.UpdateOrganization(org); err != nil {
+		return nil, err
+	}
+
+	return org, nil
+}
+
+func (s *organizationService) ListMembers(organizationID uint) ([]dto.MemberResponse, error) {
+	return s.orgRepo.ListMembers(organizationID)
+}
+
+// UpdateMemberRole changes the role of a member. Promoting to or demoting from
+// owner needs rbac.OwnersManage, and the last owner cannot be demoted.
+func (s *organizationService) UpdateMemberRole(req dto.UpdateMemberRoleRequest) error {
+	member, err := s.orgRepo.GetMembership(req.OrganizationID, req.UserID)
+	if err != nil {
+		return err
+	}
+
+	if (member.Role == models.RoleOwner || req.Role == models.RoleOwner) && !rbac.Allowed(req.ActorRole, rbac.OwnersManage) {
+		return errors.ErrForbidden
+	}
+
+	if member.Role == models.RoleOwner && req.Role != models.RoleOwner {
+		if err := s.ensureAnotherOwner(req.OrganizationID); err != nil {
+			return err
+		}
+	}
+
+	return s.orgRepo.UpdateMemberRole(req.OrganizationID, req.UserID, req.Role)
+}
+
+// RemoveMember takes a member out of the organization. Removing an owner
+// needs rbac.OwnersManage.
+func (s *organizationService) RemoveMember(req dto.RemoveMemberRequest) error {
+	member, err := s.orgRepo.GetMembership(req.OrganizationID, req.UserID)
+	if err != nil {
+		return err
+	}
+
+	if member.Role == models.RoleOwner && !rbac.Allowed(req.ActorRole, rbac.OwnersManage) {
+		return errors.ErrForbidden
+	}
+
+	return s.removeMember(member)
+}
+
+func (s *organizationService) LeaveOrganization(organizationID, userID uint) error {
+	member, err := s.orgRepo.GetMembership(organizationID, userID)
+	if err != nil {
+		return err
+	}
+
+	return s.removeMember(member)
+}
+
+func (s *organizationService) removeMember(member *models.Membership) error {
+	if member.Role == models.RoleOwner {
+		if err := s.ensureAnotherOwner(member.OrganizationID); err != nil {
+			return err
+		}
+	}
+
+	memberships, err := s.orgRepo.CountMemberships(member.UserID)
+	if err != nil {
+		return err
+	}
+
+	if memberships <= 1 {
+		return errors.ErrLastOrganization
+	}
+
+	return s.orgRepo.RemoveMember(member.OrganizationID, member.UserID)
+}
+
+func (s *organizationService) ensureAnotherOwner(organizationID uint) error {
+	owners, err := s.orgRepo.CountOwners(organizationID)
+	if err != nil {
+		return err
+	}
+
+	if owners <= 1 {
+		return errors.ErrLastOwner
+	}
+
+	return nil
+}
+
+// InviteMember emails an invitation link to join the organization. Inviting
+// an owner needs rbac.OwnersManage.
+func (s *organizationService) InviteMember(req dto.InviteMemberRequest) (*models.Invitation, error) {
+	if req.Role == models.RoleOwner && !rbac.Allowed(req.ActorRole, rbac.OwnersManage) {
+		return nil, errors.ErrForbidden
+	}
+
+	isMember, err := s.orgRepo.IsMember(req.OrganizationID, req.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	if isMember {
+		return nil, errors.ErrAlreadyMember
+	}
+
+	org, err := s.orgRepo.GetOrganization(req.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+
+	inviter, err := s.authRepo.GetUserByID(req.InvitedByID)
+	if err != nil {
+		return nil, err
+	}
+
+	token, hash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	ttl := config.GetConfig().InvitationTTL
+	invitation := &models.Invitation{
+		OrganizationID: req.OrganizationID,
+		Email:          req.Email,
+		Role:           req.Role,
+		TokenHash:      hash,
+		InvitedByID:    req.InvitedByID,
+		ExpiresAt:      time.Now().Add(ttl),
+	}
+	if err := s.orgRepo.CreateInvitation(invitation); err != nil {
+		return nil, err
+	}
+
+	err = sendTemplate(s.mailer, req.Email, "organization_invitation", map[string]string{
+		"InviterName":      inviter.Name,
+		"OrganizationName": org.Name,
+		"Role":             req.Role,
+		"Link":             appLink("/accept-invitation", token),
+		"ExpiresIn":        humanDuration(ttl),
+	})
+	if err != nil {
+		log.Printf("failed to send invitation %d: %v", invitation.ID, err)
+	}
+
+	return invitation, nil
+}
+
+func (s *organizationService) ListInvitations(organizationID uint) ([]models.Invitation, error) {
+	return s.orgRepo.ListInvitations(organizationID)
+}
+
+func (s *organizationService) RevokeInvitation(id, organizationID uint) error {
+	return s.orgRepo.DeleteInvitation(id, organizationID)
+}
+
+// AcceptInvitation adds the signed-in user to the inviting organization. The
+// invitation must have been sent to the user's email address.
+func (s *organizationService) AcceptInvitation(token string, userID uint) (*models.Membership, error) {
+	user, err := s.authRepo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	membership, err := s.orgRepo.AcceptInvitation(utils.HashToken(token), user)
+	if err != nil {
+		if e.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.ErrInvalidToken
+		}
+
+		return nil, err
+	}
+
+	return membership, nil
+}
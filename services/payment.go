@@ -0,0 +1,118 @@
+package services
+
+import (
+	e "errors"
+	"strings"
+	"time"
+
+	"github.com/hutamy/invoice-generator-backend/config"
+	"github.com/hutamy/invoice-generator-backend/dto"
+	"github.com/hutamy/invoice-generator-backend/models"
+	"github.com/hutamy/invoice-generator-backend/repositories"
+	"github.com/hutamy/invoice-generator-backend/utils/errors"
+	"gorm.io/gorm"
+)
+
+type PaymentService interface {
+	RecordPayment(req dto.CreatePaymentRequest) (*models.Payment, error)
+	ListPayments(clientID, organizationID uint) ([]models.Payment, error)
+	DeletePayment(id, clientID, organizationID uint) error
+}
+
+type paymentService struct {
+	paymentRepo repositories.PaymentRepository
+	clientRepo  repositories.ClientRepository
+	invoiceRepo repositories.InvoiceRepository
+}
+
+func NewPaymentService(
+	paymentRepo repositories.PaymentRepository,
+	clientRepo repositories.ClientRepository,
+	invoiceRepo repositories.InvoiceRepository,
+) PaymentService {
+	return &paymentService{
+		paymentRepo: paymentRepo,
+		clientRepo:  clientRepo,
+		invoiceRepo: invoiceRepo,
+	}
+}
+
+// RecordPayment stores a payment or credit of a client. A payment applied to
+// an invoice is in the invoice's currency and marks it paid once the invoice
+// is settled.
+func (s *paymentService) RecordPayment(req dto.CreatePaymentRequest) (*models.Payment, error) {
+	client, err := s.clientRepo.GetClientByIDWithArchived(req.ClientID, req.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+
+	date, err := time.Parse(time.DateOnly, req.Date)
+	if err != nil {
+		return nil, errors.ErrInvalidDateFormat
+	}
+
+	payment := &models.Payment{
+		OrganizationID: req.OrganizationID,
+		ClientID:       client.ID,
+		InvoiceID:      req.InvoiceID,
+		Type:           req.Type,
+		Amount:         req.Amount,
+		Currency:       strings.ToUpper(req.Currency),
+		Date:           date,
+		Reference:      req.Reference,
+		Notes:          req.Notes,
+	}
+
+	var invoice *models.Invoice
+	if req.InvoiceID != nil {
+		invoice, err = s.invoiceRepo.GetInvoiceByID(*req.InvoiceID, req.OrganizationID)
+		if err != nil {
+			if e.Is(err, gorm.ErrRecordNotFound) {
+				return nil, errors.ErrInvalidPaymentInvoice
+			}
+
+			return nil, err
+		}
+
+		if invoice.ClientID != client.ID || invoice.Status == "draft" {
+			return nil, errors.ErrInvalidPaymentInvoice
+		}
+
+		if payment.Currency != "" && payment.Currency != invoice.Currency {
+			return nil, errors.ErrPaymentCurrencyMismatch
+		}
+		payment.Currency = invoice.Currency
+	}
+
+	if payment.Currency == "" {
+		payment.Currency = client.Currency
+	}
+	if payment.Currency == "" {
+		payment.Currency = config.GetConfig().InvoiceCurrency
+	}
+
+	if err := s.paymentRepo.CreatePayment(payment); err != nil {
+		return nil, err
+	}
+
+	return payment, nil
+}
+
+func (s *paymentService) ListPayments(clientID, organizationID uint) ([]models.Payment, error) {
+	if _, err := s.clientRepo.GetClientByIDWithArchived(clientID, organizationID); err != nil {
+		return nil, err
+	}
+
+	return s.paymentRepo.ListPayments(clientID, organizationID)
+}
+
+// DeletePayment removes a payment or credit. A paid invoice it was applied to
+// is opened again when it is no longer settled.
+func (s *paymentService) DeletePayment(id, clientID, organizationID uint) error {
+	payment, err := s.paymentRepo.GetPayment(id, clientID, organizationID)
+	if err != nil {
+		return err
+	}
+
+	return s.paymentRepo.DeletePayment(payment)
+}
@@ -0,0 +1,359 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	e "errors"
+	"net/http"
+	"strings"
+
+	"github.com/hutamy/invoice-generator-backend/dto"
+	"github.com/hutamy/invoice-generator-backend/models"
+	"github.com/hutamy/invoice-generator-backend/repositories"
+	"github.com/hutamy/invoice-generator-backend/utils"
+	"github.com/hutamy/invoice-generator-backend/utils/errors"
+	"gorm.io/gorm"
+)
+
+// maxLogoSize keeps logos small enough to inline into every rendered invoice
+const maxLogoSize = 1 << 20
+
+type SenderProfileService interface {
+	CreateSenderProfile(req dto.CreateSenderProfileRequest) (*models.SenderProfile, error)
+	ListSenderProfiles(organizationID uint) ([]models.SenderProfile, error)
+	GetSenderProfile(id, organizationID uint) (*models.SenderProfile, error)
+	UpdateSenderProfile(req dto.UpdateSenderProfileRequest) (*models.SenderProfile, error)
+	DeleteSenderProfile(id, organizationID uint) error
+	UploadLogo(req dto.UploadLogoRequest) (*models.SenderProfile, error)
+	DeleteLogo(id, organizationID uint) error
+	GetLogo(id, organizationID uint) (*models.Logo, error)
+	ListPaymentMethods(senderProfileID, organizationID uint) ([]models.PaymentMethod, error)
+	GetPaymentMethod(id, senderProfileID, organizationID uint) (*models.PaymentMethod, error)
+	CreatePaymentMethod(req dto.CreatePaymentMethodRequest) (*models.PaymentMethod, error)
+	UpdatePaymentMethod(req dto.UpdatePaymentMethodRequest) (*models.PaymentMethod, error)
+	DeletePaymentMethod(id, senderProfileID, organizationID uint) error
+}
+
+type senderProfileService struct {
+	profileRepo repositories.SenderProfileRepository
+	paymentRepo repositories.PaymentMethodRepository
+}
+
+func NewSenderProfileService(
+	profileRepo repositories.SenderProfileRepository,
+	paymentRepo repositories.PaymentMethodRepository,
+) SenderProfileService {
+	return &senderProfileService{
+		profileRepo: profileRepo,
+		paymentRepo: paymentRepo,
+	}
+}
+
+// CreateSenderProfile adds a profile to the organization. The first profile
+// of an organization always becomes its default.
+func (s *senderProfileService) CreateSenderProfile(req dto.CreateSenderProfileRequest) (*models.SenderProfile, error) {
+	profile := &models.SenderProfile{
+		OrganizationID: req.OrganizationID,
+		SenderDetails: models.SenderDetails{
+			Name:    req.Name,
+			Email:   req.Email,
+			Phone:   req.Phone,
+			Address: req.Address,
+			TaxID:   req.TaxID,
+		},
+		IsDefault:     req.IsDefault,
+		NumberPrefix:  req.NumberPrefix,
+		NumberPadding: req.NumberPadding,
+		NextNumber:    req.NextNumber,
+	}
+
+	if profile.NumberPadding == 0 {
+		profile.NumberPadding = 4
+	}
+
+	if profile.NextNumber == 0 {
+		profile.NextNumber = 1
+	}
+
+	if !profile.IsDefault {
+		_, err := s.profileRepo.GetDefaultSenderProfile(req.OrganizationID)
+		if e.Is(err, gorm.ErrRecordNotFound) {
+			profile.IsDefault = true
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.profileRepo.CreateSenderProfile(profile); err != nil {
+		return nil, err
+	}
+
+	return profile, nil
+}
+
+func (s *senderProfileService) ListSenderProfiles(organizationID uint) ([]models.SenderProfile, error) {
+	return s.profileRepo.ListSenderProfiles(organizationID)
+}
+
+func (s *senderProfileService) GetSenderProfile(id, organizationID uint) (*models.SenderProfile, error) {
+	profile, err := s.profileRepo.GetSenderProfile(id, organizationID)
+	if err != nil {
+		return nil, err
+	}
+
+	profile.PaymentMethods, err = s.paymentRepo.ListPaymentMethods(profile.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return profile, nil
+}
+
+// UpdateSenderProfile changes the profile. Invoices already issued from it
+// keep the details they were created with.
+func (s *senderProfileService) UpdateSenderProfile(req dto.UpdateSenderProfileRequest) (*models.SenderProfile, error) {
+	profile, err := s.profileRepo.GetSenderProfile(req.ID, req.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Name != nil {
+		profile.Name = *req.Name
+	}
+
+	if req.Email != nil {
+		profile.Email = *req.Email
+	}
+
+	if req.Phone != nil {
+		profile.Phone = *req.Phone
+	}
+
+	if req.Address != nil {
+		profile.Address = *req.Address
+	}
+
+	if req.TaxID != nil {
+		profile.TaxID = *req.TaxID
+	}
+
+	if req.NumberPrefix != nil {
+		profile.NumberPrefix = *req.NumberPrefix
+	}
+
+	if req.NumberPadding != nil {
+		profile.NumberPadding = *req.NumberPadding
+	}
+
+	// The default can only be moved to another profile, not unset
+	if req.IsDefault != nil && *req.IsDefault {
+		profile.IsDefault = true
+	}
+
+	if err := s.profileRepo.UpdateSenderProfile(profile); err != nil {
+		return nil, err
+	}
+
+	if req.NextNumber != nil {
+		if err := s.profileRepo.SetNextNumber(profile.ID, *req.NextNumber); err != nil {
+			return nil, err
+		}
+
+		profile.NextNumber = *req.NextNumber
+	}
+
+	return profile, nil
+}
+
+// DeleteSenderProfile removes a profile. When it was the default another
+// profile of the organization takes its place.
+func (s *senderProfileService) DeleteSenderProfile(id, organizationID uint) error {
+	profile, err := s.profileRepo.GetSenderProfile(id, organizationID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.profileRepo.DeleteSenderProfile(id, organizationID); err != nil {
+		return err
+	}
+
+	if !profile.IsDefault {
+		return nil
+	}
+
+	profiles, err := s.profileRepo.ListSenderProfiles(organizationID)
+	if err != nil || len(profiles) == 0 {
+		return err
+	}
+
+	profiles[0].IsDefault = true
+	return s.profileRepo.UpdateSenderProfile(&profiles[0])
+}
+
+// UploadLogo stores a new logo for the profile. Earlier logos are kept since
+// issued invoices still show them.
+func (s *senderProfileService) UploadLogo(req dto.UploadLogoRequest) (*models.SenderProfile, error) {
+	if len(req.Data) > maxLogoSize {
+		return nil, errors.ErrUnsupportedLogo
+	}
+
+	contentType := http.DetectContentType(req.Data)
+	if contentType != "image/png" && contentType != "image/jpeg" {
+		return nil, errors.ErrUnsupportedLogo
+	}
+
+	profile, err := s.profileRepo.GetSenderProfile(req.SenderProfileID, req.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.Sum256(req.Data)
+	logo := &models.Logo{
+		OrganizationID: req.OrganizationID,
+		ContentType:    contentType,
+		Data:           req.Data,
+		SHA256:         hex.EncodeToString(hash[:]),
+	}
+	if err := s.profileRepo.CreateLogo(logo); err != nil {
+		return nil, err
+	}
+
+	profile.LogoID = &logo.ID
+	if err := s.profileRepo.UpdateSenderProfile(profile); err != nil {
+		return nil, err
+	}
+
+	return profile, nil
+}
+
+func (s *senderProfileService) DeleteLogo(id, organizationID uint) error {
+	profile, err := s.profileRepo.GetSenderProfile(id, organizationID)
+	if err != nil {
+		return err
+	}
+
+	profile.LogoID = nil
+	return s.profileRepo.UpdateSenderProfile(profile)
+}
+
+func (s *senderProfileService) GetLogo(id, organizationID uint) (*models.Logo, error) {
+	profile, err := s.profileRepo.GetSenderProfile(id, organizationID)
+	if err != nil {
+		return nil, err
+	}
+
+	if profile.LogoID == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	return s.profileRepo.GetLogo(*profile.LogoID)
+}
+
+func (s *senderProfileService) ListPaymentMethods(senderProfileID, organizationID uint) ([]models.PaymentMethod, error) {
+	if _, err := s.profileRepo.GetSenderProfile(senderProfileID, organizationID); err != nil {
+		return nil, err
+	}
+
+	return s.paymentRepo.ListPaymentMethods(senderProfileID)
+}
+
+func (s *senderProfileService) CreatePaymentMethod(req dto.CreatePaymentMethodRequest) (*models.PaymentMethod, error) {
+	if _, err := s.profileRepo.GetSenderProfile(req.SenderProfileID, req.OrganizationID); err != nil {
+		return nil, err
+	}
+
+	method := &models.PaymentMethod{
+		OrganizationID:  req.OrganizationID,
+		SenderProfileID: req.SenderProfileID,
+		PaymentDetails:  paymentDetails(req.PaymentMethodRequest),
+		Position:        req.Position,
+	}
+	if err := s.paymentRepo.CreatePaymentMethod(method); err != nil {
+		return nil, err
+	}
+
+	return method, nil
+}
+
+func (s *senderProfileService) GetPaymentMethod(id, senderProfileID, organizationID uint) (*models.PaymentMethod, error) {
+	if _, err := s.profileRepo.GetSenderProfile(senderProfileID, organizationID); err != nil {
+		return nil, err
+	}
+
+	return s.paymentRepo.GetPaymentMethod(id, senderProfileID)
+}
+
+// UpdatePaymentMethod replaces the details of a payment method. Invoices
+// already issued keep the details they were created with.
+func (s *senderProfileService) UpdatePaymentMethod(req dto.UpdatePaymentMethodRequest) (*models.PaymentMethod, error) {
+	if _, err := s.profileRepo.GetSenderProfile(req.SenderProfileID, req.OrganizationID); err != nil {
+		return nil, err
+	}
+
+	method, err := s.paymentRepo.GetPaymentMethod(req.ID, req.SenderProfileID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Responses mask account numbers, so a number sent back as it was masked
+	// keeps the stored one
+	details := paymentDetails(req.PaymentMethodRequest)
+	details.AccountNumber = unmask(details.AccountNumber, method.AccountNumber)
+	details.IBAN = unmask(details.IBAN, method.IBAN)
+	details.WalletID = unmask(details.WalletID, method.WalletID)
+
+	method.PaymentDetails = details
+	method.Position = req.Position
+	if err := s.paymentRepo.UpdatePaymentMethod(method); err != nil {
+		return nil, err
+	}
+
+	return method, nil
+}
+
+func (s *senderProfileService) DeletePaymentMethod(id, senderProfileID, organizationID uint) error {
+	if _, err := s.profileRepo.GetSenderProfile(senderProfileID, organizationID); err != nil {
+		return err
+	}
+
+	return s.paymentRepo.DeletePaymentMethod(id, senderProfileID)
+}
+
+// unmask returns stored when value is stored as responses mask it
+func unmask(value, stored string) string {
+	if stored != "" && value == utils.MaskAccountNumber(stored) {
+		return stored
+	}
+
+	return value
+}
+
+// paymentDetails keeps only the fields used by the type of payment method
+func paymentDetails(req dto.PaymentMethodRequest) models.PaymentDetails {
+	details := models.PaymentDetails{
+		Type:     req.Type,
+		Label:    req.Label,
+		Currency: strings.ToUpper(req.Currency),
+	}
+
+	switch req.Type {
+	case models.PaymentMethodBankTransfer:
+		details.BankName = req.BankName
+		details.AccountName = req.AccountName
+		details.AccountNumber = req.AccountNumber
+		details.SWIFT = req.SWIFT
+	case models.PaymentMethodIBAN:
+		details.BankName = req.BankName
+		details.AccountName = req.AccountName
+		details.IBAN = strings.ReplaceAll(strings.ToUpper(req.IBAN), " ", "")
+		details.SWIFT = req.SWIFT
+	case models.PaymentMethodEWallet:
+		details.Provider = req.Provider
+		details.AccountName = req.AccountName
+		details.WalletID = req.WalletID
+	case models.PaymentMethodInstructions:
+		details.Instructions = req.Instructions
+	}
+
+	return details
+}
@@ -0,0 +1,301 @@
+package services
+
+import (
+	"bytes"
+	e "errors"
+	"html/template"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hutamy/invoice-generator-backend/config"
+	"github.com/hutamy/invoice-generator-backend/dto"
+	"github.com/hutamy/invoice-generator-backend/models"
+	"github.com/hutamy/invoice-generator-backend/repositories"
+	"github.com/hutamy/invoice-generator-backend/utils/errors"
+	"github.com/hutamy/invoice-generator-backend/utils/i18n"
+	"gorm.io/gorm"
+)
+
+const statementTemplatePath = "templates/statement.html"
+
+type StatementService interface {
+	GetStatement(req dto.StatementRequest) (*dto.Statement, error)
+	GenerateStatementPDF(req dto.StatementRequest) ([]byte, error)
+}
+
+type statementService struct {
+	clientRepo  repositories.ClientRepository
+	invoiceRepo repositories.InvoiceRepository
+	paymentRepo repositories.PaymentRepository
+	profileRepo repositories.SenderProfileRepository
+}
+
+func NewStatementService(
+	clientRepo repositories.ClientRepository,
+	invoiceRepo repositories.InvoiceRepository,
+	paymentRepo repositories.PaymentRepository,
+	profileRepo repositories.SenderProfileRepository,
+) StatementService {
+	return &statementService{
+		clientRepo:  clientRepo,
+		invoiceRepo: invoiceRepo,
+		paymentRepo: paymentRepo,
+		profileRepo: profileRepo,
+	}
+}
+
+func (s *statementService) GetStatement(req dto.StatementRequest) (*dto.Statement, error) {
+	client, err := s.clientRepo.GetClientByIDWithArchived(req.ClientID, req.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.statement(client, req)
+}
+
+// GenerateStatementPDF renders the statement with the organization's default
+// sender profile as the issuer
+func (s *statementService) GenerateStatementPDF(req dto.StatementRequest) ([]byte, error) {
+	if req.Locale != "" && !i18n.IsSupported(req.Locale) {
+		return nil, errors.ErrUnsupportedLocale
+	}
+
+	client, err := s.clientRepo.GetClientByIDWithArchived(req.ClientID, req.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+
+	statement, err := s.statement(client, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var sender models.SenderDetails
+	var logo *models.Logo
+	profile, err := s.profileRepo.GetDefaultSenderProfile(req.OrganizationID)
+	if err != nil && !e.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	if profile != nil {
+		sender = profile.SenderDetails
+		if sender.LogoID != nil {
+			logo, err = s.profileRepo.GetLogo(*sender.LogoID)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	localizer, err := i18n.NewLocalizer(i18n.Resolve(req.Locale, client.Locale))
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl, err := template.New("statement.html").Funcs(template.FuncMap{
+		"t":      localizer.T,
+		"date":   localizer.Date,
+		"number": localizer.Number,
+	}).ParseFiles(statementTemplatePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var htmlBuf bytes.Buffer
+	err = tmpl.Execute(&htmlBuf, map[string]interface{}{
+		"Statement": statement,
+		"Client":    client,
+		"Sender":    &sender,
+		"Logo":      logoURL(logo),
+		"Locale":    localizer.Locale(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return generatePdf(htmlBuf.String())
+}
+
+// statement builds the ledger of client between the requested dates. The
+// opening balance carries everything before From, aging looks at what is
+// still outstanding on To.
+func (s *statementService) statement(client *models.Client, req dto.StatementRequest) (*dto.Statement, error) {
+	to, err := statementDate(req.To, time.Now().UTC().Truncate(24*time.Hour))
+	if err != nil {
+		return nil, err
+	}
+
+	from, err := statementDate(req.From, time.Date(to.Year(), to.Month(), 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		return nil, err
+	}
+
+	if from.After(to) {
+		return nil, errors.ErrInvalidDateRange
+	}
+
+	currency := strings.ToUpper(req.Currency)
+	if currency == "" {
+		currency = client.Currency
+	}
+	if currency == "" {
+		currency = config.GetConfig().InvoiceCurrency
+	}
+
+	invoices, err := s.invoiceRepo.ListIssuedInvoicesUntil(client.ID, client.OrganizationID, currency, to)
+	if err != nil {
+		return nil, err
+	}
+
+	payments, err := s.paymentRepo.ListPaymentsUntil(client.ID, client.OrganizationID, currency, to)
+	if err != nil {
+		return nil, err
+	}
+
+	statement := &dto.Statement{
+		ClientID:   client.ID,
+		ClientName: client.Name,
+		Currency:   currency,
+		From:       from,
+		To:         to,
+	}
+	statementLedger(statement, invoices, payments)
+	statement.Aging = statementAging(invoices, payments, to)
+	return statement, nil
+}
+
+// statementLedger lists the invoices and payments dated from statement.From
+// with their running balance, carrying everything before it into the opening
+// balance
+func statementLedger(statement *dto.Statement, invoices []models.Invoice, payments []models.Payment) {
+	statement.Entries = []dto.StatementEntry{}
+
+	var entries []dto.StatementEntry
+	for _, invoice := range invoices {
+		dueDate := invoice.DueDate
+		entries = append(entries, dto.StatementEntry{
+			Date:      invoice.IssueDate,
+			Type:      "invoice",
+			Reference: invoice.InvoiceNumber,
+			InvoiceID: &invoice.ID,
+			DueDate:   &dueDate,
+			Debit:     invoice.Total,
+		})
+	}
+
+	for _, payment := range payments {
+		entries = append(entries, dto.StatementEntry{
+			Date:      payment.Date,
+			Type:      payment.Type,
+			Reference: payment.Reference,
+			InvoiceID: payment.InvoiceID,
+			PaymentID: &payment.ID,
+			Credit:    payment.Amount,
+		})
+	}
+
+	// Same-day invoices come before the payments settling them
+	sort.SliceStable(entries, func(i, j int) bool {
+		if !entries[i].Date.Equal(entries[j].Date) {
+			return entries[i].Date.Before(entries[j].Date)
+		}
+
+		return entries[i].Type == "invoice" && entries[j].Type != "invoice"
+	})
+
+	balance := 0.0
+	for _, entry := range entries {
+		balance = roundMoney(balance + entry.Debit - entry.Credit)
+		if entry.Date.Before(statement.From) {
+			statement.OpeningBalance = balance
+			continue
+		}
+
+		entry.Balance = balance
+		statement.Entries = append(statement.Entries, entry)
+		switch entry.Type {
+		case "invoice":
+			statement.TotalInvoiced += entry.Debit
+		case models.PaymentTypeCredit:
+			statement.TotalCredited += entry.Credit
+		default:
+			statement.TotalPaid += entry.Credit
+		}
+	}
+
+	statement.TotalInvoiced = roundMoney(statement.TotalInvoiced)
+	statement.TotalPaid = roundMoney(statement.TotalPaid)
+	statement.TotalCredited = roundMoney(statement.TotalCredited)
+	statement.ClosingBalance = balance
+}
+
+// statementAging buckets the outstanding amount of each invoice by the days
+// it is past due on date
+func statementAging(invoices []models.Invoice, payments []models.Payment, date time.Time) dto.StatementAging {
+	outstanding := make(map[uint]float64, len(invoices))
+	for _, invoice := range invoices {
+		outstanding[invoice.ID] = invoice.Total
+	}
+
+	var aging dto.StatementAging
+	for _, payment := range payments {
+		if payment.InvoiceID != nil {
+			if _, ok := outstanding[*payment.InvoiceID]; ok {
+				outstanding[*payment.InvoiceID] -= payment.Amount
+				continue
+			}
+		}
+
+		aging.Unapplied += payment.Amount
+	}
+
+	for _, invoice := range invoices {
+		amount := outstanding[invoice.ID]
+		if amount < 0 {
+			// Overpaid invoices leave the excess on the client's account
+			aging.Unapplied -= amount
+			continue
+		}
+
+		switch days := int(date.Sub(invoice.DueDate).Hours() / 24); {
+		case days <= 0:
+			aging.Current += amount
+		case days <= 30:
+			aging.Days1To30 += amount
+		case days <= 60:
+			aging.Days31To60 += amount
+		case days <= 90:
+			aging.Days61To90 += amount
+		default:
+			aging.Over90 += amount
+		}
+	}
+
+	aging.Current = roundMoney(aging.Current)
+	aging.Days1To30 = roundMoney(aging.Days1To30)
+	aging.Days31To60 = roundMoney(aging.Days31To60)
+	aging.Days61To90 = roundMoney(aging.Days61To90)
+	aging.Over90 = roundMoney(aging.Over90)
+	aging.Unapplied = roundMoney(aging.Unapplied)
+	return aging
+}
+
+func statementDate(value string, fallback time.Time) (time.Time, error) {
+	if value == "" {
+		return fallback, nil
+	}
+
+	date, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, errors.ErrInvalidDateFormat
+	}
+
+	return date, nil
+}
+
+// roundMoney rounds to cents so sums of float amounts stay exact on paper
+func roundMoney(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
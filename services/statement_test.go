@@ -0,0 +1,240 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hutamy/invoice-generator-backend/dto"
+	"github.com/hutamy/invoice-generator-backend/models"
+)
+
+func date(value string) time.Time {
+	d, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		panic(err)
+	}
+
+	return d
+}
+
+func issued(id uint, issue, due string, total float64) models.Invoice {
+	return models.Invoice{ID: id, InvoiceNumber: fmt.Sprintf("INV-%d", id), IssueDate: date(issue), DueDate: date(due), Total: total}
+}
+
+func paid(id, invoiceID uint, kind, on string, amount float64) models.Payment {
+	payment := models.Payment{ID: id, Type: kind, Date: date(on), Amount: amount}
+	if invoiceID != 0 {
+		payment.InvoiceID = &invoiceID
+	}
+
+	return payment
+}
+
+// history is a client who paid the first invoice in two parts and got a credit
+// on the second
+var (
+	historyInvoices = []models.Invoice{
+		issued(1, "2025-01-10", "2025-02-09", 1000),
+		issued(2, "2025-02-05", "2025-03-07", 500),
+	}
+	historyPayments = []models.Payment{
+		paid(1, 1, models.PaymentTypePayment, "2025-01-20", 400),
+		paid(2, 2, models.PaymentTypeCredit, "2025-02-10", 100),
+		paid(3, 1, models.PaymentTypePayment, "2025-02-20", 600),
+	}
+)
+
+func TestStatementLedger(t *testing.T) {
+	tests := []struct {
+		name     string
+		from     string
+		invoices []models.Invoice
+		payments []models.Payment
+		opening  float64
+		types    []string
+		balances []float64
+		invoiced float64
+		paid     float64
+		credited float64
+		closing  float64
+	}{
+		{
+			name:     "from before the history",
+			from:     "2025-01-01",
+			invoices: historyInvoices,
+			payments: historyPayments,
+			types:    []string{"invoice", "payment", "invoice", "credit", "payment"},
+			balances: []float64{1000, 600, 1100, 1000, 400},
+			invoiced: 1500,
+			paid:     1000,
+			credited: 100,
+			closing:  400,
+		},
+		{
+			name:     "from in the middle of the history",
+			from:     "2025-02-01",
+			invoices: historyInvoices,
+			payments: historyPayments,
+			opening:  600,
+			types:    []string{"invoice", "credit", "payment"},
+			balances: []float64{1100, 1000, 400},
+			invoiced: 500,
+			paid:     600,
+			credited: 100,
+			closing:  400,
+		},
+		{
+			name:     "from after the history",
+			from:     "2025-03-01",
+			invoices: historyInvoices,
+			payments: historyPayments,
+			opening:  400,
+			types:    []string{},
+			balances: []float64{},
+			closing:  400,
+		},
+		{
+			name:     "invoice before the payment of the same day",
+			from:     "2025-05-01",
+			invoices: []models.Invoice{issued(1, "2025-05-02", "2025-05-02", 250)},
+			payments: []models.Payment{paid(1, 1, models.PaymentTypePayment, "2025-05-02", 250)},
+			types:    []string{"invoice", "payment"},
+			balances: []float64{250, 0},
+			invoiced: 250,
+			paid:     250,
+		},
+		{
+			name:     "partial payment and unapplied credit",
+			from:     "2025-05-01",
+			invoices: []models.Invoice{issued(1, "2025-05-02", "2025-06-01", 99.99)},
+			payments: []models.Payment{
+				paid(1, 1, models.PaymentTypePayment, "2025-05-03", 33.33),
+				paid(2, 0, models.PaymentTypeCredit, "2025-05-04", 10.1),
+			},
+			types:    []string{"invoice", "payment", "credit"},
+			balances: []float64{99.99, 66.66, 56.56},
+			invoiced: 99.99,
+			paid:     33.33,
+			credited: 10.1,
+			closing:  56.56,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statement := &dto.Statement{From: date(tt.from)}
+			statementLedger(statement, tt.invoices, tt.payments)
+
+			if len(statement.Entries) != len(tt.types) {
+				t.Fatalf("got %d entries, want %d: %+v", len(statement.Entries), len(tt.types), statement.Entries)
+			}
+
+			for i, entry := range statement.Entries {
+				if entry.Type != tt.types[i] || entry.Balance != tt.balances[i] {
+					t.Errorf("entry %d = %s with balance %v, want %s with balance %v", i, entry.Type, entry.Balance, tt.types[i], tt.balances[i])
+				}
+			}
+
+			got := [5]float64{statement.OpeningBalance, statement.TotalInvoiced, statement.TotalPaid, statement.TotalCredited, statement.ClosingBalance}
+			want := [5]float64{tt.opening, tt.invoiced, tt.paid, tt.credited, tt.closing}
+			if got != want {
+				t.Errorf("opening, invoiced, paid, credited, closing = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestStatementAging(t *testing.T) {
+	on := date("2025-04-30")
+	tests := []struct {
+		name     string
+		invoices []models.Invoice
+		payments []models.Payment
+		want     dto.StatementAging
+	}{
+		{
+			name:     "due on the statement date",
+			invoices: []models.Invoice{issued(1, "2025-04-01", "2025-04-30", 100)},
+			want:     dto.StatementAging{Current: 100},
+		},
+		{
+			name:     "not yet due",
+			invoices: []models.Invoice{issued(1, "2025-04-20", "2025-05-20", 100)},
+			want:     dto.StatementAging{Current: 100},
+		},
+		{
+			name:     "one day past due",
+			invoices: []models.Invoice{issued(1, "2025-03-30", "2025-04-29", 100)},
+			want:     dto.StatementAging{Days1To30: 100},
+		},
+		{
+			name:     "30 days past due",
+			invoices: []models.Invoice{issued(1, "2025-03-01", "2025-03-31", 100)},
+			want:     dto.StatementAging{Days1To30: 100},
+		},
+		{
+			name:     "31 days past due",
+			invoices: []models.Invoice{issued(1, "2025-02-28", "2025-03-30", 100)},
+			want:     dto.StatementAging{Days31To60: 100},
+		},
+		{
+			name:     "60 days past due",
+			invoices: []models.Invoice{issued(1, "2025-02-01", "2025-03-01", 100)},
+			want:     dto.StatementAging{Days31To60: 100},
+		},
+		{
+			name:     "61 days past due",
+			invoices: []models.Invoice{issued(1, "2025-01-29", "2025-02-28", 100)},
+			want:     dto.StatementAging{Days61To90: 100},
+		},
+		{
+			name:     "90 days past due",
+			invoices: []models.Invoice{issued(1, "2024-12-31", "2025-01-30", 100)},
+			want:     dto.StatementAging{Days61To90: 100},
+		},
+		{
+			name:     "91 days past due",
+			invoices: []models.Invoice{issued(1, "2024-12-30", "2025-01-29", 100)},
+			want:     dto.StatementAging{Over90: 100},
+		},
+		{
+			name:     "partial payment",
+			invoices: []models.Invoice{issued(1, "2025-03-01", "2025-03-31", 100)},
+			payments: []models.Payment{paid(1, 1, models.PaymentTypePayment, "2025-04-10", 40.5)},
+			want:     dto.StatementAging{Days1To30: 59.5},
+		},
+		{
+			name:     "credit applied to an invoice",
+			invoices: []models.Invoice{issued(1, "2025-04-01", "2025-05-01", 100)},
+			payments: []models.Payment{paid(1, 1, models.PaymentTypeCredit, "2025-04-10", 25)},
+			want:     dto.StatementAging{Current: 75},
+		},
+		{
+			name:     "unapplied credit",
+			invoices: []models.Invoice{issued(1, "2025-04-01", "2025-05-01", 100)},
+			payments: []models.Payment{paid(1, 0, models.PaymentTypeCredit, "2025-04-10", 25)},
+			want:     dto.StatementAging{Current: 100, Unapplied: 25},
+		},
+		{
+			name:     "overpaid invoice",
+			invoices: []models.Invoice{issued(1, "2025-03-01", "2025-03-31", 100)},
+			payments: []models.Payment{paid(1, 1, models.PaymentTypePayment, "2025-04-10", 120)},
+			want:     dto.StatementAging{Unapplied: 20},
+		},
+		{
+			name:     "settled and credited invoices",
+			invoices: historyInvoices,
+			payments: historyPayments,
+			want:     dto.StatementAging{Days31To60: 400},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := statementAging(tt.invoices, tt.payments, on); got != tt.want {
+				t.Fatalf("statementAging() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,245 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	e "errors"
+	"time"
+
+	"github.com/hutamy/invoice-generator-backend/config"
+	"github.com/hutamy/invoice-generator-backend/dto"
+	"github.com/hutamy/invoice-generator-backend/models"
+	"github.com/hutamy/invoice-generator-backend/repositories"
+	"github.com/hutamy/invoice-generator-backend/utils"
+	"github.com/hutamy/invoice-generator-backend/utils/errors"
+	"gorm.io/gorm"
+)
+
+// maxUserAgentLength caps the user agent stored for a session
+const maxUserAgentLength = 512
+
+type TokenService interface {
+	IssueTokens(userID uint, client dto.ClientInfo) (dto.TokenResponse, error)
+	RefreshTokens(refreshToken string, client dto.ClientInfo) (dto.TokenResponse, error)
+	SignOut(refreshToken string) error
+	SignOutEverywhere(userID uint) error
+	ListSessions(userID uint, currentSessionID string) ([]dto.SessionResponse, error)
+	RevokeSession(id, userID uint) error
+	ValidateSession(sessionID string, userID uint) error
+}
+
+type tokenService struct {
+	refreshTokenRepo repositories.RefreshTokenRepository
+	sessionRepo      repositories.SessionRepository
+}
+
+func NewTokenService(refreshTokenRepo repositories.RefreshTokenRepository, sessionRepo repositories.SessionRepository) TokenService {
+	return &tokenService{refreshTokenRepo: refreshTokenRepo, sessionRepo: sessionRepo}
+}
+
+// IssueTokens starts a new session and refresh token family for the user and
+// returns them together with a fresh access token.
+func (s *tokenService) IssueTokens(userID uint, client dto.ClientInfo) (dto.TokenResponse, error) {
+	familyID, err := newFamilyID()
+	if err != nil {
+		return dto.TokenResponse{}, err
+	}
+
+	refreshToken, record, err := newRefreshToken(userID, familyID)
+	if err != nil {
+		return dto.TokenResponse{}, err
+	}
+
+	if err := s.refreshTokenRepo.CreateToken(record); err != nil {
+		return dto.TokenResponse{}, err
+	}
+
+	if err := s.sessionRepo.CreateSession(newSession(userID, familyID, record.ExpiresAt, client)); err != nil {
+		return dto.TokenResponse{}, err
+	}
+
+	return s.tokenResponse(userID, familyID, refreshToken)
+}
+
+// RefreshTokens exchanges a refresh token for a new token pair. Each refresh
+// token can be used once; presenting a rotated token again revokes its family.
+func (s *tokenService) RefreshTokens(refreshToken string, client dto.ClientInfo) (dto.TokenResponse, error) {
+	current, err := s.refreshTokenRepo.GetTokenByHash(utils.HashToken(refreshToken))
+	if err != nil {
+		if e.Is(err, gorm.ErrRecordNotFound) {
+			return dto.TokenResponse{}, errors.ErrInvalidToken
+		}
+
+		return dto.TokenResponse{}, err
+	}
+
+	if current.RevokedAt != nil || time.Now().After(current.ExpiresAt) {
+		return dto.TokenResponse{}, errors.ErrInvalidToken
+	}
+
+	if current.RotatedAt != nil {
+		return dto.TokenResponse{}, s.revokeReusedFamily(current.FamilyID)
+	}
+
+	nextToken, next, err := newRefreshToken(current.UserID, current.FamilyID)
+	if err != nil {
+		return dto.TokenResponse{}, err
+	}
+
+	rotated, err := s.refreshTokenRepo.RotateToken(current, next)
+	if err != nil {
+		return dto.TokenResponse{}, err
+	}
+
+	if !rotated {
+		// Another request rotated the token first
+		return dto.TokenResponse{}, s.revokeReusedFamily(current.FamilyID)
+	}
+
+	touched, err := s.sessionRepo.TouchSession(current.FamilyID, truncateUserAgent(client.UserAgent), client.IPAddress, next.ExpiresAt)
+	if err != nil {
+		return dto.TokenResponse{}, err
+	}
+
+	if !touched {
+		// Families started before sessions were tracked get one on their next refresh
+		if err := s.sessionRepo.CreateSession(newSession(current.UserID, current.FamilyID, next.ExpiresAt, client)); err != nil {
+			return dto.TokenResponse{}, err
+		}
+	}
+
+	return s.tokenResponse(current.UserID, current.FamilyID, nextToken)
+}
+
+// SignOut revokes the family of the given refresh token
+func (s *tokenService) SignOut(refreshToken string) error {
+	current, err := s.refreshTokenRepo.GetTokenByHash(utils.HashToken(refreshToken))
+	if err != nil {
+		if e.Is(err, gorm.ErrRecordNotFound) {
+			return errors.ErrInvalidToken
+		}
+
+		return err
+	}
+
+	return s.refreshTokenRepo.RevokeFamily(current.FamilyID)
+}
+
+// SignOutEverywhere revokes every refresh token of the user
+func (s *tokenService) SignOutEverywhere(userID uint) error {
+	return s.refreshTokenRepo.RevokeAllForUser(userID)
+}
+
+// ListSessions returns the active sessions of the user and flags the one
+// identified by currentSessionID
+func (s *tokenService) ListSessions(userID uint, currentSessionID string) ([]dto.SessionResponse, error) {
+	sessions, err := s.sessionRepo.ListActiveSessions(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]dto.SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		res = append(res, dto.SessionResponse{Session: session, Current: session.FamilyID == currentSessionID})
+	}
+
+	return res, nil
+}
+
+// RevokeSession signs a single device out. Its refresh token stops working and
+// its access tokens are rejected from the next request on.
+func (s *tokenService) RevokeSession(id, userID uint) error {
+	session, err := s.sessionRepo.GetSession(id, userID)
+	if err != nil {
+		if e.Is(err, gorm.ErrRecordNotFound) {
+			return errors.ErrNotFound
+		}
+
+		return err
+	}
+
+	return s.refreshTokenRepo.RevokeFamily(session.FamilyID)
+}
+
+// ValidateSession checks that an access token's session is still active
+func (s *tokenService) ValidateSession(sessionID string, userID uint) error {
+	session, err := s.sessionRepo.GetSessionByFamily(sessionID)
+	if err != nil {
+		if e.Is(err, gorm.ErrRecordNotFound) {
+			return errors.ErrInvalidToken
+		}
+
+		return err
+	}
+
+	if session.UserID != userID || session.RevokedAt != nil {
+		return errors.ErrInvalidToken
+	}
+
+	return nil
+}
+
+func (s *tokenService) revokeReusedFamily(familyID string) error {
+	if err := s.refreshTokenRepo.RevokeFamily(familyID); err != nil {
+		return err
+	}
+
+	return errors.ErrRefreshTokenReused
+}
+
+func (s *tokenService) tokenResponse(userID uint, sessionID, refreshToken string) (dto.TokenResponse, error) {
+	ttl := config.GetConfig().AccessTokenTTL
+	accessToken, err := utils.GenerateJWT(userID, sessionID, ttl)
+	if err != nil {
+		return dto.TokenResponse{}, errors.ErrFailedGenerateToken
+	}
+
+	return dto.TokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(ttl.Seconds()),
+	}, nil
+}
+
+func newRefreshToken(userID uint, familyID string) (string, *models.RefreshToken, error) {
+	token, hash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	return token, &models.RefreshToken{
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(config.GetConfig().RefreshTokenTTL),
+	}, nil
+}
+
+func newSession(userID uint, familyID string, expiresAt time.Time, client dto.ClientInfo) *models.Session {
+	return &models.Session{
+		UserID:     userID,
+		FamilyID:   familyID,
+		UserAgent:  truncateUserAgent(client.UserAgent),
+		IPAddress:  client.IPAddress,
+		ExpiresAt:  expiresAt,
+		LastSeenAt: time.Now(),
+	}
+}
+
+func truncateUserAgent(userAgent string) string {
+	if len(userAgent) > maxUserAgentLength {
+		return userAgent[:maxUserAgentLength]
+	}
+
+	return userAgent
+}
+
+func newFamilyID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(buf), nil
+}
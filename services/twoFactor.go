@@ -0,0 +1,300 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hutamy/invoice-generator-backend/config"
+	"github.com/hutamy/invoice-generator-backend/dto"
+	"github.com/hutamy/invoice-generator-backend/models"
+	"github.com/hutamy/invoice-generator-backend/repositories"
+	"github.com/hutamy/invoice-generator-backend/utils"
+	"github.com/hutamy/invoice-generator-backend/utils/errors"
+	"github.com/hutamy/invoice-generator-backend/utils/ratelimit"
+	"github.com/hutamy/invoice-generator-backend/utils/totp"
+)
+
+const (
+	recoveryCodeCount = 10
+	// totpSkew accepts codes from one step before and after the current one
+	totpSkew = 1
+)
+
+type TwoFactorService interface {
+	Enroll(userID uint) (dto.TwoFactorEnrollResponse, error)
+	Confirm(userID uint, code string) ([]string, error)
+	Disable(req dto.DisableTwoFactorRequest) error
+	RegenerateRecoveryCodes(userID uint, code string) ([]string, error)
+	CreateChallenge(userID uint) (dto.TwoFactorChallengeResponse, error)
+	VerifyChallenge(challengeToken, code string) (uint, error)
+}
+
+type twoFactorService struct {
+	authRepo      repositories.AuthRepository
+	twoFactorRepo repositories.TwoFactorRepository
+	lockout       *ratelimit.Lockout
+}
+
+func NewTwoFactorService(
+	authRepo repositories.AuthRepository,
+	twoFactorRepo repositories.TwoFactorRepository,
+	lockout *ratelimit.Lockout,
+) TwoFactorService {
+	return &twoFactorService{authRepo: authRepo, twoFactorRepo: twoFactorRepo, lockout: lockout}
+}
+
+// Enroll creates a new TOTP secret for the user. Two-factor authentication is
+// only switched on once a code from the authenticator app is confirmed.
+func (s *twoFactorService) Enroll(userID uint) (dto.TwoFactorEnrollResponse, error) {
+	user, err := s.authRepo.GetUserByID(userID)
+	if err != nil {
+		return dto.TwoFactorEnrollResponse{}, err
+	}
+
+	if user.TwoFactorEnabled {
+		return dto.TwoFactorEnrollResponse{}, errors.ErrTwoFactorAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return dto.TwoFactorEnrollResponse{}, err
+	}
+
+	encrypted, err := utils.Encrypt(secret)
+	if err != nil {
+		return dto.TwoFactorEnrollResponse{}, err
+	}
+
+	if err := s.twoFactorRepo.SaveSecret(userID, encrypted); err != nil {
+		return dto.TwoFactorEnrollResponse{}, err
+	}
+
+	return dto.TwoFactorEnrollResponse{
+		Secret:     totp.EncodeSecret(secret),
+		OtpauthURI: totp.URI(config.GetConfig().TOTPIssuer, user.Email, secret),
+	}, nil
+}
+
+// Confirm enables two-factor authentication when code matches the enrolled
+// secret and returns the recovery codes, which are only shown this once.
+func (s *twoFactorService) Confirm(userID uint, code string) ([]string, error) {
+	user, err := s.authRepo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.TwoFactorEnabled {
+		return nil, errors.ErrTwoFactorAlreadyEnabled
+	}
+
+	if len(user.TOTPSecret) == 0 {
+		return nil, errors.ErrTwoFactorNotEnabled
+	}
+
+	secret, err := utils.Decrypt(user.TOTPSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	step, ok := totp.Validate(secret, normalizeCode(code), time.Now(), totpSkew)
+	if !ok {
+		return nil, errors.ErrInvalidTwoFactorCode
+	}
+
+	codes, records, err := generateRecoveryCodes(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.twoFactorRepo.Enable(userID, step, records); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+func (s *twoFactorService) Disable(req dto.DisableTwoFactorRequest) error {
+	user, err := s.enabledUser(req.UserID)
+	if err != nil {
+		return err
+	}
+
+	if !utils.CheckPasswordHash(req.Password, user.Password) {
+		return errors.ErrInvalidPassword
+	}
+
+	if err := s.verifyCode(user, req.Code); err != nil {
+		return err
+	}
+
+	return s.twoFactorRepo.Disable(user.ID)
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes, invalidating the old ones
+func (s *twoFactorService) RegenerateRecoveryCodes(userID uint, code string) ([]string, error) {
+	user, err := s.enabledUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.verifyCode(user, code); err != nil {
+		return nil, err
+	}
+
+	codes, records, err := generateRecoveryCodes(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.twoFactorRepo.ReplaceRecoveryCodes(userID, records); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// CreateChallenge returns the short-lived token that replaces the token pair
+// after a correct password when the account uses two-factor authentication.
+func (s *twoFactorService) CreateChallenge(userID uint) (dto.TwoFactorChallengeResponse, error) {
+	ttl := config.GetConfig().TwoFactorChallengeTTL
+	token, err := utils.GenerateChallengeJWT(userID, ttl)
+	if err != nil {
+		return dto.TwoFactorChallengeResponse{}, errors.ErrFailedGenerateToken
+	}
+
+	return dto.TwoFactorChallengeResponse{
+		TwoFactorRequired: true,
+		ChallengeToken:    token,
+		ExpiresIn:         int(ttl.Seconds()),
+	}, nil
+}
+
+// VerifyChallenge checks the second sign-in step and returns the user ID the
+// challenge was issued for.
+func (s *twoFactorService) VerifyChallenge(challengeToken, code string) (uint, error) {
+	claims, err := utils.ParseJWT(challengeToken)
+	if err != nil || claims["typ"] != utils.TokenTypeTwoFactorChallenge {
+		return 0, errors.ErrInvalidToken
+	}
+
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return 0, errors.ErrInvalidToken
+	}
+
+	user, err := s.enabledUser(uint(userID))
+	if err != nil {
+		return 0, err
+	}
+
+	if err := s.verifyCode(user, code); err != nil {
+		return 0, err
+	}
+
+	return user.ID, nil
+}
+
+func (s *twoFactorService) enabledUser(userID uint) (*models.User, error) {
+	user, err := s.authRepo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.TwoFactorEnabled {
+		return nil, errors.ErrTwoFactorNotEnabled
+	}
+
+	return user, nil
+}
+
+// verifyCode accepts either a current TOTP code, which cannot be replayed, or
+// an unused recovery code, which is consumed. Repeated wrong codes lock the
+// account's second factor like failed passwords do.
+func (s *twoFactorService) verifyCode(user *models.User, code string) error {
+	lockoutKey := fmt.Sprintf("2fa:%d", user.ID)
+	if err := s.lockout.Check(lockoutKey); err != nil {
+		return err
+	}
+
+	err := s.checkCode(user, code)
+	if err == errors.ErrInvalidTwoFactorCode {
+		if err := s.lockout.Fail(lockoutKey); err != nil {
+			return err
+		}
+
+		return errors.ErrInvalidTwoFactorCode
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return s.lockout.Succeed(lockoutKey)
+}
+
+func (s *twoFactorService) checkCode(user *models.User, code string) error {
+	code = normalizeCode(code)
+	if len(code) == totp.Digits {
+		secret, err := utils.Decrypt(user.TOTPSecret)
+		if err != nil {
+			return err
+		}
+
+		step, ok := totp.Validate(secret, code, time.Now(), totpSkew)
+		if !ok {
+			return errors.ErrInvalidTwoFactorCode
+		}
+
+		advanced, err := s.twoFactorRepo.AdvanceStep(user.ID, step)
+		if err != nil {
+			return err
+		}
+
+		if !advanced {
+			return errors.ErrInvalidTwoFactorCode
+		}
+
+		return nil
+	}
+
+	used, err := s.twoFactorRepo.UseRecoveryCode(user.ID, utils.HashToken(code))
+	if err != nil {
+		return err
+	}
+
+	if !used {
+		return errors.ErrInvalidTwoFactorCode
+	}
+
+	return nil
+}
+
+// generateRecoveryCodes returns codes formatted as XXXXX-XXXXX together with
+// the records holding their hashes.
+func generateRecoveryCodes(userID uint) ([]string, []models.RecoveryCode, error) {
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+	codes := make([]string, recoveryCodeCount)
+	records := make([]models.RecoveryCode, recoveryCodeCount)
+	for i := range codes {
+		buf := make([]byte, 7)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+
+		code := encoding.EncodeToString(buf)[:10]
+		codes[i] = code[:5] + "-" + code[5:]
+		records[i] = models.RecoveryCode{UserID: userID, CodeHash: utils.HashToken(code)}
+	}
+
+	return codes, records, nil
+}
+
+// normalizeCode strips the separators users tend to type and upper-cases
+// recovery codes.
+func normalizeCode(code string) string {
+	code = strings.NewReplacer(" ", "", "-", "").Replace(code)
+	return strings.ToUpper(code)
+}
@@ -0,0 +1,117 @@
+package cache
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+)
+
+const (
+	BackendMemory = "memory"
+	BackendDisk   = "disk"
+)
+
+// Cache stores rendered documents keyed by a content hash
+type Cache interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, data []byte) error
+}
+
+// New creates a cache for the given backend ("memory" or "disk")
+func New(backend, dir string, capacity int) (Cache, error) {
+	switch backend {
+	case "", BackendMemory:
+		return NewMemoryCache(capacity), nil
+	case BackendDisk:
+		return NewDiskCache(dir, capacity)
+	default:
+		return nil, fmt.Errorf("unknown cache backend %q", backend)
+	}
+}
+
+// lru keeps track of key recency and evicts the least recently used key
+// once capacity is exceeded. It is not safe for concurrent use on its own.
+type lru struct {
+	capacity int
+	order    *list.List
+	entries  map[string]*list.Element
+}
+
+func newLRU(capacity int) *lru {
+	if capacity < 1 {
+		capacity = 1
+	}
+
+	return &lru{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  map[string]*list.Element{},
+	}
+}
+
+func (l *lru) touch(key string) bool {
+	elem, ok := l.entries[key]
+	if !ok {
+		return false
+	}
+
+	l.order.MoveToFront(elem)
+	return true
+}
+
+// add records key as most recently used and returns the evicted keys
+func (l *lru) add(key string) []string {
+	if l.touch(key) {
+		return nil
+	}
+
+	l.entries[key] = l.order.PushFront(key)
+
+	var evicted []string
+	for l.order.Len() > l.capacity {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		oldKey := oldest.Value.(string)
+		delete(l.entries, oldKey)
+		evicted = append(evicted, oldKey)
+	}
+
+	return evicted
+}
+
+type memoryCache struct {
+	mu    sync.Mutex
+	lru   *lru
+	items map[string][]byte
+}
+
+// NewMemoryCache creates an in-memory LRU cache holding up to capacity entries
+func NewMemoryCache(capacity int) Cache {
+	return &memoryCache{
+		lru:   newLRU(capacity),
+		items: map[string][]byte{},
+	}
+}
+
+func (c *memoryCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.lru.touch(key) {
+		return nil, false
+	}
+
+	return c.items[key], true
+}
+
+func (c *memoryCache) Set(key string, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.items[key] = data
+	for _, evicted := range c.lru.add(key) {
+		delete(c.items, evicted)
+	}
+
+	return nil
+}
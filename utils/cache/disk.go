@@ -0,0 +1,122 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const diskCacheExt = ".bin"
+
+type diskCache struct {
+	mu  sync.Mutex
+	dir string
+	lru *lru
+}
+
+// NewDiskCache creates an LRU cache that stores entries as files in dir.
+// Entries left over from a previous run are picked up in modification order.
+func NewDiskCache(dir string, capacity int) (Cache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	c := &diskCache{dir: dir, lru: newLRU(capacity)}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	type existing struct {
+		key     string
+		modTime time.Time
+	}
+
+	var files []existing
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), diskCacheExt) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		files = append(files, existing{
+			key:     strings.TrimSuffix(entry.Name(), diskCacheExt),
+			modTime: info.ModTime(),
+		})
+	}
+
+	// Oldest first so the most recent files end up at the front of the LRU
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.Before(files[j].modTime)
+	})
+	for _, f := range files {
+		for _, evicted := range c.lru.add(f.key) {
+			os.Remove(c.path(evicted))
+		}
+	}
+
+	return c, nil
+}
+
+func (c *diskCache) path(key string) string {
+	return filepath.Join(c.dir, filepath.Base(key)+diskCacheExt)
+}
+
+func (c *diskCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.lru.touch(key) {
+		return nil, false
+	}
+
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return nil, false
+	}
+
+	now := time.Now()
+	os.Chtimes(c.path(key), now, now)
+	return data, true
+}
+
+func (c *diskCache) Set(key string, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Write to a temp file first so readers never see a partial entry
+	tmp, err := os.CreateTemp(c.dir, "tmp-*")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), c.path(key)); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	for _, evicted := range c.lru.add(key) {
+		os.Remove(c.path(evicted))
+	}
+
+	return nil
+}
@@ -0,0 +1,301 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/hutamy/invoice-generator-backend/config"
+)
+
+// Values are sealed with envelope encryption: every value gets its own random
+// data key, which is wrapped with a master key from the keyring. The output is
+//
+//	envelopeMagic | len(kid) | kid | wrapped data key | nonce | ciphertext
+//
+// Rotating the master key only requires re-wrapping the data keys, see Rewrap.
+var envelopeMagic = []byte("IGE1")
+
+const (
+	// legacyKeyID names ENCRYPTION_KEY in the keyring. Values sealed before
+	// envelope encryption used this key directly.
+	legacyKeyID = "default"
+	dataKeySize = 32
+	gcmNonce    = 12
+	gcmTag      = 16
+	wrappedSize = gcmNonce + dataKeySize + gcmTag
+)
+
+type keyring struct {
+	keys   map[string][]byte
+	active string
+}
+
+var (
+	keyringMu     sync.Mutex
+	keyringSource string
+	loadedKeyring *keyring
+)
+
+// InitEncryption checks that the configured master keys are usable, so a
+// misconfiguration fails at startup rather than on the first write.
+func InitEncryption(cfg config.Config) error {
+	_, err := parseKeyring(cfg)
+	return err
+}
+
+// Encrypt seals plaintext with a fresh data key wrapped by the active master
+// key (ENCRYPTION_ACTIVE_KEY_ID).
+func Encrypt(plaintext []byte) ([]byte, error) {
+	ring, err := currentKeyring()
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+
+	wrapped, err := seal(ring.keys[ring.active], dataKey, envelopeHeader(ring.active))
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := seal(dataKey, plaintext, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	out := envelopeHeader(ring.active)
+	out = append(out, wrapped...)
+	return append(out, sealed...), nil
+}
+
+// Decrypt opens a ciphertext produced by Encrypt with whichever master key
+// wrapped it. Values written before envelope encryption are opened with
+// ENCRYPTION_KEY.
+func Decrypt(ciphertext []byte) ([]byte, error) {
+	ring, err := currentKeyring()
+	if err != nil {
+		return nil, err
+	}
+
+	kid, wrapped, sealed, ok := parseEnvelope(ciphertext)
+	if !ok {
+		return decryptLegacy(ring, ciphertext)
+	}
+
+	dataKey, err := unwrapDataKey(ring, kid, wrapped)
+	if err != nil {
+		return nil, err
+	}
+
+	return open(dataKey, sealed, nil)
+}
+
+// Rewrap makes ciphertext use the active master key. Envelopes only get their
+// data key re-wrapped; legacy values are encrypted again. It reports whether
+// the ciphertext changed.
+func Rewrap(ciphertext []byte) ([]byte, bool, error) {
+	ring, err := currentKeyring()
+	if err != nil {
+		return nil, false, err
+	}
+
+	kid, wrapped, sealed, ok := parseEnvelope(ciphertext)
+	if !ok {
+		plaintext, err := decryptLegacy(ring, ciphertext)
+		if err != nil {
+			return nil, false, err
+		}
+
+		out, err := Encrypt(plaintext)
+		return out, err == nil, err
+	}
+
+	if kid == ring.active {
+		return ciphertext, false, nil
+	}
+
+	dataKey, err := unwrapDataKey(ring, kid, wrapped)
+	if err != nil {
+		return nil, false, err
+	}
+
+	rewrapped, err := seal(ring.keys[ring.active], dataKey, envelopeHeader(ring.active))
+	if err != nil {
+		return nil, false, err
+	}
+
+	out := envelopeHeader(ring.active)
+	out = append(out, rewrapped...)
+	return append(out, sealed...), true, nil
+}
+
+func envelopeHeader(kid string) []byte {
+	header := append([]byte{}, envelopeMagic...)
+	header = append(header, byte(len(kid)))
+	return append(header, kid...)
+}
+
+func parseEnvelope(ciphertext []byte) (string, []byte, []byte, bool) {
+	if !bytes.HasPrefix(ciphertext, envelopeMagic) || len(ciphertext) <= len(envelopeMagic) {
+		return "", nil, nil, false
+	}
+
+	rest := ciphertext[len(envelopeMagic):]
+	kidLen := int(rest[0])
+	rest = rest[1:]
+	if len(rest) < kidLen+wrappedSize+gcmNonce+gcmTag {
+		return "", nil, nil, false
+	}
+
+	kid := string(rest[:kidLen])
+	rest = rest[kidLen:]
+	return kid, rest[:wrappedSize], rest[wrappedSize:], true
+}
+
+func unwrapDataKey(ring *keyring, kid string, wrapped []byte) ([]byte, error) {
+	key, ok := ring.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("encryption key %q is not configured", kid)
+	}
+
+	return open(key, wrapped, envelopeHeader(kid))
+}
+
+func decryptLegacy(ring *keyring, ciphertext []byte) ([]byte, error) {
+	key, ok := ring.keys[legacyKeyID]
+	if !ok {
+		return nil, errors.New("value was encrypted with ENCRYPTION_KEY, which is not configured")
+	}
+
+	return open(key, ciphertext, nil)
+}
+
+// seal encrypts with AES-256-GCM and prepends the random nonce
+func seal(key, plaintext, additionalData []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func open(key, ciphertext, additionalData []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+
+	nonce, sealed := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	return aead.Open(nil, nonce, sealed, additionalData)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// currentKeyring parses the keys from the configuration, reusing the previous
+// result while the configuration is unchanged.
+func currentKeyring() (*keyring, error) {
+	cfg := config.GetConfig()
+	source := cfg.EncryptionKey + "|" + strings.Join(cfg.EncryptionKeys, ",") + "|" + cfg.EncryptionActiveKeyID
+
+	keyringMu.Lock()
+	defer keyringMu.Unlock()
+
+	if loadedKeyring != nil && keyringSource == source {
+		return loadedKeyring, nil
+	}
+
+	ring, err := parseKeyring(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	loadedKeyring, keyringSource = ring, source
+	return ring, nil
+}
+
+// parseKeyring reads ENCRYPTION_KEY (id "default") and the <id>:<key> entries
+// of ENCRYPTION_KEYS. Every key is a base64 encoded 32 byte AES key.
+func parseKeyring(cfg config.Config) (*keyring, error) {
+	ring := &keyring{keys: map[string][]byte{}, active: cfg.EncryptionActiveKeyID}
+	if cfg.EncryptionKey != "" {
+		key, err := decodeMasterKey(cfg.EncryptionKey)
+		if err != nil {
+			return nil, fmt.Errorf("ENCRYPTION_KEY %w", err)
+		}
+		ring.keys[legacyKeyID] = key
+	}
+
+	for _, entry := range cfg.EncryptionKeys {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		kid, encoded, found := strings.Cut(entry, ":")
+		if !found || kid == "" || len(kid) > 255 {
+			return nil, fmt.Errorf("ENCRYPTION_KEYS entries must look like <id>:<base64 key>")
+		}
+
+		key, err := decodeMasterKey(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("ENCRYPTION_KEYS key %q %w", kid, err)
+		}
+		ring.keys[kid] = key
+	}
+
+	if len(ring.keys) == 0 {
+		return nil, errors.New("ENCRYPTION_KEY or ENCRYPTION_KEYS must be set")
+	}
+
+	if ring.active == "" {
+		if len(ring.keys) > 1 {
+			return nil, errors.New("ENCRYPTION_ACTIVE_KEY_ID is required when several keys are configured")
+		}
+
+		for kid := range ring.keys {
+			ring.active = kid
+		}
+	}
+
+	if _, ok := ring.keys[ring.active]; !ok {
+		return nil, fmt.Errorf("ENCRYPTION_ACTIVE_KEY_ID %q does not match a configured key", ring.active)
+	}
+
+	return ring, nil
+}
+
+func decodeMasterKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil || len(key) != 32 {
+		return nil, errors.New("must be a base64 encoded 32 byte key")
+	}
+
+	return key, nil
+}
@@ -3,13 +3,65 @@ package errors
 import e "errors"
 
 var (
-	ErrUserAlreadyExists   = e.New("email already exists")
-	ErrLoginFailed         = e.New("invalid email and password")
-	ErrBadRequest          = e.New("please check your input")
-	ErrFailedGenerateToken = e.New("failed to generate token")
-	ErrUserNotFound        = e.New("user not found")
-	ErrInvalidToken        = e.New("invalid token")
-	ErrUnauthorized        = e.New("unauthorized access")
-	ErrNotFound            = e.New("resource not found")
-	ErrInvalidDateFormat   = e.New("invalid date format, expected YYYY-MM-DD")
+	ErrUserAlreadyExists       = e.New("email already exists")
+	ErrLoginFailed             = e.New("invalid email and password")
+	ErrBadRequest              = e.New("please check your input")
+	ErrFailedGenerateToken     = e.New("failed to generate token")
+	ErrUserNotFound            = e.New("user not found")
+	ErrInvalidToken            = e.New("invalid token")
+	ErrUnauthorized            = e.New("unauthorized access")
+	ErrNotFound                = e.New("resource not found")
+	ErrInvalidDateFormat       = e.New("invalid date format, expected YYYY-MM-DD")
+	ErrNotModified             = e.New("resource not modified")
+	ErrUnsupportedLocale       = e.New("unsupported locale")
+	ErrExportNotReady          = e.New("export is not ready yet")
+	ErrExportExpired           = e.New("export archive has expired, start a new export")
+	ErrTooManyExports          = e.New("too many exports in progress, wait for one to finish")
+	ErrUnsupportedFormat       = e.New("unsupported output format")
+	ErrInvalidEInvoice         = e.New("invoice cannot be converted to an e-invoice")
+	ErrInvalidCertificate      = e.New("invalid PKCS#12 file or password")
+	ErrCertificateExpired      = e.New("certificate is expired or not yet valid")
+	ErrInvalidSignature        = e.New("document signature is missing or invalid")
+	ErrRefreshTokenReused      = e.New("refresh token was already used, please sign in again")
+	ErrEmailNotVerified        = e.New("email address is not verified")
+	ErrInvalidPassword         = e.New("current password is incorrect")
+	ErrEmailChangeNotAllowed   = e.New("the email address can only be changed with PUT /v1/protected/me/email")
+	ErrSameEmail               = e.New("new email address is the same as the current one")
+	ErrTwoFactorAlreadyEnabled = e.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnabled     = e.New("two-factor authentication is not enabled")
+	ErrInvalidTwoFactorCode    = e.New("invalid two-factor authentication code")
+	ErrTooManyRequests         = e.New("too many requests")
+	ErrInvalidExpiry           = e.New("expiry date must be in the future")
+	ErrInsufficientScope       = e.New("API key is missing the required scope")
+	ErrAPIKeyNotAllowed        = e.New("this endpoint cannot be used with an API key")
+	ErrUnknownProvider         = e.New("unknown single sign-on provider")
+	ErrInvalidOIDCState        = e.New("single sign-on login expired or was already used, please try again")
+	ErrOIDCLoginFailed         = e.New("single sign-on login failed")
+	ErrOIDCEmailNotVerified    = e.New("the provider did not confirm a verified email address")
+	ErrInvalidOrganization     = e.New("invalid X-Organization-ID header")
+	ErrNotMember               = e.New("you are not a member of this organization")
+	ErrForbidden               = e.New("your role does not allow this action")
+	ErrLastOwner               = e.New("an organization needs at least one owner")
+	ErrLastOrganization        = e.New("a user must belong to at least one organization")
+	ErrAlreadyMember           = e.New("this user is already a member of the organization")
+	ErrInvitationEmailMismatch = e.New("this invitation was sent to a different email address")
+	ErrInvalidClient           = e.New("client does not exist in this organization")
+	ErrInvalidSenderProfile    = e.New("sender profile does not exist in this organization")
+	ErrInvoiceNumberRequired   = e.New("invoice_number is required when the organization has no sender profile")
+	ErrInvoiceNotDraft         = e.New("the sender, currency and payment methods can only be changed on draft invoices")
+	ErrClientRefreshNotDraft   = e.New("client details can only be refreshed on draft invoices")
+	ErrClientNotDraft          = e.New("client details can only be changed on draft invoices")
+	ErrInvoiceIssued           = e.New("an issued invoice cannot be moved back to draft")
+	ErrInvoiceSettled          = e.New("the payments recorded for this invoice settle it, delete one to reopen it")
+	ErrInvoiceWithoutClient    = e.New("invoice is not linked to a client")
+	ErrDueDateRequired         = e.New("due date is required when the client has no payment terms")
+	ErrInvalidPaymentInvoice   = e.New("payments can only be applied to issued invoices of the client")
+	ErrPaymentCurrencyMismatch = e.New("payment currency must match the invoice currency")
+	ErrInvalidDateRange        = e.New("from date must not be after to date")
+	ErrClientInUse             = e.New("client is still referenced by invoices or payments, archive it instead")
+	ErrMergeSameClient         = e.New("a client cannot be merged into itself")
+	ErrClientArchived          = e.New("client is archived, restore it first")
+	ErrInvalidPaymentMethod    = e.New("payment method does not belong to the sender profile of the invoice")
+	ErrPaymentMethodCurrency   = e.New("payment method does not accept the currency of the invoice")
+	ErrUnsupportedLogo         = e.New("logo must be a PNG or JPEG image")
 )
@@ -0,0 +1,20 @@
+package utils
+
+import "strings"
+
+// ETagMatches reports whether an If-None-Match header value matches etag.
+// Weak validators (W/"...") are compared by their opaque value.
+func ETagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,272 @@
+package facturx
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/hutamy/invoice-generator-backend/models"
+)
+
+const (
+	FileName         = "factur-x.xml"
+	ConformanceLevel = "BASIC"
+	// GuidelineBasic identifies the Factur-X 1.0 BASIC profile (BT-24)
+	GuidelineBasic = "urn:cen.eu:en16931:2017#compliant#urn:factur-x.eu:1p0:basic"
+
+	typeCodeCommercialInvoice = "380"
+	dateFormatCCYYMMDD        = "102"
+	unitCodePiece             = "C62"
+	taxTypeVAT                = "VAT"
+	taxCategoryStandard       = "S"
+	taxCategoryZeroRated      = "Z"
+)
+
+// Party is the seller or buyer printed on the invoice
+type Party struct {
+	Name       string
+	Email      string
+	Address    string // First address line
+	Address2   string
+	City       string
+	Region     string
+	PostalCode string
+	CountryID  string // ISO 3166-1 alpha-2
+	TaxID      string // VAT registration number
+}
+
+// Document is the Factur-X input assembled from an invoice and its parties
+type Document struct {
+	Invoice  *models.Invoice
+	Seller   Party
+	Buyer    Party
+	Currency string // ISO 4217
+}
+
+// Build renders the CrossIndustryInvoice XML for doc after validating it
+// against the BASIC profile rules, and checks the result against the
+// profile's XML schema.
+func Build(doc Document) ([]byte, error) {
+	if err := Validate(doc); err != nil {
+		return nil, err
+	}
+
+	invoice := doc.Invoice
+	category := taxCategoryStandard
+	if invoice.TaxRate == 0 {
+		category = taxCategoryZeroRated
+	}
+
+	cii := crossIndustryInvoice{
+		XmlnsRsm: "urn:un:unece:uncefact:data:standard:CrossIndustryInvoice:100",
+		XmlnsRam: "urn:un:unece:uncefact:data:standard:ReusableAggregateBusinessInformationEntity:100",
+		XmlnsUdt: "urn:un:unece:uncefact:data:standard:UnqualifiedDataType:100",
+		XmlnsQdt: "urn:un:unece:uncefact:data:standard:QualifiedDataType:100",
+		Context: documentContext{
+			Guideline: idElement{ID: GuidelineBasic},
+		},
+		Document: exchangedDocument{
+			ID:        invoice.InvoiceNumber,
+			TypeCode:  typeCodeCommercialInvoice,
+			IssueDate: newDateTime(invoice.IssueDate),
+		},
+	}
+
+	transaction := &cii.Transaction
+	for i, item := range invoice.Items {
+		transaction.Lines = append(transaction.Lines, lineItem{
+			Document: lineDocument{LineID: fmt.Sprint(i + 1)},
+			Product:  product{Name: item.Description},
+			Agreement: lineAgreement{
+				NetPrice: tradePrice{ChargeAmount: amount(item.UnitPrice)},
+			},
+			Delivery: lineDelivery{
+				BilledQuantity: quantity{UnitCode: unitCodePiece, Value: fmt.Sprint(item.Quantity)},
+			},
+			Settlement: lineSettlement{
+				Tax: tradeTax{
+					TypeCode:     taxTypeVAT,
+					CategoryCode: category,
+					RatePercent:  amount(invoice.TaxRate),
+				},
+				Summation: lineSummation{LineTotalAmount: amount(item.Total)},
+			},
+		})
+	}
+
+	transaction.Agreement = headerAgreement{
+		Seller: newTradeParty(doc.Seller),
+		Buyer:  newTradeParty(doc.Buyer),
+	}
+
+	dueDate := newDateTime(invoice.DueDate)
+	transaction.Settlement = headerSettlement{
+		Currency: doc.Currency,
+		Tax: []tradeTax{{
+			CalculatedAmount: amount(invoice.Tax),
+			TypeCode:         taxTypeVAT,
+			BasisAmount:      amount(invoice.Subtotal),
+			CategoryCode:     category,
+			RatePercent:      amount(invoice.TaxRate),
+		}},
+		PaymentTerms: &paymentTerms{DueDate: &dueDate},
+		Summation: headerSummation{
+			LineTotalAmount:     amount(invoice.Subtotal),
+			TaxBasisTotalAmount: amount(invoice.Subtotal),
+			TaxTotalAmount:      currencyAmount{CurrencyID: doc.Currency, Value: amount(invoice.Tax)},
+			GrandTotalAmount:    amount(invoice.Total),
+			DuePayableAmount:    amount(invoice.Total),
+		},
+	}
+
+	output, err := xml.MarshalIndent(cii, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	output = append([]byte(xml.Header), output...)
+	if err := ValidateXML(output); err != nil {
+		return nil, fmt.Errorf("factur-x: %w", err)
+	}
+
+	return output, nil
+}
+
+// Validate checks the business rules of the BASIC profile that this service
+// can violate: mandatory terms and the consistency of the totals.
+func Validate(doc Document) error {
+	var problems []string
+	require := func(value, term string) {
+		if strings.TrimSpace(value) == "" {
+			problems = append(problems, term+" is required")
+		}
+	}
+
+	invoice := doc.Invoice
+	if invoice == nil {
+		return fmt.Errorf("factur-x: invoice is required")
+	}
+
+	require(invoice.InvoiceNumber, "BT-1 invoice number")
+	if invoice.IssueDate.IsZero() {
+		problems = append(problems, "BT-2 issue date is required")
+	}
+	require(doc.Currency, "BT-5 invoice currency")
+	require(doc.Seller.Name, "BT-27 seller name")
+	require(doc.Seller.CountryID, "BT-40 seller country")
+	require(doc.Buyer.Name, "BT-44 buyer name")
+	require(doc.Buyer.CountryID, "BT-55 buyer country")
+
+	if len(invoice.Items) == 0 {
+		problems = append(problems, "BG-25 at least one invoice line is required")
+	}
+
+	var lineTotal float64
+	for i, item := range invoice.Items {
+		require(item.Description, fmt.Sprintf("BT-153 item name (line %d)", i+1))
+		lineTotal += item.Total
+	}
+
+	// BR-CO-10, BR-CO-15: totals must add up to two decimals
+	if !sameAmount(lineTotal, invoice.Subtotal) {
+		problems = append(problems, "BT-106 sum of line amounts does not match the line totals")
+	}
+	if !sameAmount(invoice.Subtotal+invoice.Tax, invoice.Total) {
+		problems = append(problems, "BT-112 total does not equal subtotal plus tax")
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("factur-x: %s", strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// XMP returns the Factur-X extension schema and properties that must be part
+// of the PDF/A-3 metadata of a Factur-X invoice.
+func XMP() string {
+	return `<rdf:Description rdf:about="" xmlns:fx="urn:factur-x:pdfa:CrossIndustryDocument:invoice:1p0#">
+<fx:DocumentType>INVOICE</fx:DocumentType>
+<fx:DocumentFileName>` + FileName + `</fx:DocumentFileName>
+<fx:Version>1.0</fx:Version>
+<fx:ConformanceLevel>` + ConformanceLevel + `</fx:ConformanceLevel>
+</rdf:Description>
+<rdf:Description rdf:about="" xmlns:pdfaExtension="http://www.aiim.org/pdfa/ns/extension/" xmlns:pdfaSchema="http://www.aiim.org/pdfa/ns/schema#" xmlns:pdfaProperty="http://www.aiim.org/pdfa/ns/property#">
+<pdfaExtension:schemas>
+<rdf:Bag>
+<rdf:li rdf:parseType="Resource">
+<pdfaSchema:schema>Factur-X PDFA Extension Schema</pdfaSchema:schema>
+<pdfaSchema:namespaceURI>urn:factur-x:pdfa:CrossIndustryDocument:invoice:1p0#</pdfaSchema:namespaceURI>
+<pdfaSchema:prefix>fx</pdfaSchema:prefix>
+<pdfaSchema:property>
+<rdf:Seq>
+<rdf:li rdf:parseType="Resource">
+<pdfaProperty:name>DocumentFileName</pdfaProperty:name>
+<pdfaProperty:valueType>Text</pdfaProperty:valueType>
+<pdfaProperty:category>external</pdfaProperty:category>
+<pdfaProperty:description>name of the embedded XML invoice file</pdfaProperty:description>
+</rdf:li>
+<rdf:li rdf:parseType="Resource">
+<pdfaProperty:name>DocumentType</pdfaProperty:name>
+<pdfaProperty:valueType>Text</pdfaProperty:valueType>
+<pdfaProperty:category>external</pdfaProperty:category>
+<pdfaProperty:description>INVOICE</pdfaProperty:description>
+</rdf:li>
+<rdf:li rdf:parseType="Resource">
+<pdfaProperty:name>Version</pdfaProperty:name>
+<pdfaProperty:valueType>Text</pdfaProperty:valueType>
+<pdfaProperty:category>external</pdfaProperty:category>
+<pdfaProperty:description>The actual version of the Factur-X XML schema</pdfaProperty:description>
+</rdf:li>
+<rdf:li rdf:parseType="Resource">
+<pdfaProperty:name>ConformanceLevel</pdfaProperty:name>
+<pdfaProperty:valueType>Text</pdfaProperty:valueType>
+<pdfaProperty:category>external</pdfaProperty:category>
+<pdfaProperty:description>The conformance level of the embedded Factur-X data</pdfaProperty:description>
+</rdf:li>
+</rdf:Seq>
+</pdfaSchema:property>
+</rdf:li>
+</rdf:Bag>
+</pdfaExtension:schemas>
+</rdf:Description>
+`
+}
+
+func sameAmount(a, b float64) bool {
+	return math.Abs(math.Round(a*100)-math.Round(b*100)) < 1
+}
+
+func amount(v float64) string {
+	return fmt.Sprintf("%.2f", v)
+}
+
+func newDateTime(t time.Time) dateTime {
+	return dateTime{Value: dateTimeString{Format: dateFormatCCYYMMDD, Value: t.Format("20060102")}}
+}
+
+func newTradeParty(p Party) tradeParty {
+	party := tradeParty{
+		Name: p.Name,
+		Address: &postalAddress{
+			PostcodeCode:           p.PostalCode,
+			LineOne:                p.Address,
+			LineTwo:                p.Address2,
+			CityName:               p.City,
+			CountryID:              p.CountryID,
+			CountrySubDivisionName: p.Region,
+		},
+	}
+
+	if p.Email != "" {
+		party.Email = &emailAddress{URIID: uriID{SchemeID: "EM", Value: p.Email}}
+	}
+
+	if p.TaxID != "" {
+		party.TaxRegistration = &taxRegistration{ID: uriID{SchemeID: "VA", Value: p.TaxID}}
+	}
+
+	return party
+}
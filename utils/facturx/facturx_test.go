@@ -0,0 +1,213 @@
+package facturx
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hutamy/invoice-generator-backend/models"
+	"github.com/hutamy/invoice-generator-backend/utils/xsd"
+)
+
+func testDocument() Document {
+	return Document{
+		Invoice: &models.Invoice{
+			InvoiceNumber: "INV-2025-001",
+			IssueDate:     time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC),
+			DueDate:       time.Date(2025, 7, 31, 0, 0, 0, 0, time.UTC),
+			Subtotal:      1500000,
+			TaxRate:       11,
+			Tax:           165000,
+			Total:         1665000,
+			Items: []models.InvoiceItem{
+				{Description: "Website development", Quantity: 1, UnitPrice: 1000000, Total: 1000000},
+				{Description: "Hosting & maintenance <monthly>", Quantity: 2, UnitPrice: 250000, Total: 500000},
+			},
+		},
+		Currency: "IDR",
+		Seller: Party{
+			Name:      "Studio Hutamy",
+			Email:     "billing@example.com",
+			Address:   "Jl. Sudirman 1",
+			CountryID: "ID",
+			TaxID:     "01.234.567.8-901.000",
+		},
+		Buyer: Party{
+			Name:       "PT Maju Jaya",
+			Email:      "finance@majujaya.example",
+			Address:    "Jl. Thamrin 10",
+			Address2:   "Lantai 5",
+			City:       "Jakarta",
+			Region:     "DKI Jakarta",
+			PostalCode: "10230",
+			CountryID:  "ID",
+			TaxID:      "02.345.678.9-012.000",
+		},
+	}
+}
+
+func TestBuildProducesSchemaValidXML(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(doc *Document)
+	}{
+		{"full parties", func(doc *Document) {}},
+		{"zero rated", func(doc *Document) {
+			doc.Invoice.TaxRate = 0
+			doc.Invoice.Tax = 0
+			doc.Invoice.Total = doc.Invoice.Subtotal
+		}},
+		{"minimal parties", func(doc *Document) {
+			doc.Seller = Party{Name: "Freelancer", CountryID: "ID"}
+			doc.Buyer = Party{Name: "Client", CountryID: "DE"}
+		}},
+		{"euro invoice", func(doc *Document) {
+			doc.Currency = "EUR"
+			doc.Buyer.CountryID = "FR"
+		}},
+		{"single line", func(doc *Document) {
+			doc.Invoice.Items = doc.Invoice.Items[:1]
+			doc.Invoice.Subtotal = 1000000
+			doc.Invoice.Tax = 110000
+			doc.Invoice.Total = 1110000
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := testDocument()
+			tt.modify(&doc)
+
+			data, err := Build(doc)
+			if err != nil {
+				t.Fatalf("Build() error = %v", err)
+			}
+
+			if err := ValidateXML(data); err != nil {
+				t.Fatalf("ValidateXML() error = %v\n%s", err, data)
+			}
+		})
+	}
+}
+
+func TestBuildRejectsBusinessRuleViolations(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(doc *Document)
+		want   string
+	}{
+		{"missing invoice number", func(doc *Document) { doc.Invoice.InvoiceNumber = "" }, "BT-1"},
+		{"missing issue date", func(doc *Document) { doc.Invoice.IssueDate = time.Time{} }, "BT-2"},
+		{"missing currency", func(doc *Document) { doc.Currency = "" }, "BT-5"},
+		{"missing seller name", func(doc *Document) { doc.Seller.Name = " " }, "BT-27"},
+		{"missing buyer country", func(doc *Document) { doc.Buyer.CountryID = "" }, "BT-55"},
+		{"no lines", func(doc *Document) { doc.Invoice.Items = nil }, "BG-25"},
+		{"line without name", func(doc *Document) { doc.Invoice.Items[0].Description = "" }, "BT-153"},
+		{"lines do not add up", func(doc *Document) { doc.Invoice.Subtotal = 1400000 }, "BT-106"},
+		{"total does not add up", func(doc *Document) { doc.Invoice.Total = 1600000 }, "BT-112"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := testDocument()
+			tt.modify(&doc)
+
+			_, err := Build(doc)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Build() error = %v, want it to mention %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildRejectsValuesOutsideTheSchema(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(doc *Document)
+		want   string
+	}{
+		{"unknown currency", func(doc *Document) { doc.Currency = "XYZ" }, "InvoiceCurrencyCode"},
+		{"unknown country", func(doc *Document) { doc.Buyer.CountryID = "ZZ" }, "CountryID"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := testDocument()
+			tt.modify(&doc)
+
+			_, err := Build(doc)
+			var validationErr *xsd.ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("Build() error = %v, want a schema validation error", err)
+			}
+
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Build() error = %v, want it to mention %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateXMLRejectsBrokenDocuments(t *testing.T) {
+	valid, err := Build(testDocument())
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		replace [2]string
+		want    string
+	}{
+		{
+			"elements out of order",
+			[2]string{"<ram:TypeCode>380</ram:TypeCode>\n    <ram:IssueDateTime>", "<ram:IssueDateTime>"},
+			"ExchangedDocument",
+		},
+		{
+			"missing mandatory element",
+			[2]string{"<ram:InvoiceCurrencyCode>IDR</ram:InvoiceCurrencyCode>", ""},
+			"InvoiceCurrencyCode",
+		},
+		{
+			"unknown document type",
+			[2]string{"<ram:TypeCode>380</ram:TypeCode>", "<ram:TypeCode>999</ram:TypeCode>"},
+			"TypeCode",
+		},
+		{
+			"amount that is not a number",
+			[2]string{"<ram:GrandTotalAmount>1665000.00</ram:GrandTotalAmount>", "<ram:GrandTotalAmount>1.665.000</ram:GrandTotalAmount>"},
+			"GrandTotalAmount",
+		},
+		{
+			"missing date format",
+			[2]string{`<udt:DateTimeString format="102">20250701</udt:DateTimeString>`, `<udt:DateTimeString>20250701</udt:DateTimeString>`},
+			"format",
+		},
+		{
+			"undeclared attribute",
+			[2]string{`<ram:BilledQuantity unitCode="C62">`, `<ram:BilledQuantity unitCode="C62" scale="2">`},
+			"scale",
+		},
+		{
+			"element from another profile",
+			[2]string{"<ram:Name>Website development</ram:Name>", "<ram:Name>Website development</ram:Name><ram:Description>EXTENDED only</ram:Description>"},
+			"Description",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broken := strings.Replace(string(valid), tt.replace[0], tt.replace[1], 1)
+			if broken == string(valid) {
+				t.Fatalf("fixture does not contain %q", tt.replace[0])
+			}
+
+			err := ValidateXML([]byte(broken))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("ValidateXML() error = %v, want it to mention %s", err, tt.want)
+			}
+		})
+	}
+}
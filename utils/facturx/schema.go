@@ -0,0 +1,31 @@
+package facturx
+
+import (
+	"embed"
+	"sync"
+
+	"github.com/hutamy/invoice-generator-backend/utils/xsd"
+)
+
+const basicSchemaFile = "schema/Factur-X_1.0.07_BASIC.xsd"
+
+// schemaFiles holds the XML schema of the BASIC profile with its UN/CEFACT
+// data type modules
+//
+//go:embed schema/*.xsd
+var schemaFiles embed.FS
+
+var basicSchema = sync.OnceValues(func() (*xsd.Schema, error) {
+	return xsd.Load(schemaFiles, basicSchemaFile)
+})
+
+// ValidateXML checks a CrossIndustryInvoice document against the XML schema
+// of the BASIC profile
+func ValidateXML(data []byte) error {
+	schema, err := basicSchema()
+	if err != nil {
+		return err
+	}
+
+	return schema.Validate(data)
+}
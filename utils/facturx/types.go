@@ -0,0 +1,156 @@
+package facturx
+
+import "encoding/xml"
+
+// The structs below mirror the subset of the UN/CEFACT CrossIndustryInvoice
+// D16B schema used by the BASIC profile. Field order follows the schema
+// sequence, which is significant for validation.
+
+type crossIndustryInvoice struct {
+	XMLName     xml.Name          `xml:"rsm:CrossIndustryInvoice"`
+	XmlnsRsm    string            `xml:"xmlns:rsm,attr"`
+	XmlnsRam    string            `xml:"xmlns:ram,attr"`
+	XmlnsUdt    string            `xml:"xmlns:udt,attr"`
+	XmlnsQdt    string            `xml:"xmlns:qdt,attr"`
+	Context     documentContext   `xml:"rsm:ExchangedDocumentContext"`
+	Document    exchangedDocument `xml:"rsm:ExchangedDocument"`
+	Transaction tradeTransaction  `xml:"rsm:SupplyChainTradeTransaction"`
+}
+
+type documentContext struct {
+	Guideline idElement `xml:"ram:GuidelineSpecifiedDocumentContextParameter"`
+}
+
+type idElement struct {
+	ID string `xml:"ram:ID"`
+}
+
+type exchangedDocument struct {
+	ID        string   `xml:"ram:ID"`
+	TypeCode  string   `xml:"ram:TypeCode"`
+	IssueDate dateTime `xml:"ram:IssueDateTime"`
+}
+
+type dateTime struct {
+	Value dateTimeString `xml:"udt:DateTimeString"`
+}
+
+type dateTimeString struct {
+	Format string `xml:"format,attr"`
+	Value  string `xml:",chardata"`
+}
+
+type tradeTransaction struct {
+	Lines      []lineItem       `xml:"ram:IncludedSupplyChainTradeLineItem"`
+	Agreement  headerAgreement  `xml:"ram:ApplicableHeaderTradeAgreement"`
+	Delivery   struct{}         `xml:"ram:ApplicableHeaderTradeDelivery"`
+	Settlement headerSettlement `xml:"ram:ApplicableHeaderTradeSettlement"`
+}
+
+type lineItem struct {
+	Document   lineDocument   `xml:"ram:AssociatedDocumentLineDocument"`
+	Product    product        `xml:"ram:SpecifiedTradeProduct"`
+	Agreement  lineAgreement  `xml:"ram:SpecifiedLineTradeAgreement"`
+	Delivery   lineDelivery   `xml:"ram:SpecifiedLineTradeDelivery"`
+	Settlement lineSettlement `xml:"ram:SpecifiedLineTradeSettlement"`
+}
+
+type lineDocument struct {
+	LineID string `xml:"ram:LineID"`
+}
+
+type product struct {
+	Name string `xml:"ram:Name"`
+}
+
+type lineAgreement struct {
+	NetPrice tradePrice `xml:"ram:NetPriceProductTradePrice"`
+}
+
+type tradePrice struct {
+	ChargeAmount string `xml:"ram:ChargeAmount"`
+}
+
+type lineDelivery struct {
+	BilledQuantity quantity `xml:"ram:BilledQuantity"`
+}
+
+type quantity struct {
+	UnitCode string `xml:"unitCode,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type lineSettlement struct {
+	Tax       tradeTax      `xml:"ram:ApplicableTradeTax"`
+	Summation lineSummation `xml:"ram:SpecifiedTradeSettlementLineMonetarySummation"`
+}
+
+type lineSummation struct {
+	LineTotalAmount string `xml:"ram:LineTotalAmount"`
+}
+
+type tradeTax struct {
+	CalculatedAmount string `xml:"ram:CalculatedAmount,omitempty"`
+	TypeCode         string `xml:"ram:TypeCode"`
+	BasisAmount      string `xml:"ram:BasisAmount,omitempty"`
+	CategoryCode     string `xml:"ram:CategoryCode"`
+	RatePercent      string `xml:"ram:RateApplicablePercent"`
+}
+
+type headerAgreement struct {
+	Seller tradeParty `xml:"ram:SellerTradeParty"`
+	Buyer  tradeParty `xml:"ram:BuyerTradeParty"`
+}
+
+type tradeParty struct {
+	Name            string           `xml:"ram:Name"`
+	Address         *postalAddress   `xml:"ram:PostalTradeAddress,omitempty"`
+	Email           *emailAddress    `xml:"ram:URIUniversalCommunication,omitempty"`
+	TaxRegistration *taxRegistration `xml:"ram:SpecifiedTaxRegistration,omitempty"`
+}
+
+type postalAddress struct {
+	PostcodeCode           string `xml:"ram:PostcodeCode,omitempty"`
+	LineOne                string `xml:"ram:LineOne,omitempty"`
+	LineTwo                string `xml:"ram:LineTwo,omitempty"`
+	CityName               string `xml:"ram:CityName,omitempty"`
+	CountryID              string `xml:"ram:CountryID"`
+	CountrySubDivisionName string `xml:"ram:CountrySubDivisionName,omitempty"`
+}
+
+type taxRegistration struct {
+	ID uriID `xml:"ram:ID"`
+}
+
+type emailAddress struct {
+	URIID uriID `xml:"ram:URIID"`
+}
+
+type uriID struct {
+	SchemeID string `xml:"schemeID,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type headerSettlement struct {
+	Currency     string          `xml:"ram:InvoiceCurrencyCode"`
+	Tax          []tradeTax      `xml:"ram:ApplicableTradeTax"`
+	PaymentTerms *paymentTerms   `xml:"ram:SpecifiedTradePaymentTerms,omitempty"`
+	Summation    headerSummation `xml:"ram:SpecifiedTradeSettlementHeaderMonetarySummation"`
+}
+
+type paymentTerms struct {
+	DueDate *dateTime `xml:"ram:DueDateDateTime,omitempty"`
+}
+
+type headerSummation struct {
+	LineTotalAmount     string         `xml:"ram:LineTotalAmount"`
+	TaxBasisTotalAmount string         `xml:"ram:TaxBasisTotalAmount"`
+	TaxTotalAmount      currencyAmount `xml:"ram:TaxTotalAmount"`
+	GrandTotalAmount    string         `xml:"ram:GrandTotalAmount"`
+	DuePayableAmount    string         `xml:"ram:DuePayableAmount"`
+}
+
+type currencyAmount struct {
+	CurrencyID string `xml:"currencyID,attr"`
+	Value      string `xml:",chardata"`
+}
@@ -0,0 +1,140 @@
+package i18n
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-playground/locales"
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/id"
+)
+
+const (
+	DefaultLocale = "en"
+	catalogDir    = "templates/i18n"
+)
+
+// translators lists the supported locales and how they format dates and numbers.
+// Every locale here needs a matching catalog in templates/i18n.
+var translators = map[string]func() locales.Translator{
+	"en": en.New,
+	"id": id.New,
+}
+
+// Localizer translates document labels and formats dates and numbers for one locale
+type Localizer struct {
+	locale     string
+	messages   map[string]string
+	fallback   map[string]string
+	translator locales.Translator
+}
+
+// IsSupported reports whether a catalog exists for locale
+func IsSupported(locale string) bool {
+	_, ok := translators[Normalize(locale)]
+	return ok
+}
+
+// Normalize lowercases a locale and strips any region, e.g. "id-ID" becomes "id"
+func Normalize(locale string) string {
+	locale = strings.ToLower(strings.TrimSpace(locale))
+	if i := strings.IndexAny(locale, "-_"); i > 0 {
+		locale = locale[:i]
+	}
+
+	return locale
+}
+
+// Resolve returns the first supported locale from candidates, or DefaultLocale
+func Resolve(candidates ...string) string {
+	for _, candidate := range candidates {
+		if IsSupported(candidate) {
+			return Normalize(candidate)
+		}
+	}
+
+	return DefaultLocale
+}
+
+// NewLocalizer loads the catalog for locale, falling back to DefaultLocale for
+// unsupported locales and missing keys.
+func NewLocalizer(locale string) (*Localizer, error) {
+	locale = Resolve(locale)
+
+	fallback, err := loadCatalog(DefaultLocale)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := fallback
+	if locale != DefaultLocale {
+		messages, err = loadCatalog(locale)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &Localizer{
+		locale:     locale,
+		messages:   messages,
+		fallback:   fallback,
+		translator: translators[locale](),
+	}, nil
+}
+
+func loadCatalog(locale string) (map[string]string, error) {
+	content, err := os.ReadFile(filepath.Join(catalogDir, locale+".json"))
+	if err != nil {
+		return nil, err
+	}
+
+	messages := map[string]string{}
+	if err := json.Unmarshal(content, &messages); err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+func (l *Localizer) Locale() string {
+	return l.locale
+}
+
+// T returns the translated label for key
+func (l *Localizer) T(key string) string {
+	if message, ok := l.messages[key]; ok {
+		return message
+	}
+
+	if message, ok := l.fallback[key]; ok {
+		return message
+	}
+
+	return key
+}
+
+// Date formats t the way the locale writes full dates, e.g. "2 Januari 2006"
+func (l *Localizer) Date(t time.Time) string {
+	return l.translator.FmtDateLong(t)
+}
+
+// Number formats value with the locale's grouping and decimal separators
+func (l *Localizer) Number(value float64, digits uint64) string {
+	return l.translator.FmtNumber(value, digits)
+}
+
+// Messages returns the effective catalog, with fallback labels filled in
+func (l *Localizer) Messages() map[string]string {
+	messages := make(map[string]string, len(l.fallback))
+	for key, message := range l.fallback {
+		messages[key] = message
+	}
+	for key, message := range l.messages {
+		messages[key] = message
+	}
+
+	return messages
+}
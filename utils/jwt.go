@@ -1,36 +1,219 @@
 package utils
 
 import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
 	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/hutamy/invoice-generator-backend/config"
 )
 
-var secret = []byte(config.GetConfig().JwtSecret)
+const (
+	// TokenTypeAccess is the "typ" claim of access tokens. Refresh tokens are
+	// opaque and stored in the database, so they can never pass as a JWT.
+	TokenTypeAccess = "access"
+	// TokenTypeTwoFactorChallenge is issued after a correct password when the
+	// account has two-factor authentication enabled. It only unlocks the
+	// second sign-in step.
+	TokenTypeTwoFactorChallenge = "2fa_challenge"
+)
+
+// signingKey is a private key identified by its kid. The algorithm follows
+// from the key type: RS256 for RSA keys and EdDSA for Ed25519 keys.
+type signingKey struct {
+	kid    string
+	method jwt.SigningMethod
+	key    crypto.Signer
+}
+
+// JWK is a public key in JSON Web Key format
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKSet is the document served at /.well-known/jwks.json
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+var (
+	signingKeys map[string]signingKey
+	activeKey   signingKey
+	issuer      string
+	audience    string
+)
+
+// InitJWT loads the signing keys from cfg.JwtKeyDir, where every <kid>.pem file
+// holds one RSA or Ed25519 private key in PEM format. Tokens are signed with
+// cfg.JwtActiveKID and verified with any loaded key, so a new key can be
+// published first and activated later without invalidating issued tokens.
+// It must be called after config.LoadEnv.
+func InitJWT(cfg config.Config) error {
+	keys, err := loadSigningKeys(cfg.JwtKeyDir)
+	if err != nil {
+		return err
+	}
+
+	activeKID := cfg.JwtActiveKID
+	if activeKID == "" && len(keys) == 1 {
+		for kid := range keys {
+			activeKID = kid
+		}
+	}
+
+	active, ok := keys[activeKID]
+	if !ok {
+		return fmt.Errorf("JWT_ACTIVE_KID %q does not match any key in %s", activeKID, cfg.JwtKeyDir)
+	}
+
+	signingKeys = keys
+	activeKey = active
+	issuer = cfg.JwtIssuer
+	audience = cfg.JwtAudience
+	return nil
+}
+
+func loadSigningKeys(dir string) (map[string]signingKey, error) {
+	keys := map[string]signingKey{}
+	if dir == "" {
+		log.Println("JWT_KEY_DIR is not set, signing tokens with a temporary key; tokens will not survive a restart")
+		_, key, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			return nil, err
+		}
+
+		keys["ephemeral"] = signingKey{kid: "ephemeral", method: jwt.SigningMethodEdDSA, key: key}
+		return keys, nil
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range paths {
+		kid := strings.TrimSuffix(filepath.Base(path), ".pem")
+		key, err := readSigningKey(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load JWT key %s: %w", kid, err)
+		}
+
+		key.kid = kid
+		keys[kid] = key
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no *.pem keys found in %s", dir)
+	}
+
+	return keys, nil
+}
+
+func readSigningKey(path string) (signingKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return signingKey{}, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return signingKey{}, errors.New("no PEM block found")
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return signingKey{}, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return signingKey{}, err
+	}
+
+	switch key := parsed.(type) {
+	case *rsa.PrivateKey:
+		return signingKey{method: jwt.SigningMethodRS256, key: key}, nil
+	case ed25519.PrivateKey:
+		return signingKey{method: jwt.SigningMethodEdDSA, key: key}, nil
+	default:
+		return signingKey{}, fmt.Errorf("unsupported key type %T, expected RSA or Ed25519", parsed)
+	}
+}
+
+// GenerateJWT issues an access token for the session identified by sessionID
+func GenerateJWT(userID uint, sessionID string, duration time.Duration) (string, error) {
+	return generateToken(userID, TokenTypeAccess, duration, jwt.MapClaims{"sid": sessionID})
+}
+
+func GenerateChallengeJWT(userID uint, duration time.Duration) (string, error) {
+	return generateToken(userID, TokenTypeTwoFactorChallenge, duration, nil)
+}
+
+func generateToken(userID uint, tokenType string, duration time.Duration, extra jwt.MapClaims) (string, error) {
+	if activeKey.key == nil {
+		return "", errors.New("JWT keys are not initialized")
+	}
 
-func GenerateJWT(userID uint, duration time.Duration) (string, error) {
 	claims := jwt.MapClaims{
 		"user_id": userID,
+		"typ":     tokenType,
+		"iss":     issuer,
+		"aud":     audience,
 		"exp":     time.Now().Add(duration).Unix(),
 		"iat":     time.Now().Unix(), // Issued at
 	}
+	for name, value := range extra {
+		claims[name] = value
+	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(secret)
+	token := jwt.NewWithClaims(activeKey.method, claims)
+	token.Header["kid"] = activeKey.kid
+	return token.SignedString(activeKey.key)
 }
 
 func ParseJWT(tokenString string) (jwt.MapClaims, error) {
 	token, err := jwt.Parse(
 		tokenString,
 		func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			kid, _ := token.Header["kid"].(string)
+			key, ok := signingKeys[kid]
+			if !ok {
+				return nil, errors.New("unknown signing key")
+			}
+
+			if token.Method.Alg() != key.method.Alg() {
 				return nil, errors.New("unexpected signing method")
 			}
 
-			return secret, nil
+			return key.key.Public(), nil
 		},
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}),
+		jwt.WithIssuer(issuer),
+		jwt.WithAudience(audience),
+		jwt.WithExpirationRequired(),
 	)
 	if err != nil || !token.Valid {
 		return nil, err
@@ -38,3 +221,31 @@ func ParseJWT(tokenString string) (jwt.MapClaims, error) {
 
 	return token.Claims.(jwt.MapClaims), nil
 }
+
+// PublicJWKS returns the public part of every loaded signing key
+func PublicJWKS() JWKSet {
+	kids := make([]string, 0, len(signingKeys))
+	for kid := range signingKeys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	set := JWKSet{Keys: make([]JWK, 0, len(kids))}
+	for _, kid := range kids {
+		key := signingKeys[kid]
+		jwk := JWK{Kid: kid, Use: "sig", Alg: key.method.Alg()}
+		switch pub := key.key.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	return set
+}
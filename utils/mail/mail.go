@@ -0,0 +1,112 @@
+package mail
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	DriverSMTP = "smtp"
+	DriverFile = "file"
+	DriverLog  = "log"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers emails
+type Sender interface {
+	Send(msg Message) error
+}
+
+// Options configures the sender returned by New
+type Options struct {
+	Driver       string
+	From         string
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	Dir          string
+}
+
+// New returns the sender for opts.Driver
+func New(opts Options) (Sender, error) {
+	switch opts.Driver {
+	case DriverSMTP:
+		if opts.SMTPHost == "" {
+			return nil, fmt.Errorf("SMTP host is required for the smtp mail driver")
+		}
+		return NewSMTPSender(opts.SMTPHost, opts.SMTPPort, opts.SMTPUsername, opts.SMTPPassword, opts.From), nil
+	case DriverFile:
+		return NewFileSender(opts.Dir, opts.From)
+	case DriverLog, "":
+		return NewLogSender(opts.From), nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", opts.Driver)
+	}
+}
+
+// render formats msg as an RFC 5322 message
+func render(from string, msg Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+type logSender struct {
+	from string
+}
+
+// NewLogSender writes every email to the application log
+func NewLogSender(from string) Sender {
+	return &logSender{from: from}
+}
+
+func (s *logSender) Send(msg Message) error {
+	log.Printf("mail to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+type fileSender struct {
+	dir  string
+	from string
+}
+
+// NewFileSender stores every email as an .eml file in dir, which is handy for
+// local development and manual testing.
+func NewFileSender(dir, from string) (Sender, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &fileSender{dir: dir, from: from}, nil
+}
+
+func (s *fileSender) Send(msg Message) error {
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102T150405.000000000"), sanitize(msg.To))
+	return os.WriteFile(filepath.Join(s.dir, name), render(s.from, msg), 0o644)
+}
+
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '@' || r == '.' || r == '-' || r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, s)
+}
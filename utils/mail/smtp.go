@@ -0,0 +1,49 @@
+package mail
+
+import (
+	"fmt"
+	"net/smtp"
+	"strings"
+)
+
+type smtpSender struct {
+	addr string
+	host string
+	auth smtp.Auth
+	from string
+}
+
+// NewSMTPSender sends emails through an SMTP server, using STARTTLS when the
+// server offers it. Authentication is skipped when username is empty.
+func NewSMTPSender(host string, port int, username, password, from string) Sender {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return &smtpSender{
+		addr: fmt.Sprintf("%s:%d", host, port),
+		host: host,
+		auth: auth,
+		from: from,
+	}
+}
+
+func (s *smtpSender) Send(msg Message) error {
+	if strings.ContainsAny(msg.To, "\r\n") || strings.ContainsAny(msg.Subject, "\r\n") {
+		return fmt.Errorf("invalid mail header")
+	}
+
+	return smtp.SendMail(s.addr, s.auth, envelopeAddress(s.from), []string{msg.To}, render(s.from, msg))
+}
+
+// envelopeAddress extracts the bare address from a "Name <address>" header value
+func envelopeAddress(from string) string {
+	if start := strings.LastIndex(from, "<"); start >= 0 {
+		if end := strings.LastIndex(from, ">"); end > start {
+			return from[start+1 : end]
+		}
+	}
+
+	return from
+}
@@ -0,0 +1,296 @@
+// Package oidc implements the relying party side of the OpenID Connect
+// authorization code flow with PKCE.
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Options configures a Provider
+type Options struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string // empty for public clients
+	RedirectURL  string
+	Scopes       []string // defaults to openid, email and profile
+	HTTPClient   *http.Client
+}
+
+// Claims are the identity claims taken from a verified ID token
+type Claims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// Provider talks to one OpenID provider. Its discovery document and signing
+// keys are fetched on first use and cached.
+type Provider struct {
+	opts Options
+
+	mu        sync.Mutex
+	discovery *discovery
+	keys      map[string]interface{}
+}
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type tokenResponse struct {
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// New returns a provider. No network request is made until it is used.
+func New(opts Options) *Provider {
+	if len(opts.Scopes) == 0 {
+		opts.Scopes = []string{"openid", "email", "profile"}
+	}
+
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return &Provider{opts: opts}
+}
+
+// Name returns the configured provider name
+func (p *Provider) Name() string {
+	return p.opts.Name
+}
+
+// AuthCodeURL returns the URL to send the user to. The verifier is kept
+// server side and presented again in Exchange.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	doc, err := p.getDiscovery(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.opts.ClientID},
+		"redirect_uri":          {p.opts.RedirectURL},
+		"scope":                 {strings.Join(p.opts.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {S256Challenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(doc.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+
+	return doc.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange redeems an authorization code and returns the claims of the
+// verified ID token. nonce must match the one passed to AuthCodeURL.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (*Claims, error) {
+	doc, err := p.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.opts.RedirectURL},
+		"client_id":     {p.opts.ClientID},
+		"code_verifier": {verifier},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, doc.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.opts.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.opts.ClientID), url.QueryEscape(p.opts.ClientSecret))
+	}
+
+	var token tokenResponse
+	status, err := p.do(req, &token)
+	if err != nil {
+		return nil, err
+	}
+
+	if status != http.StatusOK || token.IDToken == "" {
+		if token.Error != "" {
+			return nil, fmt.Errorf("oidc: token request failed: %s", strings.TrimSpace(token.Error+" "+token.ErrorDescription))
+		}
+
+		return nil, fmt.Errorf("oidc: token request failed with status %d", status)
+	}
+
+	return p.verify(ctx, doc, token.IDToken, nonce)
+}
+
+func (p *Provider) verify(ctx context.Context, doc *discovery, idToken, nonce string) (*Claims, error) {
+	parsed, err := jwt.Parse(
+		idToken,
+		func(token *jwt.Token) (interface{}, error) {
+			kid, _ := token.Header["kid"].(string)
+			return p.publicKey(ctx, doc, kid)
+		},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}),
+		jwt.WithIssuer(doc.Issuer),
+		jwt.WithAudience(p.opts.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: invalid ID token: %w", err)
+	}
+
+	claims := parsed.Claims.(jwt.MapClaims)
+	if got, _ := claims["nonce"].(string); got == "" || got != nonce {
+		return nil, fmt.Errorf("oidc: ID token nonce does not match")
+	}
+
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return nil, fmt.Errorf("oidc: ID token has no subject")
+	}
+
+	result := &Claims{Subject: subject}
+	result.Email, _ = claims["email"].(string)
+	result.Name, _ = claims["name"].(string)
+	// Some providers send email_verified as a string
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		result.EmailVerified = verified
+	case string:
+		result.EmailVerified = verified == "true"
+	}
+
+	return result, nil
+}
+
+func (p *Provider) getDiscovery(ctx context.Context) (*discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(p.opts.Issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc discovery
+	status, err := p.do(req, &doc)
+	if err != nil {
+		return nil, err
+	}
+
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("oidc: discovery failed with status %d", status)
+	}
+
+	if doc.Issuer != p.opts.Issuer {
+		return nil, fmt.Errorf("oidc: discovery issuer %q does not match %q", doc.Issuer, p.opts.Issuer)
+	}
+
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return nil, fmt.Errorf("oidc: discovery document is incomplete")
+	}
+
+	p.discovery = &doc
+	return p.discovery, nil
+}
+
+// publicKey returns the signing key with the given kid. The key set is fetched
+// again when the kid is unknown, which picks up key rotations at the provider.
+func (p *Provider) publicKey(ctx context.Context, doc *discovery, kid string) (interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, doc.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var set jwkSet
+	status, err := p.do(req, &set)
+	if err != nil {
+		return nil, err
+	}
+
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("oidc: fetching keys failed with status %d", status)
+	}
+
+	p.keys = set.publicKeys()
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("oidc: unknown signing key %q", kid)
+}
+
+// lookupKey finds a key by kid. A token without kid is accepted when the
+// provider publishes exactly one key.
+func (p *Provider) lookupKey(kid string) (interface{}, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+func (p *Provider) do(req *http.Request, out interface{}) (int, error) {
+	res, err := p.opts.HTTPClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("oidc: %w", err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return 0, fmt.Errorf("oidc: %w", err)
+	}
+
+	if err := json.Unmarshal(body, out); err != nil && res.StatusCode == http.StatusOK {
+		return 0, fmt.Errorf("oidc: invalid response from %s: %w", req.URL.Host, err)
+	}
+
+	return res.StatusCode, nil
+}
+
+// S256Challenge derives the PKCE code challenge from a code verifier
+func S256Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,215 @@
+package oidc_test
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/hutamy/invoice-generator-backend/utils/oidc"
+	"github.com/hutamy/invoice-generator-backend/utils/oidc/oidctest"
+)
+
+const (
+	testClientID    = "invoice-app"
+	testRedirectURL = "https://app.example.com/auth/callback"
+)
+
+var testIdentity = oidctest.Identity{
+	Subject:       "user-1",
+	Email:         "jane@example.com",
+	EmailVerified: true,
+	Name:          "Jane Doe",
+}
+
+func newProvider(t *testing.T) (*oidctest.Provider, *oidc.Provider) {
+	t.Helper()
+	mock := oidctest.NewProvider(testClientID)
+	t.Cleanup(mock.Close)
+
+	return mock, oidc.New(oidc.Options{
+		Name:        "mock",
+		Issuer:      mock.Issuer(),
+		ClientID:    testClientID,
+		RedirectURL: testRedirectURL,
+	})
+}
+
+// login runs the authorization code flow up to the redirect back to the client
+func login(t *testing.T, mock *oidctest.Provider, provider *oidc.Provider, state, nonce, verifier string) string {
+	t.Helper()
+	authURL, err := provider.AuthCodeURL(context.Background(), state, nonce, verifier)
+	if err != nil {
+		t.Fatalf("AuthCodeURL() error = %v", err)
+	}
+
+	code, gotState, err := mock.Login(authURL, testIdentity)
+	if err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+
+	if gotState != state {
+		t.Fatalf("state = %q, want %q", gotState, state)
+	}
+
+	return code
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	mock, provider := newProvider(t)
+	authURL, err := provider.AuthCodeURL(context.Background(), "state-1", "nonce-1", "verifier-1")
+	if err != nil {
+		t.Fatalf("AuthCodeURL() error = %v", err)
+	}
+
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("invalid URL %q: %v", authURL, err)
+	}
+
+	if got := parsed.Scheme + "://" + parsed.Host + parsed.Path; got != mock.Issuer()+"/authorize" {
+		t.Errorf("endpoint = %q, want the provider's authorization endpoint", got)
+	}
+
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             testClientID,
+		"redirect_uri":          testRedirectURL,
+		"scope":                 "openid email profile",
+		"state":                 "state-1",
+		"nonce":                 "nonce-1",
+		"code_challenge":        oidc.S256Challenge("verifier-1"),
+		"code_challenge_method": "S256",
+	}
+	for name, value := range want {
+		if got := parsed.Query().Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+
+	if parsed.Query().Get("code_challenge") == "verifier-1" {
+		t.Error("the code verifier must not be sent to the provider")
+	}
+}
+
+func TestS256Challenge(t *testing.T) {
+	// Example from RFC 7636, appendix B
+	got := oidc.S256Challenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk")
+	if want := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"; got != want {
+		t.Fatalf("S256Challenge() = %q, want %q", got, want)
+	}
+}
+
+func TestExchange(t *testing.T) {
+	mock, provider := newProvider(t)
+	code := login(t, mock, provider, "state", "nonce", "verifier")
+
+	claims, err := provider.Exchange(context.Background(), code, "verifier", "nonce")
+	if err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+
+	want := oidc.Claims{Subject: "user-1", Email: "jane@example.com", EmailVerified: true, Name: "Jane Doe"}
+	if *claims != want {
+		t.Fatalf("Exchange() = %+v, want %+v", *claims, want)
+	}
+}
+
+func TestExchangeRejectsInvalidLogins(t *testing.T) {
+	tests := []struct {
+		name     string
+		verifier string
+		nonce    string
+		claims   func(claims jwt.MapClaims)
+		want     string
+	}{
+		{name: "wrong PKCE verifier", verifier: "other-verifier", want: "PKCE verification failed"},
+		{name: "nonce mismatch", nonce: "other-nonce", want: "nonce does not match"},
+		{name: "missing nonce", claims: func(c jwt.MapClaims) { delete(c, "nonce") }, want: "nonce does not match"},
+		{name: "other issuer", claims: func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }, want: "issuer"},
+		{name: "other audience", claims: func(c jwt.MapClaims) { c["aud"] = "another-app" }, want: "audience"},
+		{name: "expired", claims: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, want: "expired"},
+		{name: "no expiry", claims: func(c jwt.MapClaims) { delete(c, "exp") }, want: "exp"},
+		{name: "no subject", claims: func(c jwt.MapClaims) { c["sub"] = "" }, want: "no subject"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, provider := newProvider(t)
+			mock.Claims = tt.claims
+			code := login(t, mock, provider, "state", "nonce", "verifier")
+
+			verifier, nonce := "verifier", "nonce"
+			if tt.verifier != "" {
+				verifier = tt.verifier
+			}
+			if tt.nonce != "" {
+				nonce = tt.nonce
+			}
+
+			_, err := provider.Exchange(context.Background(), code, verifier, nonce)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Exchange() error = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestExchangeRedeemsCodeOnce(t *testing.T) {
+	mock, provider := newProvider(t)
+	code := login(t, mock, provider, "state", "nonce", "verifier")
+
+	if _, err := provider.Exchange(context.Background(), code, "verifier", "nonce"); err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+
+	if _, err := provider.Exchange(context.Background(), code, "verifier", "nonce"); err == nil {
+		t.Fatal("Exchange() accepted a code twice")
+	}
+}
+
+func TestExchangeAcceptsStringEmailVerified(t *testing.T) {
+	mock, provider := newProvider(t)
+	mock.Claims = func(c jwt.MapClaims) { c["email_verified"] = "true" }
+	code := login(t, mock, provider, "state", "nonce", "verifier")
+
+	claims, err := provider.Exchange(context.Background(), code, "verifier", "nonce")
+	if err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+
+	if !claims.EmailVerified {
+		t.Fatal("EmailVerified = false, want true")
+	}
+}
+
+func TestExchangeFollowsKeyRotation(t *testing.T) {
+	mock, provider := newProvider(t)
+	code := login(t, mock, provider, "state", "nonce", "verifier")
+	if _, err := provider.Exchange(context.Background(), code, "verifier", "nonce"); err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+
+	mock.RotateKey()
+	code = login(t, mock, provider, "state", "nonce", "verifier")
+	if _, err := provider.Exchange(context.Background(), code, "verifier", "nonce"); err != nil {
+		t.Fatalf("Exchange() after key rotation error = %v", err)
+	}
+}
+
+func TestDiscoveryRejectsIssuerMismatch(t *testing.T) {
+	mock, _ := newProvider(t)
+	provider := oidc.New(oidc.Options{
+		Name:        "mock",
+		Issuer:      mock.Issuer() + "/",
+		ClientID:    testClientID,
+		RedirectURL: testRedirectURL,
+	})
+
+	_, err := provider.AuthCodeURL(context.Background(), "state", "nonce", "verifier")
+	if err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Fatalf("AuthCodeURL() error = %v, want an issuer mismatch", err)
+	}
+}
@@ -0,0 +1,213 @@
+// Package oidctest provides an OpenID provider for tests. It serves the
+// discovery document, the signing keys and a token endpoint that checks PKCE,
+// and lets tests sign in a user without a browser.
+package oidctest
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Identity is the account a user signs in with at the provider
+type Identity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// Provider is an OpenID provider running on an httptest.Server
+type Provider struct {
+	Server   *httptest.Server
+	ClientID string
+
+	// Claims, when set, may change the ID token claims before they are signed
+	Claims func(claims jwt.MapClaims)
+
+	mu     sync.Mutex
+	kid    string
+	key    ed25519.PrivateKey
+	grants map[string]grant
+	serial int
+}
+
+// grant is an authorization code waiting to be redeemed
+type grant struct {
+	identity    Identity
+	redirectURI string
+	challenge   string
+	nonce       string
+}
+
+// NewProvider starts a provider that issues ID tokens for clientID
+func NewProvider(clientID string) *Provider {
+	p := &Provider{ClientID: clientID, grants: map[string]grant{}}
+	p.RotateKey()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("/jwks", p.jwks)
+	mux.HandleFunc("/token", p.token)
+	p.Server = httptest.NewServer(mux)
+
+	return p
+}
+
+// Issuer returns the issuer URL of the provider
+func (p *Provider) Issuer() string {
+	return p.Server.URL
+}
+
+func (p *Provider) Close() {
+	p.Server.Close()
+}
+
+// RotateKey replaces the signing key with a new one under a new kid
+func (p *Provider) RotateKey() {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.serial++
+	p.kid = fmt.Sprintf("key-%d", p.serial)
+	p.key = key
+}
+
+// Login signs identity in at the authorization URL the client built and
+// returns the code and state the provider redirects back with.
+func (p *Provider) Login(authURL string, identity Identity) (code, state string, err error) {
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		return "", "", err
+	}
+
+	query := parsed.Query()
+	switch {
+	case query.Get("response_type") != "code":
+		return "", "", fmt.Errorf("unsupported response_type %q", query.Get("response_type"))
+	case query.Get("client_id") != p.ClientID:
+		return "", "", fmt.Errorf("unknown client_id %q", query.Get("client_id"))
+	case query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "":
+		return "", "", fmt.Errorf("missing S256 code challenge")
+	}
+
+	code = base64.RawURLEncoding.EncodeToString(randomBytes())
+	p.mu.Lock()
+	p.grants[code] = grant{
+		identity:    identity,
+		redirectURI: query.Get("redirect_uri"),
+		challenge:   query.Get("code_challenge"),
+		nonce:       query.Get("nonce"),
+	}
+	p.mu.Unlock()
+
+	return code, query.Get("state"), nil
+}
+
+func (p *Provider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 p.Issuer(),
+		"authorization_endpoint": p.Issuer() + "/authorize",
+		"token_endpoint":         p.Issuer() + "/token",
+		"jwks_uri":               p.Issuer() + "/jwks",
+	})
+}
+
+func (p *Provider) jwks(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "OKP",
+			"crv": "Ed25519",
+			"use": "sig",
+			"kid": p.kid,
+			"x":   base64.RawURLEncoding.EncodeToString(p.key.Public().(ed25519.PublicKey)),
+		}},
+	})
+}
+
+// token redeems a code once, checking the client, the redirect URI and the
+// PKCE verifier the way a provider does
+func (p *Provider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	p.mu.Lock()
+	g, ok := p.grants[r.PostForm.Get("code")]
+	delete(p.grants, r.PostForm.Get("code"))
+	p.mu.Unlock()
+
+	verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	switch {
+	case !ok:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "unknown code"})
+		return
+	case r.PostForm.Get("client_id") != p.ClientID || r.PostForm.Get("redirect_uri") != g.redirectURI:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "client mismatch"})
+		return
+	case base64.RawURLEncoding.EncodeToString(verifier[:]) != g.challenge:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            p.Issuer(),
+		"aud":            p.ClientID,
+		"sub":            g.identity.Subject,
+		"email":          g.identity.Email,
+		"email_verified": g.identity.EmailVerified,
+		"name":           g.identity.Name,
+		"nonce":          g.nonce,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+	}
+	if p.Claims != nil {
+		p.Claims(claims)
+	}
+
+	p.mu.Lock()
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = p.kid
+	idToken, err := token.SignedString(p.key)
+	p.mu.Unlock()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"id_token": idToken, "token_type": "Bearer"})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func randomBytes() []byte {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+
+	return buf
+}
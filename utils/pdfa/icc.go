@@ -0,0 +1,119 @@
+package pdfa
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+)
+
+const outputConditionSRGB = "sRGB IEC61966-2.1"
+
+// srgbProfile builds a minimal ICC v2 display profile for sRGB, used as the
+// PDF/A output intent. The primaries are the D50-adapted sRGB values and the
+// tone curve is approximated with a 2.2 gamma.
+func srgbProfile() []byte {
+	type tag struct {
+		signature string
+		data      []byte
+	}
+
+	trc := curveTag(2.2)
+	tags := []tag{
+		{"desc", textDescriptionTag(outputConditionSRGB)},
+		{"cprt", textTag("No copyright, use freely")},
+		{"wtpt", xyzTag(0.9642, 1.0, 0.8249)},
+		{"rXYZ", xyzTag(0.4361, 0.2225, 0.0139)},
+		{"gXYZ", xyzTag(0.3851, 0.7169, 0.0971)},
+		{"bXYZ", xyzTag(0.1431, 0.0606, 0.7141)},
+		{"rTRC", trc},
+		{"gTRC", trc},
+		{"bTRC", trc},
+	}
+
+	const headerSize = 128
+	tableSize := 4 + 12*len(tags)
+
+	var table, body bytes.Buffer
+	binary.Write(&table, binary.BigEndian, uint32(len(tags)))
+
+	// Tags with identical data share one element, as the spec allows
+	offsets := map[string]int{}
+	for _, t := range tags {
+		offset, ok := offsets[string(t.data)]
+		if !ok {
+			offset = headerSize + tableSize + body.Len()
+			offsets[string(t.data)] = offset
+			body.Write(t.data)
+			for body.Len()%4 != 0 {
+				body.WriteByte(0)
+			}
+		}
+
+		table.WriteString(t.signature)
+		binary.Write(&table, binary.BigEndian, uint32(offset))
+		binary.Write(&table, binary.BigEndian, uint32(len(t.data)))
+	}
+
+	size := headerSize + table.Len() + body.Len()
+
+	header := make([]byte, headerSize)
+	binary.BigEndian.PutUint32(header[0:], uint32(size))
+	binary.BigEndian.PutUint32(header[8:], 0x02100000) // version 2.1
+	copy(header[12:], "mntr")
+	copy(header[16:], "RGB ")
+	copy(header[20:], "XYZ ")
+	binary.BigEndian.PutUint16(header[24:], 2024)
+	binary.BigEndian.PutUint16(header[26:], 1)
+	binary.BigEndian.PutUint16(header[28:], 1)
+	copy(header[36:], "acsp")
+	copy(header[68:], xyzNumber(0.9642, 1.0, 0.8249))
+
+	var profile bytes.Buffer
+	profile.Write(header)
+	profile.Write(table.Bytes())
+	profile.Write(body.Bytes())
+	return profile.Bytes()
+}
+
+func s15Fixed16(v float64) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, uint32(int32(math.Round(v*65536))))
+	return b
+}
+
+func xyzNumber(x, y, z float64) []byte {
+	var b []byte
+	b = append(b, s15Fixed16(x)...)
+	b = append(b, s15Fixed16(y)...)
+	b = append(b, s15Fixed16(z)...)
+	return b
+}
+
+func xyzTag(x, y, z float64) []byte {
+	b := []byte("XYZ \x00\x00\x00\x00")
+	return append(b, xyzNumber(x, y, z)...)
+}
+
+func curveTag(gamma float64) []byte {
+	b := []byte("curv\x00\x00\x00\x00")
+	b = binary.BigEndian.AppendUint32(b, 1)
+	return binary.BigEndian.AppendUint16(b, uint16(math.Round(gamma*256)))
+}
+
+func textTag(text string) []byte {
+	b := []byte("text\x00\x00\x00\x00")
+	b = append(b, text...)
+	return append(b, 0)
+}
+
+func textDescriptionTag(text string) []byte {
+	b := []byte("desc\x00\x00\x00\x00")
+	b = binary.BigEndian.AppendUint32(b, uint32(len(text)+1))
+	b = append(b, text...)
+	b = append(b, 0)
+	b = binary.BigEndian.AppendUint32(b, 0) // Unicode language code
+	b = binary.BigEndian.AppendUint32(b, 0) // Unicode count
+	b = binary.BigEndian.AppendUint16(b, 0) // ScriptCode code
+	b = append(b, 0)                        // ScriptCode count
+	return append(b, make([]byte, 67)...)
+}
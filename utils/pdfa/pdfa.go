@@ -0,0 +1,182 @@
+package pdfa
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/hutamy/invoice-generator-backend/utils/pdfdoc"
+)
+
+const producer = "Invoice Generator"
+
+// Attachment is a file embedded into the PDF/A-3 document
+type Attachment struct {
+	Name         string
+	Description  string
+	MimeType     string
+	Relationship string // AFRelationship, e.g. Alternative, Data or Source
+	Data         []byte
+}
+
+// Options describes the document metadata written to the Info dictionary and XMP packet
+type Options struct {
+	Title      string
+	Author     string
+	CreatedAt  time.Time
+	ModifiedAt time.Time
+	Attachment *Attachment
+	// ExtensionXMP is inserted into the XMP packet as additional rdf:Description
+	// elements, e.g. the Factur-X extension schema.
+	ExtensionXMP string
+}
+
+// Convert turns a PDF into a PDF/A-3b candidate by appending an incremental
+// update with an XMP metadata stream, an sRGB output intent, a matching Info
+// dictionary, a document ID and the optional associated file.
+//
+// The source PDF must already embed its fonts, which is the case for
+// documents printed by Chrome.
+func Convert(pdf []byte, opts Options) ([]byte, error) {
+	if opts.CreatedAt.IsZero() {
+		opts.CreatedAt = time.Now()
+	}
+
+	if opts.ModifiedAt.IsZero() {
+		opts.ModifiedAt = opts.CreatedAt
+	}
+
+	update, err := pdfdoc.NewUpdate(pdf)
+	if err != nil {
+		return nil, err
+	}
+
+	rootNum, err := update.RootNum()
+	if err != nil {
+		return nil, err
+	}
+
+	catalog, err := pdfdoc.ReadObject(pdf, rootNum)
+	if err != nil {
+		return nil, err
+	}
+
+	metadataNum := update.Alloc()
+	update.WriteStream(metadataNum, "/Type /Metadata /Subtype /XML", []byte(xmpPacket(opts)))
+
+	iccNum := update.Alloc()
+	update.WriteStream(iccNum, "/N 3", srgbProfile())
+
+	outputIntentNum := update.Alloc()
+	update.WriteObject(outputIntentNum, fmt.Sprintf(
+		"<< /Type /OutputIntent /S /GTS_PDFA1 /OutputConditionIdentifier %s /Info %s /DestOutputProfile %d 0 R >>",
+		pdfdoc.String(outputConditionSRGB), pdfdoc.String(outputConditionSRGB), iccNum,
+	))
+
+	infoNum := update.Alloc()
+	update.WriteObject(infoNum, fmt.Sprintf(
+		"<< /Title %s /Author %s /Creator %s /Producer %s /CreationDate %s /ModDate %s >>",
+		pdfdoc.String(opts.Title), pdfdoc.String(opts.Author), pdfdoc.String(producer), pdfdoc.String(producer),
+		pdfdoc.Date(opts.CreatedAt), pdfdoc.Date(opts.ModifiedAt),
+	))
+
+	newCatalog := catalog.Without("/AF").
+		Set("/Metadata", fmt.Sprintf("%d 0 R", metadataNum)).
+		Set("/OutputIntents", fmt.Sprintf("[%d 0 R]", outputIntentNum))
+
+	if opts.Attachment != nil {
+		a := opts.Attachment
+		fileNum := update.Alloc()
+		update.WriteStream(fileNum, fmt.Sprintf(
+			"/Type /EmbeddedFile /Subtype %s /Params << /Size %d /ModDate %s >>",
+			pdfdoc.Name(a.MimeType), len(a.Data), pdfdoc.Date(opts.ModifiedAt),
+		), a.Data)
+
+		specNum := update.Alloc()
+		update.WriteObject(specNum, fmt.Sprintf(
+			"<< /Type /Filespec /F %s /UF %s /Desc %s /AFRelationship /%s /EF << /F %d 0 R /UF %d 0 R >> >>",
+			pdfdoc.String(a.Name), pdfdoc.String(a.Name), pdfdoc.String(a.Description), a.Relationship, fileNum, fileNum,
+		))
+
+		names, err := embedFileName(pdf, catalog, a.Name, specNum)
+		if err != nil {
+			return nil, err
+		}
+
+		newCatalog = newCatalog.
+			Set("/Names", names.String()).
+			Set("/AF", fmt.Sprintf("[%d 0 R]", specNum))
+	}
+
+	update.WriteObject(rootNum, newCatalog.String())
+
+	sum := md5.Sum(pdf)
+	id := hex.EncodeToString(sum[:])
+	return update.Finish(pdfdoc.Dict{
+		{Key: "/Info", Value: fmt.Sprintf("%d 0 R", infoNum)},
+		{Key: "/ID", Value: fmt.Sprintf("[<%s> <%s>]", id, id)},
+	}), nil
+}
+
+// embedFileName returns the catalog /Names dictionary with the attachment
+// registered in its EmbeddedFiles name tree, keeping any other name trees.
+func embedFileName(pdf []byte, catalog pdfdoc.Dict, name string, specNum int) (pdfdoc.Dict, error) {
+	var names pdfdoc.Dict
+	if value, ok := catalog.Get("/Names"); ok {
+		if num, isRef := pdfdoc.ParseRef(value); isRef {
+			existing, err := pdfdoc.ReadObject(pdf, num)
+			if err != nil {
+				return nil, err
+			}
+			names = existing
+		} else {
+			existing, _, err := pdfdoc.ParseDict([]byte(value), 0)
+			if err != nil {
+				return nil, err
+			}
+			names = existing
+		}
+	}
+
+	tree := fmt.Sprintf("<< /Names [%s %d 0 R] >>", pdfdoc.String(name), specNum)
+	return names.Set("/EmbeddedFiles", tree), nil
+}
+
+func xmpPacket(opts Options) string {
+	var b strings.Builder
+	b.WriteString("<?xpacket begin=\"\xEF\xBB\xBF\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	b.WriteString(`<x:xmpmeta xmlns:x="adobe:ns:meta/">` + "\n")
+	b.WriteString(`<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">` + "\n")
+	fmt.Fprintf(&b, `<rdf:Description rdf:about="" xmlns:pdfaid="http://www.aiim.org/pdfa/ns/id/">
+<pdfaid:part>3</pdfaid:part>
+<pdfaid:conformance>B</pdfaid:conformance>
+</rdf:Description>
+<rdf:Description rdf:about="" xmlns:dc="http://purl.org/dc/elements/1.1/">
+<dc:format>application/pdf</dc:format>
+<dc:title><rdf:Alt><rdf:li xml:lang="x-default">%s</rdf:li></rdf:Alt></dc:title>
+<dc:creator><rdf:Seq><rdf:li>%s</rdf:li></rdf:Seq></dc:creator>
+</rdf:Description>
+<rdf:Description rdf:about="" xmlns:pdf="http://ns.adobe.com/pdf/1.3/">
+<pdf:Producer>%s</pdf:Producer>
+</rdf:Description>
+<rdf:Description rdf:about="" xmlns:xmp="http://ns.adobe.com/xap/1.0/">
+<xmp:CreatorTool>%s</xmp:CreatorTool>
+<xmp:CreateDate>%s</xmp:CreateDate>
+<xmp:ModifyDate>%s</xmp:ModifyDate>
+</rdf:Description>
+`,
+		html.EscapeString(opts.Title), html.EscapeString(opts.Author), producer, producer,
+		xmpDate(opts.CreatedAt), xmpDate(opts.ModifiedAt),
+	)
+	b.WriteString(opts.ExtensionXMP)
+	b.WriteString("</rdf:RDF>\n</x:xmpmeta>\n")
+	b.WriteString(`<?xpacket end="w"?>`)
+	return b.String()
+}
+
+func xmpDate(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05+00:00")
+}
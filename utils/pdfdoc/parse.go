@@ -0,0 +1,403 @@
+package pdfdoc
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// This file holds just enough of a PDF parser to locate the trailer and the
+// objects that need to be rewritten in an incremental update. Objects inside
+// object streams are not supported, which is fine for documents printed by
+// Chrome.
+
+var (
+	startXrefPattern = regexp.MustCompile(`startxref\s+(\d+)\s+%%EOF\s*$`)
+	refPattern       = regexp.MustCompile(`^(\d+)\s+(\d+)\s+R$`)
+)
+
+type Entry struct {
+	Key   string
+	Value string
+}
+
+// Dict is a parsed dictionary whose values are kept as raw PDF syntax
+type Dict []Entry
+
+func (d Dict) Get(key string) (string, bool) {
+	for _, entry := range d {
+		if entry.Key == key {
+			return entry.Value, true
+		}
+	}
+
+	return "", false
+}
+
+// Set replaces the value of key, appending it when missing
+func (d Dict) Set(key, value string) Dict {
+	for i, entry := range d {
+		if entry.Key == key {
+			out := append(Dict{}, d...)
+			out[i].Value = value
+			return out
+		}
+	}
+
+	return append(append(Dict{}, d...), Entry{Key: key, Value: value})
+}
+
+func (d Dict) Without(keys ...string) Dict {
+	var out Dict
+	for _, entry := range d {
+		keep := true
+		for _, key := range keys {
+			if entry.Key == key {
+				keep = false
+				break
+			}
+		}
+
+		if keep {
+			out = append(out, entry)
+		}
+	}
+
+	return out
+}
+
+func (d Dict) String() string {
+	var buf bytes.Buffer
+	buf.WriteString("<<")
+	for _, entry := range d {
+		buf.WriteString(" ")
+		buf.WriteString(entry.Key)
+		buf.WriteString(" ")
+		buf.WriteString(entry.Value)
+	}
+	buf.WriteString(" >>")
+	return buf.String()
+}
+
+// ParseRef returns the object number of an indirect reference such as "12 0 R"
+func ParseRef(value string) (int, bool) {
+	match := refPattern.FindStringSubmatch(value)
+	if match == nil {
+		return 0, false
+	}
+
+	num, err := strconv.Atoi(match[1])
+	if err != nil {
+		return 0, false
+	}
+
+	return num, true
+}
+
+// LastStartXref returns the offset of the most recent cross-reference section
+func LastStartXref(data []byte) (int, error) {
+	match := startXrefPattern.FindSubmatch(data)
+	if match == nil {
+		return 0, fmt.Errorf("pdf: startxref not found")
+	}
+
+	offset, err := strconv.Atoi(string(match[1]))
+	if err != nil || offset <= 0 || offset >= len(data) {
+		return 0, fmt.Errorf("pdf: invalid startxref offset")
+	}
+
+	return offset, nil
+}
+
+// ReadTrailer parses the trailer dictionary of the section at offset. Both
+// classic xref tables and xref streams are supported.
+func ReadTrailer(data []byte, offset int) (Dict, error) {
+	if bytes.HasPrefix(data[offset:], []byte("xref")) {
+		idx := bytes.Index(data[offset:], []byte("trailer"))
+		if idx < 0 {
+			return nil, fmt.Errorf("pdf: trailer not found")
+		}
+
+		trailer, _, err := ParseDict(data, offset+idx+len("trailer"))
+		return trailer, err
+	}
+
+	trailer, _, err := parseObjectDict(data, offset)
+	return trailer, err
+}
+
+// ReadObject finds the latest definition of object num and parses its dictionary
+func ReadObject(data []byte, num int) (Dict, error) {
+	start, err := findObject(data, num)
+	if err != nil {
+		return nil, err
+	}
+
+	d, _, err := parseObjectDict(data, start)
+	return d, err
+}
+
+// ReadObjectValue returns the raw value of object num, e.g. an array
+func ReadObjectValue(data []byte, num int) (string, error) {
+	start, err := findObject(data, num)
+	if err != nil {
+		return "", err
+	}
+
+	idx := bytes.Index(data[start:], []byte("obj"))
+	valueStart := skipSpace(data, start+idx+len("obj"))
+	valueEnd, err := skipValue(data, valueStart)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data[valueStart:valueEnd]), nil
+}
+
+func findObject(data []byte, num int) (int, error) {
+	pattern := regexp.MustCompile(fmt.Sprintf(`(?:^|[^0-9])%d\s+\d+\s+obj\b`, num))
+	matches := pattern.FindAllIndex(data, -1)
+	if len(matches) == 0 {
+		return 0, fmt.Errorf("pdf: object %d not found (object streams are not supported)", num)
+	}
+
+	start := matches[len(matches)-1][0]
+	if data[start] < '0' || data[start] > '9' {
+		start++
+	}
+
+	return start, nil
+}
+
+func parseObjectDict(data []byte, pos int) (Dict, int, error) {
+	idx := bytes.Index(data[pos:], []byte("obj"))
+	if idx < 0 {
+		return nil, pos, fmt.Errorf("pdf: malformed object at offset %d", pos)
+	}
+
+	return ParseDict(data, pos+idx+len("obj"))
+}
+
+// ParseDict parses the dictionary starting at pos and returns it together with
+// the offset just past its closing delimiter.
+func ParseDict(data []byte, pos int) (Dict, int, error) {
+	pos = skipSpace(data, pos)
+	if !bytes.HasPrefix(data[pos:], []byte("<<")) {
+		return nil, pos, fmt.Errorf("pdf: expected dictionary at offset %d", pos)
+	}
+	pos += 2
+
+	var d Dict
+	for {
+		pos = skipSpace(data, pos)
+		if pos >= len(data) {
+			return nil, pos, fmt.Errorf("pdf: unterminated dictionary")
+		}
+
+		if bytes.HasPrefix(data[pos:], []byte(">>")) {
+			return d, pos + 2, nil
+		}
+
+		if data[pos] != '/' {
+			return nil, pos, fmt.Errorf("pdf: expected name at offset %d", pos)
+		}
+
+		keyEnd := skipName(data, pos)
+		key := string(data[pos:keyEnd])
+
+		valueStart := skipSpace(data, keyEnd)
+		valueEnd, err := skipValue(data, valueStart)
+		if err != nil {
+			return nil, pos, err
+		}
+
+		d = append(d, Entry{Key: key, Value: string(data[valueStart:valueEnd])})
+		pos = valueEnd
+	}
+}
+
+// ArrayItems splits a raw array value into its raw elements
+func ArrayItems(value string) ([]string, error) {
+	data := []byte(value)
+	pos := skipSpace(data, 0)
+	if pos >= len(data) || data[pos] != '[' {
+		return nil, fmt.Errorf("pdf: expected array")
+	}
+	pos++
+
+	var items []string
+	for {
+		pos = skipSpace(data, pos)
+		if pos >= len(data) {
+			return nil, fmt.Errorf("pdf: unterminated array")
+		}
+
+		if data[pos] == ']' {
+			return items, nil
+		}
+
+		end, err := skipValue(data, pos)
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, string(data[pos:end]))
+		pos = end
+	}
+}
+
+// skipValue returns the offset just past the value at pos. Indirect references
+// are treated as a single value.
+func skipValue(data []byte, pos int) (int, error) {
+	end, err := skipToken(data, pos)
+	if err != nil {
+		return pos, err
+	}
+
+	if refEnd, ok := skipRefTail(data, end); ok && isInteger(data[pos:end]) {
+		return refEnd, nil
+	}
+
+	return end, nil
+}
+
+func skipRefTail(data []byte, pos int) (int, bool) {
+	next := skipSpace(data, pos)
+	genEnd := next
+	for genEnd < len(data) && data[genEnd] >= '0' && data[genEnd] <= '9' {
+		genEnd++
+	}
+
+	if genEnd == next {
+		return pos, false
+	}
+
+	r := skipSpace(data, genEnd)
+	if r < len(data) && data[r] == 'R' && (r+1 == len(data) || isDelimiter(data[r+1]) || isSpace(data[r+1])) {
+		return r + 1, true
+	}
+
+	return pos, false
+}
+
+func skipToken(data []byte, pos int) (int, error) {
+	if pos >= len(data) {
+		return pos, fmt.Errorf("pdf: unexpected end of data")
+	}
+
+	switch {
+	case bytes.HasPrefix(data[pos:], []byte("<<")):
+		_, end, err := ParseDict(data, pos)
+		return end, err
+	case data[pos] == '<':
+		end := bytes.IndexByte(data[pos:], '>')
+		if end < 0 {
+			return pos, fmt.Errorf("pdf: unterminated hex string")
+		}
+		return pos + end + 1, nil
+	case data[pos] == '(':
+		return skipLiteralString(data, pos)
+	case data[pos] == '[':
+		pos++
+		for {
+			pos = skipSpace(data, pos)
+			if pos >= len(data) {
+				return pos, fmt.Errorf("pdf: unterminated array")
+			}
+
+			if data[pos] == ']' {
+				return pos + 1, nil
+			}
+
+			end, err := skipValue(data, pos)
+			if err != nil {
+				return pos, err
+			}
+			pos = end
+		}
+	case data[pos] == '/':
+		return skipName(data, pos), nil
+	default:
+		end := pos
+		for end < len(data) && !isSpace(data[end]) && !isDelimiter(data[end]) {
+			end++
+		}
+
+		if end == pos {
+			return pos, fmt.Errorf("pdf: unexpected %q at offset %d", data[pos], pos)
+		}
+		return end, nil
+	}
+}
+
+func skipLiteralString(data []byte, pos int) (int, error) {
+	depth := 0
+	for i := pos; i < len(data); i++ {
+		switch data[i] {
+		case '\\':
+			i++
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i + 1, nil
+			}
+		}
+	}
+
+	return pos, fmt.Errorf("pdf: unterminated string")
+}
+
+func skipName(data []byte, pos int) int {
+	end := pos + 1
+	for end < len(data) && !isSpace(data[end]) && !isDelimiter(data[end]) {
+		end++
+	}
+
+	return end
+}
+
+func skipSpace(data []byte, pos int) int {
+	for pos < len(data) {
+		if isSpace(data[pos]) {
+			pos++
+			continue
+		}
+
+		// Comments run to the end of the line
+		if data[pos] == '%' {
+			for pos < len(data) && data[pos] != '\n' && data[pos] != '\r' {
+				pos++
+			}
+			continue
+		}
+
+		break
+	}
+
+	return pos
+}
+
+func isInteger(b []byte) bool {
+	if len(b) == 0 {
+		return false
+	}
+
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\n' || b == '\r' || b == '\t' || b == '\f' || b == 0
+}
+
+func isDelimiter(b byte) bool {
+	return bytes.IndexByte([]byte("()<>[]{}/%"), b) >= 0
+}
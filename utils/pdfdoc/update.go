@@ -0,0 +1,172 @@
+package pdfdoc
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// Update appends an incremental update to an existing PDF. New and rewritten
+// objects are written in order and a cross-reference section chaining to the
+// previous one is added by Finish.
+type Update struct {
+	buf        *bytes.Buffer
+	offsets    map[int]int
+	trailer    Dict
+	prevOffset int
+	nextNum    int
+}
+
+// NewUpdate reads the current trailer of pdf and prepares an update on top of it
+func NewUpdate(pdf []byte) (*Update, error) {
+	xrefOffset, err := LastStartXref(pdf)
+	if err != nil {
+		return nil, err
+	}
+
+	trailer, err := ReadTrailer(pdf, xrefOffset)
+	if err != nil {
+		return nil, err
+	}
+
+	sizeValue, _ := trailer.Get("/Size")
+	var size int
+	if _, err := fmt.Sscan(sizeValue, &size); err != nil || size <= 0 {
+		return nil, fmt.Errorf("pdf: trailer has no valid /Size")
+	}
+
+	buf := bytes.NewBuffer(append([]byte{}, pdf...))
+	if !bytes.HasSuffix(pdf, []byte("\n")) {
+		buf.WriteString("\n")
+	}
+
+	return &Update{
+		buf:        buf,
+		offsets:    map[int]int{},
+		trailer:    trailer,
+		prevOffset: xrefOffset,
+		nextNum:    size,
+	}, nil
+}
+
+// Trailer returns the trailer of the document being updated
+func (u *Update) Trailer() Dict {
+	return u.trailer
+}
+
+// RootNum returns the object number of the document catalog
+func (u *Update) RootNum() (int, error) {
+	value, _ := u.trailer.Get("/Root")
+	num, ok := ParseRef(value)
+	if !ok {
+		return 0, fmt.Errorf("pdf: trailer has no /Root reference")
+	}
+
+	return num, nil
+}
+
+// Alloc reserves a new object number
+func (u *Update) Alloc() int {
+	u.nextNum++
+	return u.nextNum - 1
+}
+
+// Len returns the current size of the document including the update so far
+func (u *Update) Len() int {
+	return u.buf.Len()
+}
+
+func (u *Update) WriteObject(num int, body string) {
+	u.offsets[num] = u.buf.Len()
+	fmt.Fprintf(u.buf, "%d 0 obj\n%s\nendobj\n", num, body)
+}
+
+func (u *Update) WriteStream(num int, entries string, data []byte) {
+	u.offsets[num] = u.buf.Len()
+	fmt.Fprintf(u.buf, "%d 0 obj\n<< %s /Length %d >>\nstream\n", num, entries, len(data))
+	u.buf.Write(data)
+	u.buf.WriteString("\nendstream\nendobj\n")
+}
+
+// Finish writes the cross-reference section and trailer. Entries in
+// trailerEntries replace the ones inherited from the previous trailer.
+func (u *Update) Finish(trailerEntries Dict) []byte {
+	nums := make([]int, 0, len(u.offsets))
+	for num := range u.offsets {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+
+	xrefOffset := u.buf.Len()
+	u.buf.WriteString("xref\n")
+	for i := 0; i < len(nums); {
+		j := i
+		for j+1 < len(nums) && nums[j+1] == nums[j]+1 {
+			j++
+		}
+
+		fmt.Fprintf(u.buf, "%d %d\n", nums[i], j-i+1)
+		for _, num := range nums[i : j+1] {
+			fmt.Fprintf(u.buf, "%010d 00000 n \n", u.offsets[num])
+		}
+		i = j + 1
+	}
+
+	trailer := u.trailer.Without("/Prev", "/XRefStm", "/Type", "/W", "/Index", "/Filter", "/DecodeParms", "/Length")
+	for _, entry := range trailerEntries {
+		trailer = trailer.Set(entry.Key, entry.Value)
+	}
+	trailer = trailer.Set("/Size", fmt.Sprint(u.nextNum))
+	trailer = trailer.Set("/Prev", fmt.Sprint(u.prevOffset))
+
+	fmt.Fprintf(u.buf, "trailer\n%s\nstartxref\n%d\n%%%%EOF\n", trailer.String(), xrefOffset)
+	return u.buf.Bytes()
+}
+
+// String encodes s as a PDF text string, using UTF-16BE for non-ASCII text
+func String(s string) string {
+	ascii := true
+	for _, r := range s {
+		if r > 126 || r < 32 {
+			ascii = false
+			break
+		}
+	}
+
+	if ascii {
+		replacer := strings.NewReplacer(`\`, `\\`, `(`, `\(`, `)`, `\)`)
+		return "(" + replacer.Replace(s) + ")"
+	}
+
+	buf := []byte{0xFE, 0xFF}
+	for _, unit := range utf16.Encode([]rune(s)) {
+		buf = append(buf, byte(unit>>8), byte(unit))
+	}
+
+	return "<" + hex.EncodeToString(buf) + ">"
+}
+
+// Name encodes s as a PDF name, escaping delimiters such as the slash in MIME types
+func Name(s string) string {
+	var b strings.Builder
+	b.WriteString("/")
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 33 || c > 126 || isDelimiter(c) || c == '#' {
+			fmt.Fprintf(&b, "#%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+
+	return b.String()
+}
+
+// Date formats t as a PDF date string in UTC
+func Date(t time.Time) string {
+	return "(D:" + t.UTC().Format("20060102150405") + "+00'00')"
+}
@@ -0,0 +1,320 @@
+package pdfsign
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"sort"
+)
+
+// CMS (RFC 5652) SignedData structures for detached CAdES signatures, as
+// required by the ETSI.CAdES.detached PDF signature subfilter.
+
+var (
+	oidData                = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidAttrContentType     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidAttrMessageDigest   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidAttrSigningCertV2   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47}
+	oidSHA256              = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384              = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512              = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+	oidRSAEncryption       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidSHA256WithRSA       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidECDSAWithSHA256     = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidECDSAWithSHA384     = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+	oidECDSAWithSHA512     = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}
+	oidSHA384WithRSA       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}
+	oidSHA512WithRSA       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}
+	asn1Null               = asn1.RawValue{Tag: asn1.TagNull}
+	digestAlgorithmSHA256  = pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1Null}
+	hashByDigestAlgorithm  = map[string]crypto.Hash{oidSHA256.String(): crypto.SHA256, oidSHA384.String(): crypto.SHA384, oidSHA512.String(): crypto.SHA512}
+	errUnsupportedKeyType  = fmt.Errorf("pdfsign: only RSA and ECDSA keys are supported")
+	errMalformedSignedData = fmt.Errorf("pdfsign: malformed CMS signature")
+)
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapContentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+type encapContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+}
+
+type issuerAndSerial struct {
+	Issuer       asn1.RawValue
+	SerialNumber asn1.RawValue
+}
+
+type signerInfo struct {
+	Version            int
+	SID                issuerAndSerial
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue `asn1:"set"`
+}
+
+type essCertIDv2 struct {
+	CertHash []byte
+}
+
+type signingCertificateV2 struct {
+	Certs []essCertIDv2
+}
+
+// buildSignedData creates a detached CMS signature over a document digest
+// computed with SHA-256.
+func buildSignedData(digest []byte, signer Signer) ([]byte, error) {
+	signatureAlgorithm, err := signatureAlgorithmFor(signer.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	certHash := sha256.Sum256(signer.Certificate.Raw)
+	attrs, err := marshalAttributes(
+		attributeValue{oidAttrContentType, oidData},
+		attributeValue{oidAttrMessageDigest, digest},
+		attributeValue{oidAttrSigningCertV2, signingCertificateV2{Certs: []essCertIDv2{{CertHash: certHash[:]}}}},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// The signature covers the DER encoding of the attributes as a SET
+	attrsHash := sha256.Sum256(attrs)
+	signature, err := signer.Key.Sign(rand.Reader, attrsHash[:], crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+
+	var certs []byte
+	certs = append(certs, signer.Certificate.Raw...)
+	for _, cert := range signer.Chain {
+		if !bytes.Equal(cert.Raw, signer.Certificate.Raw) {
+			certs = append(certs, cert.Raw...)
+		}
+	}
+
+	// In SignerInfo the attributes are [0] IMPLICIT instead of a SET
+	signedAttrs := asn1.RawValue{FullBytes: append([]byte{0xA0}, attrs[1:]...)}
+
+	sd := signedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{digestAlgorithmSHA256},
+		EncapContentInfo: encapContentInfo{ContentType: oidData},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: certs},
+		SignerInfos: []signerInfo{{
+			Version: 1,
+			SID: issuerAndSerial{
+				Issuer:       asn1.RawValue{FullBytes: signer.Certificate.RawIssuer},
+				SerialNumber: mustMarshalRaw(signer.Certificate.SerialNumber),
+			},
+			DigestAlgorithm:    digestAlgorithmSHA256,
+			SignedAttrs:        signedAttrs,
+			SignatureAlgorithm: signatureAlgorithm,
+			Signature:          signature,
+		}},
+	}
+
+	content, err := asn1.Marshal(sd)
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: content},
+	})
+}
+
+type attributeValue struct {
+	oid   asn1.ObjectIdentifier
+	value interface{}
+}
+
+// marshalAttributes encodes attributes as a DER SET, which must be sorted by
+// the encoding of its elements.
+func marshalAttributes(values ...attributeValue) ([]byte, error) {
+	var encoded [][]byte
+	for _, v := range values {
+		value, err := asn1.Marshal(v.value)
+		if err != nil {
+			return nil, err
+		}
+
+		attr, err := asn1.Marshal(attribute{
+			Type:   v.oid,
+			Values: asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: value},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		encoded = append(encoded, attr)
+	}
+
+	sort.Slice(encoded, func(i, j int) bool {
+		return bytes.Compare(encoded[i], encoded[j]) < 0
+	})
+
+	return asn1.Marshal(asn1.RawValue{
+		Class:      asn1.ClassUniversal,
+		Tag:        asn1.TagSet,
+		IsCompound: true,
+		Bytes:      bytes.Join(encoded, nil),
+	})
+}
+
+func signatureAlgorithmFor(key crypto.Signer) (pkix.AlgorithmIdentifier, error) {
+	switch key.Public().(type) {
+	case *rsa.PublicKey:
+		return pkix.AlgorithmIdentifier{Algorithm: oidRSAEncryption, Parameters: asn1Null}, nil
+	case *ecdsa.PublicKey:
+		return pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA256}, nil
+	default:
+		return pkix.AlgorithmIdentifier{}, errUnsupportedKeyType
+	}
+}
+
+func mustMarshalRaw(v interface{}) asn1.RawValue {
+	der, err := asn1.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+
+	return asn1.RawValue{FullBytes: der}
+}
+
+// parsedSignature is the verified content of a CMS signature
+type parsedSignature struct {
+	signer *x509.Certificate
+}
+
+// verifySignedData checks that the CMS signature in der is valid for content
+// and returns the signing certificate.
+func verifySignedData(der, content []byte) (*parsedSignature, error) {
+	var ci contentInfo
+	if _, err := asn1.Unmarshal(der, &ci); err != nil || !ci.ContentType.Equal(oidSignedData) {
+		return nil, errMalformedSignedData
+	}
+
+	var sd signedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, errMalformedSignedData
+	}
+
+	if len(sd.SignerInfos) != 1 {
+		return nil, fmt.Errorf("pdfsign: expected exactly one signer, found %d", len(sd.SignerInfos))
+	}
+
+	certs, err := x509.ParseCertificates(sd.Certificates.Bytes)
+	if err != nil {
+		return nil, errMalformedSignedData
+	}
+
+	si := sd.SignerInfos[0]
+	var signer *x509.Certificate
+	for _, cert := range certs {
+		if bytes.Equal(cert.RawIssuer, si.SID.Issuer.FullBytes) && bytes.Equal(mustMarshalRaw(cert.SerialNumber).FullBytes, si.SID.SerialNumber.FullBytes) {
+			signer = cert
+			break
+		}
+	}
+
+	if signer == nil {
+		return nil, fmt.Errorf("pdfsign: signer certificate is not embedded in the signature")
+	}
+
+	hash, ok := hashByDigestAlgorithm[si.DigestAlgorithm.Algorithm.String()]
+	if !ok {
+		return nil, fmt.Errorf("pdfsign: unsupported digest algorithm %s", si.DigestAlgorithm.Algorithm)
+	}
+
+	if len(si.SignedAttrs.FullBytes) == 0 {
+		return nil, fmt.Errorf("pdfsign: signature has no signed attributes")
+	}
+
+	// Re-tag the [0] IMPLICIT attributes as a SET, which is what was signed
+	attrs := append([]byte{0x31}, si.SignedAttrs.FullBytes[1:]...)
+	var parsedAttrs []attribute
+	if _, err := asn1.UnmarshalWithParams(attrs, &parsedAttrs, "set"); err != nil {
+		return nil, errMalformedSignedData
+	}
+
+	var messageDigest []byte
+	for _, attr := range parsedAttrs {
+		if attr.Type.Equal(oidAttrMessageDigest) {
+			if _, err := asn1.Unmarshal(attr.Values.Bytes, &messageDigest); err != nil {
+				return nil, errMalformedSignedData
+			}
+		}
+	}
+
+	h := hash.New()
+	h.Write(content)
+	if !bytes.Equal(messageDigest, h.Sum(nil)) {
+		return nil, fmt.Errorf("pdfsign: document digest does not match, the file was modified after signing")
+	}
+
+	algorithm, err := x509SignatureAlgorithm(si.SignatureAlgorithm.Algorithm, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := signer.CheckSignature(algorithm, attrs, si.Signature); err != nil {
+		return nil, fmt.Errorf("pdfsign: invalid signature: %w", err)
+	}
+
+	return &parsedSignature{signer: signer}, nil
+}
+
+func x509SignatureAlgorithm(oid asn1.ObjectIdentifier, hash crypto.Hash) (x509.SignatureAlgorithm, error) {
+	switch {
+	case oid.Equal(oidRSAEncryption):
+		switch hash {
+		case crypto.SHA256:
+			return x509.SHA256WithRSA, nil
+		case crypto.SHA384:
+			return x509.SHA384WithRSA, nil
+		case crypto.SHA512:
+			return x509.SHA512WithRSA, nil
+		}
+	case oid.Equal(oidSHA256WithRSA):
+		return x509.SHA256WithRSA, nil
+	case oid.Equal(oidSHA384WithRSA):
+		return x509.SHA384WithRSA, nil
+	case oid.Equal(oidSHA512WithRSA):
+		return x509.SHA512WithRSA, nil
+	case oid.Equal(oidECDSAWithSHA256):
+		return x509.ECDSAWithSHA256, nil
+	case oid.Equal(oidECDSAWithSHA384):
+		return x509.ECDSAWithSHA384, nil
+	case oid.Equal(oidECDSAWithSHA512):
+		return x509.ECDSAWithSHA512, nil
+	}
+
+	return x509.UnknownSignatureAlgorithm, fmt.Errorf("pdfsign: unsupported signature algorithm %s", oid)
+}
@@ -0,0 +1,208 @@
+package pdfsign
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hutamy/invoice-generator-backend/utils/pdfdoc"
+)
+
+const (
+	// signatureSize is the space reserved for the CMS signature in bytes
+	signatureSize = 16384
+	// byteRangeWidth is the space reserved for each number in /ByteRange
+	byteRangeWidth = 10
+)
+
+// Signer holds the certificate and key used to sign documents
+type Signer struct {
+	Certificate *x509.Certificate
+	Chain       []*x509.Certificate
+	Key         crypto.Signer
+	Name        string
+	Reason      string
+	SignedAt    time.Time
+}
+
+// Sign appends an invisible PAdES (ETSI.CAdES.detached) signature to pdf in
+// an incremental update, leaving the original bytes untouched.
+func Sign(pdf []byte, signer Signer) ([]byte, error) {
+	if signer.Certificate == nil || signer.Key == nil {
+		return nil, fmt.Errorf("pdfsign: signer has no certificate or key")
+	}
+
+	if _, err := signatureAlgorithmFor(signer.Key); err != nil {
+		return nil, err
+	}
+
+	if signer.SignedAt.IsZero() {
+		signer.SignedAt = time.Now()
+	}
+
+	update, err := pdfdoc.NewUpdate(pdf)
+	if err != nil {
+		return nil, err
+	}
+
+	rootNum, err := update.RootNum()
+	if err != nil {
+		return nil, err
+	}
+
+	catalog, err := pdfdoc.ReadObject(pdf, rootNum)
+	if err != nil {
+		return nil, err
+	}
+
+	pageNum, page, err := firstPage(pdf, catalog)
+	if err != nil {
+		return nil, err
+	}
+
+	sigNum := update.Alloc()
+	fieldNum := update.Alloc()
+
+	sigOffset := update.Len()
+	placeholderRange := strings.Repeat("0", byteRangeWidth)
+	update.WriteObject(sigNum, fmt.Sprintf(
+		"<< /Type /Sig /Filter /Adobe.PPKLite /SubFilter /ETSI.CAdES.detached /ByteRange [0 %s %s %s] /Contents <%s> /M %s /Name %s /Reason %s >>",
+		placeholderRange, placeholderRange, placeholderRange,
+		strings.Repeat("0", signatureSize*2),
+		pdfdoc.Date(signer.SignedAt), pdfdoc.String(signer.Name), pdfdoc.String(signer.Reason),
+	))
+
+	update.WriteObject(fieldNum, fmt.Sprintf(
+		"<< /Type /Annot /Subtype /Widget /FT /Sig /T %s /V %d 0 R /F 132 /Rect [0 0 0 0] /P %d 0 R >>",
+		pdfdoc.String(fmt.Sprintf("Signature%d", fieldNum)), sigNum, pageNum,
+	))
+
+	annots, err := resolveArray(pdf, page, "/Annots")
+	if err != nil {
+		return nil, err
+	}
+	annots = append(annots, fmt.Sprintf("%d 0 R", fieldNum))
+	update.WriteObject(pageNum, page.Set("/Annots", "["+strings.Join(annots, " ")+"]").String())
+
+	acroForm, err := resolveDict(pdf, catalog, "/AcroForm")
+	if err != nil {
+		return nil, err
+	}
+
+	fields, err := resolveArray(pdf, acroForm, "/Fields")
+	if err != nil {
+		return nil, err
+	}
+	fields = append(fields, fmt.Sprintf("%d 0 R", fieldNum))
+	acroForm = acroForm.Set("/Fields", "["+strings.Join(fields, " ")+"]").Set("/SigFlags", "3")
+	update.WriteObject(rootNum, catalog.Set("/AcroForm", acroForm.String()).String())
+
+	out := update.Finish(nil)
+	return fillSignature(out, sigOffset, signer)
+}
+
+// fillSignature computes the byte range around the reserved /Contents
+// placeholder, signs those bytes and writes the signature into the placeholder.
+func fillSignature(out []byte, sigOffset int, signer Signer) ([]byte, error) {
+	contentsKey := bytes.Index(out[sigOffset:], []byte("/Contents <"))
+	rangeKey := bytes.Index(out[sigOffset:], []byte("/ByteRange ["))
+	if contentsKey < 0 || rangeKey < 0 {
+		return nil, fmt.Errorf("pdfsign: signature placeholder not found")
+	}
+
+	contentsStart := sigOffset + contentsKey + len("/Contents ")
+	contentsEnd := contentsStart + signatureSize*2 + 2
+	byteRange := [4]int{0, contentsStart, contentsEnd, len(out) - contentsEnd}
+
+	rangeStart := sigOffset + rangeKey + len("/ByteRange [")
+	rangeEnd := rangeStart + bytes.IndexByte(out[rangeStart:], ']')
+	rangeValue := fmt.Sprintf("%d %d %d %d", byteRange[0], byteRange[1], byteRange[2], byteRange[3])
+	if len(rangeValue) > rangeEnd-rangeStart {
+		return nil, fmt.Errorf("pdfsign: document too large to sign")
+	}
+	copy(out[rangeStart:rangeEnd], rangeValue+strings.Repeat(" ", rangeEnd-rangeStart-len(rangeValue)))
+
+	h := sha256.New()
+	h.Write(out[byteRange[0]:byteRange[1]])
+	h.Write(out[byteRange[2] : byteRange[2]+byteRange[3]])
+
+	signature, err := buildSignedData(h.Sum(nil), signer)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(signature) > signatureSize {
+		return nil, fmt.Errorf("pdfsign: signature is larger than the reserved %d bytes", signatureSize)
+	}
+
+	copy(out[contentsStart+1:], hex.EncodeToString(signature))
+	return out, nil
+}
+
+func firstPage(pdf []byte, catalog pdfdoc.Dict) (int, pdfdoc.Dict, error) {
+	value, _ := catalog.Get("/Pages")
+	for depth := 0; depth < 32; depth++ {
+		num, ok := pdfdoc.ParseRef(value)
+		if !ok {
+			return 0, nil, fmt.Errorf("pdfsign: invalid page tree")
+		}
+
+		node, err := pdfdoc.ReadObject(pdf, num)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		nodeType, _ := node.Get("/Type")
+		if nodeType == "/Page" {
+			return num, node, nil
+		}
+
+		kids, err := resolveArray(pdf, node, "/Kids")
+		if err != nil || len(kids) == 0 {
+			return 0, nil, fmt.Errorf("pdfsign: document has no pages")
+		}
+		value = kids[0]
+	}
+
+	return 0, nil, fmt.Errorf("pdfsign: page tree too deep")
+}
+
+// resolveArray returns the items of an array entry that may be stored inline
+// or as an indirect object. A missing entry yields an empty array.
+func resolveArray(pdf []byte, d pdfdoc.Dict, key string) ([]string, error) {
+	value, ok := d.Get(key)
+	if !ok {
+		return nil, nil
+	}
+
+	if num, isRef := pdfdoc.ParseRef(value); isRef {
+		resolved, err := pdfdoc.ReadObjectValue(pdf, num)
+		if err != nil {
+			return nil, err
+		}
+		value = resolved
+	}
+
+	return pdfdoc.ArrayItems(value)
+}
+
+// resolveDict returns a dictionary entry that may be stored inline or as an
+// indirect object. A missing entry yields an empty dictionary.
+func resolveDict(pdf []byte, d pdfdoc.Dict, key string) (pdfdoc.Dict, error) {
+	value, ok := d.Get(key)
+	if !ok {
+		return pdfdoc.Dict{}, nil
+	}
+
+	if num, isRef := pdfdoc.ParseRef(value); isRef {
+		return pdfdoc.ReadObject(pdf, num)
+	}
+
+	parsed, _, err := pdfdoc.ParseDict([]byte(value), 0)
+	return parsed, err
+}
@@ -0,0 +1,61 @@
+package pdfsign
+
+import (
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+var byteRangePattern = regexp.MustCompile(`/ByteRange\s*\[\s*(\d+)\s+(\d+)\s+(\d+)\s+(\d+)\s*\]`)
+
+// Verification is the result of checking the last signature of a document
+type Verification struct {
+	Signer *x509.Certificate
+	// CoversWholeDocument is false when content was appended after signing
+	CoversWholeDocument bool
+}
+
+// Verify checks the most recent signature in pdf. It returns an error when the
+// document is unsigned, malformed or the signature does not match its content.
+func Verify(pdf []byte) (*Verification, error) {
+	matches := byteRangePattern.FindAllSubmatch(pdf, -1)
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("pdfsign: document is not signed")
+	}
+
+	var byteRange [4]int
+	for i := range byteRange {
+		value, err := strconv.Atoi(string(matches[len(matches)-1][i+1]))
+		if err != nil {
+			return nil, fmt.Errorf("pdfsign: invalid byte range")
+		}
+		byteRange[i] = value
+	}
+
+	start1, len1, start2, len2 := byteRange[0], byteRange[1], byteRange[2], byteRange[3]
+	if start1 != 0 || len1 <= 0 || start2 <= len1+1 || start2+len2 > len(pdf) ||
+		pdf[len1] != '<' || pdf[start2-1] != '>' {
+		return nil, fmt.Errorf("pdfsign: invalid byte range")
+	}
+
+	signature, err := hex.DecodeString(string(pdf[len1+1 : start2-1]))
+	if err != nil {
+		return nil, fmt.Errorf("pdfsign: invalid signature contents")
+	}
+
+	content := make([]byte, 0, len1+len2)
+	content = append(content, pdf[start1:start1+len1]...)
+	content = append(content, pdf[start2:start2+len2]...)
+
+	parsed, err := verifySignedData(signature, content)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Verification{
+		Signer:              parsed.signer,
+		CoversWholeDocument: start2+len2 == len(pdf),
+	}, nil
+}
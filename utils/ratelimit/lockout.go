@@ -0,0 +1,60 @@
+package ratelimit
+
+import (
+	"time"
+)
+
+// Lockout locks an account after repeated failures. Every failure past the
+// threshold doubles the lock duration, up to MaxDuration.
+type Lockout struct {
+	Store Store
+	// Threshold is the number of failures within FailureWindow before locking
+	Threshold     int
+	FailureWindow time.Duration
+	BaseDuration  time.Duration
+	MaxDuration   time.Duration
+}
+
+// Check returns a *LimitError while key is locked
+func (l *Lockout) Check(key string) error {
+	lock, err := l.Store.Get("lock:" + key)
+	if err != nil {
+		return err
+	}
+
+	if lock.Count > 0 {
+		return &LimitError{RetryAfter: time.Until(lock.ExpiresAt)}
+	}
+
+	return nil
+}
+
+// Fail records a failed attempt and locks key once the threshold is reached
+func (l *Lockout) Fail(key string) error {
+	failures, err := l.Store.Increment("fail:"+key, l.FailureWindow)
+	if err != nil {
+		return err
+	}
+
+	if failures.Count < l.Threshold {
+		return nil
+	}
+
+	duration := l.BaseDuration
+	for i := l.Threshold; i < failures.Count && duration < l.MaxDuration; i++ {
+		duration *= 2
+	}
+	duration = min(duration, l.MaxDuration)
+
+	if err := l.Store.Reset("lock:" + key); err != nil {
+		return err
+	}
+
+	_, err = l.Store.Increment("lock:"+key, duration)
+	return err
+}
+
+// Succeed clears the failures of key
+func (l *Lockout) Succeed(key string) error {
+	return l.Store.Reset("fail:" + key)
+}
@@ -0,0 +1,71 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often expired counters are dropped from memory
+const sweepInterval = time.Minute
+
+type memoryStore struct {
+	mu        sync.Mutex
+	counters  map[string]Counter
+	lastSweep time.Time
+}
+
+// NewMemoryStore keeps counters in process memory. Limits are enforced per
+// replica; use the Postgres store when running several instances.
+func NewMemoryStore() Store {
+	return &memoryStore{counters: map[string]Counter{}, lastSweep: time.Now()}
+}
+
+func (s *memoryStore) Increment(key string, window time.Duration) (Counter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+
+	counter, ok := s.counters[key]
+	if !ok || !now.Before(counter.ExpiresAt) {
+		counter = Counter{ExpiresAt: now.Add(window)}
+	}
+
+	counter.Count++
+	s.counters[key] = counter
+	return counter, nil
+}
+
+func (s *memoryStore) Get(key string) (Counter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counter, ok := s.counters[key]
+	if !ok || !time.Now().Before(counter.ExpiresAt) {
+		return Counter{}, nil
+	}
+
+	return counter, nil
+}
+
+func (s *memoryStore) Reset(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.counters, key)
+	return nil
+}
+
+func (s *memoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+
+	for key, counter := range s.counters {
+		if !now.Before(counter.ExpiresAt) {
+			delete(s.counters, key)
+		}
+	}
+	s.lastSweep = now
+}
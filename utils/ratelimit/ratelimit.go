@@ -0,0 +1,78 @@
+package ratelimit
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hutamy/invoice-generator-backend/utils/errors"
+)
+
+const (
+	StoreMemory   = "memory"
+	StorePostgres = "postgres"
+)
+
+// Counter is the state of a fixed window counter
+type Counter struct {
+	Count     int
+	ExpiresAt time.Time
+}
+
+// Store keeps fixed window counters. Implementations must be safe for
+// concurrent use; the Postgres store lets several replicas share counters.
+type Store interface {
+	// Increment adds one to key, starting a new window of the given length
+	// when the current one has expired.
+	Increment(key string, window time.Duration) (Counter, error)
+	// Get returns the current counter, or a zero Counter when it expired.
+	Get(key string) (Counter, error)
+	Reset(key string) error
+}
+
+// Rule allows Limit requests per Window
+type Rule struct {
+	Limit  int
+	Window time.Duration
+}
+
+// Result describes the outcome of Allow
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration
+}
+
+// LimitError is returned when a caller is throttled or locked out. It matches
+// errors.ErrTooManyRequests with errors.Is.
+type LimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s, retry in %s", errors.ErrTooManyRequests.Error(), e.RetryAfter.Round(time.Second))
+}
+
+func (e *LimitError) Is(target error) bool {
+	return target == errors.ErrTooManyRequests
+}
+
+// Allow counts a request for key against rule
+func Allow(store Store, key string, rule Rule) (Result, error) {
+	counter, err := store.Increment(key, rule.Window)
+	if err != nil {
+		return Result{}, err
+	}
+
+	result := Result{
+		Allowed:   counter.Count <= rule.Limit,
+		Limit:     rule.Limit,
+		Remaining: max(rule.Limit-counter.Count, 0),
+	}
+
+	if !result.Allowed {
+		result.RetryAfter = time.Until(counter.ExpiresAt)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,97 @@
+// Package rbac declares what each organization role may do. Routes name the
+// permission they need and middleware.Authorize checks it against the role of
+// the caller in the current organization.
+package rbac
+
+import (
+	"github.com/hutamy/invoice-generator-backend/models"
+)
+
+type Permission string
+
+const (
+	OrganizationRead   Permission = "organization:read"
+	OrganizationUpdate Permission = "organization:update"
+	MembersManage      Permission = "members:manage"
+	// OwnersManage covers inviting, appointing, demoting and removing owners
+	OwnersManage Permission = "owners:manage"
+	// SigningCertificateManage covers uploading and removing the certificate
+	// invoice PDFs are signed with in the organization's name
+	SigningCertificateManage Permission = "signing_certificate:manage"
+	// SenderProfilesManage covers creating and changing the sender profiles
+	// invoices are issued from
+	SenderProfilesManage Permission = "sender_profiles:manage"
+	// PaymentDetailsReveal covers reading the full account numbers, IBANs and
+	// wallet IDs of payment methods, which every other response masks
+	PaymentDetailsReveal Permission = "payment_details:reveal"
+
+	ClientsRead   Permission = "clients:read"
+	ClientsWrite  Permission = "clients:write"
+	ClientsDelete Permission = "clients:delete"
+
+	InvoicesRead   Permission = "invoices:read"
+	InvoicesCreate Permission = "invoices:create"
+	// InvoicesEdit covers changing the details and items of an invoice
+	InvoicesEdit   Permission = "invoices:edit"
+	InvoicesDelete Permission = "invoices:delete"
+	// InvoicesRecordPayment covers status changes such as marking an invoice
+	// paid, and recording client payments and credits
+	InvoicesRecordPayment Permission = "invoices:record_payment"
+	InvoicesExport        Permission = "invoices:export"
+
+	// APIKeysManage covers creating and listing personal API keys. A key
+	// acts with its owner's role in whichever organization it is used in.
+	APIKeysManage Permission = "api_keys:manage"
+)
+
+var viewerPermissions = []Permission{
+	OrganizationRead,
+	ClientsRead,
+	InvoicesRead,
+}
+
+var accountantPermissions = append([]Permission{
+	InvoicesRecordPayment,
+	InvoicesExport,
+	APIKeysManage,
+}, viewerPermissions...)
+
+var adminPermissions = append([]Permission{
+	OrganizationUpdate,
+	MembersManage,
+	SenderProfilesManage,
+	PaymentDetailsReveal,
+	ClientsWrite,
+	ClientsDelete,
+	InvoicesCreate,
+	InvoicesEdit,
+	InvoicesDelete,
+}, accountantPermissions...)
+
+var ownerPermissions = append([]Permission{
+	OwnersManage,
+	SigningCertificateManage,
+}, adminPermissions...)
+
+var rolePermissions = map[string][]Permission{
+	models.RoleOwner:      ownerPermissions,
+	models.RoleAdmin:      adminPermissions,
+	models.RoleAccountant: accountantPermissions,
+	models.RoleViewer:     viewerPermissions,
+}
+
+// Allowed reports whether role grants permission. Unknown roles grant nothing.
+func Allowed(role string, permission Permission) bool {
+	for _, p := range rolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Permissions lists what role grants
+func Permissions(role string) []Permission {
+	return append([]Permission(nil), rolePermissions[role]...)
+}
@@ -0,0 +1,74 @@
+package rbac
+
+import (
+	"testing"
+
+	"github.com/hutamy/invoice-generator-backend/models"
+)
+
+// grants is the full permission matrix: the roles each permission is granted to
+var grants = map[Permission][]string{
+	OrganizationRead:         {models.RoleOwner, models.RoleAdmin, models.RoleAccountant, models.RoleViewer},
+	ClientsRead:              {models.RoleOwner, models.RoleAdmin, models.RoleAccountant, models.RoleViewer},
+	InvoicesRead:             {models.RoleOwner, models.RoleAdmin, models.RoleAccountant, models.RoleViewer},
+	InvoicesRecordPayment:    {models.RoleOwner, models.RoleAdmin, models.RoleAccountant},
+	InvoicesExport:           {models.RoleOwner, models.RoleAdmin, models.RoleAccountant},
+	APIKeysManage:            {models.RoleOwner, models.RoleAdmin, models.RoleAccountant},
+	InvoicesCreate:           {models.RoleOwner, models.RoleAdmin},
+	InvoicesEdit:             {models.RoleOwner, models.RoleAdmin},
+	InvoicesDelete:           {models.RoleOwner, models.RoleAdmin},
+	ClientsWrite:             {models.RoleOwner, models.RoleAdmin},
+	ClientsDelete:            {models.RoleOwner, models.RoleAdmin},
+	SenderProfilesManage:     {models.RoleOwner, models.RoleAdmin},
+	PaymentDetailsReveal:     {models.RoleOwner, models.RoleAdmin},
+	OrganizationUpdate:       {models.RoleOwner, models.RoleAdmin},
+	MembersManage:            {models.RoleOwner, models.RoleAdmin},
+	OwnersManage:             {models.RoleOwner},
+	SigningCertificateManage: {models.RoleOwner},
+}
+
+func TestAllowed(t *testing.T) {
+	for permission, roles := range grants {
+		for _, role := range models.Roles {
+			want := false
+			for _, granted := range roles {
+				want = want || granted == role
+			}
+
+			if got := Allowed(role, permission); got != want {
+				t.Errorf("Allowed(%q, %q) = %v, want %v", role, permission, got, want)
+			}
+		}
+	}
+}
+
+func TestAllowedUnknownRole(t *testing.T) {
+	for permission := range grants {
+		for _, role := range []string{"", "superuser", "Owner"} {
+			if Allowed(role, permission) {
+				t.Errorf("Allowed(%q, %q) = true, want false", role, permission)
+			}
+		}
+	}
+}
+
+// TestPermissionsCovered fails when a role is granted a permission the matrix
+// above does not list, so new permissions get a row in the test
+func TestPermissionsCovered(t *testing.T) {
+	for _, role := range models.Roles {
+		for _, permission := range Permissions(role) {
+			if _, ok := grants[permission]; !ok {
+				t.Errorf("role %q is granted %q, which is missing from the test matrix", role, permission)
+			}
+		}
+	}
+}
+
+func TestPermissionsReturnsCopy(t *testing.T) {
+	permissions := Permissions(models.RoleViewer)
+	permissions[0] = OwnersManage
+
+	if Allowed(models.RoleViewer, OwnersManage) {
+		t.Fatal("changing the result of Permissions changed the role's grants")
+	}
+}
@@ -1,6 +1,14 @@
 package utils
 
-import "github.com/labstack/echo/v4"
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hutamy/invoice-generator-backend/utils/errors"
+	"github.com/labstack/echo/v4"
+)
 
 type GenericResponse struct {
 	Status  int         `json:"status"`
@@ -15,3 +23,14 @@ func Response(c echo.Context, status int, message string, data interface{}) erro
 		Data:    data,
 	})
 }
+
+// TooManyRequests responds with 429 and a Retry-After header in whole seconds
+func TooManyRequests(c echo.Context, retryAfter time.Duration) error {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	c.Response().Header().Set("Retry-After", strconv.Itoa(seconds))
+	return Response(c, http.StatusTooManyRequests, errors.ErrTooManyRequests.Error(), nil)
+}
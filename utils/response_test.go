@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestTooManyRequests(t *testing.T) {
+	tests := []struct {
+		name       string
+		retryAfter time.Duration
+		header     string
+	}{
+		{"whole seconds", time.Minute, "60"},
+		{"rounded up", 59*time.Second + time.Millisecond, "60"},
+		{"under a second", 300 * time.Millisecond, "1"},
+		{"already expired", -time.Second, "1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/", nil), rec)
+			if err := TooManyRequests(c, tt.retryAfter); err != nil {
+				t.Fatal(err)
+			}
+
+			if rec.Code != http.StatusTooManyRequests {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusTooManyRequests)
+			}
+
+			if got := rec.Header().Get("Retry-After"); got != tt.header {
+				t.Fatalf("Retry-After = %q, want %q", got, tt.header)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package utils
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/hutamy/invoice-generator-backend/models"
+	"gorm.io/gorm/schema"
+)
+
+// encryptedPrefix marks column values written by EncryptedSerializer. Values
+// without it are plaintext from before the column was encrypted and are read
+// as is until the re-encryption command rewrites them.
+const encryptedPrefix = "enc:"
+
+func init() {
+	schema.RegisterSerializer("encrypted", EncryptedSerializer{})
+}
+
+// EncryptedSerializer encrypts string fields tagged with
+// `gorm:"serializer:encrypted"` on write and decrypts them on read.
+type EncryptedSerializer struct{}
+
+func (EncryptedSerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	var stored string
+	switch value := dbValue.(type) {
+	case nil:
+	case string:
+		stored = value
+	case []byte:
+		stored = string(value)
+	default:
+		return fmt.Errorf("unsupported value %T for encrypted field %s", dbValue, field.Name)
+	}
+
+	plaintext, err := DecryptString(stored)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt %s: %w", field.Name, err)
+	}
+
+	field.ReflectValueOf(ctx, dst).SetString(plaintext)
+	return nil
+}
+
+func (EncryptedSerializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	plaintext, ok := fieldValue.(string)
+	if !ok {
+		return nil, fmt.Errorf("encrypted field %s must be a string", field.Name)
+	}
+
+	return EncryptString(plaintext)
+}
+
+// EncryptString encrypts a value for a text column. Empty strings stay empty.
+func EncryptString(plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+
+	ciphertext, err := Encrypt([]byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// DecryptString reverses EncryptString. Plaintext values are returned unchanged.
+func DecryptString(stored string) (string, error) {
+	if !strings.HasPrefix(stored, encryptedPrefix) {
+		return stored, nil
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, encryptedPrefix))
+	if err != nil {
+		return "", err
+	}
+
+	plaintext, err := Decrypt(ciphertext)
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintext), nil
+}
+
+// ReencryptString brings a stored text value onto the active key, encrypting
+// plaintext values. It reports whether the value changed.
+func ReencryptString(stored string) (string, bool, error) {
+	if stored == "" {
+		return stored, false, nil
+	}
+
+	if !strings.HasPrefix(stored, encryptedPrefix) {
+		encrypted, err := EncryptString(stored)
+		return encrypted, err == nil, err
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, encryptedPrefix))
+	if err != nil {
+		return "", false, err
+	}
+
+	rewrapped, changed, err := Rewrap(ciphertext)
+	if err != nil || !changed {
+		return stored, false, err
+	}
+
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(rewrapped), true, nil
+}
+
+// MaskAccountNumber hides all but the last four characters of an account number
+func MaskAccountNumber(number string) string {
+	runes := []rune(number)
+	if len(runes) <= 4 {
+		return strings.Repeat("*", len(runes))
+	}
+
+	return strings.Repeat("*", len(runes)-4) + string(runes[len(runes)-4:])
+}
+
+// MaskPaymentDetails hides the account number, IBAN and wallet ID of payment
+// details the way MaskAccountNumber does. Only responses are masked: invoices
+// are still printed with the full details.
+func MaskPaymentDetails(details *models.PaymentDetails) {
+	details.AccountNumber = MaskAccountNumber(details.AccountNumber)
+	details.IBAN = MaskAccountNumber(details.IBAN)
+	details.WalletID = MaskAccountNumber(details.WalletID)
+}
@@ -0,0 +1,121 @@
+package xsd
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	xmlnsPrefix       = "xmlns"
+	xsiNamespace      = "http://www.w3.org/2001/XMLSchema-instance"
+	xmlNamespace      = "http://www.w3.org/XML/1998/namespace"
+	maxValidateErrors = 20
+)
+
+// node is an element of a parsed document with the namespace prefixes in
+// scope, which QName values such as type="ram:IDType" are resolved with
+type node struct {
+	name       xml.Name
+	attrs      []xml.Attr
+	children   []*node
+	text       string
+	namespaces map[string]string
+}
+
+func parse(data []byte) (*node, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var root *node
+	var stack []*node
+	var text []*strings.Builder
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			n := &node{name: t.Name, namespaces: map[string]string{}}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				for prefix, space := range parent.namespaces {
+					n.namespaces[prefix] = space
+				}
+				parent.children = append(parent.children, n)
+			} else if root == nil {
+				root = n
+			}
+
+			for _, attr := range t.Attr {
+				switch {
+				case attr.Name.Space == xmlnsPrefix:
+					n.namespaces[attr.Name.Local] = attr.Value
+				case attr.Name.Space == "" && attr.Name.Local == xmlnsPrefix:
+					n.namespaces[""] = attr.Value
+				default:
+					n.attrs = append(n.attrs, attr)
+				}
+			}
+
+			stack = append(stack, n)
+			text = append(text, &strings.Builder{})
+		case xml.CharData:
+			if len(text) > 0 {
+				text[len(text)-1].Write(t)
+			}
+		case xml.EndElement:
+			stack[len(stack)-1].text = text[len(text)-1].String()
+			stack = stack[:len(stack)-1]
+			text = text[:len(text)-1]
+		}
+	}
+
+	if root == nil {
+		return nil, fmt.Errorf("document has no root element")
+	}
+
+	return root, nil
+}
+
+func (n *node) attr(local string) string {
+	for _, attr := range n.attrs {
+		if attr.Name.Space == "" && attr.Name.Local == local {
+			return attr.Value
+		}
+	}
+
+	return ""
+}
+
+// xsdChildren returns the child elements in the XML Schema namespace
+func (n *node) xsdChildren() []*node {
+	var children []*node
+	for _, child := range n.children {
+		if child.name.Space == xsdNamespace {
+			children = append(children, child)
+		}
+	}
+
+	return children
+}
+
+// resolve turns a prefixed name like "xs:string" into its qualified name
+func (n *node) resolve(value string) (qname, error) {
+	prefix, local, found := strings.Cut(strings.TrimSpace(value), ":")
+	if !found {
+		prefix, local = "", prefix
+	}
+
+	space, ok := n.namespaces[prefix]
+	if !ok && prefix != "" {
+		return qname{}, fmt.Errorf("undeclared namespace prefix %q in %q", prefix, value)
+	}
+
+	return qname{space: space, local: local}, nil
+}
@@ -0,0 +1,606 @@
+// Package xsd validates XML documents against W3C XML Schema definitions.
+//
+// It implements the part of XSD 1.0 the e-invoice schemas kept in this
+// repository are written in: global and local element declarations, named
+// and anonymous complex types with sequence and choice content, simple
+// content extended with attributes, and simple types restricting a built-in
+// type with enumeration, pattern and length facets. Schemas using anything
+// else are rejected when loaded rather than half enforced.
+package xsd
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const xsdNamespace = "http://www.w3.org/2001/XMLSchema"
+
+type qname struct {
+	space, local string
+}
+
+func (n qname) String() string {
+	if n.space == "" {
+		return n.local
+	}
+
+	return "{" + n.space + "}" + n.local
+}
+
+// Schema is a set of schema documents loaded together with their imports
+type Schema struct {
+	elements     map[qname]*elementDecl
+	complexTypes map[qname]*complexType
+	simpleTypes  map[qname]*simpleType
+}
+
+type elementDecl struct {
+	name     qname
+	ref      *qname // refers to a global element
+	typeName *qname
+	complex  *complexType // anonymous type
+	simple   *simpleType  // anonymous type
+}
+
+type particleKind int
+
+const (
+	particleElement particleKind = iota
+	particleSequence
+	particleChoice
+)
+
+type particle struct {
+	kind     particleKind
+	element  *elementDecl
+	children []*particle
+	min, max int // max is -1 for unbounded
+}
+
+type complexType struct {
+	name       qname
+	content    *particle // nil when the type has no element content
+	valueType  *qname    // base of simple content
+	attributes []*attributeDecl
+}
+
+type attributeDecl struct {
+	name     string
+	typeName *qname
+	simple   *simpleType
+	required bool
+}
+
+type simpleType struct {
+	name         qname
+	base         qname
+	enumeration  []string
+	patterns     []*regexp.Regexp
+	length       int
+	minLength    int
+	maxLength    int
+	hasLength    bool
+	hasMinLength bool
+	hasMaxLength bool
+}
+
+// builtinTypes are the XSD built-in types schemas can derive from, with the
+// whitespace handling their values get before checking
+var builtinTypes = map[string]string{
+	"string":           "preserve",
+	"normalizedString": "replace",
+	"token":            "collapse",
+	"decimal":          "collapse",
+	"integer":          "collapse",
+	"boolean":          "collapse",
+	"date":             "collapse",
+	"anyURI":           "collapse",
+}
+
+// Load reads the schema document name from fsys, following its imports and
+// includes relative to the importing document.
+func Load(fsys fs.FS, name string) (*Schema, error) {
+	l := &loader{
+		fsys:   fsys,
+		loaded: map[string]bool{},
+		schema: &Schema{
+			elements:     map[qname]*elementDecl{},
+			complexTypes: map[qname]*complexType{},
+			simpleTypes:  map[qname]*simpleType{},
+		},
+	}
+
+	if err := l.load(name); err != nil {
+		return nil, err
+	}
+
+	if err := l.schema.checkReferences(); err != nil {
+		return nil, err
+	}
+
+	return l.schema, nil
+}
+
+type loader struct {
+	fsys   fs.FS
+	loaded map[string]bool
+	schema *Schema
+
+	// state of the document being read
+	file      string
+	target    string
+	qualified bool
+}
+
+func (l *loader) load(name string) error {
+	if l.loaded[name] {
+		return nil
+	}
+	l.loaded[name] = true
+
+	data, err := fs.ReadFile(l.fsys, name)
+	if err != nil {
+		return err
+	}
+
+	root, err := parse(data)
+	if err != nil {
+		return fmt.Errorf("xsd: %s: %w", name, err)
+	}
+
+	if root.name != (xml.Name{Space: xsdNamespace, Local: "schema"}) {
+		return fmt.Errorf("xsd: %s: root element is not xs:schema", name)
+	}
+
+	for _, child := range root.children {
+		if child.name.Space != xsdNamespace {
+			continue
+		}
+
+		switch child.name.Local {
+		case "import", "include":
+			location := child.attr("schemaLocation")
+			if location == "" {
+				return fmt.Errorf("xsd: %s: %s without schemaLocation", name, child.name.Local)
+			}
+
+			if err := l.load(path.Join(path.Dir(name), location)); err != nil {
+				return err
+			}
+		}
+	}
+
+	l.file = name
+	l.target = root.attr("targetNamespace")
+	l.qualified = root.attr("elementFormDefault") == "qualified"
+	for _, child := range root.children {
+		if err := l.topLevel(root, child); err != nil {
+			return fmt.Errorf("xsd: %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+func (l *loader) topLevel(root, n *node) error {
+	if n.name.Space != xsdNamespace {
+		return fmt.Errorf("unexpected element %s", n.name.Local)
+	}
+
+	switch n.name.Local {
+	case "import", "include", "annotation":
+		return nil
+	case "element":
+		decl, err := l.element(n, true)
+		if err != nil {
+			return err
+		}
+
+		l.schema.elements[decl.name] = decl
+	case "complexType":
+		ct, err := l.complexType(n)
+		if err != nil {
+			return err
+		}
+
+		l.schema.complexTypes[ct.name] = ct
+	case "simpleType":
+		st, err := l.simpleType(n)
+		if err != nil {
+			return err
+		}
+
+		l.schema.simpleTypes[st.name] = st
+	default:
+		return fmt.Errorf("xs:%s is not supported", n.name.Local)
+	}
+
+	return nil
+}
+
+func (l *loader) element(n *node, global bool) (*elementDecl, error) {
+	decl := &elementDecl{}
+	if ref := n.attr("ref"); ref != "" {
+		name, err := n.resolve(ref)
+		if err != nil {
+			return nil, err
+		}
+
+		decl.ref = &name
+		decl.name = name
+		return decl, nil
+	}
+
+	decl.name = qname{local: n.attr("name")}
+	if decl.name.local == "" {
+		return nil, fmt.Errorf("element without a name")
+	}
+
+	if global || l.qualified {
+		decl.name.space = l.target
+	}
+
+	if typ := n.attr("type"); typ != "" {
+		name, err := n.resolve(typ)
+		if err != nil {
+			return nil, err
+		}
+
+		decl.typeName = &name
+	}
+
+	for _, child := range n.xsdChildren() {
+		var err error
+		switch child.name.Local {
+		case "annotation":
+		case "complexType":
+			decl.complex, err = l.complexType(child)
+		case "simpleType":
+			decl.simple, err = l.simpleType(child)
+		default:
+			err = fmt.Errorf("xs:%s in element %s is not supported", child.name.Local, decl.name.local)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if decl.typeName == nil && decl.complex == nil && decl.simple == nil {
+		return nil, fmt.Errorf("element %s has no type", decl.name.local)
+	}
+
+	return decl, nil
+}
+
+func (l *loader) complexType(n *node) (*complexType, error) {
+	ct := &complexType{name: qname{space: l.target, local: n.attr("name")}}
+	if n.attr("mixed") == "true" {
+		return nil, fmt.Errorf("mixed content in %s is not supported", ct.name.local)
+	}
+
+	for _, child := range n.xsdChildren() {
+		switch child.name.Local {
+		case "annotation":
+		case "sequence", "choice":
+			p, err := l.particle(child)
+			if err != nil {
+				return nil, err
+			}
+
+			ct.content = p
+		case "attribute":
+			attr, err := l.attribute(child)
+			if err != nil {
+				return nil, err
+			}
+
+			ct.attributes = append(ct.attributes, attr)
+		case "simpleContent":
+			if err := l.simpleContent(ct, child); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("xs:%s in complex type %s is not supported", child.name.Local, ct.name.local)
+		}
+	}
+
+	return ct, nil
+}
+
+func (l *loader) simpleContent(ct *complexType, n *node) error {
+	for _, child := range n.xsdChildren() {
+		switch child.name.Local {
+		case "annotation":
+		case "extension":
+			base, err := child.resolve(child.attr("base"))
+			if err != nil {
+				return err
+			}
+
+			ct.valueType = &base
+			for _, attr := range child.xsdChildren() {
+				switch attr.name.Local {
+				case "annotation":
+				case "attribute":
+					decl, err := l.attribute(attr)
+					if err != nil {
+						return err
+					}
+
+					ct.attributes = append(ct.attributes, decl)
+				default:
+					return fmt.Errorf("xs:%s in simple content is not supported", attr.name.Local)
+				}
+			}
+		default:
+			return fmt.Errorf("xs:%s in simple content is not supported", child.name.Local)
+		}
+	}
+
+	if ct.valueType == nil {
+		return fmt.Errorf("simple content of %s has no base", ct.name.local)
+	}
+
+	return nil
+}
+
+func (l *loader) particle(n *node) (*particle, error) {
+	p := &particle{}
+	var err error
+	if p.min, p.max, err = occurs(n); err != nil {
+		return nil, err
+	}
+
+	switch n.name.Local {
+	case "element":
+		p.kind = particleElement
+		p.element, err = l.element(n, false)
+		return p, err
+	case "sequence":
+		p.kind = particleSequence
+	case "choice":
+		p.kind = particleChoice
+	default:
+		return nil, fmt.Errorf("xs:%s is not supported in content models", n.name.Local)
+	}
+
+	for _, child := range n.xsdChildren() {
+		if child.name.Local == "annotation" {
+			continue
+		}
+
+		c, err := l.particle(child)
+		if err != nil {
+			return nil, err
+		}
+
+		p.children = append(p.children, c)
+	}
+
+	return p, nil
+}
+
+func (l *loader) attribute(n *node) (*attributeDecl, error) {
+	attr := &attributeDecl{name: n.attr("name"), required: n.attr("use") == "required"}
+	if attr.name == "" {
+		return nil, fmt.Errorf("attribute without a name")
+	}
+
+	if typ := n.attr("type"); typ != "" {
+		name, err := n.resolve(typ)
+		if err != nil {
+			return nil, err
+		}
+
+		attr.typeName = &name
+	}
+
+	for _, child := range n.xsdChildren() {
+		switch child.name.Local {
+		case "annotation":
+		case "simpleType":
+			st, err := l.simpleType(child)
+			if err != nil {
+				return nil, err
+			}
+
+			attr.simple = st
+		default:
+			return nil, fmt.Errorf("xs:%s in attribute %s is not supported", child.name.Local, attr.name)
+		}
+	}
+
+	if attr.typeName == nil && attr.simple == nil {
+		name := qname{space: xsdNamespace, local: "string"}
+		attr.typeName = &name
+	}
+
+	return attr, nil
+}
+
+func (l *loader) simpleType(n *node) (*simpleType, error) {
+	st := &simpleType{name: qname{space: l.target, local: n.attr("name")}}
+	var restriction *node
+	for _, child := range n.xsdChildren() {
+		switch child.name.Local {
+		case "annotation":
+		case "restriction":
+			restriction = child
+		default:
+			return nil, fmt.Errorf("xs:%s in simple type %s is not supported", child.name.Local, st.name.local)
+		}
+	}
+
+	if restriction == nil {
+		return nil, fmt.Errorf("simple type %s is not a restriction", st.name.local)
+	}
+
+	base, err := restriction.resolve(restriction.attr("base"))
+	if err != nil {
+		return nil, err
+	}
+	st.base = base
+
+	for _, facet := range restriction.xsdChildren() {
+		value := facet.attr("value")
+		switch facet.name.Local {
+		case "annotation":
+		case "enumeration":
+			st.enumeration = append(st.enumeration, value)
+		case "pattern":
+			// XSD patterns match the whole value
+			re, err := regexp.Compile("^(?:" + value + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("pattern of %s: %w", st.name.local, err)
+			}
+
+			st.patterns = append(st.patterns, re)
+		case "length", "minLength", "maxLength":
+			size, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s of %s: %w", facet.name.Local, st.name.local, err)
+			}
+
+			switch facet.name.Local {
+			case "length":
+				st.length, st.hasLength = size, true
+			case "minLength":
+				st.minLength, st.hasMinLength = size, true
+			default:
+				st.maxLength, st.hasMaxLength = size, true
+			}
+		default:
+			return nil, fmt.Errorf("facet xs:%s in %s is not supported", facet.name.Local, st.name.local)
+		}
+	}
+
+	return st, nil
+}
+
+func occurs(n *node) (int, int, error) {
+	min, max := 1, 1
+	if value := n.attr("minOccurs"); value != "" {
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return 0, 0, fmt.Errorf("minOccurs: %w", err)
+		}
+
+		min = v
+	}
+
+	if value := n.attr("maxOccurs"); value == "unbounded" {
+		max = -1
+	} else if value != "" {
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return 0, 0, fmt.Errorf("maxOccurs: %w", err)
+		}
+
+		max = v
+	}
+
+	return min, max, nil
+}
+
+// checkReferences makes sure every type and element a declaration refers to
+// was loaded, so a missing import fails on Load rather than on Validate
+func (s *Schema) checkReferences() error {
+	var problems []string
+	checkType := func(name *qname, simpleOnly bool) {
+		if name == nil {
+			return
+		}
+
+		if name.space == xsdNamespace {
+			if _, ok := builtinTypes[name.local]; !ok {
+				problems = append(problems, "built-in type "+name.local+" is not supported")
+			}
+
+			return
+		}
+
+		if _, ok := s.simpleTypes[*name]; ok {
+			return
+		}
+
+		if ct, ok := s.complexTypes[*name]; ok && (!simpleOnly || ct.valueType != nil) {
+			return
+		}
+
+		problems = append(problems, "unknown type "+name.String())
+	}
+
+	var checkElement func(decl *elementDecl)
+	var checkComplex func(ct *complexType)
+	var checkParticle func(p *particle)
+	checkSimple := func(st *simpleType) {
+		if st != nil {
+			base := st.base
+			checkType(&base, true)
+		}
+	}
+
+	checkComplex = func(ct *complexType) {
+		if ct == nil {
+			return
+		}
+
+		checkType(ct.valueType, true)
+		for _, attr := range ct.attributes {
+			checkType(attr.typeName, true)
+			checkSimple(attr.simple)
+		}
+
+		if ct.content != nil {
+			checkParticle(ct.content)
+		}
+	}
+
+	checkParticle = func(p *particle) {
+		if p.kind == particleElement {
+			checkElement(p.element)
+		}
+
+		for _, child := range p.children {
+			checkParticle(child)
+		}
+	}
+
+	checkElement = func(decl *elementDecl) {
+		if decl.ref != nil {
+			if _, ok := s.elements[*decl.ref]; !ok {
+				problems = append(problems, "unknown element "+decl.ref.String())
+			}
+
+			return
+		}
+
+		checkType(decl.typeName, false)
+		checkComplex(decl.complex)
+		checkSimple(decl.simple)
+	}
+
+	for _, decl := range s.elements {
+		checkElement(decl)
+	}
+
+	for _, ct := range s.complexTypes {
+		checkComplex(ct)
+	}
+
+	for _, st := range s.simpleTypes {
+		checkSimple(st)
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("xsd: %s", strings.Join(problems, "; "))
+	}
+
+	return nil
+}
@@ -0,0 +1,428 @@
+package xsd
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	decimalValue = regexp.MustCompile(`^[+-]?(\d+(\.\d*)?|\.\d+)$`)
+	integerValue = regexp.MustCompile(`^[+-]?\d+$`)
+)
+
+// ValidationError lists where a document breaks its schema
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "schema validation failed: " + strings.Join(e.Problems, "; ")
+}
+
+// Validate checks data against the schema. Problems in the document are
+// returned as a *ValidationError.
+func (s *Schema) Validate(data []byte) error {
+	root, err := parse(data)
+	if err != nil {
+		return err
+	}
+
+	v := &validator{schema: s}
+	decl, ok := s.elements[qname{space: root.name.Space, local: root.name.Local}]
+	if !ok {
+		v.fail("/"+root.name.Local, "element is not declared by the schema")
+	} else {
+		v.element(decl, root, "/"+root.name.Local)
+	}
+
+	if len(v.problems) > 0 {
+		return &ValidationError{Problems: v.problems}
+	}
+
+	return nil
+}
+
+type validator struct {
+	schema   *Schema
+	problems []string
+}
+
+func (v *validator) fail(path, format string, args ...interface{}) {
+	if len(v.problems) < maxValidateErrors {
+		v.problems = append(v.problems, path+": "+fmt.Sprintf(format, args...))
+	}
+}
+
+func (v *validator) element(decl *elementDecl, n *node, path string) {
+	if decl.ref != nil {
+		decl = v.schema.elements[*decl.ref]
+	}
+
+	complex, simple := decl.complex, decl.simple
+	if decl.typeName != nil {
+		complex, simple = v.schema.lookup(*decl.typeName)
+	}
+
+	if complex == nil {
+		v.attributes(nil, n, path)
+		if len(n.children) > 0 {
+			v.fail(path, "element %s is not allowed in a simple value", n.children[0].name.Local)
+			return
+		}
+
+		typeName := qname{}
+		if decl.typeName != nil {
+			typeName = *decl.typeName
+		}
+		if err := v.schema.checkValue(simple, typeName, n.text); err != nil {
+			v.fail(path, "%v", err)
+		}
+		return
+	}
+
+	v.attributes(complex, n, path)
+	if valueType := complex.valueType; valueType != nil {
+		if len(n.children) > 0 {
+			v.fail(path, "element %s is not allowed in a simple value", n.children[0].name.Local)
+			return
+		}
+
+		if err := v.schema.checkContentValue(*valueType, n.text); err != nil {
+			v.fail(path, "%v", err)
+		}
+		return
+	}
+
+	if strings.TrimSpace(n.text) != "" {
+		v.fail(path, "text is not allowed here")
+	}
+
+	if complex.content == nil {
+		if len(n.children) > 0 {
+			v.fail(path, "element %s is not expected, the element must be empty", n.children[0].name.Local)
+		}
+		return
+	}
+
+	m := &matcher{children: n.children, decls: make([]*elementDecl, len(n.children))}
+	pos, ok := m.match(complex.content, 0)
+	if !ok {
+		// Report the problem where matching got stuck rather than where
+		// the failed group started
+		pos = m.furthest
+	}
+
+	switch {
+	case pos < len(n.children):
+		message := fmt.Sprintf("element %s is not expected", n.children[pos].name.Local)
+		if m.missing != "" {
+			message += ", expected " + m.missing
+		}
+		v.fail(path, "%s", message)
+	case !ok:
+		v.fail(path, "content is incomplete, expected %s", m.missing)
+	}
+
+	counts := map[string]int{}
+	for i, child := range n.children[:pos] {
+		counts[child.name.Local]++
+		if m.decls[i] == nil {
+			continue
+		}
+
+		childPath := fmt.Sprintf("%s/%s", path, child.name.Local)
+		if counts[child.name.Local] > 1 {
+			childPath = fmt.Sprintf("%s[%d]", childPath, counts[child.name.Local])
+		}
+
+		v.element(m.decls[i], child, childPath)
+	}
+}
+
+// attributes checks the attributes of n against the ones complex declares,
+// ignoring namespace declarations and xsi attributes
+func (v *validator) attributes(complex *complexType, n *node, path string) {
+	var declared []*attributeDecl
+	if complex != nil {
+		declared = v.schema.attributesOf(complex)
+	}
+
+	for _, attr := range n.attrs {
+		if attr.Name.Space == xsiNamespace || attr.Name.Space == xmlNamespace {
+			continue
+		}
+
+		var decl *attributeDecl
+		for _, d := range declared {
+			if attr.Name.Space == "" && d.name == attr.Name.Local {
+				decl = d
+			}
+		}
+
+		if decl == nil {
+			v.fail(path, "attribute %s is not allowed", attr.Name.Local)
+			continue
+		}
+
+		typeName := qname{}
+		if decl.typeName != nil {
+			typeName = *decl.typeName
+		}
+		if err := v.schema.checkValue(decl.simple, typeName, attr.Value); err != nil {
+			v.fail(path+"/@"+attr.Name.Local, "%v", err)
+		}
+	}
+
+	for _, decl := range declared {
+		if decl.required && n.attr(decl.name) == "" {
+			v.fail(path, "attribute %s is required", decl.name)
+		}
+	}
+}
+
+// matcher assigns the children of an element to the element declarations of
+// its content model. XSD content models are deterministic, so taking the
+// first alternative that matches is enough.
+type matcher struct {
+	children   []*node
+	decls      []*elementDecl
+	missing    string // required element not found at the furthest position
+	missingPos int
+	furthest   int // position after the last child matched
+}
+
+func (m *matcher) match(p *particle, pos int) (int, bool) {
+	count := 0
+	for p.max < 0 || count < p.max {
+		next, ok := m.matchOnce(p, pos)
+		if !ok || next == pos {
+			break
+		}
+
+		pos = next
+		count++
+	}
+
+	if count < p.min && !emptiable(p) {
+		return pos, false
+	}
+
+	return pos, true
+}
+
+func (m *matcher) matchOnce(p *particle, pos int) (int, bool) {
+	switch p.kind {
+	case particleElement:
+		if pos < len(m.children) && m.children[pos].name.Space == p.element.name.space &&
+			m.children[pos].name.Local == p.element.name.local {
+			m.decls[pos] = p.element
+			if pos+1 > m.furthest {
+				m.furthest = pos + 1
+			}
+			return pos + 1, true
+		}
+
+		if p.min > 0 && (m.missing == "" || pos > m.missingPos) {
+			m.missing, m.missingPos = p.element.name.local, pos
+		}
+		return pos, false
+	case particleSequence:
+		start := pos
+		for _, child := range p.children {
+			next, ok := m.match(child, pos)
+			if !ok {
+				return start, false
+			}
+
+			pos = next
+		}
+
+		return pos, true
+	default:
+		for _, child := range p.children {
+			if next, ok := m.match(child, pos); ok && next > pos {
+				return next, true
+			}
+		}
+
+		return pos, emptiable(p)
+	}
+}
+
+// emptiable reports whether the particle can match no elements at all
+func emptiable(p *particle) bool {
+	if p.min == 0 {
+		return true
+	}
+
+	switch p.kind {
+	case particleSequence:
+		for _, child := range p.children {
+			if !emptiable(child) {
+				return false
+			}
+		}
+
+		return true
+	case particleChoice:
+		for _, child := range p.children {
+			if emptiable(child) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (s *Schema) lookup(name qname) (*complexType, *simpleType) {
+	if ct, ok := s.complexTypes[name]; ok {
+		return ct, nil
+	}
+
+	return nil, s.simpleTypes[name]
+}
+
+// attributesOf returns the attributes of ct including the ones its simple
+// content inherits from a complex base type
+func (s *Schema) attributesOf(ct *complexType) []*attributeDecl {
+	attributes := append([]*attributeDecl{}, ct.attributes...)
+	for base := ct.valueType; base != nil; {
+		baseType, ok := s.complexTypes[*base]
+		if !ok {
+			break
+		}
+
+		attributes = append(attributes, baseType.attributes...)
+		base = baseType.valueType
+	}
+
+	return attributes
+}
+
+// checkContentValue checks the value of simple content, whose base is either
+// a simple type or another complex type with simple content
+func (s *Schema) checkContentValue(base qname, value string) error {
+	for {
+		ct, ok := s.complexTypes[base]
+		if !ok {
+			return s.checkValue(nil, base, value)
+		}
+
+		base = *ct.valueType
+	}
+}
+
+// checkValue checks value against the anonymous type st, or the named simple
+// or built-in type name when st is nil
+func (s *Schema) checkValue(st *simpleType, name qname, value string) error {
+	if st == nil {
+		if name.space == xsdNamespace {
+			return checkBuiltin(name.local, value)
+		}
+
+		named, ok := s.simpleTypes[name]
+		if !ok {
+			return fmt.Errorf("unknown type %s", name)
+		}
+
+		st = named
+	}
+
+	if err := s.checkValue(nil, st.base, value); err != nil {
+		return err
+	}
+
+	value = whitespace(s.builtinOf(st), value)
+	if len(st.enumeration) > 0 {
+		found := false
+		for _, allowed := range st.enumeration {
+			if value == allowed {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return fmt.Errorf("value %q is not allowed", value)
+		}
+	}
+
+	if len(st.patterns) > 0 {
+		matched := false
+		for _, pattern := range st.patterns {
+			if pattern.MatchString(value) {
+				matched = true
+				break
+			}
+		}
+
+		if !matched {
+			return fmt.Errorf("value %q does not match the required pattern", value)
+		}
+	}
+
+	length := utf8.RuneCountInString(value)
+	switch {
+	case st.hasLength && length != st.length:
+		return fmt.Errorf("value %q must be %d characters long", value, st.length)
+	case st.hasMinLength && length < st.minLength:
+		return fmt.Errorf("value %q must be at least %d characters long", value, st.minLength)
+	case st.hasMaxLength && length > st.maxLength:
+		return fmt.Errorf("value %q must be at most %d characters long", value, st.maxLength)
+	}
+
+	return nil
+}
+
+// builtinOf returns the built-in type st is derived from
+func (s *Schema) builtinOf(st *simpleType) string {
+	for st.base.space != xsdNamespace {
+		st = s.simpleTypes[st.base]
+	}
+
+	return st.base.local
+}
+
+func checkBuiltin(name, value string) error {
+	value = whitespace(name, value)
+	var valid bool
+	switch name {
+	case "decimal":
+		valid = decimalValue.MatchString(value)
+	case "integer":
+		valid = integerValue.MatchString(value)
+	case "boolean":
+		valid = value == "true" || value == "false" || value == "1" || value == "0"
+	case "date":
+		_, err := time.Parse(time.DateOnly, value)
+		valid = err == nil
+	default:
+		valid = true
+	}
+
+	if !valid {
+		return fmt.Errorf("value %q is not a valid %s", value, name)
+	}
+
+	return nil
+}
+
+func whitespace(builtin, value string) string {
+	switch builtinTypes[builtin] {
+	case "replace":
+		return strings.Map(func(r rune) rune {
+			if r == '\t' || r == '\n' || r == '\r' {
+				return ' '
+			}
+			return r
+		}, value)
+	case "collapse":
+		return strings.Join(strings.Fields(value), " ")
+	}
+
+	return value
+}
@@ -0,0 +1,254 @@
+package xsd
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+const testSchema = `<?xml version="1.0"?>
+<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema" xmlns:t="urn:test" xmlns:c="urn:common"
+  targetNamespace="urn:test" elementFormDefault="qualified">
+  <xs:import namespace="urn:common" schemaLocation="common/common.xsd"/>
+  <xs:element name="Order" type="t:OrderType"/>
+  <xs:complexType name="OrderType">
+    <xs:sequence>
+      <xs:element name="ID" type="c:IDType"/>
+      <xs:element name="Note" type="xs:string" minOccurs="0" maxOccurs="2"/>
+      <xs:choice>
+        <xs:element name="Pickup" type="t:EmptyType"/>
+        <xs:element name="Address" type="xs:string"/>
+      </xs:choice>
+      <xs:element name="Line" type="t:LineType" maxOccurs="unbounded"/>
+    </xs:sequence>
+  </xs:complexType>
+  <xs:complexType name="EmptyType"/>
+  <xs:complexType name="LineType">
+    <xs:sequence>
+      <xs:element name="Quantity" type="xs:integer"/>
+      <xs:element name="Price" type="c:AmountType"/>
+      <xs:element name="Unit" type="c:UnitType" minOccurs="0"/>
+    </xs:sequence>
+  </xs:complexType>
+</xs:schema>`
+
+const commonSchema = `<?xml version="1.0"?>
+<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema" xmlns:c="urn:common"
+  targetNamespace="urn:common" elementFormDefault="qualified">
+  <xs:complexType name="IDType">
+    <xs:simpleContent>
+      <xs:extension base="xs:token">
+        <xs:attribute name="schemeID" type="xs:string" use="required"/>
+      </xs:extension>
+    </xs:simpleContent>
+  </xs:complexType>
+  <xs:complexType name="AmountType">
+    <xs:simpleContent>
+      <xs:extension base="xs:decimal">
+        <xs:attribute name="currencyID" type="c:CurrencyType"/>
+      </xs:extension>
+    </xs:simpleContent>
+  </xs:complexType>
+  <xs:simpleType name="CurrencyType">
+    <xs:restriction base="xs:token">
+      <xs:pattern value="[A-Z]{3}"/>
+    </xs:restriction>
+  </xs:simpleType>
+  <xs:simpleType name="UnitType">
+    <xs:restriction base="xs:token">
+      <xs:enumeration value="C62"/>
+      <xs:enumeration value="HUR"/>
+    </xs:restriction>
+  </xs:simpleType>
+</xs:schema>`
+
+func loadTestSchema(t *testing.T) *Schema {
+	t.Helper()
+	schema, err := Load(fstest.MapFS{
+		"order.xsd":         {Data: []byte(testSchema)},
+		"common/common.xsd": {Data: []byte(commonSchema)},
+	}, "order.xsd")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	return schema
+}
+
+func order(body string) string {
+	return `<?xml version="1.0"?><o:Order xmlns:o="urn:test">` + body + `</o:Order>`
+}
+
+func TestValidate(t *testing.T) {
+	schema := loadTestSchema(t)
+	tests := []struct {
+		name string
+		doc  string
+		want string // empty when the document is valid
+	}{
+		{
+			name: "valid",
+			doc:  order(`<o:ID schemeID="x"> A-1 </o:ID><o:Note>n</o:Note><o:Pickup/><o:Line><o:Quantity>2</o:Quantity><o:Price currencyID="EUR">9.50</o:Price><o:Unit>HUR</o:Unit></o:Line>`),
+		},
+		{
+			name: "other choice and repeated lines",
+			doc:  order(`<o:ID schemeID="x">1</o:ID><o:Address>Main St</o:Address><o:Line><o:Quantity>1</o:Quantity><o:Price>1</o:Price></o:Line><o:Line><o:Quantity>3</o:Quantity><o:Price>.5</o:Price></o:Line>`),
+		},
+		{
+			name: "default namespace",
+			doc:  `<Order xmlns="urn:test"><ID schemeID="x">1</ID><Pickup/><Line><Quantity>1</Quantity><Price>1</Price></Line></Order>`,
+		},
+		{
+			name: "unknown root",
+			doc:  `<o:Invoice xmlns:o="urn:test"/>`,
+			want: "not declared",
+		},
+		{
+			name: "wrong namespace",
+			doc:  `<Order xmlns="urn:other"/>`,
+			want: "not declared",
+		},
+		{
+			name: "missing required element",
+			doc:  order(`<o:ID schemeID="x">1</o:ID><o:Pickup/>`),
+			want: "expected Line",
+		},
+		{
+			name: "out of order",
+			doc:  order(`<o:Pickup/><o:ID schemeID="x">1</o:ID><o:Line><o:Quantity>1</o:Quantity><o:Price>1</o:Price></o:Line>`),
+			want: "element Pickup is not expected, expected ID",
+		},
+		{
+			name: "too many occurrences",
+			doc:  order(`<o:ID schemeID="x">1</o:ID><o:Note/><o:Note/><o:Note/><o:Pickup/><o:Line><o:Quantity>1</o:Quantity><o:Price>1</o:Price></o:Line>`),
+			want: "element Note is not expected",
+		},
+		{
+			name: "both choices",
+			doc:  order(`<o:ID schemeID="x">1</o:ID><o:Pickup/><o:Address>a</o:Address><o:Line><o:Quantity>1</o:Quantity><o:Price>1</o:Price></o:Line>`),
+			want: "element Address is not expected",
+		},
+		{
+			name: "missing required attribute",
+			doc:  order(`<o:ID>1</o:ID><o:Pickup/><o:Line><o:Quantity>1</o:Quantity><o:Price>1</o:Price></o:Line>`),
+			want: "attribute schemeID is required",
+		},
+		{
+			name: "undeclared attribute",
+			doc:  order(`<o:ID schemeID="x" lang="en">1</o:ID><o:Pickup/><o:Line><o:Quantity>1</o:Quantity><o:Price>1</o:Price></o:Line>`),
+			want: "attribute lang is not allowed",
+		},
+		{
+			name: "attribute breaks pattern",
+			doc:  order(`<o:ID schemeID="x">1</o:ID><o:Pickup/><o:Line><o:Quantity>1</o:Quantity><o:Price currencyID="euro">1</o:Price></o:Line>`),
+			want: "Price/@currencyID",
+		},
+		{
+			name: "not an integer",
+			doc:  order(`<o:ID schemeID="x">1</o:ID><o:Pickup/><o:Line><o:Quantity>1.5</o:Quantity><o:Price>1</o:Price></o:Line>`),
+			want: "not a valid integer",
+		},
+		{
+			name: "not a decimal in the second line",
+			doc:  order(`<o:ID schemeID="x">1</o:ID><o:Pickup/><o:Line><o:Quantity>1</o:Quantity><o:Price>1</o:Price></o:Line><o:Line><o:Quantity>1</o:Quantity><o:Price>1,00</o:Price></o:Line>`),
+			want: "/Order/Line[2]/Price",
+		},
+		{
+			name: "value outside enumeration",
+			doc:  order(`<o:ID schemeID="x">1</o:ID><o:Pickup/><o:Line><o:Quantity>1</o:Quantity><o:Price>1</o:Price><o:Unit>KGM</o:Unit></o:Line>`),
+			want: `value "KGM" is not allowed`,
+		},
+		{
+			name: "content in an empty element",
+			doc:  order(`<o:ID schemeID="x">1</o:ID><o:Pickup>now</o:Pickup><o:Line><o:Quantity>1</o:Quantity><o:Price>1</o:Price></o:Line>`),
+			want: "text is not allowed",
+		},
+		{
+			name: "element in a simple value",
+			doc:  order(`<o:ID schemeID="x"><o:Note/></o:ID><o:Pickup/><o:Line><o:Quantity>1</o:Quantity><o:Price>1</o:Price></o:Line>`),
+			want: "not allowed in a simple value",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := schema.Validate([]byte(tt.doc))
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("Validate() error = %v", err)
+				}
+				return
+			}
+
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("Validate() error = %v, want a *ValidationError", err)
+			}
+
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Validate() error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateMalformedXML(t *testing.T) {
+	err := loadTestSchema(t).Validate([]byte(`<o:Order xmlns:o="urn:test">`))
+	var validationErr *ValidationError
+	if err == nil || errors.As(err, &validationErr) {
+		t.Fatalf("Validate() error = %v, want a parse error", err)
+	}
+}
+
+func TestLoadRejectsUnsupportedSchemas(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		want   string
+	}{
+		{
+			name:   "complex content",
+			schema: `<xs:complexType name="T"><xs:complexContent/></xs:complexType>`,
+			want:   "xs:complexContent",
+		},
+		{
+			name:   "wildcard",
+			schema: `<xs:complexType name="T"><xs:sequence><xs:any/></xs:sequence></xs:complexType>`,
+			want:   "xs:any",
+		},
+		{
+			name:   "unsupported facet",
+			schema: `<xs:simpleType name="T"><xs:restriction base="xs:decimal"><xs:totalDigits value="5"/></xs:restriction></xs:simpleType>`,
+			want:   "xs:totalDigits",
+		},
+		{
+			name:   "unsupported built-in type",
+			schema: `<xs:element name="E" type="xs:dateTime"/>`,
+			want:   "dateTime",
+		},
+		{
+			name:   "unknown type",
+			schema: `<xs:element name="E" type="t:Missing"/>`,
+			want:   "unknown type {urn:test}Missing",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := `<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema" xmlns:t="urn:test" targetNamespace="urn:test">` +
+				tt.schema + `</xs:schema>`
+			_, err := Load(fstest.MapFS{"s.xsd": {Data: []byte(doc)}}, "s.xsd")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Load() error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadMissingImport(t *testing.T) {
+	_, err := Load(fstest.MapFS{"order.xsd": {Data: []byte(testSchema)}}, "order.xsd")
+	if err == nil {
+		t.Fatal("Load() succeeded without the imported schema")
+	}
+}